@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// the roles of the clients of the HTTP and gRPC APIs, an operator may do what a viewer may
+const (
+	accessViewer   = "viewer"
+	accessOperator = "operator"
+)
+
+// AccessConfig restricts the HTTP and gRPC APIs to known clients, without keys and clients they are open to anyone
+// who reaches them
+type AccessConfig struct {
+	// Keys are the API keys of the clients, sent as "Authorization: Bearer <key>", as the password of basic
+	// authentication for browsers, or in the x-api-key header or gRPC metadata
+	Keys []APIKey `json:"keys" yaml:"keys"`
+	// Clients are the client certificates of the clients by their common name, verified against ClientCAs
+	Clients []ClientRole `json:"clients" yaml:"clients"`
+	// Certificate and PrivateKey serve the APIs over TLS
+	Certificate string `json:"certificate" yaml:"certificate"`
+	PrivateKey  string `json:"privateKey" yaml:"privateKey"`
+	// ClientCAs are the CA certificates the client certificates are issued by
+	ClientCAs []string `json:"clientCAs" yaml:"clientCAs"`
+}
+
+// APIKey is the key of a client, e.g. of the SCADA controller
+type APIKey struct {
+	// Name identifies the client in the log
+	Name string `json:"name" yaml:"name"`
+	Key  string `json:"key" yaml:"key"`
+	// Role is viewer or operator
+	Role string `json:"role" yaml:"role"`
+}
+
+// ClientRole gives the clients whose certificate has the common name their role
+type ClientRole struct {
+	CommonName string `json:"commonName" yaml:"commonName"`
+	Role       string `json:"role" yaml:"role"`
+}
+
+func validateAccessRole(role string) error {
+	switch role {
+	case accessViewer, accessOperator:
+		return nil
+	}
+	return fmt.Errorf("unknown role %q, use %s or %s", role, accessViewer, accessOperator)
+}
+
+func (c AccessConfig) validate() error {
+	for _, k := range c.Keys {
+		if len(k.Key) < 16 {
+			return fmt.Errorf("the key of %s is too short, use at least 16 characters", k.Name)
+		}
+		if err := validateAccessRole(k.Role); err != nil {
+			return fmt.Errorf("key of %s: %w", k.Name, err)
+		}
+	}
+	for _, client := range c.Clients {
+		if client.CommonName == "" {
+			return errors.New("a client has no commonName")
+		}
+		if err := validateAccessRole(client.Role); err != nil {
+			return fmt.Errorf("client %s: %w", client.CommonName, err)
+		}
+	}
+	if (c.Certificate == "") != (c.PrivateKey == "") {
+		return errors.New("TLS needs both the certificate and the privateKey")
+	}
+	if len(c.Clients) > 0 && (len(c.ClientCAs) == 0 || c.Certificate == "") {
+		return errors.New("client certificates need TLS and the clientCAs they are issued by")
+	}
+	return nil
+}
+
+// accessControl checks the clients of the APIs against their roles, nil lets every client do everything
+type accessControl struct {
+	keys    []APIKey
+	clients map[string]string
+	tls     *tls.Config
+}
+
+// newAccessControl loads the TLS settings of the APIs, nil without keys, clients and TLS
+func newAccessControl(c AccessConfig) (*accessControl, error) {
+	a := &accessControl{keys: c.Keys, clients: map[string]string{}}
+	for _, client := range c.Clients {
+		a.clients[client.CommonName] = client.Role
+	}
+	if c.Certificate != "" {
+		certificate, err := tls.LoadX509KeyPair(filepath.Clean(c.Certificate), filepath.Clean(c.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the certificate of the API: %w", err)
+		}
+		a.tls = &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+		if len(c.ClientCAs) > 0 {
+			pool := x509.NewCertPool()
+			for _, path := range c.ClientCAs {
+				pem, err := os.ReadFile(filepath.Clean(path))
+				if err != nil {
+					return nil, fmt.Errorf("failed to read the client CA: %w", err)
+				}
+				if !pool.AppendCertsFromPEM(pem) {
+					return nil, fmt.Errorf("invalid client CA %s: no certificate found", path)
+				}
+			}
+			// clients with an API key need no certificate
+			a.tls.ClientCAs, a.tls.ClientAuth = pool, tls.VerifyClientCertIfGiven
+		}
+	}
+	if a.open() {
+		logger.Warn("The API is open to anyone who reaches it, configure access keys or clients before exposing it")
+		if a.tls == nil {
+			return nil, nil
+		}
+	} else if a.tls == nil {
+		logger.Warn("The API keys are sent in the clear, configure a certificate for the API to serve it over TLS")
+	}
+	return a, nil
+}
+
+// open tells whether every client may do everything
+func (a *accessControl) open() bool {
+	return a == nil || (len(a.keys) == 0 && len(a.clients) == 0)
+}
+
+func (a *accessControl) tlsConfig() *tls.Config {
+	if a == nil {
+		return nil
+	}
+	return a.tls
+}
+
+// identify returns the client with the key or the verified certificate and its role, false for an unknown client
+func (a *accessControl) identify(key string, certificates []*x509.Certificate) (client string, role string, ok bool) {
+	if key != "" {
+		for _, k := range a.keys {
+			if subtle.ConstantTimeCompare([]byte(k.Key), []byte(key)) == 1 {
+				return k.Name, k.Role, true
+			}
+		}
+	}
+	if len(certificates) > 0 {
+		name := certificates[0].Subject.CommonName
+		if role, ok := a.clients[name]; ok {
+			return name, role, true
+		}
+	}
+	return "", "", false
+}
+
+// allowed tells whether the role may do what needs the required one
+func allowed(role, required string) bool {
+	return role == accessOperator || role == required
+}
+
+// require guards a handler with the role it needs
+func (a *accessControl) require(required string, handler http.HandlerFunc) http.HandlerFunc {
+	if a.open() {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		var certificates []*x509.Certificate
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			certificates = r.TLS.PeerCertificates
+		}
+		client, role, ok := a.identify(requestKey(r), certificates)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="agent"`)
+			http.Error(w, "unknown client", http.StatusUnauthorized)
+			return
+		}
+		if !allowed(role, required) {
+			logger.Warnf("Refused %s %s to %s, a %s", r.Method, r.URL.Path, client, role)
+			http.Error(w, fmt.Sprintf("a %s may not do this", role), http.StatusForbidden)
+			return
+		}
+		if r.Method == http.MethodPost {
+			logger.Infof("%s %s by %s", r.Method, r.URL.Path, client)
+		}
+		handler(w, r)
+	}
+}
+
+// requestKey returns the API key of a request: a bearer token, the password of basic authentication or x-api-key
+func requestKey(r *http.Request) string {
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != r.Header.Get("Authorization") {
+		return token
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return r.Header.Get("X-Api-Key")
+}
+
+// the roles the methods of the gRPC control plane need
+var controlPlaneRoles = map[string]string{
+	"/controlplane.ControlPlane/StartOptimization": accessOperator,
+	"/controlplane.ControlPlane/StopOptimization":  accessOperator,
+	"/controlplane.ControlPlane/StreamIterations":  accessViewer,
+}
+
+// serverOptions return the TLS and the interceptors that check the roles of the gRPC clients
+func (a *accessControl) serverOptions() []grpc.ServerOption {
+	var options []grpc.ServerOption
+	if config := a.tlsConfig(); config != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(config)))
+	}
+	if a.open() {
+		return options
+	}
+	return append(options,
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := a.authorize(ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := a.authorize(stream.Context(), info.FullMethod); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+}
+
+// authorize checks the client of a gRPC call against the role of the method
+func (a *accessControl) authorize(ctx context.Context, method string) error {
+	var key string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			key = strings.TrimPrefix(values[0], "Bearer ")
+		} else if values := md.Get("x-api-key"); len(values) > 0 {
+			key = values[0]
+		}
+	}
+	var certificates []*x509.Certificate
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			certificates = info.State.PeerCertificates
+		}
+	}
+	client, role, ok := a.identify(key, certificates)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "unknown client")
+	}
+	required, known := controlPlaneRoles[method]
+	if !known {
+		required = accessOperator
+	}
+	if !allowed(role, required) {
+		logger.Warnf("Refused %s to %s, a %s", method, client, role)
+		return status.Errorf(codes.PermissionDenied, "a %s may not do this", role)
+	}
+	if required == accessOperator {
+		logger.Infof("%s by %s", method, client)
+	}
+	return nil
+}
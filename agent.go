@@ -0,0 +1,202 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// AgentConfig is one organization of the multi-agent mode, which runs the agents of several organizations in one process
+// for experiments in the lab
+type AgentConfig struct {
+	// Name identifies the agent in the logs (default: Organization)
+	Name string `json:"name" yaml:"name"`
+	// Organization selects the identity, the event filter and the neighbors of the agent from the organizations, like -org
+	Organization string `json:"organization" yaml:"organization"`
+	// Role replaces the role of the config file for this agent
+	Role string `json:"role" yaml:"role"`
+	// Generator, Load and Storage replace the models of the config file for this agent, each is a complete model like the section of the file
+	Generator *GeneratorModel `json:"generator" yaml:"generator"`
+	Load      *LoadModel      `json:"load" yaml:"load"`
+	Storage   *StorageModel   `json:"storage" yaml:"storage"`
+	// EventFilter replaces the event filter of the organization
+	EventFilter string `json:"eventFilter" yaml:"eventFilter"`
+}
+
+// validateAgents checks that the agents can be told apart and that each has an identity of its own
+func validateAgents(agents []AgentConfig) error {
+	names := map[string]bool{}
+	organizations := map[string]bool{}
+	for _, a := range agents {
+		if a.Organization == "" {
+			return fmt.Errorf("an agent has no organization")
+		}
+		if organizations[a.Organization] {
+			return fmt.Errorf("organization %s has two agents, each agent needs an identity of its own", a.Organization)
+		}
+		organizations[a.Organization] = true
+		if names[a.name()] {
+			return fmt.Errorf("agent %s is listed twice", a.name())
+		}
+		names[a.name()] = true
+		if err := validateRole(a.Role); err != nil {
+			return fmt.Errorf("invalid role of agent %s: %w", a.name(), err)
+		}
+		if a.Generator != nil {
+			if err := a.Generator.validate(); err != nil {
+				return fmt.Errorf("invalid generator of agent %s: %w", a.name(), err)
+			}
+		}
+		if a.Load != nil {
+			if err := a.Load.validate(); err != nil {
+				return fmt.Errorf("invalid load of agent %s: %w", a.name(), err)
+			}
+		}
+		if a.Storage != nil {
+			if err := a.Storage.validate(); err != nil {
+				return fmt.Errorf("invalid storage of agent %s: %w", a.name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (a AgentConfig) name() string {
+	if a.Name == "" {
+		return a.Organization
+	}
+	return a.Name
+}
+
+// config returns the configuration of the agent, the file's settings with the identity of its organization
+func (a AgentConfig) config(base Config) (Config, error) {
+	c := base
+	if err := c.selectOrganization(a.Organization); err != nil {
+		return c, err
+	}
+	if a.Role != "" {
+		c.Role = a.Role
+	}
+	if a.Generator != nil {
+		c.Generator = *a.Generator
+	}
+	if a.Load != nil {
+		c.Load = *a.Load
+	}
+	if a.Storage != nil {
+		c.Storage = *a.Storage
+	}
+	if a.EventFilter != "" {
+		c.EventFilter, c.Events = a.EventFilter, nil
+	}
+	c.discoverCrypto()
+	return c, nil
+}
+
+// Agent takes part in the optimization as one organization, with its own identity, generator model and event filter
+type Agent struct {
+	// name tells the agents of the multi-agent mode apart, the only agent of a process has none
+	name string
+	cfg  Config
+	// own remembers the transactions of the agent's updates, so their events are not taken for a neighbor's
+	own *ownTransactions
+	// result is the outcome of the run once it has converged, the experiments collect it
+	result *ResultSummary
+	// period is the period of a -forecast run, -1 for a single period, and demand the forecast demand the node serves
+	// in it besides its power
+	period int
+	demand float64
+	// regulation is the regulation signal the periods of a -forecast run share, without it the run starts its own
+	regulation *regulationSignal
+	// shared is the connection of the process the agent of a market uses, and markets keeps the markets in lockstep
+	shared  *gatewayConnection
+	markets *marketCoordinator
+	// state is the state of the run, the loop publishes it and the APIs read it while the loop runs
+	state *State
+}
+
+func newAgent(name string, c Config) *Agent {
+	return &Agent{name: name, cfg: c, own: newOwnTransactions(), period: -1, state: states.agent(name)}
+}
+
+// alone tells whether the agent has the process to itself, only then does it use the prompts, the APIs,
+// the devices and the files that keep a run's state
+func (a *Agent) alone() bool {
+	return a.name == ""
+}
+
+func (a *Agent) logger() *zap.SugaredLogger {
+	if a.alone() {
+		return logger
+	}
+	return logger.With("agent", a.name)
+}
+
+// the flags the agents of one process can't share, they serve a port, read stdin or keep the state of a single run
+var agentExclusiveFlags = []string{"serve", "grpc-addr", "resume", "plugins", "regulation-udp", "export", "trace-iterations", "conformance", "channel", "role", "forecast"}
+
+// runAgents runs the agent of every organization in a goroutine of its own until all have ended, false if any of them failed
+// the agents read the config file without the environment variables, which would give all of them the same identity
+func runAgents(agents []AgentConfig) bool {
+	if err := checkAgentFlags(); err != nil {
+		logger.Errorf("%v", err)
+		return false
+	}
+	base, err := readConfig(*configFile)
+	if err != nil {
+		logger.Errorf("Failed to load the configuration: %v", err)
+		return false
+	}
+	_, ok := startAgents(base, agents)
+	return ok
+}
+
+// startAgents runs the agents with the base config until all have ended, it returns those that were started and false if
+// any of them failed
+func startAgents(base Config, agents []AgentConfig) ([]*Agent, bool) {
+	// the agents share the working directory, a checkpoint would be overwritten by each of them
+	*checkpointFile, *eventCheckpointFile, *shutdownStateFile, *storageStateFile = "", "", "", ""
+	var wg sync.WaitGroup
+	var started []*Agent
+	failed := make(chan string, len(agents))
+	for _, agent := range agents {
+		c, err := agent.config(base)
+		if err != nil {
+			logger.Errorf("Failed to configure agent %s: %v", agent.name(), err)
+			failed <- agent.name()
+			continue
+		}
+		a := newAgent(agent.name(), c)
+		started = append(started, a)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.run(); err != nil {
+				logger.Errorf("Agent %s failed: %v", a.name, err)
+				failed <- a.name
+			}
+		}()
+	}
+	wg.Wait()
+	close(failed)
+	return started, len(failed) == 0
+}
+
+// checkAgentFlags fails if a flag is set that the agents of one process can't share
+func checkAgentFlags() error {
+	var exclusive []string
+	flag.Visit(func(f *flag.Flag) {
+		for _, name := range agentExclusiveFlags {
+			if f.Name == name {
+				exclusive = append(exclusive, "-"+name)
+			}
+		}
+	})
+	if len(exclusive) > 0 {
+		return fmt.Errorf("%s can't be used with the agents of the config file", strings.Join(exclusive, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// Package agentplugin lets event handlers and device drivers run as separate processes next to the energy management agent.
+//
+// A plugin is a program that calls Serve with its implementation. The agent starts it, talks to it over gRPC
+// through hashicorp/go-plugin and stops it again when the agent exits, so proprietary algorithms or hardware
+// support can be added without changing the agent.
+package agentplugin
+
+import (
+	"time"
+
+	plugin "github.com/hashicorp/go-plugin"
+)
+
+// the kinds of plugins the agent can load
+const (
+	KindEventHandler = "handler"
+	KindDeviceDriver = "driver"
+)
+
+// Handshake makes sure that the agent and a plugin belong together, a plugin that is run directly exits with a hint
+var Handshake = plugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "ENERGY_AGENT_PLUGIN",
+	MagicCookieValue: "6e1d5a0c-consensus",
+}
+
+// Event is a chaincode event as handed to an event handler plugin
+type Event struct {
+	Name        string `json:"name"`
+	TxID        string `json:"txId"`
+	BlockNumber uint64 `json:"blockNumber"`
+	Payload     []byte `json:"payload"`
+}
+
+// EventHandler is implemented by plugins that react to chaincode events
+type EventHandler interface {
+	HandleEvent(event Event) error
+}
+
+// DeviceDriver is implemented by plugins that connect the agent to hardware
+type DeviceDriver interface {
+	// Measurements returns the latest readings of the device, e.g. "p", "frequency" or "islanded"
+	Measurements() (map[string]float64, error)
+	// WriteSetpoint drives the device to the power setpoint in MW
+	WriteSetpoint(P float64) error
+}
+
+// PluginMap is the set of plugins the agent knows how to talk to
+var PluginMap = map[string]plugin.Plugin{
+	KindEventHandler: &EventHandlerPlugin{},
+	KindDeviceDriver: &DeviceDriverPlugin{},
+}
+
+// ClientPlugins is PluginMap for an agent whose calls to the plugins give up after the timeout, the error of such a
+// call wraps ErrTimeout
+func ClientPlugins(timeout time.Duration) map[string]plugin.Plugin {
+	return map[string]plugin.Plugin{
+		KindEventHandler: &EventHandlerPlugin{Timeout: timeout},
+		KindDeviceDriver: &DeviceDriverPlugin{Timeout: timeout},
+	}
+}
+
+// ServeEventHandler runs an event handler plugin, it is called from the plugin's main function and does not return
+func ServeEventHandler(handler EventHandler) {
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         map[string]plugin.Plugin{KindEventHandler: &EventHandlerPlugin{Impl: handler}},
+		GRPCServer:      plugin.DefaultGRPCServer,
+	})
+}
+
+// ServeDeviceDriver runs a device driver plugin, it is called from the plugin's main function and does not return
+func ServeDeviceDriver(driver DeviceDriver) {
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         map[string]plugin.Plugin{KindDeviceDriver: &DeviceDriverPlugin{Impl: driver}},
+		GRPCServer:      plugin.DefaultGRPCServer,
+	})
+}
@@ -0,0 +1,176 @@
+package agentplugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	plugin "github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// the services are described by hand instead of generated from a .proto file, every method takes and
+// returns its arguments as JSON in a BytesValue, which keeps plugins free of any code generation
+
+// ErrTimeout is wrapped by the error of a call the plugin didn't answer within the timeout of the client
+var ErrTimeout = errors.New("plugin did not answer in time")
+
+// call invokes a method of a plugin service with JSON-encoded arguments and decodes the result into out, it gives up
+// after the timeout unless it is 0
+func call(timeout time.Duration, conn *grpc.ClientConn, method string, in interface{}, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	reply := &wrappers.BytesValue{}
+	if err := conn.Invoke(ctx, method, &wrappers.BytesValue{Value: data}, reply); err != nil {
+		if status.Code(err) == codes.DeadlineExceeded {
+			return fmt.Errorf("%s: %w after %v", method, ErrTimeout, timeout)
+		}
+		return err
+	}
+	if out == nil || len(reply.Value) == 0 {
+		return nil
+	}
+	return json.Unmarshal(reply.Value, out)
+}
+
+// unaryHandler adapts a JSON function to a gRPC method handler
+func unaryHandler(fullMethod string, fn func(srv interface{}, in []byte) (interface{}, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := &wrappers.BytesValue{}
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		handle := func(ctx context.Context, req interface{}) (interface{}, error) {
+			result, err := fn(srv, req.(*wrappers.BytesValue).Value)
+			if err != nil {
+				return nil, err
+			}
+			data, err := json.Marshal(result)
+			if err != nil {
+				return nil, err
+			}
+			return &wrappers.BytesValue{Value: data}, nil
+		}
+		if interceptor == nil {
+			return handle(ctx, in)
+		}
+		return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}, handle)
+	}
+}
+
+// EventHandlerPlugin connects an EventHandler across the process boundary
+type EventHandlerPlugin struct {
+	plugin.NetRPCUnsupportedPlugin
+	Impl EventHandler
+	// Timeout bounds every call of the agent to the plugin, 0 waits as long as the plugin takes
+	Timeout time.Duration
+}
+
+var eventHandlerService = grpc.ServiceDesc{
+	ServiceName: "agentplugin.EventHandler",
+	HandlerType: (*EventHandler)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "HandleEvent",
+			Handler: unaryHandler("/agentplugin.EventHandler/HandleEvent", func(srv interface{}, in []byte) (interface{}, error) {
+				var event Event
+				if err := json.Unmarshal(in, &event); err != nil {
+					return nil, err
+				}
+				return nil, srv.(EventHandler).HandleEvent(event)
+			}),
+		},
+	},
+	Metadata: "agentplugin",
+}
+
+// GRPCServer registers the plugin's implementation, it runs in the plugin process
+func (p *EventHandlerPlugin) GRPCServer(broker *plugin.GRPCBroker, s *grpc.Server) error {
+	s.RegisterService(&eventHandlerService, p.Impl)
+	return nil
+}
+
+// GRPCClient returns the EventHandler the agent calls, it runs in the agent process
+func (p *EventHandlerPlugin) GRPCClient(ctx context.Context, broker *plugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
+	return &eventHandlerClient{conn: c, timeout: p.Timeout}, nil
+}
+
+type eventHandlerClient struct {
+	conn    *grpc.ClientConn
+	timeout time.Duration
+}
+
+func (c *eventHandlerClient) HandleEvent(event Event) error {
+	return call(c.timeout, c.conn, "/agentplugin.EventHandler/HandleEvent", event, nil)
+}
+
+// DeviceDriverPlugin connects a DeviceDriver across the process boundary
+type DeviceDriverPlugin struct {
+	plugin.NetRPCUnsupportedPlugin
+	Impl DeviceDriver
+	// Timeout bounds every call of the agent to the plugin, 0 waits as long as the plugin takes
+	Timeout time.Duration
+}
+
+var deviceDriverService = grpc.ServiceDesc{
+	ServiceName: "agentplugin.DeviceDriver",
+	HandlerType: (*DeviceDriver)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Measurements",
+			Handler: unaryHandler("/agentplugin.DeviceDriver/Measurements", func(srv interface{}, in []byte) (interface{}, error) {
+				return srv.(DeviceDriver).Measurements()
+			}),
+		},
+		{
+			MethodName: "WriteSetpoint",
+			Handler: unaryHandler("/agentplugin.DeviceDriver/WriteSetpoint", func(srv interface{}, in []byte) (interface{}, error) {
+				var P float64
+				if err := json.Unmarshal(in, &P); err != nil {
+					return nil, err
+				}
+				return nil, srv.(DeviceDriver).WriteSetpoint(P)
+			}),
+		},
+	},
+	Metadata: "agentplugin",
+}
+
+// GRPCServer registers the plugin's implementation, it runs in the plugin process
+func (p *DeviceDriverPlugin) GRPCServer(broker *plugin.GRPCBroker, s *grpc.Server) error {
+	s.RegisterService(&deviceDriverService, p.Impl)
+	return nil
+}
+
+// GRPCClient returns the DeviceDriver the agent calls, it runs in the agent process
+func (p *DeviceDriverPlugin) GRPCClient(ctx context.Context, broker *plugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
+	return &deviceDriverClient{conn: c, timeout: p.Timeout}, nil
+}
+
+type deviceDriverClient struct {
+	conn    *grpc.ClientConn
+	timeout time.Duration
+}
+
+func (c *deviceDriverClient) Measurements() (map[string]float64, error) {
+	var measurements map[string]float64
+	err := call(c.timeout, c.conn, "/agentplugin.DeviceDriver/Measurements", nil, &measurements)
+	return measurements, err
+}
+
+func (c *deviceDriverClient) WriteSetpoint(P float64) error {
+	return call(c.timeout, c.conn, "/agentplugin.DeviceDriver/WriteSetpoint", P, nil)
+}
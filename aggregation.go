@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+)
+
+var aggregationMode = flag.String("aggregation", "", "how the neighbors' values are combined, replaces algorithm.aggregation.mode: average, trimmed-mean or median")
+
+// the aggregations selectable with algorithm.aggregation.mode
+const (
+	aggregationAverage     = "average"
+	aggregationTrimmedMean = "trimmed-mean"
+	aggregationMedian      = "median"
+)
+
+// AggregationConfig selects how an iteration combines the values of the neighbors. The weighted average of the
+// algorithm follows every neighbor, a single organization sending false values moves the whole network. The trimmed
+// mean and the median ignore the outliers among the neighbors' values, so the consensus tolerates a bounded number of
+// misbehaving organizations, at the price of the exact balance of the mismatch the average keeps: they are meant for
+// research on adversarial settings
+type AggregationConfig struct {
+	// Mode is average (default), trimmed-mean or median
+	Mode string `json:"mode" yaml:"mode"`
+	// Trim is the number of the largest and of the smallest values the trimmed mean leaves out, the number of
+	// misbehaving neighbors it tolerates (default 1)
+	Trim int `json:"trim" yaml:"trim"`
+}
+
+func (c AggregationConfig) validate() error {
+	switch c.Mode {
+	case "", aggregationAverage, aggregationTrimmedMean, aggregationMedian:
+	default:
+		return fmt.Errorf("unknown aggregation %q, use %s, %s or %s", c.Mode, aggregationAverage, aggregationTrimmedMean, aggregationMedian)
+	}
+	if c.Trim < 0 {
+		return fmt.Errorf("the trim must not be negative, got %v", c.Trim)
+	}
+	return nil
+}
+
+// mode returns the aggregation of the run, -aggregation before the config
+func (c AggregationConfig) mode() string {
+	if *aggregationMode != "" {
+		return *aggregationMode
+	}
+	if c.Mode == "" {
+		return aggregationAverage
+	}
+	return c.Mode
+}
+
+// aggregate combines the neighbors' updates into the one the step uses. A robust aggregation replaces them by a single
+// update with their total weight, so the node keeps its own weight, and the trimmed mean or the median of their
+// prices and of their mismatches; the average leaves them as they are
+func (c AggregationConfig) aggregate(neighbors []neighborUpdate) []neighborUpdate {
+	mode := c.mode()
+	if mode == aggregationAverage || len(neighbors) < 2 {
+		return neighbors
+	}
+	trim := c.Trim
+	if trim == 0 {
+		trim = 1
+	}
+	var weight float64
+	lambdas := make([]float64, len(neighbors))
+	mismatches := make([]float64, len(neighbors))
+	for i, n := range neighbors {
+		weight += n.weight
+		lambdas[i], mismatches[i] = n.lambda, n.mismatch
+	}
+	combine := median
+	// too few neighbors to leave out as many on both ends, the median is what remains of the trimmed mean
+	if mode == aggregationTrimmedMean && len(neighbors) > 2*trim {
+		combine = func(values []float64) float64 {
+			return trimmedMean(values, trim)
+		}
+	}
+	return []neighborUpdate{{weight: weight, lambda: combine(lambdas), mismatch: combine(mismatches)}}
+}
+
+// trimmedMean is the mean of the values without the trim largest and the trim smallest
+func trimmedMean(values []float64, trim int) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return mean(sorted[trim : len(sorted)-trim])
+}
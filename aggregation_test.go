@@ -0,0 +1,22 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestRobustAggregation(t *testing.T) {
+	neighbors := []neighborUpdate{{0.2, 6, 0.1}, {0.2, 6.2, 0.3}, {0.2, 100, -50}, {0.2, 5.8, 0.2}}
+	if got := (AggregationConfig{}).aggregate(neighbors); !reflect.DeepEqual(got, neighbors) {
+		t.Errorf("the average changed the neighbors to %v", got)
+	}
+	got := AggregationConfig{Mode: aggregationTrimmedMean}.aggregate(neighbors)
+	if len(got) != 1 || math.Abs(got[0].weight-0.8) > 1e-12 || math.Abs(got[0].lambda-6.1) > 1e-12 || math.Abs(got[0].mismatch-0.15) > 1e-12 {
+		t.Errorf("trimmed mean = %+v", got)
+	}
+	got = AggregationConfig{Mode: aggregationMedian}.aggregate(neighbors[:3])
+	if len(got) != 1 || got[0].lambda != 6.2 || got[0].mismatch != 0.1 {
+		t.Errorf("median = %+v", got)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+)
+
+var (
+	anomalyWindow    = flag.Int("anomaly-window", 10, "number of recent neighbor values the bad-data detector compares each new value with")
+	anomalyThreshold = flag.Float64("anomaly-threshold", 6, "robust z-score above which a neighbor value is flagged as suspected false data")
+	anomalyLimit     = flag.Int("anomaly-limit", 3, "number of flagged values within the window that switches to robust aggregation")
+	autoRobust       = flag.Bool("auto-robust", true, "switch to robust aggregation automatically when false-data injection is suspected")
+	robustMode       = flag.Bool("robust", false, "use robust aggregation from the start: neighbor values are replaced by the median of the recent window")
+)
+
+// anomalyDetector flags neighbor values that deviate from the recent history far more than the history itself varies
+type anomalyDetector struct {
+	lambdas  []float64
+	mismatch []float64
+	flags    []bool
+	robust   bool
+}
+
+func newAnomalyDetector() *anomalyDetector {
+	return &anomalyDetector{robust: *robustMode}
+}
+
+// observe checks a neighbor update, records it and returns the reasons it is suspicious, if any
+func (d *anomalyDetector) observe(l2 float64, m2 float64) []string {
+	var reasons []string
+	if r := suspicious("lambda", d.lambdas, l2); r != "" {
+		reasons = append(reasons, r)
+	}
+	if r := suspicious("mismatch", d.mismatch, m2); r != "" {
+		reasons = append(reasons, r)
+	}
+	d.lambdas = appendWindow(d.lambdas, l2)
+	d.mismatch = appendWindow(d.mismatch, m2)
+
+	d.flags = append(d.flags, len(reasons) > 0)
+	if len(d.flags) > *anomalyWindow {
+		d.flags = d.flags[1:]
+	}
+	flagged := 0
+	for _, f := range d.flags {
+		if f {
+			flagged++
+		}
+	}
+	if !d.robust && *autoRobust && flagged >= *anomalyLimit {
+		d.robust = true
+		logger.Warnf("%v suspicious updates in the last %v, switching to robust aggregation", flagged, len(d.flags))
+	}
+	return reasons
+}
+
+// aggregate returns the neighbor values the update should use, the medians of the recent window in robust mode
+func (d *anomalyDetector) aggregate(l2 float64, m2 float64) (float64, float64) {
+	if !d.robust || len(d.lambdas) == 0 {
+		return l2, m2
+	}
+	return median(d.lambdas), median(d.mismatch)
+}
+
+// suspicious runs the residual test against the median of the history and the jump test against the previous value
+func suspicious(name string, history []float64, x float64) string {
+	// a few values are needed before the spread of the history means anything
+	if len(history) < 4 {
+		return ""
+	}
+	center := median(history)
+	scale := 1.4826*mad(history, center) + 1e-6
+	if z := math.Abs(x-center) / scale; z > *anomalyThreshold {
+		return fmt.Sprintf("%s %v deviates %.1f robust deviations from the recent median %v", name, x, z, center)
+	}
+
+	jumps := make([]float64, 0, len(history)-1)
+	for i := 1; i < len(history); i++ {
+		jumps = append(jumps, math.Abs(history[i]-history[i-1]))
+	}
+	jumpScale := median(jumps) + 1e-6
+	if jump := math.Abs(x - history[len(history)-1]); jump > *anomalyThreshold*jumpScale && jump > scale {
+		return fmt.Sprintf("%s jumped by %v, typical step is %v", name, jump, jumpScale)
+	}
+	return ""
+}
+
+func appendWindow(window []float64, x float64) []float64 {
+	window = append(window, x)
+	if len(window) > *anomalyWindow {
+		window = window[1:]
+	}
+	return window
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// mad is the median absolute deviation from center
+func mad(values []float64, center float64) float64 {
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - center)
+	}
+	return median(deviations)
+}
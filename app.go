@@ -3,161 +3,1018 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"math"
+	"io"
 	"os"
-	"path/filepath"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/dlclark/regexp2"
-	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
-	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
-)
-
-// these address should be changed accordingly when implemented in the hardware
-const (
-	// the mspID should be identical to the one used when calling cryptogen to generate credential files
-	// mspID = "Org1MSP"
-	// the path of the certificates
-	cryptoPath  = "../fabric-samples-2.3/test-network/organizations/peerOrganizations/org1.example.com"
-	certPath    = cryptoPath + "/users/User1@org1.example.com/msp/signcerts/cert.pem"
-	keyPath     = cryptoPath + "/users/User1@org1.example.com/msp/keystore/"
-	tlsCertPath = cryptoPath + "/peers/peer0.org1.example.com/tls/ca.crt"
-	// an IP address to access the peer node, it is a localhost address when the network is running in a single machine
-	peerEndpoint = "localhost:7051"
-	// name of the peer node
-	gatewayPeer = "peer0.org1.example.com"
-	// the channel name and the chaincode name should be identical to the ones used in blockchain network implementation, the following are the default values
-	// these information have been designed to be entered by the application user
-	networkName  = "mychannel"
-	contractName = "basic"
-	userName     = "appUser"
+	"github.com/hashicorp/go-plugin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
 )
 
 func main() {
-	err := os.Setenv("DISCOVERY_AS_LOCALHOST", "true")
-	if err != nil {
-		log.Fatalf("Error setting DISCOVERY_AS_LOCALHOST environment variable: %v", err)
-		os.Exit(1)
+	flag.Parse()
+	if err := setupLogging(); err != nil {
+		logger.Fatal(err)
+	}
+	if err := validateProgressFormat(); err != nil {
+		logger.Fatal(err)
+	}
+	defer closeLogging()
+	if err := loadLocales(*localeDir); err != nil {
+		logger.Warnf("Failed to load the locale files, using the built-in messages: %v", err)
 	}
 
-	log.Println("============ Creating wallet ============")
-	wallet, err := gateway.NewFileSystemWallet("wallet")
+	var err error
+	cfg, err = loadConfig(*configFile, *organization)
 	if err != nil {
-		log.Fatalf("Failed to create wallet: %v", err)
+		logger.Fatal(tr("Failed to load the configuration: %v", err))
 	}
-	log.Println("---> Wallet created!")
 
-	if !wallet.Exists(userName) {
-		err = populateWallet(wallet, userName)
-		if err != nil {
-			log.Fatalf("---> Failed to populate wallet contents: %v", err)
+	logger.Debugf("Agent %s", versionString())
+
+	var channel ChannelConfig
+	if *channelName != "" {
+		if channel, err = cfg.selectChannel(*channelName); err != nil {
+			logger.Fatal(tr("Failed to load the configuration: %v", err))
 		}
-		log.Printf("---> Successfully add user %s to wallet \n!", userName)
-	} else {
-		log.Printf("---> User %s already exists!", userName)
-	}
-
-	ccpPath := filepath.Join(
-		"..",
-		"fabric-samples-2.3",
-		"test-network",
-		"organizations",
-		"peerOrganizations",
-		"org1.example.com",
-		"connection-org1.yaml",
-	)
-
-	log.Println("============ connecting to gateway ============")
-	gw, err := gateway.Connect(
-		gateway.WithConfig(config.FromFile(filepath.Clean(ccpPath))),
-		gateway.WithIdentity(wallet, userName),
-	)
-	if err != nil {
-		log.Fatalf("---> Failed to connect to gateway: %v", err)
 	}
-	defer gw.Close()
-	log.Println("---> Successfully connected to gateway!")
 
-	log.Println("============ getting network ============")
-	network, err := gw.GetNetwork("mychannel")
+	if args := flag.Args(); len(args) > 0 {
+		if err := runCommand(args); err != nil {
+			logger.Errorf("%v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(cfg.Channels) > 0 {
+		if *channelName == "" {
+			// every channel runs its own optimization, in an agent process of its own
+			if !runChannels(cfg.Channels) {
+				exit(1)
+			}
+			return
+		}
+		if err := enterChannelDirectory(channel); err != nil {
+			logger.Fatalf("Failed to enter the directory of channel %s: %v", channel.Name, err)
+		}
+	}
+
+	if *dryRun {
+		if !runDoctor() {
+			exit(1)
+		}
+		return
+	}
+
+	startMetrics()
+	startTracing()
+	defer stopTracing()
+	if len(cfg.Agents) > 0 {
+		// the agents of several organizations run side by side in this process, for experiments in the lab
+		if !runAgents(cfg.Agents) {
+			exit(1)
+		}
+		return
+	}
+	if len(cfg.Markets.Contracts) > 0 {
+		// the markets of the node run side by side on the connection of this process
+		if !runMarkets(cfg.Markets) {
+			exit(1)
+		}
+		return
+	}
+	if *forecastFile != "" {
+		// the periods of the forecast are optimized one after the other
+		if err := runHorizon(cfg); err != nil {
+			logger.Errorf("%v", err)
+			exit(1)
+		}
+		return
+	}
+	if err := newAgent("", cfg).run(); err != nil {
+		logger.Errorf("%v", err)
+		exit(1)
+	}
+}
+
+// exit ends the process once the spans still buffered are exported and the log is written, the deferred calls of main
+// don't run on os.Exit
+func exit(code int) {
+	stopTracing()
+	closeLogging()
+	os.Exit(code)
+}
+
+// run connects the agent and takes part in the optimization until it converges or is stopped
+func (a *Agent) run() error {
+	// the log lines of an agent of the multi-agent mode tell which agent wrote them, and all of them the run
+	runs := newRunTracker()
+	logger := a.logger().With("run", runs.id)
+	wallet, err := a.cfg.openWallet()
 	if err != nil {
-		log.Fatalf("---> Failed to get network: %v", err)
+		return err
 	}
-	log.Println("---> successfully connected to network", networkName)
 
-	log.Println("============ getting contract ============")
-	contract := network.GetContract(contractName)
-	log.Println("---> successfully got contract", contractName)
+	gw, contract, err := a.connect(wallet)
+	if err != nil {
+		progress("error", map[string]interface{}{"error": err.Error()})
+		return err
+	}
+	progress("connected", map[string]interface{}{"channel": a.cfg.NetworkName, "contract": a.cfg.ContractName, "user": a.cfg.UserName, "run": runs.id, "version": version})
+	warnIncompatible(gw)
+	learnEndorsementPolicy(gw)
+	// the health checks follow the connection and the registration of the agent
+	status := health.agent(a.name)
+	status.connected(gw)
+	defer status.finish()
+	// the connection is replaced when the certificate is renewed, so the deferred calls look it up when they run
+	defer func() { gw.Close() }()
 
 	// eventID is a regular expression, which can be used to filter the events with specific event name
-	eventID := "Org1"
+	eventID := a.cfg.eventFilter()
+
+	if *conformanceMode {
+		if !runConformance(gw, contract, eventID, *conformanceTimeout) {
+			gw.Close()
+			exit(1)
+		}
+		return nil
+	}
+
+	checkEventFilter(contract, eventID)
+
 	// reg is the registration that can be used to unregister when event listening is no longer needed
 	// notifier is the channel that the event conmes from
-	reg, notifier, err := contract.RegisterEvent(eventID)
+	// a resumed run reads the events it missed while it was offline from the ledger
+	if a.alone() {
+		if replay, err = openEventReplay(); err != nil {
+			logger.Warnf("Failed to open the event checkpoint, missed events can't be replayed: %v", err)
+		}
+		defer replay.close()
+	}
+	reg, notifier, err := registerDecoded(gw, eventID, replayOptions()...)
 	if err != nil {
-		fmt.Printf("Failed to register contract event: %s", err)
-		return
+		progress("error", map[string]interface{}{"error": err.Error()})
+		return errors.New(tr("Failed to register contract event: %s", err))
+	}
+	status.registration(true)
+	defer func() { reg() }()
+	// the updates of the participants that are not on the blockchain arrive from the message buses
+	var busEvents <-chan *decodedEvent
+	if sources := openEventSources(a.cfg.EventSources, a.cfg.MSPID); len(sources) > 0 {
+		busReg, busNotifier, err := sources.RegisterEvent(eventID)
+		if err != nil {
+			progress("error", map[string]interface{}{"error": err.Error()})
+			return fmt.Errorf("failed to listen to the event sources: %w", err)
+		}
+		defer busReg()
+		busEvents = decodeStage(busNotifier, a.cfg.MSPID)
 	}
-	defer contract.Unregister(reg)
 
-	// this is the generator
-	var P float64 = 0
-	var l1 float64 = 1.6 * P
-	var m1 float64 = 0
+	if a.cfg.role() == roleStorage {
+		a.cfg.Storage = resumeStorage(a.cfg.Storage)
+	}
+	cost, limits := a.participant()
+	P, m1 := a.cfg.initialState()
+	// the forecast demand of a period starts in the mismatch of a node that serves it
+	m1 += a.demand
+	// the grid events of the protection relays restart the optimization with the constraints they leave the node with
+	var grid *gridEvents
+	if a.alone() {
+		if fieldDevice, err = openModbus(a.cfg.Modbus); err != nil {
+			logger.Warnf("Invalid Modbus settings, the device is not used: %v", err)
+		}
+		defer fieldDevice.close()
+		if plantServer, err = openOPCUA(a.cfg.OPCUA); err != nil {
+			logger.Warnf("Invalid OPC UA settings, the server is not used: %v", err)
+		}
+		defer plantServer.close()
+		if grid, err = subscribeGoose(a.cfg.Goose); err != nil {
+			logger.Warnf("Failed to subscribe to the GOOSE events, grid events don't restart the optimization: %v", err)
+		}
+		defer grid.close()
+	}
+	// a new run starts from the generation and load measured at the device, a resumed one from its checkpoint
+	if !*resume {
+		// a warm start moves the power of an earlier run into the mismatch, a measured power still replaces it
+		warm, powerSource, err := initialPower(*initPower, P, limits)
+		if err != nil {
+			logger.Warnf("Failed to get the initial power, starting from the initial state: %v", err)
+		} else if *initPower != "" {
+			m1 += P - warm
+			P = warm
+			logger.Infof("Initial power %v (%s)", P, powerSource)
+		}
+		P, m1 = fieldDevice.seed(P, m1)
+		P, m1 = plantServer.seed(P, m1)
+	}
+	// the part of the mismatch that is the node's own, the rest came from its neighbors and is handed over on leaving
+	demand := m1 + P
+	l1, lambdaSource, err := initialLambda(*initLambda, cost.marginal(P))
+	if err != nil {
+		logger.Warnf("Failed to get the initial price, starting from the default: %v", err)
+		l1, lambdaSource, _ = initialLambda("", cost.marginal(P))
+	}
+	logger.Info(tr("Initial price %v (%s)", l1, lambdaSource))
 	var iter int = 0
+	regulation := a.regulation
+	if !a.inHorizon() {
+		regulation = startRegulation(a.cfg.MQTT)
+		defer regulation.close()
+	}
+	defer regulation.stop()
+	island := &islandDetector{base: limits, events: grid}
+	// every neighbor's values are checked against the bounds and its own history
+	validator := newUpdateValidator()
+	detectors := map[string]*anomalyDetector{}
+	// with neighbors configured an iteration waits for all of them, otherwise every event is an iteration with its sender
+	round := newConsensusRound(a.cfg.Neighbors)
+	// with -membership the neighbors that leave the run are left out of the rounds until they join again
+	members := newMembership()
+	// an open round is ended after -round-timeout, roundEvent is the last update it received
+	if err := validateLatePolicy(); err != nil {
+		return err
+	}
+	if err := validateCommitWait(); err != nil {
+		return err
+	}
+	if err := validateInvalidUpdates(); err != nil {
+		return err
+	}
+	if err := validateReportFormat(*reportFormat); err != nil {
+		return err
+	}
+	if err := (AggregationConfig{Mode: *aggregationMode}).validate(); err != nil {
+		return fmt.Errorf("invalid -aggregation: %w", err)
+	}
+	if mode := a.cfg.Algorithm.Aggregation.mode(); mode != aggregationAverage {
+		logger.Infof("The neighbors' values are combined by their %s", mode)
+	}
+	if err := validatePayloadEncoding(); err != nil {
+		return err
+	}
+	deadline := newRoundDeadline()
+	defer deadline.stop()
+	var roundEvent *client.ChaincodeEvent
+	// roundTrace is the trace of roundEvent
+	var roundTrace context.Context
+	// with -signed-updates only the updates signed by the neighbors themselves enter the iterations
+	verifier, err := newUpdateVerifier(a.cfg.Neighbors)
+	if err != nil {
+		return err
+	}
+	peers := loadReputations()
+	// plugins run in their own processes, which are stopped again when the agent exits
+	defer plugin.CleanupClients()
+	pluginHandlers, err := loadPlugins()
+	if err != nil {
+		return fmt.Errorf("failed to load the plugins: %w", err)
+	}
+	// handlers that are not part of the consensus, such as the webhook forwarder, run on their own workers
+	pool := newEventPool(*eventWorkers, append(eventHandlers(), pluginHandlers...)...)
+	history := newHistoryRing(*historySize)
+	defer history.close()
+	// the hooks run the operator's commands on the lifecycle events of the run
+	hooks := startHooks(a.cfg.Hooks, a.name, a.cfg.MSPID, runs)
+	defer hooks.close(5 * time.Second)
+	if a.alone() {
+		if api, err = startAPI(a.state, history, a.cfg.Access); err != nil {
+			return err
+		}
+		if !a.inHorizon() {
+			if setpoints, err = startMQTT(a.cfg.MQTT); err != nil {
+				logger.Warnf("Failed to connect to the MQTT broker, the setpoints are not published: %v", err)
+			}
+			defer setpoints.close()
+		}
+	}
+	if *resume {
+		if state, err := loadCheckpoint(); err != nil {
+			logger.Warnf("Failed to load the checkpoint, starting a new run: %v", err)
+		} else {
+			iter, l1, m1, P = state.Iteration, state.Lambda, state.Mismatch, state.P
+			island.islanded = state.Islanded
+			if state.Islanded {
+				demand += *islandDemand
+			}
+			logger.Info(tr("Resuming from iteration %v of %s", iter, state.Time.Format(time.RFC3339)))
+		}
+	}
+	// on a change of the grid mode the local demand moves into or out of the mismatch
+	if islanded, changed := island.check(); changed {
+		if islanded {
+			m1 += *islandDemand
+			demand += *islandDemand
+		} else {
+			m1 -= *islandDemand
+			demand -= *islandDemand
+		}
+		notifyModeChange(contract, island.mode())
+	}
 	var terminate bool = false
-	fmt.Println("-> Solve energy management problem with consensus-based algorithm? [y/n]")
-	startConfirm := catchOneInput()
+	if !checkEstopLatch() {
+		logger.Warn(tr("Not rejoining the optimization until the emergency stop is acknowledged"))
+		return nil
+	}
+	var startConfirm bool
+	switch {
+	case !a.alone():
+		// the agents of the multi-agent mode start together
+		startConfirm = true
+	case api != nil:
+		// the device runs unattended, the optimization is started over the API
+		if !api.waitStart() {
+			return nil
+		}
+		startConfirm = true
+	default:
+		// a node that doesn't start the optimization joins it with the first update of a neighbor
+		startConfirm = confirm(tr("Solve energy management problem with consensus-based algorithm? [y/n]"), *autoStart)
+	}
 	// capture the start time of the optimization process
 	start := time.Now()
-	// send the first update of the optimization process
-	if isYes(startConfirm) {
-		Lambda := fmt.Sprintf("%v", l1)
-		Mismatch := fmt.Sprintf("%v", m1)
-		_, err = contract.SubmitTransaction("SendUpdate", Lambda, Mismatch)
-		if err != nil {
-			panic(fmt.Errorf("failed to submit transaction: %w", err))
+	status.start()
+	// the live status line of a single agent on a terminal, the agents of a simulation would draw over each other
+	var live *statusLine
+	if a.alone() {
+		live = newStatusLine(start, a.cfg.Generator.Epsilon)
+	}
+	defer live.done()
+	// the run, its iterations and transactions are kept in the -runs-db database
+	store, err := openRunStore(*runsDatabase)
+	if err != nil {
+		logger.Warnf("Failed to open the database of the runs, the run is not recorded: %v", err)
+	}
+	defer store.close()
+	run := a.recordRun(store, start)
+	// neighbors are scored on how long after our own update theirs arrives
+	lastSubmit := start
+	a.observe(iter, l1, m1, P, terminate, peers)
+	algorithm := newOptimizer(a.cfg.Algorithm)
+	algorithm.start(l1, m1, P)
+	convergence := newConvergenceLog(start)
+	// a run whose mismatch keeps growing is stopped rather than submitting updates forever
+	divergence := newDivergenceDetector(a.cfg.Generator.DivergenceSteps)
+	// the criteria of the termination policy, its window starts over with the algorithm
+	termination := newTerminationPolicy(a.cfg.Termination)
+	convergence.add(iter, l1, m1, P, algorithm.eta(iter))
+	var pending []*decodedEvent
+	if *resume {
+		pending = backfill(contract, eventID)
+	}
+	stats := newConnectionStats()
+	// reconnected counts a new connection or event registration, the reconnect hooks learn of it too, and the updates
+	// the neighbors sent meanwhile are read from the ledger with -backfill
+	reconnected := func(since time.Time, reason string) {
+		stats.reconnected(time.Since(since))
+		hooks.fire(hookReconnect, map[string]interface{}{"iteration": iter, "reason": reason, "peer": gw.peer.Name, "elapsed": time.Since(since).Seconds()})
+		pending = append(pending, backfill(contract, eventID)...)
+	}
+	// the iterations are timed by phase, waitFrom is when the node began to wait for the events of the next one
+	timings := newIterationTimings()
+	waitFrom := start
+	api.watchConnection(stats)
+	// the updates are confirmed from the blocks if -watch-blocks is set
+	blocks := startBlockWatch(gw)
+	defer func() { blocks.close() }()
+	commits := newCommitTracker()
+	// redelivered and stale events are dropped before they can start an iteration
+	sequencer := newEventSequencer(*eventWindow)
+	// the updates are submitted in the background, their results come back in order
+	queue := newSubmitQueue(a.own, gw, contract, *submitQueueSize, a.period)
+	defer queue.close()
+	// submitted handles the result of a submission, false if the run can't go on
+	submitted := func(r *submitResult) bool {
+		auditSubmission(r)
+		traceSubmission(r, a.cfg.MSPID)
+		run.transaction(r)
+		if r.superseded {
+			// the update of a later iteration is on its way, the neighbors get that one instead
+			logger.Warnf("The update of iteration %v was invalidated, a later update replaces it: %s", r.iteration, explainError(r.err))
+			countError("invalidated")
+			progress("invalidated", map[string]interface{}{"iteration": r.iteration, "txId": r.txID, "error": r.err.Error()})
+			return true
+		}
+		if r.err != nil {
+			countError("submit")
+			progress("error", map[string]interface{}{"iteration": r.iteration, "error": explainError(r.err).Error()})
+			hooks.fire(hookSubmissionFailure, map[string]interface{}{"iteration": r.iteration, "txId": r.txID, "error": explainError(r.err).Error()})
+			// the state of the last successful update stays in the checkpoint, so the run can be resumed
+			logger.Errorf("failed to submit transaction: %s", explainError(r.err))
+			return false
+		}
+		commits.submitted(r.txID, r.iteration)
+		status.activity()
+		progress("submitted", map[string]interface{}{"iteration": r.iteration, "lambda": r.args[0], "mismatch": r.args[1], "txId": r.txID})
+		lastSubmit = time.Now()
+		submitLatency.Observe(lastSubmit.Sub(r.started).Seconds())
+		if !r.ordered.IsZero() {
+			timings.observe(phaseSubmit, r.ordered.Sub(r.started))
+			timings.observe(phaseCommit, r.finished.Sub(r.ordered))
+		}
+		if r.event == nil {
+			// the first update follows no event and leaves no checkpoint
+			return true
+		}
+		if err := saveCheckpoint(r.state); err != nil {
+			logger.Warnf("Failed to save the checkpoint: %v", err)
 		}
+		if err := replay.commit(r.event); err != nil {
+			logger.Warnf("Failed to save the event checkpoint: %v", err)
+		}
+		return true
+	}
+	// with a barrier the node stops once all participants have converged, starting from a cleared flag
+	barrier := newConvergenceBarrier(a.cfg.Barrier)
+	// send the first update of the optimization process
+	if startConfirm {
+		barrier.reset(contract)
+		members.announceJoin(contract, iter)
+		queue.enqueue(&submission{name: "SendUpdate", args: updateArgs(gw, l1, m1, runs.id, a.period), iteration: iter, run: runs.id})
+	}
+	// commands typed while the optimization runs, "estop" aborts the run
+	var commands <-chan string
+	switch {
+	case api != nil:
+		commands = api.controls
+	case a.alone():
+		commands = input()
+	}
+	// the connection is swapped in place when the user certificate is renewed, the optimization state is kept
+	watcher := newCertWatcher(a.cfg.certPath())
+	certs := certTicker()
+	// the tunable parameters are read again from the config file on SIGHUP, without dropping the connection
+	var reloader *configReloader
+	if a.alone() {
+		reloader = newConfigReloader()
+		defer reloader.stop()
+	}
+	// a signal or the exit command ends the run through the same path as convergence, so the event is unregistered and the gateway closed
+	ctx, stop := shutdownContext()
+	defer stop()
+	var shutdownReason string
+	// the select would wait forever if the neighbors stopped sending updates
+	stall := newStallDetector()
+	defer stall.stop()
+	if commands != nil {
+		fmt.Fprintln(display(), "-> "+tr("Type estop at any time for an emergency stop"))
 	}
-	// select choose from different cases where the information comes, we only have one case here, thus the program will keeps on waiting for the desired event to come
+	// select choose from different cases where the information comes, the program will keeps on waiting for the desired event or a command to come
 iterLoop:
 	for {
-		select {
-		//when a new chaicode event, whose name matches the regular expression set in eventID, this case will be selected
-		case event := <-notifier:
+		var event *client.ChaincodeEvent
+		// received is the event with its payload, as the decoding stage passed it on
+		var received *decodedEvent
+		// late is set when the round deadline ends an iteration that some neighbors didn't report in
+		late := false
+		if len(pending) > 0 {
+			// events drained from a replaced connection are handled first
+			received, pending = pending[0], pending[1:]
+			event = received.ChaincodeEvent
+		} else {
+			select {
+			case line, ok := <-commands:
+				if !ok {
+					// stdin has ended, keep listening for events only
+					commands = nil
+					continue
+				}
+				line = strings.TrimSpace(line)
+				if isExit(line) {
+					shutdownReason = "exit command"
+					break iterLoop
+				}
+				if isEstop(line) {
+					regulation.stop()
+					emergencyStop(contract, "operator command")
+					break iterLoop
+				}
+				fmt.Fprintln(display(), tr("Unknown command %q, type estop for an emergency stop", line))
+				continue
+			case <-ctx.Done():
+				shutdownReason = "signal"
+				break iterLoop
+			case <-deadline.C():
+				deadline.stop()
+				// the iteration is attributed to the last update of the round
+				event, late = roundEvent, true
+			case <-stall.C():
+				snapshot := stats.snapshot()
+				logger.Warn(tr("No event for %s at iteration %v (%v events so far, largest block jump %v)", *iterationTimeout, iter, snapshot.Events, snapshot.LargestBlockJump))
+				progress("stall", map[string]interface{}{"iteration": iter, "timeout": iterationTimeout.Seconds()})
+				countError("stall")
+				if stall.stalled() {
+					logger.Error(tr("Aborting after %v stalls in a row: check that the neighbors are running, that the chaincode emits events matching %q and that the peer is reachable", *stallLimit, eventID))
+					shutdownReason = "stalled"
+					break iterLoop
+				}
+				if *stallReregister {
+					registerStart := time.Now()
+					reg()
+					reg, notifier, err = registerDecoded(gw, eventID, replayOptions()...)
+					status.registration(err == nil)
+					if err != nil {
+						logger.Warnf("Failed to register contract event: %v", err)
+						shutdownReason = "stalled"
+						break iterLoop
+					}
+					reconnected(registerStart, "stall")
+				}
+				continue
+			case <-certs:
+				if !watcher.changed() {
+					continue
+				}
+				reloadStart := time.Now()
+				next, err := a.cfg.reloadIdentity(wallet, eventID)
+				if err != nil {
+					logger.Warnf("Failed to reload the renewed certificate, keeping the current connection: %v", err)
+					continue
+				}
+				queue.use(next.gw, next.contract)
+				pending = next.swap(&liveConnection{gw: gw, contract: contract, reg: reg, notifier: notifier}, pending)
+				gw, contract, reg, notifier = next.gw, next.contract, next.reg, next.notifier
+				status.connected(gw)
+				reconnected(reloadStart, "certificate renewed")
+				continue
+			case <-reloader.C():
+				next, changed, err := reloadTunables(a.cfg)
+				if err != nil {
+					logger.Warnf("Failed to reload the configuration, keeping the current parameters: %v", err)
+					continue
+				}
+				if len(changed) == 0 {
+					logger.Info("Reloaded the configuration, no tunable parameter changed")
+					continue
+				}
+				// the next iteration goes on from the current price, mismatch and power with the new parameters
+				a.cfg, cfg = next, next
+				cost, limits = a.participant()
+				island.base = limits
+				members.use(round, a.cfg.Neighbors)
+				divergence.steps = a.cfg.Generator.DivergenceSteps
+				logger.Infof("Reloaded the configuration at iteration %v: %s", iter, strings.Join(changed, ", "))
+				progress("reload", map[string]interface{}{"iteration": iter, "changed": changed})
+				continue
+			case change := <-grid.C():
+				// the run starts over from the current price, with the power moved into the new limits and the
+				// demand of the event in the mismatch, and the neighbors learn of it from the update
+				m1 += change.demand()
+				demand += change.demand()
+				constrained := island.limits()
+				next := constrained.clamp(P)
+				m1 += P - next
+				P = next
+				algorithm.start(l1, m1, P)
+				divergence = newDivergenceDetector(a.cfg.Generator.DivergenceSteps)
+				termination = newTerminationPolicy(a.cfg.Termination)
+				state := "cleared"
+				if change.active {
+					state = "active"
+				}
+				logger.Warnf("Grid event %s is %s at iteration %v, restarting the optimization with the power limits [%v, %v] MW", change.event.name(), state, iter, constrained.Min, constrained.Max)
+				progress("grid-event", map[string]interface{}{"iteration": iter, "event": change.event.name(), "active": change.active, "pMin": constrained.Min, "pMax": constrained.Max})
+				a.observe(iter, l1, m1, P, terminate, peers)
+				queue.enqueue(&submission{name: "SendUpdate", args: updateArgs(gw, l1, m1, runs.id, a.period), iteration: iter, run: runs.id})
+				continue
+			case r := <-queue.C():
+				if !submitted(r) {
+					shutdownReason = "submit failed"
+					break iterLoop
+				}
+				continue
+			case <-queue.reconnects:
+				// the network is unreachable for the submissions, the events come from the new connection as well
+				reconnectStart := time.Now()
+				next, err := a.cfg.openConnection(wallet, eventID)
+				if err != nil {
+					logger.Warnf("Failed to reconnect: %v", err)
+					continue
+				}
+				queue.use(next.gw, next.contract)
+				pending = next.swap(&liveConnection{gw: gw, contract: contract, reg: reg, notifier: notifier}, pending)
+				gw, contract, reg, notifier = next.gw, next.contract, next.reg, next.notifier
+				status.connected(gw)
+				reconnected(reconnectStart, "unreachable")
+				continue
+			case block, ok := <-blocks.C():
+				if !ok {
+					// the stream ends with its connection too, the listener follows the current one
+					logger.Warn("Block event stream closed, registering again")
+					if blocks, err = blocks.restart(gw); err != nil {
+						logger.Warnf("Failed to register for block events, commits are no longer confirmed: %v", err)
+					}
+					continue
+				}
+				blocks.delivered(block)
+				commits.confirm(block)
+				continue
+			//when a new chaicode event, whose name matches the regular expression set in eventID, this case will be selected
+			case received = <-notifier:
+				if received == nil {
+					// the event stream was closed underneath us, register again
+					stats.streamError()
+					countError("stream")
+					logger.Warn("Event stream closed, registering again")
+					status.registration(false)
+					registerStart := time.Now()
+					if len(a.cfg.Peers) > 0 {
+						// the peer may be gone, a new connection goes to the first of the organization's peers that is reachable
+						next, err := a.cfg.openConnection(wallet, eventID)
+						if err == nil {
+							queue.use(next.gw, next.contract)
+							pending = next.swap(&liveConnection{gw: gw, contract: contract, reg: reg, notifier: notifier}, pending)
+							gw, contract, reg, notifier = next.gw, next.contract, next.reg, next.notifier
+							status.connected(gw)
+							status.registration(true)
+							reconnected(registerStart, "event stream closed")
+							continue
+						}
+						logger.Warnf("Failed to connect to another peer, registering again on peer %s: %v", gw.peer.Name, err)
+					}
+					reg, notifier, err = registerWithRetry(gw, eventID)
+					status.registration(err == nil)
+					if err != nil {
+						logger.Errorf("Failed to register contract event: %v", err)
+						shutdownReason = "event stream lost"
+						break iterLoop
+					}
+					reconnected(registerStart, "event stream closed")
+					continue
+				}
+				queueDepth.WithLabelValues("decoded").Set(float64(len(notifier)))
+				event = received.ChaincodeEvent
+			case received = <-busEvents:
+				if received == nil {
+					// the buses retry on their own, they only end when they fail for good
+					countError("stream")
+					logger.Warn("The event sources ended, the updates of the participants off the chain no longer arrive")
+					busEvents = nil
+					continue
+				}
+				event = received.ChaincodeEvent
+			}
+		}
+		var neighbors []neighborUpdate
+		var l2, m2 float64
+		// traced is the trace the iteration and its update are recorded in
+		traced := received.context()
+		if late {
+			traced = roundTrace
+			// the round ran out of time, it goes on with the updates it has
+			var missing []string
+			neighbors, missing = round.takeLate(peers, *latePolicy)
+			l2, m2 = neighborhoodAverage(neighbors)
+			logger.Warn(tr("Neighbors %v missed the round deadline of %s at iteration %v, policy %s", missing, *roundTimeout, iter, *latePolicy))
+			progress("late", map[string]interface{}{"iteration": iter, "neighbors": missing, "policy": *latePolicy})
+			countError("late")
+		} else {
+			if a.ownEvent(event) {
+				logger.Info(tr("Ignoring event %s from block %v, it is this node's own update (tx %s)", event.EventName, event.BlockNumber, event.TransactionID))
+				continue
+			}
+			if err := sequencer.admit(event); err != nil {
+				logger.Info(tr("Discarding event %s from block %v: %v", event.EventName, event.BlockNumber, err))
+				countError("duplicate")
+				continue
+			}
+			stats.event(event.BlockNumber)
+			status.activity()
+			progress("event", map[string]interface{}{"iteration": iter, "name": event.EventName, "block": event.BlockNumber, "txId": event.TransactionID, "payload": string(event.Payload)})
+			eventsCounter.WithLabelValues(event.EventName).Inc()
+			eventLatency.Observe(time.Since(lastSubmit).Seconds())
+			stall.received()
 			// fmt.Printf("Received CC event: %s - %s \n", event.EventName, event.Payload)
-			iter += 1
-			l2 := getLambda(string(event.Payload))
-			m2 := getMismatch(string(event.Payload))
-			l1, m1, P, terminate = update(l1, l2, m1, m2, P, iter)
-			// usefull trick to convert float variable to string
-			Lambda := fmt.Sprintf("%v", l1)
-			Mismatch := fmt.Sprintf("%v", m1)
-			_, err := contract.SubmitTransaction("SendUpdate", Lambda, Mismatch)
+			pool.dispatch(event)
+			// a neighbor that leaves hands its part of the mismatch over and the run starts over without it, until it joins again
+			if change, ok, err := decodeMembership(string(event.Payload)); ok && members != nil {
+				if err != nil {
+					logger.Warn(tr("Discarding event %s from block %v: %v", event.EventName, event.BlockNumber, err))
+					countError("discarded")
+					continue
+				}
+				rebalanced := false
+				switch change.Membership {
+				case "leave":
+					var handover float64
+					if handover, rebalanced = members.leave(a.cfg.Neighbors, change, event.EventName); rebalanced {
+						m1 += handover
+						logger.Warn(tr("Neighbor %s left the run at iteration %v, taking over a mismatch of %v", event.EventName, iter, handover))
+					}
+				case "join":
+					if rebalanced = members.join(event.EventName); rebalanced {
+						logger.Info(tr("Neighbor %s rejoined the run at iteration %v", event.EventName, iter))
+					}
+				}
+				if !rebalanced {
+					continue
+				}
+				members.use(round, a.cfg.Neighbors)
+				algorithm.start(l1, m1, P)
+				divergence = newDivergenceDetector(a.cfg.Generator.DivergenceSteps)
+				termination = newTerminationPolicy(a.cfg.Termination)
+				progress("membership", map[string]interface{}{"iteration": iter, "neighbor": event.EventName, "membership": change.Membership, "neighbors": len(round.neighbors)})
+				a.observe(iter, l1, m1, P, terminate, peers)
+				queue.enqueue(&submission{name: "SendUpdate", args: updateArgs(gw, l1, m1, runs.id, a.period), iteration: iter, run: runs.id})
+				continue
+			}
+			if members.left(event.EventName) {
+				logger.Info(tr("Ignoring event %s, the neighbor has left the run", event.EventName))
+				continue
+			}
+			// of a batch of updates only the neighbor's latest enters the iteration
+			update := received.update
+			if err := received.err; err != nil {
+				logger.Warn(tr("Discarding event %s from block %v: %v", event.EventName, event.BlockNumber, err))
+				countError("discarded")
+				peers.record(event.EventName, false, time.Since(lastSubmit))
+				continue
+			}
+			// the seal covers the run and the period, so they are checked only once the seal is verified
+			if err := verifier.verify(event.EventName, &update); err != nil {
+				logger.Warn(tr("Discarding event %s from block %v: %v", event.EventName, event.BlockNumber, err))
+				countError("forged")
+				peers.record(event.EventName, false, time.Since(lastSubmit))
+				continue
+			}
+			if err := a.checkPeriod(update); err != nil {
+				logger.Info(tr("Discarding event %s from block %v: %v", event.EventName, event.BlockNumber, err))
+				countError("duplicate")
+				continue
+			}
+			followed, err := runs.admit(update.Run)
 			if err != nil {
-				panic(fmt.Errorf("failed to submit transaction: %w", err))
+				logger.Info(tr("Discarding event %s from block %v: %v", event.EventName, event.BlockNumber, err))
+				countError("duplicate")
+				continue
+			}
+			if followed {
+				logger = a.logger().With("run", runs.id)
+				logger.Info(tr("Following the newer run %s of neighbor %s", runs.id, event.EventName))
+			}
+			var clamped []string
+			l2, m2, clamped, err = validator.check(event.EventName, update.Lambda, update.Mismatch, cost)
+			if err != nil {
+				logger.Warn(tr("Discarding event %s from block %v: %v", event.EventName, event.BlockNumber, err))
+				countError("discarded")
+				peers.record(event.EventName, false, time.Since(lastSubmit))
+				validator.suspect(contract, event.EventName, runs.id, iter, err.Error())
+				continue
+			}
+			if len(clamped) > 0 {
+				reason := "clamped " + strings.Join(clamped, ", ")
+				logger.Warnf("Event %s from block %v is implausible, %s", event.EventName, event.BlockNumber, reason)
+				countError("clamped")
+				validator.suspect(contract, event.EventName, runs.id, iter, reason)
 			}
-			if terminate {
-				elapsed := time.Since(start)
-				// fmt.Printf("Done at iteration %v: P=%v, lambda=%v, mismatch=%v, used %s\n", iter, P, l1, m1, elapsed)
-				fmt.Printf("Solving process ends at iteration 50. \n")
-				fmt.Printf("The optimal power generation is 6.1319 MW. \n")
-				fmt.Printf("The electricity price is $4.9055/MWh. \n")
-				fmt.Printf("The power mismatch is 0. \n")
-				fmt.Printf("The solving is completed in %s.\n", elapsed)
+			detector, ok := detectors[event.EventName]
+			if !ok {
+				detector = newAnomalyDetector()
+				detectors[event.EventName] = detector
+			}
+			reasons := detector.observe(l2, m2)
+			if len(reasons) > 0 {
+				logger.Warn(tr("Suspected false data in event %s from block %v: %s", event.EventName, event.BlockNumber, strings.Join(reasons, "; ")))
+				countError("suspicious")
+			}
+			peers.record(event.EventName, len(reasons) == 0, time.Since(lastSubmit))
+			l2, m2 = detector.aggregate(l2, m2)
+			if len(a.cfg.Neighbors) == 0 {
+				neighbors = []neighborUpdate{{weight: peers.weight(event.EventName), lambda: l2, mismatch: m2}}
+			} else {
+				if !round.expects(event.EventName) {
+					logger.Warn(tr("Ignoring event %s, it is not from a configured neighbor", event.EventName))
+					continue
+				}
+				round.add(event.EventName, l2, m2)
+				roundEvent, roundTrace = event, traced
+				if !round.complete() {
+					deadline.start()
+					continue
+				}
+				deadline.stop()
+				neighbors = round.take(peers)
+				l2, m2 = neighborhoodAverage(neighbors)
+			}
+		}
+		iter += 1
+		computeStart := time.Now()
+		timings.observe(phaseWait, computeStart.Sub(waitFrom))
+		// on a change of the grid mode the local demand moves into or out of the mismatch
+		if islanded, changed := island.check(); changed {
+			if islanded {
+				m1 += *islandDemand
+				demand += *islandDemand
+			} else {
+				m1 -= *islandDemand
+				demand -= *islandDemand
+			}
+			notifyModeChange(contract, island.mode())
+		}
+		previous := l1
+		a.markets.await(a.name, iter)
+		l1, m1, P = algorithm.step(cost, a.markets.limits(a.name, island.limits()), a.cfg.Algorithm.Aggregation.aggregate(neighbors), l1, m1, P, iter)
+		a.markets.finished(a.name, iter, P)
+		traced = traceOptimization(traced, a.cfg.MSPID, computeStart, iter, l1, m1, P)
+		converged := termination.done(iterationOutcome{
+			lambda:    l1,
+			mismatch:  m1,
+			P:         P,
+			change:    l1 - previous,
+			converged: algorithm.converged(a.cfg.Generator.Epsilon),
+			epsilon:   a.cfg.Generator.Epsilon,
+			elapsed:   time.Since(start),
+		})
+		terminate = barrier.observe(contract, iter, converged)
+		traceIteration(iter, l1, l2, m1, m2, P, algorithm.eta(iter))
+		convergence.add(iter, l1, m1, P, algorithm.eta(iter))
+		entry := iterationRecord{
+			Iteration:        iter,
+			Time:             time.Now(),
+			Event:            event.EventName,
+			Block:            event.BlockNumber,
+			Lambda:           l1,
+			Mismatch:         m1,
+			P:                P,
+			NeighborLambda:   l2,
+			NeighborMismatch: m2,
+		}
+		history.add(entry)
+		run.iteration(entry)
+		if regulation != nil {
+			logger.Info(tr("Iteration %v: dispatch %v MW, regulated setpoint %v MW", iter, P, regulation.setpoint(P, island.limits())))
+		}
+		regulation.follow(P, island.limits())
+		setpoints.publishIteration(setpointMessage{Iteration: iter, P: P, Setpoint: regulation.setpoint(P, island.limits()), Lambda: l1, Mismatch: m1, Reason: "iteration"})
+		record := map[string]interface{}{"iteration": iter, "lambda": l1, "mismatch": m1, "p": P, "neighborLambda": l2, "neighborMismatch": m2}
+		if a.cfg.role() == roleStorage {
+			// the state of charge the battery would reach with this iteration's power
+			record["soc"] = a.cfg.Storage.after(P)
+		}
+		progress("iteration", record)
+		hooks.fire(hookIteration, record)
+		live.update(iter, m1)
+		a.observe(iter, l1, m1, P, terminate, peers)
+		queue.enqueue(&submission{
+			name:      "SendUpdate",
+			args:      updateArgs(gw, l1, m1, runs.id, a.period),
+			iteration: iter,
+			run:       runs.id,
+			state:     optimizationState{Iteration: iter, Lambda: l1, Mismatch: m1, P: P, Islanded: island.islanded, Time: time.Now()},
+			event:     event,
+			trace:     traced,
+		})
+		waitFrom = time.Now()
+		timings.observe(phaseCompute, waitFrom.Sub(computeStart))
+		if terminate {
+			// the run has only converged once the final update is committed
+			failed := false
+			for _, r := range queue.wait() {
+				failed = failed || !submitted(r)
+			}
+			if failed {
+				shutdownReason = "submit failed"
 				break iterLoop
 			}
+			live.done()
+			elapsed := time.Since(start)
+			fields := map[string]interface{}{"iteration": iter, "lambda": l1, "mismatch": m1, "p": P, "elapsed": elapsed.Seconds()}
+			progress("converged", fields)
+			hooks.fire(hookConvergence, fields)
+			convergedCounter.Inc()
+			result := ResultSummary{
+				Organization:   a.cfg.MSPID,
+				Run:            runs.id,
+				Time:           time.Now(),
+				Iterations:     iter,
+				Power:          P,
+				Price:          l1,
+				Mismatch:       m1,
+				Elapsed:        elapsed,
+				ElapsedSeconds: elapsed.Seconds(),
+				Setpoint:       regulation.setpoint(P, island.limits()),
+				Timing:         timings.summary(),
+			}
+			result.Participants = participantResults(contract)
+			result.print(a.cfg.Report.format())
+			a.result = &result
+			if regulation != nil {
+				fmt.Fprintln(display(), tr("The regulated setpoint is %v MW.", result.Setpoint))
+			}
+			fieldDevice.writeSetpoint(result.Setpoint)
+			plantServer.writeSetpoint(result.Setpoint)
+			setpoints.publishSetpoint(setpointMessage{Iteration: iter, P: P, Setpoint: result.Setpoint, Lambda: l1, Mismatch: m1, Reason: "converged"})
+			if err := result.save(*resultsFile); err != nil {
+				logger.Warnf("Failed to save the result: %v", err)
+			}
+			if err := result.record(contract); err != nil {
+				logger.Warnf("Failed to record the result on the ledger: %s", explainError(err))
+			}
+			settleResult(result, a.cfg.role(), cost).settled(contract)
+			if err := clearCheckpoint(); err != nil {
+				logger.Warnf("Failed to remove the checkpoint: %v", err)
+			}
+			if err := saveLastPrice(lastPriceFile, l1, P, iter); err != nil {
+				logger.Warnf("Failed to save the converged price: %v", err)
+			}
+			if *operatingMode == modeDayAhead {
+				if err := commitPower(a.scheduleHour(), P); err != nil {
+					logger.Warnf("Failed to commit the day-ahead schedule: %v", err)
+				}
+			}
+			if a.cfg.role() == roleStorage {
+				logger.Infof("The state of charge goes from %.3f to %.3f", a.cfg.Storage.SoC, a.cfg.Storage.after(P))
+				if err := keepStorage(a.cfg.Storage, P); err != nil {
+					logger.Warnf("Failed to keep the state of charge: %v", err)
+				}
+			}
+			break iterLoop
+		}
+		diverged := divergence.observe(m1)
+		if a.cfg.Generator.MaxIterations > 0 && iter >= a.cfg.Generator.MaxIterations {
+			logger.Error(tr("No convergence after %v iterations in %s: lambda %v, mismatch %v, P %v", iter, time.Since(start).Round(time.Millisecond), l1, m1, P))
+			shutdownReason = "iteration limit"
+			break iterLoop
+		}
+		if diverged {
+			logger.Error(tr("The mismatch grew in each of the last %v iterations (%s): lambda %v, P %v at iteration %v", a.cfg.Generator.DivergenceSteps, divergence, l1, P, iter))
+			shutdownReason = "diverged"
+			break iterLoop
 		}
 	}
 
+	if shutdownReason == "iteration limit" || shutdownReason == "diverged" {
+		// the last update goes on the chain before the failure is reported
+		for _, r := range queue.wait() {
+			submitted(r)
+		}
+		reportFailure(contract, shutdownReason, iter)
+	}
+
+	if shutdownReason != "" {
+		logger.Info(tr("Shutting down (%s) at iteration %v", shutdownReason, iter))
+		progress("shutdown", map[string]interface{}{"reason": shutdownReason, "iteration": iter, "lambda": l1, "mismatch": m1, "p": P})
+		// the neighbors go on without the node, they take over the mismatch it holds beyond its own demand and a
+		// resumed run starts with its own demand only
+		if members.announceLeave(contract, iter, m1-(demand-P), round.neighbors) {
+			m1 = demand - P
+			if err := saveCheckpoint(optimizationState{Iteration: iter, Lambda: l1, Mismatch: m1, P: P, Islanded: island.islanded, Time: time.Now()}); err != nil {
+				logger.Warnf("Failed to save the checkpoint: %v", err)
+			}
+		}
+		state := optimizationState{Iteration: iter, Lambda: l1, Mismatch: m1, P: P, Islanded: island.islanded, Time: time.Now(), Reason: shutdownReason}
+		if err := saveOptimizationState(state); err != nil {
+			logger.Warnf("Failed to save the optimization state: %v", err)
+		}
+	}
+
+	outcome := shutdownReason
+	if terminate {
+		outcome = "converged"
+	} else if outcome == "" {
+		outcome = "emergency stop"
+	}
+	run.finish(outcome, iter, l1, m1, P)
+
+	// the iterations are exported however the run ended, a stopped run is worth plotting too
+	if err := convergence.save(*exportFile); err != nil {
+		logger.Warnf("Failed to export the iterations: %v", err)
+	}
+
 	// unregister since we don't need to listen to events when the optimization is ended'
-	contract.Unregister(reg)
+	reg()
+	status.finish()
+	pool.close(5 * time.Second)
+
+	fmt.Fprintln(display(), tr("Connection: %s", stats))
+	fmt.Fprint(display(), tr("Iteration timing:\n%s", timings))
+	if err := stats.save(); err != nil {
+		logger.Warnf("Failed to save the connection statistics: %v", err)
+	}
+	fmt.Fprint(display(), tr("Neighbor reputations:\n%s", peers))
+	if err := peers.save(); err != nil {
+		logger.Warnf("Failed to save the neighbor reputations: %v", err)
+	}
+
+	if api != nil {
+		reason := shutdownReason
+		if !terminate && reason == "" {
+			reason = "emergency stop"
+		}
+		api.finished(reason)
+		// the status and the history stay available until the agent is stopped
+		<-ctx.Done()
+		logger.Info(tr("application-golang ends"))
+		return nil
+	}
 
 	// funcLoop:
 	// 	for {
@@ -167,12 +1024,12 @@ iterLoop:
 	// 			eventID := "Org1[a-zA-Z]+"
 	// 			reg, notifier, err := contract.RegisterEvent(eventID)
 	// 			if err != nil {
-	// 				fmt.Printf("Failed to register contract event: %s", err)
+	// 				fmt.Println(tr("Failed to register contract event: %s", err))
 	// 				return
 	// 			}
 	// 			defer contract.Unregister(reg)
 	// 			invokeFunc(contract)
-	// 			var event *fab.CCEvent
+	// 			var event *client.ChaincodeEvent
 	// 			select {
 	// 			case event = <-notifier:
 	// 				fmt.Printf("Received CC event: %s - %s \n", event.EventName, event.Payload)
@@ -187,188 +1044,173 @@ iterLoop:
 	// 		}
 	// 	}
 
+	if shutdownReason != "" || !a.alone() {
+		logger.Info(tr("application-golang ends"))
+		return nil
+	}
+	if a.inHorizon() {
+		// runHorizon offers the cleanup after the last period
+		return nil
+	}
+
 	// the credentials must be cleaned if you are going to shut down the current network connection
 	// everytime the network is established, new credential files will be generated
-	fmt.Println("-> Clean up?: [y/n] ")
-	cleanUpConfirm := catchOneInput()
-	if isYes(cleanUpConfirm) {
-		cleanUp()
-	}
+	offerCleanup()
+	return nil
 }
 
-func update(l1 float64, l2 float64, m1 float64, m2 float64, P float64, iter int) (float64, float64, float64, bool) {
-	var eta float64 = 1 / float64(iter)
-	if eta < 0.01 {
-		eta = 0.01
+// participant returns the cost and the power limits of the generator, load or battery of the node
+func (a *Agent) participant() (costFunction, powerLimits) {
+	logger := a.logger()
+	cost, limits := a.cfg.participant()
+	logger.Infof("Taking part as %s with the power limits [%v, %v] MW", a.cfg.role(), limits.Min, limits.Max)
+	if a.alone() && a.cfg.role() == roleGenerator && a.cfg.Generator.quadratic() {
+		// the agents of the multi-agent mode keep to their models, the measurements are those of the device
+		cost = loadCostCurve(a.cfg.Generator)
 	}
-	ltemp := 0.5*l1 + 0.5*l2 + eta*m1
-	Ptemp := ltemp / 1.6
-	if Ptemp > 8 {
-		Ptemp = 8
-	} else if Ptemp < 0 {
-		Ptemp = 0
+	if *operatingMode == modeRealTime {
+		committed, err := committedPower(a.scheduleHour())
+		if err != nil {
+			logger.Infof("No deviation penalty in this run: %v", err)
+		} else {
+			cost = withPenalty(cost, *deviationPenalty, committed, limits)
+			logger.Infof("Penalizing deviations from the committed power %v MW", committed)
+		}
 	}
-	mtemp := 0.5*m1 + 0.5*m2 + P - Ptemp
-
-	var terminate bool
-	if math.Abs(mtemp) < 0.01 && math.Abs(ltemp-l1) < 0.01 {
-		terminate = true
-	} else {
-		terminate = false
+	network := a.cfg.Generator.Network
+	cost, constrained := network.apply(cost, limits)
+	if pf := network.penaltyFactor(); pf != 1 {
+		logger.Infof("Dispatching with the loss penalty factor %v", pf)
 	}
-
-	// fmt.Printf("Iteration %v: Lambda=%v, Mismatch=%v, P=%v, Terminate=%v\n", iter, ltemp, mtemp, Ptemp, terminate)
-
-	return ltemp, mtemp, Ptemp, terminate
+	if constrained != limits {
+		logger.Infof("The lines narrow the power limits to [%v, %v] MW", constrained.Min, constrained.Max)
+	}
+	return cost, constrained
 }
 
-func getLambda(s string) float64 {
-
-	// looking for string that contains only numbers and decimal points, starting with "Lambda=" and ending with ","
-	pattern := "(?<=Lambda=)[0-9.-]+(?=,)"
-
-	// regexp2 supports more regular expressions than the official regexp
-	reg, err := regexp2.Compile(pattern, 0)
+// connect connects to the gateway with the wallet identity and returns the contract of the channel
+func (c Config) connect(wallet *fileWallet) (*gatewayConnection, *client.Contract, error) {
+	id, err := wallet.get(c.UserName)
 	if err != nil {
-		fmt.Printf("reg: %v, err: %v\n", reg, err)
-		return 0
+		return nil, nil, fmt.Errorf("failed to get identity %s from the wallet: %w", c.UserName, err)
+	}
+	x509ID, sign, release, err := signingIdentity(id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load identity %s: %w", c.UserName, err)
 	}
 
-	value, _ := reg.FindStringMatch(s)
-
-	// convert string to float64 variable
-	Lambda, _ := strconv.ParseFloat(fmt.Sprintf("%v", value), 64)
-
-	return Lambda
-}
-
-func getMismatch(s string) float64 {
-
-	pattern := "(?<=Mismatch=)[0-9.-]+(?=, end)"
-
-	reg, err := regexp2.Compile(pattern, 0)
+	logger.Info(tr("connecting to gateway"))
+	conn, peer, err := c.dialPeers()
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	gateway, err := client.Connect(x509ID, gatewayOptions(sign, conn)...)
 	if err != nil {
-		fmt.Printf("reg: %v, err: %v\n", reg, err)
-		return 0
+		conn.Close()
+		release()
+		return nil, nil, fmt.Errorf("failed to connect to gateway: %w", err)
 	}
+	gw := &gatewayConnection{Gateway: gateway, conn: conn, sign: sign, release: release, channel: c.NetworkName, chaincode: c.ContractName, peer: peer}
+	logger.Info(tr("Successfully connected to gateway!"))
 
-	value, _ := reg.FindStringMatch(s)
+	logger.Info(tr("getting network"))
+	network := gw.GetNetwork(c.NetworkName)
+	logger.Info(tr("successfully connected to network %s", c.NetworkName))
 
-	Mismatch, _ := strconv.ParseFloat(fmt.Sprintf("%v", value), 64)
+	logger.Info(tr("getting contract"))
+	contract := network.GetContract(c.ContractName)
+	logger.Info(tr("successfully got contract %s", c.ContractName))
 
-	return Mismatch
+	return gw, contract, nil
 }
 
-func getIter(s string) float64 {
-
-	pattern := "(?<=Iteration=)[0-9.-]+(?=, end)"
+// latestUpdate returns the last update of the payload of a SendUpdateBatch event, which lists the updates separated by ';'
+// the payload of a single update is returned as it is
+func latestUpdate(payload string) string {
+	updates := strings.Split(strings.TrimRight(payload, "; "), ";")
+	return strings.TrimSpace(updates[len(updates)-1])
+}
 
-	reg, err := regexp2.Compile(pattern, 0)
+// openWallet opens the wallet and imports the configured user's credentials if they are not in it yet
+func (c Config) openWallet() (*fileWallet, error) {
+	logger.Info(tr("Creating wallet"))
+	wallet, err := c.wallet()
 	if err != nil {
-		fmt.Printf("reg: %v, err: %v\n", reg, err)
-		return 0
+		return nil, errors.New(tr("Failed to create wallet: %v", err))
 	}
+	logger.Info(tr("Wallet created!"))
 
-	value, _ := reg.FindStringMatch(s)
-
-	Iteration, errIteration := strconv.ParseFloat(fmt.Sprintf("%v", value), 64)
-	if errIteration != nil {
-		log.Panic("Error capturing iteration")
+	if !wallet.exists(c.UserName) {
+		err = c.populateWallet(wallet)
+		if err != nil {
+			return nil, errors.New(tr("Failed to populate wallet contents: %v", err))
+		}
+		logger.Info(tr("Successfully added user %s to wallet!", c.UserName))
+	} else {
+		logger.Info(tr("User %s already exists!", c.UserName))
 	}
-
-	return Iteration
+	return wallet, nil
 }
 
-func populateWallet(wallet *gateway.Wallet, userName string) error {
-	credPath := filepath.Join(
-		"..",
-		"fabric-samples-2.3",
-		"test-network",
-		"organizations",
-		"peerOrganizations",
-		"org1.example.com",
-		"users",
-		"User1@org1.example.com",
-		"msp",
-	)
-
-	certPath := filepath.Join(credPath, "signcerts", "User1@org1.example.com-cert.pem")
-	// read the certificate pem
-	cert, err := ioutil.ReadFile(filepath.Clean(certPath))
-	if err != nil {
-		return err
-	}
-
-	keyDir := filepath.Join(credPath, "keystore")
-	// there's a single file in this dir containing the private key
-	files, err := ioutil.ReadDir(keyDir)
-	if err != nil {
-		return err
-	}
-	if len(files) != 1 {
-		return fmt.Errorf("keystore folder should have contain one file")
+// populateWallet puts the configured user's identity into the wallet
+func (c Config) populateWallet(wallet *fileWallet) error {
+	var identity *walletIdentity
+	var err error
+	if c.CA.URL != "" && c.CA.EnrollmentID != "" {
+		// devices in the field enroll with the CA instead of having the MSP folder copied to them
+		identity, err = enrollWithRetry(c.MSPID, c.CA)
+	} else {
+		if err := c.validateCrypto(true); err != nil {
+			return err
+		}
+		identity, err = loadIdentity(c.MSPID, c.certPath(), c.keyPath(), c.HSM.Library != "")
 	}
-	keyPath := filepath.Join(keyDir, files[0].Name())
-	key, err := ioutil.ReadFile(filepath.Clean(keyPath))
 	if err != nil {
 		return err
 	}
 
-	identity := gateway.NewX509Identity("Org1MSP", string(cert), string(key))
-
-	return wallet.Put(userName, identity)
+	return wallet.put(c.UserName, identity)
 }
 
-func cleanUp() {
-	log.Println("-> Cleaning up wallet...")
-	if _, err := os.Stat("wallet"); err == nil {
-		e := os.RemoveAll("wallet")
-		if e != nil {
-			log.Fatal(e)
-		}
-	}
-	if _, err := os.Stat("keystore"); err == nil {
-		e := os.RemoveAll("keystore")
-		if e != nil {
-			log.Fatal(e)
-		}
-	}
-	log.Println("-> Wallet cleaned up successfully")
+// all input goes through a single reader, so that commands typed while the optimization runs don't steal the answer of a later prompt
+var (
+	inputLines     = make(chan string)
+	startInputOnce sync.Once
+)
+
+// input returns the channel of lines typed by the user, it is closed when stdin ends
+func input() <-chan string {
+	startInputOnce.Do(func() {
+		go readLines(os.Stdin, inputLines)
+	})
+	return inputLines
 }
 
-func invokeFunc(contract *gateway.Contract) {
-	var functionName string
-	var paraNumber int
-	fmt.Println("-> Please enter the name of the smart contract function you want to invoke")
-	functionName = catchOneInput()
-	fmt.Println("-> Please enter the number of parameters")
-	paraNumber, _ = strconv.Atoi(catchOneInput())
-	var functionPara []string
-	for i := 0; i < paraNumber; i++ {
-		fmt.Printf("-> Please enter parameter %v: ", i+1)
-		functionPara = append(functionPara, catchOneInput())
-	}
-	if paraNumber == 0 {
-		result, err := contract.SubmitTransaction(functionName)
-		if err != nil {
-			panic(fmt.Errorf("failed to submit transaction: %w", err))
+// readLines sends the lines of the reader without their line ending, "\n" or the "\r\n" of Windows, and closes the
+// channel at the end of the input, e.g. when Ctrl-D (Ctrl-Z on Windows) is typed; a last line without an ending is sent too
+func readLines(r io.Reader, lines chan<- string) {
+	reader := bufio.NewReader(r)
+	for {
+		s, err := reader.ReadString('\n')
+		if s != "" {
+			lines <- strings.TrimRight(s, "\r\n")
 		}
-		fmt.Printf("Result: %s \n", string(result))
-	} else {
-		result, err := contract.SubmitTransaction(functionName, functionPara...)
 		if err != nil {
-			panic(fmt.Errorf("failed to submit transaction: %w", err))
+			close(lines)
+			return
 		}
-		fmt.Printf("Result: %s \n", string(result))
 	}
 }
 
+// catchOneInput returns the next line typed by the user, the application ends when the input has ended and nobody
+// can answer anymore
 func catchOneInput() string {
-	// instantiate a new reader
-	reader := bufio.NewReader(os.Stdin)
-	s, _ := reader.ReadString('\n')
-	// get rid of the \n at the end of the string
-	s = strings.Replace(s, "\n", "", -1)
+	s, ok := <-input()
+	if !ok {
+		logger.Info(tr("The input has ended"))
+		exitApp()
+	}
 	// if the string is exit, exit the application directly
 	// this allows the user to exit the application whereever they want and saves the effort of detecting the exit command elsewhere
 	if isExit(s) {
@@ -377,28 +1219,21 @@ func catchOneInput() string {
 	return s
 }
 
-func isYes(s string) bool {
-	return strings.Compare(s, "Y") == 0 || strings.Compare(s, "y") == 0 || strings.Compare(s, "Yes") == 0 || strings.Compare(s, "yes") == 0
-}
-
-func isNo(s string) bool {
-	return strings.Compare(s, "N") == 0 || strings.Compare(s, "n") == 0 || strings.Compare(s, "No") == 0 || strings.Compare(s, "no") == 0
-}
-
 func isExit(s string) bool {
-	return strings.Compare(s, "Exit") == 0 || strings.Compare(s, "exit") == 0 || strings.Compare(s, "EXIT") == 0
+	return strings.EqualFold(strings.TrimSpace(s), "exit")
 }
 
 func exitApp() {
-	log.Println("============ application-golang ends ============")
+	logger.Info(tr("application-golang ends"))
 	// exit code zero indicates that no error occurred
-	os.Exit(0)
+	exit(0)
 }
 
+// formatJSON indents a JSON result, a result that isn't JSON is returned as it is
 func formatJSON(data []byte) string {
 	var result bytes.Buffer
 	if err := json.Indent(&result, data, "", "  "); err != nil {
-		panic(fmt.Errorf("failed to parse JSON: %w", err))
+		return string(data)
 	}
 	return result.String()
 }
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadLinesNormalizesLineEndings(t *testing.T) {
+	lines := make(chan string, 8)
+	readLines(strings.NewReader("y\r\n exit \nLambda=1\r\nlast"), lines)
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+	if want := []string{"y", " exit ", "Lambda=1", "last"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+	if !isYes(got[0]) || !isExit(got[1]) {
+		t.Errorf("the answers of a Windows terminal are not understood")
+	}
+}
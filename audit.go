@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var auditFile = flag.String("audit", "audit.jsonl", "JSON lines file every submitted transaction is appended to with its ID and response, for tracing the optimization on the ledger; empty disables it")
+
+// auditEntry is a line of the audit log, a transaction that was submitted or failed to be
+type auditEntry struct {
+	Time     time.Time `json:"time"`
+	Function string    `json:"function"`
+	Args     []string  `json:"args"`
+	// Iteration is the iteration of an update, invocations by hand have none
+	Iteration *int   `json:"iteration,omitempty"`
+	TxID      string `json:"txId,omitempty"`
+	Result    string `json:"result,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+var auditMu sync.Mutex
+
+// audit appends a transaction to the audit log, the file is only ever appended to
+func audit(entry auditEntry) {
+	if *auditFile == "" {
+		return
+	}
+	entry.Time = time.Now()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		logger.Warnf("Failed to write the audit log: %v", err)
+		return
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	file, err := os.OpenFile(*auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		logger.Warnf("Failed to write the audit log: %v", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		logger.Warnf("Failed to write the audit log: %v", err)
+	}
+}
+
+// auditSubmission records the result of a consensus update
+func auditSubmission(r *submitResult) {
+	iteration := r.iteration
+	entry := auditEntry{Function: r.name, Args: r.args, Iteration: &iteration, TxID: r.txID, Result: string(r.result)}
+	if r.err != nil {
+		entry.Error = explainError(r.err).Error()
+	}
+	audit(entry)
+}
+
+// auditInvocation records a transaction submitted by hand
+func auditInvocation(name string, args []string, txID string, result []byte, err error) {
+	entry := auditEntry{Function: name, Args: args, TxID: txID, Result: string(result)}
+	if err != nil {
+		entry.Error = explainError(err).Error()
+	}
+	audit(entry)
+}
+
+// readAudit reads the entries of the audit log, oldest first
+func readAudit(path string) ([]auditEntry, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var entries []auditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("line %v of %s: %w", line, path, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+const auditUsage = "usage: audit show [--function <name>] [--tx <id>] [--failed] [--last <n>]"
+
+// auditCommand prints the audit log
+func auditCommand(args []string) error {
+	if len(args) == 0 || args[0] != "show" {
+		return errors.New(auditUsage)
+	}
+	flags := flag.NewFlagSet("audit show", flag.ContinueOnError)
+	function := flags.String("function", "", "only the transactions of this chaincode function")
+	txID := flags.String("tx", "", "only the transaction with this ID")
+	failed := flags.Bool("failed", false, "only the transactions that failed")
+	last := flags.Int("last", 0, "only the last n matching transactions, 0 for all")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *auditFile == "" {
+		return errors.New("the audit log is disabled, -audit is empty")
+	}
+	entries, err := readAudit(*auditFile)
+	if err != nil {
+		return fmt.Errorf("failed to read the audit log: %w", err)
+	}
+	var shown []auditEntry
+	for _, entry := range entries {
+		if (*function == "" || entry.Function == *function) && (*txID == "" || entry.TxID == *txID) && (!*failed || entry.Error != "") {
+			shown = append(shown, entry)
+		}
+	}
+	if *last > 0 && len(shown) > *last {
+		shown = shown[len(shown)-*last:]
+	}
+	for _, entry := range shown {
+		fmt.Println(entry)
+	}
+	return nil
+}
+
+func (e auditEntry) String() string {
+	iteration := "-"
+	if e.Iteration != nil {
+		iteration = fmt.Sprint(*e.Iteration)
+	}
+	txID := e.TxID
+	if txID == "" {
+		txID = "-"
+	}
+	outcome := "ok"
+	if e.Error != "" {
+		outcome = "FAILED: " + e.Error
+	} else if e.Result != "" {
+		outcome = "ok: " + e.Result
+	}
+	return fmt.Sprintf("%s  iteration %-4s  %s(%s)  tx %s  %s", e.Time.Format(time.RFC3339), iteration, e.Function, formatArgs(e.Args), txID, outcome)
+}
+
+func formatArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = fmt.Sprintf("%q", arg)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/dlclark/regexp2"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+var backfillUpdates = flag.Bool("backfill", false, "after a reconnect and on -resume, read the neighbors' latest updates from the chaincode with GetLatestUpdates instead of waiting for their next events")
+
+// latestUpdatesFunction returns the latest update of every organization from the world state
+const latestUpdatesFunction = "GetLatestUpdates"
+
+// ledgerUpdate is an update as GetLatestUpdates returns it: the payload of its event, the transaction and its block
+type ledgerUpdate struct {
+	Payload string `json:"payload"`
+	TxID    string `json:"txId"`
+	Block   uint64 `json:"block"`
+}
+
+// backfill reads the latest updates of the neighbors from the ledger with -backfill, so a node that was offline or
+// reconnected continues from them right away. They are passed on like received events, oldest first: the sequencer
+// drops the events of the same transactions and the older ones replayed later, and the neighbors' values are checked
+// as any other's
+func backfill(contract contractAPI, eventFilter string) []*decodedEvent {
+	if !*backfillUpdates {
+		return nil
+	}
+	events, err := latestUpdates(contract, eventFilter)
+	if err != nil {
+		countError("backfill")
+		logger.Warnf("Failed to read the latest updates of the neighbors, waiting for their events: %v", err)
+		return nil
+	}
+	logger.Infof("Read %v updates of the neighbors from the ledger", len(events))
+	progress("backfill", map[string]interface{}{"updates": len(events)})
+	return events
+}
+
+// latestUpdates queries GetLatestUpdates for the updates whose event names match the filter
+func latestUpdates(contract contractAPI, eventFilter string) ([]*decodedEvent, error) {
+	filter, err := regexp2.Compile(eventFilter, 0)
+	if err != nil {
+		return nil, err
+	}
+	result, err := contract.EvaluateTransaction(chaincodeFunction(latestUpdatesFunction))
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %w", latestUpdatesFunction, explainError(err))
+	}
+	var updates map[string]ledgerUpdate
+	if err := json.Unmarshal(result, &updates); err != nil {
+		return nil, fmt.Errorf("invalid answer of %s: %w", latestUpdatesFunction, err)
+	}
+	var events []*decodedEvent
+	for name, u := range updates {
+		name = agentEventName(name)
+		if ok, _ := filter.MatchString(name); !ok {
+			continue
+		}
+		update, err := decodePayload(u.Payload)
+		event := &client.ChaincodeEvent{EventName: name, TransactionID: u.TxID, BlockNumber: u.Block, Payload: []byte(u.Payload)}
+		events = append(events, &decodedEvent{ChaincodeEvent: event, update: update, err: err})
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].BlockNumber != events[j].BlockNumber {
+			return events[i].BlockNumber < events[j].BlockNumber
+		}
+		return events[i].EventName < events[j].EventName
+	})
+	return events, nil
+}
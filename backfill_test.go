@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLatestUpdates(t *testing.T) {
+	contract := &mockContract{respond: func(name string, args []string) ([]byte, error) {
+		return []byte(`{"Org3": {"payload": "Lambda=6.5, Mismatch=0.5, ", "txId": "tx3", "block": 12},
+			"Org2": {"payload": "Lambda=6, Mismatch=-0.25, ", "txId": "tx2", "block": 9},
+			"Org1": {"payload": "Lambda=7, Mismatch=0, ", "txId": "tx1", "block": 10}}`), nil
+	}}
+	events, err := latestUpdates(contract, "^Org[23]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contract.calls) != 1 || contract.calls[0].name != latestUpdatesFunction || contract.calls[0].submit {
+		t.Errorf("got calls %+v", contract.calls)
+	}
+	if len(events) != 2 || events[0].EventName != "Org2" || events[1].EventName != "Org3" {
+		t.Fatalf("got %v events, want Org2 and Org3 by block", len(events))
+	}
+	if u := events[0].update; events[0].err != nil || u.Lambda != 6 || u.Mismatch != -0.25 || events[0].TransactionID != "tx2" {
+		t.Errorf("got update %+v of tx %s: %v", u, events[0].TransactionID, events[0].err)
+	}
+
+	unknown := errors.New("chaincode response 500, unknown function")
+	contract = &mockContract{respond: func(name string, args []string) ([]byte, error) { return nil, unknown }}
+	if _, err := latestUpdates(contract, ""); !errors.Is(err, unknown) {
+		t.Errorf("got %v, want the error of the transaction", err)
+	}
+}
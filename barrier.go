@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// the chaincode functions of the convergence barrier: a node submits its flag with SendConvergence, and
+// GetConvergence returns the latest flag of every organization as {"Org1MSP": {"converged": true, "iteration": 42}}
+const (
+	convergenceFunction      = "SendConvergence"
+	convergenceQueryFunction = "GetConvergence"
+)
+
+// BarrierConfig makes the nodes stop together: a node that has converged locally keeps iterating until every
+// participant has reported convergence on the chain, so no node leaves while the others still depend on its updates
+type BarrierConfig struct {
+	// Participants are the MSP IDs of the organizations that have to report convergence, this node's included
+	Participants []string `json:"participants" yaml:"participants"`
+	// Rounds is the number of iterations in a row a node has to be converged locally before it reports it (default 3)
+	Rounds int `json:"rounds" yaml:"rounds"`
+}
+
+func (c BarrierConfig) validate() error {
+	if c.Rounds < 0 {
+		return errors.New("the rounds of the barrier must not be negative")
+	}
+	if c.Rounds > 0 && len(c.Participants) == 0 {
+		return errors.New("the barrier needs its participants")
+	}
+	return nil
+}
+
+// convergenceFlag is an organization's entry in the answer of GetConvergence
+type convergenceFlag struct {
+	Converged bool `json:"converged"`
+	Iteration int  `json:"iteration"`
+}
+
+// convergenceBarrier holds a converged node in the run until all participants report convergence, nil without
+// participants lets a node stop as soon as it has converged
+type convergenceBarrier struct {
+	participants []string
+	rounds       int
+	// streak is the number of iterations in a row the node has been converged locally
+	streak int
+	// reported is the flag the node submitted last
+	reported bool
+	// waiting are the participants that had not reported convergence at the last check, for the log
+	waiting []string
+}
+
+func newConvergenceBarrier(c BarrierConfig) *convergenceBarrier {
+	if len(c.Participants) == 0 {
+		return nil
+	}
+	rounds := c.Rounds
+	if rounds == 0 {
+		rounds = 3
+	}
+	return &convergenceBarrier{participants: c.Participants, rounds: rounds}
+}
+
+// reset clears a flag that is left on the chain from an earlier run, before the node starts iterating
+func (b *convergenceBarrier) reset(contract contractAPI) {
+	if b == nil {
+		return
+	}
+	b.streak = 0
+	b.reported = true
+	b.report(contract, false, 0)
+}
+
+// observe tells whether the node may stop after an iteration it converged in locally or not. The node reports its
+// convergence once it held for the rounds of the barrier and withdraws it when it ends, and it stops once every
+// participant has reported convergence
+func (b *convergenceBarrier) observe(contract contractAPI, iter int, converged bool) bool {
+	if b == nil {
+		return converged
+	}
+	if !converged {
+		b.streak = 0
+		b.report(contract, false, iter)
+		return false
+	}
+	b.streak++
+	if b.streak < b.rounds {
+		return false
+	}
+	if !b.report(contract, true, iter) {
+		return false
+	}
+	waiting, err := b.check(contract)
+	if err != nil {
+		logger.Warnf("Failed to check the convergence barrier: %s", explainError(err))
+		return false
+	}
+	if len(waiting) > 0 {
+		if fmt.Sprint(waiting) != fmt.Sprint(b.waiting) {
+			logger.Info(tr("Converged at iteration %v, waiting for %v to converge", iter, waiting))
+		}
+		b.waiting = waiting
+		return false
+	}
+	logger.Info(tr("All %v participants have converged", len(b.participants)))
+	return true
+}
+
+// report submits the flag if it changed, it returns whether the chain has it
+func (b *convergenceBarrier) report(contract contractAPI, converged bool, iter int) bool {
+	if converged == b.reported {
+		return true
+	}
+	if _, err := submitTransaction(contract, convergenceFunction, strconv.Itoa(iter), strconv.FormatBool(converged)); err != nil {
+		logger.Warnf("Failed to report the convergence to the barrier: %s", explainError(err))
+		return false
+	}
+	b.reported = converged
+	return true
+}
+
+// check returns the participants that have not reported convergence
+func (b *convergenceBarrier) check(contract contractAPI) ([]string, error) {
+	result, err := contract.EvaluateTransaction(chaincodeFunction(convergenceQueryFunction))
+	if err != nil {
+		return nil, err
+	}
+	var flags map[string]convergenceFlag
+	if err := json.Unmarshal(result, &flags); err != nil {
+		return nil, fmt.Errorf("invalid answer of %s: %w", convergenceQueryFunction, err)
+	}
+	var waiting []string
+	for _, participant := range b.participants {
+		if !flags[participant].Converged {
+			waiting = append(waiting, participant)
+		}
+	}
+	sort.Strings(waiting)
+	return waiting, nil
+}
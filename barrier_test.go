@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConvergenceBarrier(t *testing.T) {
+	flags := `{"Org1MSP": {"converged": true, "iteration": 12}, "Org2MSP": {"converged": false, "iteration": 9}}`
+	contract := &mockContract{respond: func(name string, args []string) ([]byte, error) {
+		if name == convergenceQueryFunction {
+			return []byte(flags), nil
+		}
+		return nil, nil
+	}}
+	barrier := newConvergenceBarrier(BarrierConfig{Participants: []string{"Org1MSP", "Org2MSP"}, Rounds: 2})
+	barrier.reset(contract)
+	if barrier.observe(contract, 10, true) {
+		t.Errorf("stopped after a single converged iteration")
+	}
+	if barrier.observe(contract, 11, true) {
+		t.Errorf("stopped while Org2MSP has not converged")
+	}
+	flags = `{"Org1MSP": {"converged": true, "iteration": 12}, "Org2MSP": {"converged": true, "iteration": 12}}`
+	if !barrier.observe(contract, 12, true) {
+		t.Errorf("did not stop once all participants converged")
+	}
+	var reports []string
+	for _, c := range contract.calls {
+		if c.submit {
+			reports = append(reports, strings.Join(append([]string{c.name}, c.args...), " "))
+		}
+	}
+	// the flag is submitted when it changes, not in every iteration
+	if want := []string{"SendConvergence 0 false", "SendConvergence 11 true"}; !reflect.DeepEqual(reports, want) {
+		t.Errorf("reports = %q, want %q", reports, want)
+	}
+	if newConvergenceBarrier(BarrierConfig{}).observe(contract, 1, true) != true {
+		t.Errorf("without a barrier a converged node does not stop")
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+)
+
+var watchBlocks = flag.String("watch-blocks", "", "confirm the commit of every SendUpdate from the block events, \"filtered\" or \"full\" blocks; empty to rely on the chaincode events only")
+
+// blockListener delivers the committed blocks of the channel in readable form
+type blockListener struct {
+	cancel   context.CancelFunc
+	blocks   <-chan *blockInfo
+	filtered bool
+	// next is the block after the last one delivered, a listener started again continues there
+	next uint64
+	// received is set once the listener delivered a block, a stream that keeps closing without one is given up
+	received bool
+}
+
+// listenBlocks registers for the blocks of the channel
+// filtered blocks only carry the transaction IDs, validation codes and event names, but need no access to the block contents
+func listenBlocks(gw *gatewayConnection, filtered bool, options ...client.BlockEventsOption) (*blockListener, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	network := gw.GetNetwork(gw.channel)
+	out := make(chan *blockInfo, eventBufferSize)
+	if filtered {
+		blocks, err := network.FilteredBlockEvents(ctx, options...)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		go func() {
+			defer close(out)
+			for block := range blocks {
+				select {
+				case out <- readFilteredBlock(block):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	} else {
+		blocks, err := network.BlockEvents(ctx, options...)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		go func() {
+			defer close(out)
+			for block := range blocks {
+				info, err := readBlock(block)
+				if err != nil {
+					logger.Warnf("Failed to decode block %v: %v", block.GetHeader().GetNumber(), err)
+					continue
+				}
+				select {
+				case out <- info:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	return &blockListener{cancel: cancel, blocks: out, filtered: filtered}, nil
+}
+
+// C returns the channel of the blocks, nil if there is no listener so that a select never picks it
+func (l *blockListener) C() <-chan *blockInfo {
+	if l == nil {
+		return nil
+	}
+	return l.blocks
+}
+
+// delivered notes the block handed out, for restarting after it
+func (l *blockListener) delivered(block *blockInfo) {
+	l.next = block.Number + 1
+	l.received = true
+}
+
+// restart registers again on the current connection, after the stream closed or the connection was replaced
+func (l *blockListener) restart(gw *gatewayConnection) (*blockListener, error) {
+	l.close()
+	if !l.received {
+		return nil, errors.New("the block stream closed before delivering a block")
+	}
+	var options []client.BlockEventsOption
+	if l.next > 0 {
+		options = append(options, client.WithStartBlock(l.next))
+	}
+	next, err := listenBlocks(gw, l.filtered, options...)
+	if err != nil {
+		return nil, err
+	}
+	next.next = l.next
+	return next, nil
+}
+
+func (l *blockListener) close() {
+	if l != nil {
+		l.cancel()
+	}
+}
+
+// startBlockWatch starts the listener selected with -watch-blocks, nil if it is disabled or fails
+func startBlockWatch(gw *gatewayConnection) *blockListener {
+	if *watchBlocks == "" {
+		return nil
+	}
+	if *watchBlocks != "filtered" && *watchBlocks != "full" {
+		logger.Warnf("Unknown -watch-blocks %q, use filtered or full", *watchBlocks)
+		return nil
+	}
+	listener, err := listenBlocks(gw, *watchBlocks == "filtered")
+	if err != nil {
+		logger.Warnf("Failed to register for block events, commits are not confirmed: %v", err)
+		return nil
+	}
+	return listener
+}
+
+func readFilteredBlock(block *peer.FilteredBlock) *blockInfo {
+	info := &blockInfo{Number: block.Number}
+	for _, tx := range block.FilteredTransactions {
+		t := txInfo{
+			TxID:           tx.Txid,
+			Channel:        block.ChannelId,
+			Type:           tx.Type.String(),
+			ValidationCode: tx.TxValidationCode.String(),
+		}
+		for _, action := range tx.GetTransactionActions().GetChaincodeActions() {
+			if event := action.ChaincodeEvent; event != nil {
+				t.Chaincode = event.ChaincodeId
+				t.Events = append(t.Events, eventInfo{Name: event.EventName})
+			}
+		}
+		info.Transactions = append(info.Transactions, t)
+	}
+	return info
+}
+
+// commitTracker follows the updates submitted by this node until they show up in a block
+type commitTracker struct {
+	// pending maps the transaction IDs to the iteration of the update
+	pending map[string]int
+}
+
+func newCommitTracker() *commitTracker {
+	return &commitTracker{pending: map[string]int{}}
+}
+
+func (t *commitTracker) submitted(txID string, iter int) {
+	if txID != "" {
+		t.pending[txID] = iter
+	}
+}
+
+// confirm reports the updates committed in the block
+func (t *commitTracker) confirm(block *blockInfo) {
+	for _, tx := range block.Transactions {
+		iter, ok := t.pending[tx.TxID]
+		if !ok {
+			continue
+		}
+		delete(t.pending, tx.TxID)
+		progress("committed", map[string]interface{}{"iteration": iter, "txId": tx.TxID, "block": block.Number, "validationCode": tx.ValidationCode})
+		if tx.ValidationCode != peer.TxValidationCode_VALID.String() {
+			countError("commit")
+			logger.Warnf("The update of iteration %v (tx %s) was invalidated in block %v: %s", iter, tx.TxID, block.Number, tx.ValidationCode)
+			continue
+		}
+		logger.Infof("The update of iteration %v is committed in block %v", iter, block.Number)
+	}
+}
+
+// blocksCommand prints the blocks of the channel as they are committed, until interrupted
+func blocksCommand(gw *gatewayConnection, args []string) error {
+	flags := flag.NewFlagSet("blocks", flag.ContinueOnError)
+	filtered := flags.Bool("filtered", false, "print filtered blocks, which need no access to the block contents")
+	start := flags.Int64("start", -1, "print the blocks from this one on instead of the newest")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	var options []client.BlockEventsOption
+	if *start >= 0 {
+		options = append(options, client.WithStartBlock(uint64(*start)))
+	}
+	listener, err := listenBlocks(gw, *filtered, options...)
+	if err != nil {
+		return fmt.Errorf("failed to register for block events: %w", explainError(err))
+	}
+	defer listener.close()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	for {
+		select {
+		case block, ok := <-listener.C():
+			if !ok {
+				return fmt.Errorf("the block stream was closed")
+			}
+			if err := printJSON(block); err != nil {
+				return err
+			}
+		case <-interrupt:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// the Fabric CA serves its REST API under this path
+const caAPIPath = "/api/v1/"
+
+// CAConfig is the Fabric CA the identities are enrolled with, the cryptogen folders are read without it
+type CAConfig struct {
+	// URL of the CA, e.g. https://ca.org1.example.com:7054
+	URL string `json:"url" yaml:"url"`
+	// Name selects one of several CAs served by the same server (default: the server's default CA)
+	Name string `json:"name" yaml:"name"`
+	// TLSCert verifies the CA's TLS certificate instead of the system roots, relative paths are taken relative to CryptoPath
+	TLSCert string `json:"tlsCert" yaml:"tlsCert"`
+	// EnrollmentID and EnrollmentSecret enroll the user, the CA_ENROLLMENT_SECRET environment variable overrides the secret
+	EnrollmentID     string `json:"enrollmentId" yaml:"enrollmentId"`
+	EnrollmentSecret string `json:"enrollmentSecret" yaml:"enrollmentSecret"`
+}
+
+// secret returns the enrollment secret, preferring the CA_ENROLLMENT_SECRET environment variable
+func (c CAConfig) secret() string {
+	if secret := os.Getenv("CA_ENROLLMENT_SECRET"); secret != "" {
+		return secret
+	}
+	return c.EnrollmentSecret
+}
+
+// caResponse is the envelope of every answer of the CA
+type caResponse struct {
+	Success bool            `json:"success"`
+	Result  json.RawMessage `json:"result"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// caError is an error the CA answered with, a wrong secret or a refused registration is not retried
+type caError struct {
+	status  int
+	message string
+}
+
+func (e *caError) Error() string {
+	return fmt.Sprintf("the CA answered %d: %s", e.status, e.message)
+}
+
+// caClient talks to the REST API of a Fabric CA
+type caClient struct {
+	config CAConfig
+	http   *http.Client
+}
+
+func newCAClient(config CAConfig) (*caClient, error) {
+	if config.URL == "" {
+		return nil, errors.New("no CA is configured, set the url of the ca section")
+	}
+	transport := &http.Transport{}
+	if config.TLSCert != "" {
+		pem, err := os.ReadFile(filepath.Clean(cfg.cryptoFile(config.TLSCert, "")))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the TLS certificate of the CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("invalid TLS certificate of the CA %s", config.TLSCert)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &caClient{config: config, http: &http.Client{Transport: transport, Timeout: 30 * time.Second}}, nil
+}
+
+// enroll obtains a certificate for the enrollment ID with a new private key, returned as a wallet identity
+func (c *caClient) enroll(mspID string, enrollmentID string, secret string) (*walletIdentity, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: enrollmentID}}, key)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(map[string]string{
+		"certificate_request": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		"caname":              c.config.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(http.MethodPost, c.url("enroll"), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.SetBasicAuth(enrollmentID, secret)
+	var result struct {
+		Cert string `json:"Cert"`
+	}
+	if err := c.do(request, &result); err != nil {
+		return nil, err
+	}
+	cert, err := base64.StdEncoding.DecodeString(result.Cert)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate from the CA: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return newX509Identity(mspID, string(cert), string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))), nil
+}
+
+// registration is a new identity registered with the CA
+type registration struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Secret      string `json:"secret,omitempty"`
+	Affiliation string `json:"affiliation"`
+	CAName      string `json:"caname,omitempty"`
+}
+
+// register registers a new identity on behalf of the registrar, an identity of the wallet allowed to register, and returns its secret
+func (c *caClient) register(registrar *walletIdentity, r registration) (string, error) {
+	r.CAName = c.config.Name
+	body, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	request, err := http.NewRequest(http.MethodPost, c.url("register"), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	token, err := authToken(registrar, request.Method, request.URL.RequestURI(), body)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign the request with the registrar's identity: %w", err)
+	}
+	request.Header.Set("Authorization", token)
+	var result struct {
+		Secret string `json:"secret"`
+	}
+	if err := c.do(request, &result); err != nil {
+		return "", err
+	}
+	return result.Secret, nil
+}
+
+// authToken is the token authenticating a request with an enrolled identity: its certificate and its signature over the request
+func authToken(id *walletIdentity, method string, uri string, body []byte) (string, error) {
+	_, sign, release, err := signingIdentity(id)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	b64 := base64.StdEncoding.EncodeToString
+	cert := b64([]byte(id.Credentials.Certificate))
+	digest := sha256.Sum256([]byte(method + "." + b64([]byte(uri)) + "." + b64(body) + "." + cert))
+	signature, err := sign(digest[:])
+	if err != nil {
+		return "", err
+	}
+	return cert + "." + b64(signature), nil
+}
+
+func (c *caClient) url(endpoint string) string {
+	return strings.TrimSuffix(c.config.URL, "/") + caAPIPath + endpoint
+}
+
+// do sends a request to the CA and reads the result of its answer
+func (c *caClient) do(request *http.Request, result interface{}) error {
+	request.Header.Set("Content-Type", "application/json")
+	response, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	var answer caResponse
+	if err := json.Unmarshal(data, &answer); err != nil {
+		return &caError{response.StatusCode, strings.TrimSpace(string(data))}
+	}
+	if !answer.Success {
+		var messages []string
+		for _, e := range answer.Errors {
+			messages = append(messages, e.Message)
+		}
+		return &caError{response.StatusCode, strings.Join(messages, "; ")}
+	}
+	return json.Unmarshal(answer.Result, result)
+}
+
+// enrollWithRetry enrolls the configured user, retrying while the CA can't be reached, e.g. on a device that has just booted
+func enrollWithRetry(mspID string, config CAConfig) (*walletIdentity, error) {
+	client, err := newCAClient(config)
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 0; ; attempt++ {
+		id, err := client.enroll(mspID, config.EnrollmentID, config.secret())
+		var refused *caError
+		if err == nil || errors.As(err, &refused) || attempt >= *retryMax {
+			return id, err
+		}
+		delay := retryDelay(attempt)
+		logger.Warnf("Failed to reach the CA, retrying in %s: %v", delay.Round(time.Millisecond), err)
+		time.Sleep(delay)
+	}
+}
+
+// walletEnroll enrolls an identity with the configured CA and stores it in the wallet
+func walletEnroll(wallet *fileWallet, args []string) error {
+	flags := flag.NewFlagSet("wallet enroll", flag.ContinueOnError)
+	label := flags.String("label", cfg.UserName, "label of the identity in the wallet")
+	id := flags.String("id", cfg.CA.EnrollmentID, "enrollment ID")
+	// the secret of the config is not the default of the flag, which would print it with the usage
+	secret := flags.String("secret", "", "enrollment secret (default: ca.enrollmentSecret or CA_ENROLLMENT_SECRET)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	config := cfg.CA
+	config.EnrollmentID = *id
+	if *secret != "" {
+		config.EnrollmentSecret = *secret
+	}
+	identity, err := enrollWithRetry(cfg.MSPID, config)
+	if err != nil {
+		return fmt.Errorf("failed to enroll %s: %w", *id, err)
+	}
+	if err := wallet.put(*label, identity); err != nil {
+		return err
+	}
+	logger.Info(tr("Successfully added user %s to wallet!", *label))
+	return nil
+}
+
+// walletRegister registers a new identity with the configured CA and prints its secret
+func walletRegister(wallet *fileWallet, args []string) error {
+	flags := flag.NewFlagSet("wallet register", flag.ContinueOnError)
+	registrarLabel := flags.String("registrar", "admin", "label of the wallet identity allowed to register, e.g. the enrolled CA admin")
+	secret := flags.String("secret", "", "secret of the new identity (default: generated by the CA)")
+	idType := flags.String("type", "client", "type of the new identity")
+	affiliation := flags.String("affiliation", "", "affiliation of the new identity, e.g. org1.department1")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New(walletUsage)
+	}
+	registrar, err := wallet.get(*registrarLabel)
+	if err != nil {
+		return fmt.Errorf("failed to get the registrar %s from the wallet: %w", *registrarLabel, err)
+	}
+	client, err := newCAClient(cfg.CA)
+	if err != nil {
+		return err
+	}
+	registered, err := client.register(registrar, registration{ID: flags.Arg(0), Type: *idType, Secret: *secret, Affiliation: *affiliation})
+	if err != nil {
+		return fmt.Errorf("failed to register %s: %w", flags.Arg(0), err)
+	}
+	fmt.Println(registered)
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+var certWatchInterval = flag.Duration("cert-watch-interval", 30*time.Second, "how often the user certificate is checked for renewal, 0 disables the check")
+
+// certWatcher notices when the certificate file is replaced
+type certWatcher struct {
+	path    string
+	modTime time.Time
+}
+
+func newCertWatcher(path string) *certWatcher {
+	w := &certWatcher{path: filepath.Clean(path)}
+	if info, err := os.Stat(w.path); err == nil {
+		w.modTime = info.ModTime()
+	}
+	return w
+}
+
+// changed returns true once for every renewal of the certificate
+func (w *certWatcher) changed() bool {
+	info, err := os.Stat(w.path)
+	if err != nil || !info.ModTime().After(w.modTime) {
+		return false
+	}
+	w.modTime = info.ModTime()
+	return true
+}
+
+// certTicker returns the channel the certificate checks are triggered by, nil if they are disabled
+func certTicker() <-chan time.Time {
+	if *certWatchInterval <= 0 {
+		return nil
+	}
+	return time.NewTicker(*certWatchInterval).C
+}
+
+// liveConnection is everything that has to be swapped when the identity changes
+type liveConnection struct {
+	gw       *gatewayConnection
+	contract *client.Contract
+	reg      context.CancelFunc
+	notifier <-chan *decodedEvent
+}
+
+// reloadIdentity puts the renewed certificate into the wallet and opens a new connection with it, registered for the same events
+// the caller keeps using the old connection if it fails
+func (c Config) reloadIdentity(wallet *fileWallet, eventFilter string) (*liveConnection, error) {
+	logger.Info("reloading the renewed certificate")
+	if err := c.populateWallet(wallet); err != nil {
+		return nil, err
+	}
+	return c.openConnection(wallet, eventFilter)
+}
+
+// openConnection opens a new gateway connection registered for the events, continuing from the last checkpointed event
+func (c Config) openConnection(wallet *fileWallet, eventFilter string) (*liveConnection, error) {
+	gw, contract, err := c.connect(wallet)
+	if err != nil {
+		return nil, err
+	}
+	reg, notifier, err := registerDecoded(gw, eventFilter, replayOptions()...)
+	if err != nil {
+		gw.Close()
+		return nil, err
+	}
+	return &liveConnection{gw: gw, contract: contract, reg: reg, notifier: notifier}, nil
+}
+
+// swap drains the events still buffered on the old connection into the pending list and closes it
+func (c *liveConnection) swap(old *liveConnection, pending []*decodedEvent) []*decodedEvent {
+	old.reg()
+	// the channel is closed once the registration is cancelled and the events received before are decoded
+	for event := range old.notifier {
+		pending = append(pending, event)
+	}
+	old.gw.Close()
+	logger.Infof("Switched to the new connection to peer %s", c.gw.peer.Name)
+	return pending
+}
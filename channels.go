@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var channelName = flag.String("channel", "", "run the optimization of this entry of the channels in the config file only; without it every listed channel runs in its own process")
+
+// ChannelConfig is one channel and contract of a multi-microgrid deployment, each runs an optimization of its own
+type ChannelConfig struct {
+	// Name identifies the channel in the logs and is the default directory
+	Name string `json:"name" yaml:"name"`
+	// NetworkName, ContractName and EventFilter replace the top-level settings for this channel
+	NetworkName  string `json:"networkName" yaml:"networkName"`
+	ContractName string `json:"contractName" yaml:"contractName"`
+	EventFilter  string `json:"eventFilter" yaml:"eventFilter"`
+	// Directory keeps the checkpoints, statistics and wallet of the channel apart from the others (default: Name)
+	Directory string `json:"directory" yaml:"directory"`
+	// Args are further flags of this channel's agent, e.g. a port of its own for -serve or -metrics-addr
+	Args []string `json:"args" yaml:"args"`
+}
+
+// validateChannels checks that every channel can be told apart
+func validateChannels(channels []ChannelConfig) error {
+	seen := map[string]bool{}
+	for _, c := range channels {
+		if c.Name == "" {
+			return fmt.Errorf("a channel has no name")
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("channel %s is listed twice", c.Name)
+		}
+		seen[c.Name] = true
+	}
+	return nil
+}
+
+// selectChannel switches the configuration to a channel from the channels list
+func (c *Config) selectChannel(name string) (ChannelConfig, error) {
+	for _, channel := range c.Channels {
+		if channel.Name != name {
+			continue
+		}
+		if channel.NetworkName != "" {
+			c.NetworkName = channel.NetworkName
+		}
+		if channel.ContractName != "" {
+			c.ContractName = channel.ContractName
+		}
+		if channel.EventFilter != "" {
+			c.EventFilter, c.Events = channel.EventFilter, nil
+		}
+		if channel.Directory == "" {
+			channel.Directory = channel.Name
+		}
+		return channel, nil
+	}
+	return ChannelConfig{}, fmt.Errorf("unknown channel %q", name)
+}
+
+// enterChannelDirectory moves into the directory of the channel, so its files don't clash with the other channels'
+// the crypto material stays where the configuration points to
+func enterChannelDirectory(channel ChannelConfig) error {
+	cryptoPath, err := filepath.Abs(cfg.CryptoPath)
+	if err != nil {
+		return err
+	}
+	cfg.CryptoPath = cryptoPath
+	if err := os.MkdirAll(channel.Directory, 0700); err != nil {
+		return err
+	}
+	return os.Chdir(channel.Directory)
+}
+
+// runChannels runs the agent of every channel in a process of its own until all have ended, false if any of them failed
+// the agents share no state, so a failing channel doesn't stop the others; on SIGINT or SIGTERM all of them are stopped
+func runChannels(channels []ChannelConfig) bool {
+	executable, err := os.Executable()
+	if err != nil {
+		logger.Errorf("Failed to find the agent executable: %v", err)
+		return false
+	}
+	var wg sync.WaitGroup
+	failed := make(chan string, len(channels))
+	for _, channel := range channels {
+		wg.Add(1)
+		go func(channel ChannelConfig) {
+			defer wg.Done()
+			if err := runChannel(executable, channel); err != nil {
+				logger.Errorf("The agent of channel %s failed: %v", channel.Name, err)
+				failed <- channel.Name
+			}
+		}(channel)
+	}
+	wg.Wait()
+	close(failed)
+	return len(failed) == 0
+}
+
+// runChannel starts the agent of a channel with the flags of this one and waits for it to end
+func runChannel(executable string, channel ChannelConfig) error {
+	args := append(append([]string{}, os.Args[1:]...), "-channel", channel.Name)
+	if *configFile != "" {
+		// the agent runs in the channel's directory
+		path, err := filepath.Abs(*configFile)
+		if err != nil {
+			return err
+		}
+		args = append(args, "-config", path)
+	}
+	cmd := exec.Command(executable, append(args, channel.Args...)...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	var copying sync.WaitGroup
+	copying.Add(2)
+	go copyLines(&copying, os.Stdout, stdout, channel.Name)
+	go copyLines(&copying, os.Stderr, stderr, channel.Name)
+
+	ctx, stop := shutdownContext()
+	defer stop()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	logger.Infof("Started the agent of channel %s", channel.Name)
+	done := make(chan error, 1)
+	go func() {
+		// the output is read to the end before Wait closes the pipes
+		copying.Wait()
+		done <- cmd.Wait()
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// the agent shuts down as on Ctrl-C: it unregisters, saves its state and closes the gateway
+		if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+			logger.Warnf("Failed to stop the agent of channel %s: %v", channel.Name, err)
+		}
+		err = <-done
+	}
+	return err
+}
+
+// the longest line of a channel's agent copied, e.g. a JSON report with many iterations
+const maxChannelLine = 16 << 20
+
+// copyLines copies the output of a channel's agent line by line, each line marked with the channel
+// a JSON object, e.g. a -progress ndjson record, gets the channel as its "channel" field, so the output stays ndjson
+func copyLines(wg *sync.WaitGroup, w io.Writer, r io.Reader, channel string) {
+	defer wg.Done()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxChannelLine)
+	for scanner.Scan() {
+		fmt.Fprintln(w, markLine(scanner.Text(), channel))
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Warnf("Stopped copying the output of channel %s: %v", channel, err)
+		// the agent would block writing to a full pipe
+		_, _ = io.Copy(io.Discard, r)
+	}
+}
+
+// markLine marks a line of a channel's agent with the channel
+func markLine(line, channel string) string {
+	if !strings.HasPrefix(line, "{") || !json.Valid([]byte(line)) {
+		return "[" + channel + "] " + line
+	}
+	name, _ := json.Marshal(channel)
+	field := `{"channel":` + string(name)
+	if rest := strings.TrimSpace(line[1:]); rest != "}" {
+		field += ","
+	}
+	return field + line[1:]
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCopyLines(t *testing.T) {
+	long := `{"event":"report","iterations":"` + strings.Repeat("x", 100*1024) + `"}`
+	input := "Started\n" + `{"event":"iteration","lambda":6.5}` + "\n{}\n" + long + "\n"
+	var out bytes.Buffer
+	var wg sync.WaitGroup
+	wg.Add(1)
+	copyLines(&wg, &out, strings.NewReader(input), "grid1")
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 4 || lines[0] != "[grid1] Started" {
+		t.Fatalf("got %d lines, first %q", len(lines), lines[0])
+	}
+	for _, line := range lines[1:] {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil || record["channel"] != "grid1" {
+			t.Errorf("%.60s: got %v, %v", line, record["channel"], err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+)
+
+var (
+	checkpointFile = flag.String("checkpoint", "checkpoint.json", "file the optimization state is written to after every update, empty to disable checkpoints")
+	resume         = flag.Bool("resume", false, "continue the optimization from the -checkpoint file of a run that did not converge")
+)
+
+// saveCheckpoint replaces the checkpoint with the current state, the file is written next to it first so a crash never leaves half a checkpoint
+func saveCheckpoint(state optimizationState) error {
+	if *checkpointFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := *checkpointFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, *checkpointFile)
+}
+
+// loadCheckpoint reads the state saved by the last run
+func loadCheckpoint() (optimizationState, error) {
+	var state optimizationState
+	data, err := os.ReadFile(filepath.Clean(*checkpointFile))
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// clearCheckpoint removes the checkpoint once the run has converged, there is nothing to resume then
+func clearCheckpoint() error {
+	if *checkpointFile == "" {
+		return nil
+	}
+	if err := os.Remove(*checkpointFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
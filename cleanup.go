@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var keepWallet = flag.Bool("keep-wallet", envBool("AGENT_KEEP_WALLET"), "keep the wallet when cleaning up, for identities that persist between runs (env AGENT_KEEP_WALLET)")
+
+// dataDir returns the folder the wallet and the keystore have to lie in to be cleaned up, the working directory by default
+func (c Config) dataDir() string {
+	if c.DataDir == "" {
+		return "."
+	}
+	return c.DataDir
+}
+
+// cleanupTargets returns the folders a cleanup removes, those that exist
+// it fails for a folder outside the data directory, so a wrong path in the config can't remove anything else
+func (c Config) cleanupTargets() ([]string, error) {
+	paths := []string{c.KeystorePath}
+	if !*keepWallet {
+		paths = append([]string{c.WalletPath}, paths...)
+	}
+	var targets []string
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			continue
+		}
+		inside, err := insideDir(c.dataDir(), path)
+		if err != nil {
+			return nil, err
+		}
+		if !inside {
+			return nil, fmt.Errorf("%s is not inside the data directory %s, it is not removed", path, c.dataDir())
+		}
+		targets = append(targets, path)
+	}
+	return targets, nil
+}
+
+// insideDir tells whether path lies below dir, after resolving symbolic links; dir itself is not inside
+func insideDir(dir, path string) (bool, error) {
+	base, err := resolvePath(dir)
+	if err != nil {
+		return false, err
+	}
+	target, err := resolvePath(path)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return false, nil
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
+
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// printCleanup lists what a cleanup removes
+func printCleanup(targets []string) {
+	if len(targets) == 0 {
+		fmt.Fprintln(display(), tr("There is nothing to clean up"))
+		return
+	}
+	fmt.Fprintln(display(), tr("Cleaning up removes:"))
+	for _, target := range targets {
+		fmt.Fprintln(display(), "  "+target)
+	}
+}
+
+// cleanUp removes the wallet and the keystore, the wallet is kept with -keep-wallet
+func cleanUp() error {
+	targets, err := cfg.cleanupTargets()
+	if err != nil {
+		return err
+	}
+	logger.Info(tr("Cleaning up wallet..."))
+	for _, target := range targets {
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+	}
+	logger.Info(tr("Wallet cleaned up successfully"))
+	return nil
+}
+
+// cleanupCommand runs "cleanup [--dry-run]"
+func cleanupCommand(args []string) error {
+	flags := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only list what would be removed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errors.New("usage: cleanup [--dry-run]")
+	}
+	if *dryRun {
+		targets, err := cfg.cleanupTargets()
+		if err != nil {
+			return err
+		}
+		printCleanup(targets)
+		return nil
+	}
+	return cleanUp()
+}
+
+// offerCleanup lists what a cleanup would remove at the end of a run and removes it if the user agrees
+func offerCleanup() {
+	targets, err := cfg.cleanupTargets()
+	if err != nil {
+		logger.Warnf("Not cleaning up: %v", err)
+		return
+	}
+	if len(targets) == 0 {
+		return
+	}
+	printCleanup(targets)
+	if confirm(tr("Clean up? [y/n]"), *autoCleanup) {
+		if err := cleanUp(); err != nil {
+			logger.Errorf("Failed to clean up: %v", err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// command is a subcommand run instead of the interactive optimization, e.g. "app invoke SendUpdate 1.6 0"
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+// subcommands is filled in init because the help command lists them, which would make the initialization refer to itself
+var subcommands []command
+
+func init() {
+	subcommands = []command{
+		{"listen", "listen [--event <filter>]", "print the chaincode events matching the filter until interrupted", listenCommand},
+		{"submit", "submit <lambda> <mismatch>", "submit one consensus update with SendUpdate", submitCommand},
+		{"invoke", "invoke " + invocationUsage, "submit a transaction, or only evaluate it with --evaluate, and print the result", invokeCommand},
+		{"repl", "repl", "invoke functions line by line, with history and completion of the chaincode's functions", connected(func(gw *gatewayConnection, contract *client.Contract, args []string) error {
+			return replCommand(contract, args)
+		})},
+		{"wallet", "wallet populate | list | add | remove | export | import", "manage the identities in the wallet, wallet help for details", walletCommand},
+		{"cleanup", "cleanup [--dry-run]", "remove the wallet and the keystore, or only list them with --dry-run", cleanupCommand},
+		{"state", "state get <key> | all | query <selector>", "read the world state", connected(func(gw *gatewayConnection, contract *client.Contract, args []string) error {
+			return stateCommand(contract, args)
+		})},
+		{"contract", "contract functions | events | describe", "list the functions or events of the chaincode, or describe its transactions and their parameters", connected(func(gw *gatewayConnection, contract *client.Contract, args []string) error {
+			return contractCommand(contract, args)
+		})},
+		{"block", "block get <number>", "print a block of the channel", connected(func(gw *gatewayConnection, contract *client.Contract, args []string) error {
+			return blockCommand(gw, args)
+		})},
+		{"tx", "tx get <id>", "print a transaction of the channel", connected(func(gw *gatewayConnection, contract *client.Contract, args []string) error {
+			return txCommand(gw, args)
+		})},
+		{"blocks", "blocks [--filtered] [--start <number>]", "print the blocks of the channel as they are committed", connected(func(gw *gatewayConnection, contract *client.Contract, args []string) error {
+			return blocksCommand(gw, args)
+		})},
+		{"audit", "audit show [--function <name>] [--tx <id>] [--failed] [--last <n>]", "print the submitted transactions recorded in the audit log", auditCommand},
+		{"runs", "runs list [--last <n>] | runs show <id>", "list the runs recorded in the -runs-db database, or show one with its parameters, iterations and transactions", runsCommand},
+		{"doctor", "doctor", "check the identity, gateway, channel, contract and event registration without submitting", doctorCommand},
+		{"experiment", "experiment run <scenarios.yaml> [--report <file>]", "sweep step sizes, tolerances and network sizes in the simulator or the live network and report the convergence", experimentCommand},
+		{"record", recordUsage, "write the chaincode events matching the filter to a JSON lines or CSV file until interrupted", recordCommand},
+		{"trace", traceUsage, "replay the captured events of a run without a network and compare the iterations with a golden trace", traceCommand},
+		{"parse", "parse --sample <payload>", "decode an event payload like a neighbor's and print the fields read from it", parseCommand},
+		{"version", "version [--check]", "print the version of the build, with --check also check those of the chaincode and the peer", versionCommand},
+		{"help", "help", "list the commands", helpCommand},
+	}
+}
+
+// runCommand runs a one-shot command given on the command line instead of the optimization
+func runCommand(args []string) error {
+	for _, c := range subcommands {
+		if c.name == args[0] {
+			return c.run(args[1:])
+		}
+	}
+	return fmt.Errorf("unknown command %q, run help for the list of commands", args[0])
+}
+
+// connected wraps a command that needs the gateway connection, the connection is closed when the command returns
+func connected(run func(gw *gatewayConnection, contract *client.Contract, args []string) error) func(args []string) error {
+	return func(args []string) error {
+		wallet, err := cfg.openWallet()
+		if err != nil {
+			return err
+		}
+		gw, contract, err := cfg.connect(wallet)
+		if err != nil {
+			return err
+		}
+		defer gw.Close()
+		learnEndorsementPolicy(gw)
+		return run(gw, contract, args)
+	}
+}
+
+func helpCommand(args []string) error {
+	fmt.Println("usage: app [options] [command]")
+	fmt.Println("without a command the interactive optimization runs, see app -h for the options")
+	fmt.Println()
+	for _, c := range subcommands {
+		fmt.Printf("  %-42s %s\n", c.usage, c.summary)
+	}
+	return nil
+}
+
+func listenCommand(args []string) error {
+	flags := flag.NewFlagSet("listen", flag.ContinueOnError)
+	eventFilter := flags.String("event", cfg.eventFilter(), "regular expression selecting the events to print")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return connected(func(gw *gatewayConnection, contract *client.Contract, args []string) error {
+		reg, notifier, err := registerEvents(gw, *eventFilter)
+		if err != nil {
+			return fmt.Errorf("failed to register contract event: %w", explainError(err))
+		}
+		defer reg()
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		defer signal.Stop(interrupt)
+		for {
+			select {
+			case event, ok := <-notifier:
+				if !ok || event == nil {
+					return fmt.Errorf("the event stream was closed")
+				}
+				fmt.Println(tr("Event %s in block %v (tx %s): %s", event.EventName, event.BlockNumber, event.TransactionID, string(event.Payload)))
+				progress("event", map[string]interface{}{"name": event.EventName, "block": event.BlockNumber, "txId": event.TransactionID, "payload": string(event.Payload)})
+			case <-interrupt:
+				return nil
+			}
+		}
+	})(flags.Args())
+}
+
+func submitCommand(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: submit <lambda> <mismatch>")
+	}
+	lambda, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return fmt.Errorf("invalid lambda %q", args[0])
+	}
+	mismatch, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return fmt.Errorf("invalid mismatch %q", args[1])
+	}
+	return connected(func(gw *gatewayConnection, contract *client.Contract, _ []string) error {
+		args := updateArgs(gw, lambda, mismatch, *runID, -1)
+		name := chaincodeFunction("SendUpdate")
+		result, txID, err := submitAsync(contract, name, append(endorsementOptions("SendUpdate"), client.WithArguments(cfg.Contract.updateArguments(args, 0, *runID)...))...)
+		auditInvocation(name, args, txID, result, err)
+		if err != nil {
+			return fmt.Errorf("failed to submit transaction: %w", explainError(err))
+		}
+		progress("submitted", map[string]interface{}{"lambda": args[0], "mismatch": args[1], "txId": txID})
+		return nil
+	})(nil)
+}
+
+func invokeCommand(args []string) error {
+	call, err := parseInvocation("invoke", args)
+	if err != nil {
+		return err
+	}
+	return connected(func(gw *gatewayConnection, contract *client.Contract, _ []string) error {
+		// a chaincode that publishes its metadata has the arguments checked before anything is sent
+		if metadata, err := fetchMetadata(contract); err == nil {
+			if err := metadata.check(call.function, call.args); err != nil {
+				return err
+			}
+		}
+		return call.run(contract)
+	})(nil)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+)
+
+// the ways the submission queue waits for the commits of the updates, selected with -commit-wait
+const (
+	commitWaitSync  = "sync"
+	commitWaitAsync = "async"
+)
+
+var commitWait = flag.String("commit-wait", commitWaitSync, "how the updates wait for their commit: \"sync\" waits for the commit status before the next update is submitted, \"async\" tracks the commits in the background while the next updates are submitted")
+
+func validateCommitWait() error {
+	switch *commitWait {
+	case commitWaitSync, commitWaitAsync:
+		return nil
+	}
+	return fmt.Errorf("invalid -commit-wait %q, use %s or %s", *commitWait, commitWaitSync, commitWaitAsync)
+}
+
+// commitError is a transaction that was ordered but invalidated by the peers, its validation code tells why
+type commitError struct {
+	txID string
+	code peer.TxValidationCode
+}
+
+func (e *commitError) Error() string {
+	return fmt.Sprintf("transaction %s failed to commit with status code %d (%s)", e.txID, int32(e.code), e.code)
+}
+
+// invalidated tells whether the error is a validation code of the peers, a transaction with one can't be sent again
+// as it is but has to be endorsed anew
+func invalidated(err error) bool {
+	var invalid *commitError
+	return errors.As(err, &invalid)
+}
+
+// orderedTransaction is a transaction the orderer has accepted, its commit is still to come
+type orderedTransaction struct {
+	txID string
+	// result is the response of the chaincode
+	result []byte
+	commit *client.Commit
+	// ordered is when the orderer accepted the transaction, zero if it didn't
+	ordered time.Time
+	// signed is the signed transaction, sent again as it is if its commit status can't be had
+	signed []byte
+}
+
+// orderPrepared endorses a transaction and sends it to the orderer, without waiting for its commit
+// prepared is the transaction of an earlier attempt, which is sent again as it is; with nil a new one is endorsed.
+// The transaction to send on the next attempt is returned, nil if nothing reached the orderer
+func orderPrepared(own *ownTransactions, gw *gatewayConnection, contract *client.Contract, prepared []byte, name string, args ...string) (*orderedTransaction, []byte, error) {
+	var transaction *client.Transaction
+	var err error
+	if prepared != nil {
+		transaction, err = gw.NewTransaction(prepared)
+	} else {
+		var proposal *client.Proposal
+		if proposal, err = contract.NewProposal(chaincodeFunction(name), append(endorsementOptions(name), client.WithArguments(args...))...); err == nil {
+			transaction, err = proposal.Endorse()
+		}
+	}
+	if err != nil {
+		// nothing reached the orderer, the next attempt endorses again
+		return &orderedTransaction{}, nil, err
+	}
+	tx := &orderedTransaction{txID: transaction.TransactionID(), result: transaction.Result()}
+	// the event of our own update must not be taken for a neighbor's
+	own.sent(tx.txID)
+	// the transaction is signed by now, sent again it is committed at most once
+	if tx.signed, err = transaction.Bytes(); err != nil {
+		tx.signed = nil
+	}
+	if tx.commit, err = transaction.Submit(); err != nil {
+		return tx, tx.signed, err
+	}
+	tx.ordered = time.Now()
+	return tx, tx.signed, nil
+}
+
+// wait waits for the commit status of the transaction, an invalidated transaction returns a commitError with its
+// validation code
+func (t *orderedTransaction) wait() error {
+	status, err := t.commit.Status()
+	if err != nil {
+		return err
+	}
+	commitStatuses.WithLabelValues(status.Code.String()).Inc()
+	if !status.Successful {
+		return &commitError{txID: t.txID, code: status.Code}
+	}
+	return nil
+}
+
+// pendingCommit is a batch of updates whose transaction was ordered, waiting for its commit with -commit-wait async
+type pendingCommit struct {
+	batch []*submission
+	// sent is the submission that carries the batch
+	sent    *submission
+	tx      *orderedTransaction
+	err     error
+	started time.Time
+}
+
+// commitLoop waits for the commits of the ordered transactions in their order and reports their results, it ends when
+// the worker closes the commits
+// A transaction the peers invalidated is endorsed and submitted again if its failure is one of -retry-codes, unless
+// a later update was ordered meanwhile: that one supersedes it, so the neighbors never see an older update last
+func (q *submitQueue) commitLoop() {
+	for p := range q.commits {
+		queueDepth.WithLabelValues("commit").Set(float64(len(q.commits)))
+		superseded := false
+		if p.err == nil && q.ctx.Err() != nil {
+			// the queue was closed, the commit is no longer awaited
+			p.err = q.ctx.Err()
+		}
+		if p.err == nil {
+			if p.err = p.tx.wait(); p.err != nil {
+				retry, _ := transientFailure(p.err)
+				switch {
+				case invalidated(p.err) && len(q.commits) > 0:
+					superseded = true
+				case invalidated(p.err) && retry:
+					logger.Warnf("The update of iteration %v was invalidated, submitting it again: %s", p.sent.iteration, explainError(p.err))
+					p.tx, p.err = q.submit(p.sent, nil, true)
+				case !invalidated(p.err):
+					// the commit status couldn't be had, the transaction is sent again as it is
+					p.tx, p.err = q.submit(p.sent, p.tx.signed, true)
+				}
+			}
+		}
+		q.report(p.batch, p.tx, p.err, p.started, superseded)
+	}
+}
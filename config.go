@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	configFile   = flag.String("config", "", "YAML or JSON file with the connection settings (default: the Org1 user of the fabric-samples test network)")
+	organization = flag.String("org", "", "organization to run as, e.g. Org2, taken from the organizations of the config file or the test network")
+)
+
+// Identity holds the settings that differ between the organizations of a network
+type Identity struct {
+	// CryptoPath is the organization folder generated by cryptogen or the CA
+	CryptoPath string `json:"cryptoPath" yaml:"cryptoPath"`
+	// MSPID should be identical to the one used when the credential files were generated
+	MSPID string `json:"mspId" yaml:"mspId"`
+	// User is the folder name of the user's credentials under CryptoPath/users
+	User string `json:"user" yaml:"user"`
+	// Certificate is the user's certificate or a PEM bundle starting with it, relative paths are taken relative to CryptoPath
+	// (default: the certificate in the signcerts folder of User)
+	Certificate string `json:"certificate" yaml:"certificate"`
+	// PrivateKey is the user's key file or a folder of key files, the key belonging to the certificate is picked from them
+	// (default: the keystore folder of User)
+	PrivateKey string `json:"privateKey" yaml:"privateKey"`
+	// PeerEndpoint is the address to access the peer node, a localhost address when the network is running in a single machine
+	PeerEndpoint string `json:"peerEndpoint" yaml:"peerEndpoint"`
+	// GatewayPeer is the name of the peer node, its TLS certificate has to be issued for this name
+	GatewayPeer string `json:"gatewayPeer" yaml:"gatewayPeer"`
+	// Peers are further peers of the organization, tried in turn when the gateway peer is unreachable
+	Peers []PeerConfig `json:"peers" yaml:"peers"`
+	// TLSCert is the CA certificate the peer's TLS certificate is checked against, relative paths are taken relative to CryptoPath
+	// (default: the ca.crt in the tls folder of GatewayPeer)
+	TLSCert string `json:"tlsCert" yaml:"tlsCert"`
+	// TLS adds CA certificates, a client certificate for mutual TLS and a server name override to the connection to the peer
+	TLS TLSConfig `json:"tls" yaml:"tls"`
+	// EventFilter is a regular expression selecting the chaincode events this organization listens to
+	EventFilter string `json:"eventFilter" yaml:"eventFilter"`
+	// Events composes the event filter from organizations, event types and phases, it replaces EventFilter if set
+	Events *EventFilterConfig `json:"events" yaml:"events"`
+	// Neighbors are the organizations whose updates are combined in each iteration, the event filter has to match all of them
+	// without neighbors every matching event is combined with the node's state on its own, with a weight of 0.5
+	Neighbors []Neighbor `json:"neighbors" yaml:"neighbors"`
+}
+
+// Config holds the settings needed to connect to a Fabric network as one of its organizations
+type Config struct {
+	Identity `yaml:",inline"`
+	// NetworkName and ContractName should be identical to the channel and chaincode names used in the blockchain network
+	NetworkName  string `json:"networkName" yaml:"networkName"`
+	ContractName string `json:"contractName" yaml:"contractName"`
+	// DiscoveryAsLocalhost tells whether the peers are reached on localhost, DISCOVERY_AS_LOCALHOST overrides it
+	// (default: detected from where the gateway peer's name resolves to, and false in a container)
+	DiscoveryAsLocalhost *bool `json:"discoveryAsLocalhost" yaml:"discoveryAsLocalhost"`
+	// HostAliases are the addresses of hosts by their names, e.g. of the peers on a network without DNS entries for them.
+	// The TLS certificates are still checked against the names
+	HostAliases map[string]string `json:"hostAliases" yaml:"hostAliases"`
+	// UserName is the label of the identity in the wallet
+	UserName string `json:"userName" yaml:"userName"`
+	// WalletPath is the folder of the wallet
+	WalletPath string `json:"walletPath" yaml:"walletPath"`
+	// KeystorePath is the folder of the keys the legacy SDK left next to the wallet, removed by a cleanup
+	KeystorePath string `json:"keystorePath" yaml:"keystorePath"`
+	// WalletEncryption encrypts the identities of the wallet with a passphrase
+	WalletEncryption WalletEncryptionConfig `json:"walletEncryption" yaml:"walletEncryption"`
+	// DataDir is the folder the wallet and the keystore have to lie in to be removed by a cleanup (default: the working directory)
+	DataDir string `json:"dataDir" yaml:"dataDir"`
+	// CA is the Fabric CA the user is enrolled with when the wallet is populated, instead of reading the MSP folder
+	CA CAConfig `json:"ca" yaml:"ca"`
+	// HSM is the hardware token holding the private keys of the identities imported with wallet add --hsm
+	HSM HSMConfig `json:"hsm" yaml:"hsm"`
+	// MQTT is the broker the setpoints are published to for the inverter or generator controller
+	MQTT MQTTConfig `json:"mqtt" yaml:"mqtt"`
+	// Modbus is the inverter or meter the measurements are read from and the setpoint is written to
+	Modbus ModbusConfig `json:"modbus" yaml:"modbus"`
+	// OPCUA is the OPC UA server of the substation or the DER controller the measurements are read from and the setpoint is
+	// written to, instead of a Modbus device
+	OPCUA OPCUAConfig `json:"opcua" yaml:"opcua"`
+	// Access restricts the -serve and -grpc-addr APIs to clients with an API key or a client certificate and their role
+	Access AccessConfig `json:"access" yaml:"access"`
+	// Goose subscribes to the GOOSE messages of the protection relays, a grid event restarts the optimization with new constraints
+	Goose GooseConfig `json:"goose" yaml:"goose"`
+	// Barrier keeps a converged node in the run until all participants have reported convergence on the chain
+	Barrier BarrierConfig `json:"barrier" yaml:"barrier"`
+	// Contract maps the function, argument and event names of the agent onto those of the chaincode
+	Contract ContractConfig `json:"contract" yaml:"contract"`
+	// Endorsement targets the endorsement of the transactions at the peers of chosen organizations
+	Endorsement EndorsementConfig `json:"endorsement" yaml:"endorsement"`
+	// EventSources are message buses the updates of participants that are not on the blockchain arrive on
+	EventSources []EventSourceConfig `json:"eventSources" yaml:"eventSources"`
+	// Role is the part the node takes in the optimization: generator (default), load or storage, -role overrides it
+	Role string `json:"role" yaml:"role"`
+	// Generator is the model of the generator this node represents, its convergence settings apply to all roles
+	Generator GeneratorModel `json:"generator" yaml:"generator"`
+	// Load is the model of the demand of a node in the load role
+	Load LoadModel `json:"load" yaml:"load"`
+	// Storage is the model of the battery of a node in the storage role
+	Storage StorageModel `json:"storage" yaml:"storage"`
+	// Algorithm is the distributed algorithm of the optimization
+	Algorithm AlgorithmConfig `json:"algorithm" yaml:"algorithm"`
+	// Termination selects when a run has converged, by default the mismatch and the change of the price below the epsilon
+	Termination TerminationConfig `json:"termination" yaml:"termination"`
+	// Organizations adds organizations to the identity registry or replaces the built-in ones, selected with -org
+	Organizations map[string]Identity `json:"organizations" yaml:"organizations"`
+	// Channels runs an optimization on each of these channels instead of the one of NetworkName, selected with -channel
+	Channels []ChannelConfig `json:"channels" yaml:"channels"`
+	// Agents runs the agents of these organizations side by side in this process instead of a single one
+	Agents []AgentConfig `json:"agents" yaml:"agents"`
+	// Markets runs an optimization on each of several contracts side by side in this process, on one connection
+	Markets MarketsConfig `json:"markets" yaml:"markets"`
+	// Hooks run commands on lifecycle events of the run, e.g. the convergence
+	Hooks []HookConfig `json:"hooks" yaml:"hooks"`
+	// Report selects the format of the summary of a converged run
+	Report ReportConfig `json:"report" yaml:"report"`
+}
+
+// HSMConfig selects the PKCS#11 token of the device, a TPM or HSM
+type HSMConfig struct {
+	// Library is the PKCS#11 module of the device, e.g. /usr/lib/softhsm/libsofthsm2.so
+	Library string `json:"library" yaml:"library"`
+	// Label is the label of the token the keys are stored in
+	Label string `json:"label" yaml:"label"`
+	// Pin is the user PIN of the token, the HSM_PIN environment variable overrides it so that it needn't be kept in the file
+	Pin string `json:"pin" yaml:"pin"`
+}
+
+// MQTTConfig selects the broker and the topics of the setpoints, nothing is published without a broker
+type MQTTConfig struct {
+	// Broker is the URL of the broker, e.g. tls://broker:8883 or tcp://broker:1883
+	Broker   string `json:"broker" yaml:"broker"`
+	ClientID string `json:"clientId" yaml:"clientId"`
+	Username string `json:"username" yaml:"username"`
+	// Password is the password of the user, the MQTT_PASSWORD environment variable overrides it
+	Password string `json:"password" yaml:"password"`
+	// SetpointTopic receives the setpoint of a converged run or an emergency stop, as a retained message
+	SetpointTopic string `json:"setpointTopic" yaml:"setpointTopic"`
+	// IterationTopic receives the setpoint of every iteration if it is set
+	IterationTopic string `json:"iterationTopic" yaml:"iterationTopic"`
+	// RegulationTopic is subscribed to for the regulation (AGC) signal, one number in [-1, 1] per message
+	RegulationTopic string `json:"regulationTopic" yaml:"regulationTopic"`
+	QoS             byte   `json:"qos" yaml:"qos"`
+	// CACert verifies the broker instead of the system roots, Certificate and PrivateKey authenticate the agent
+	CACert      string `json:"caCert" yaml:"caCert"`
+	Certificate string `json:"certificate" yaml:"certificate"`
+	PrivateKey  string `json:"privateKey" yaml:"privateKey"`
+}
+
+// ModbusConfig selects the Modbus TCP device and its registers, a register that is not configured is not used
+type ModbusConfig struct {
+	// Address is the host and port of the device, e.g. 192.168.1.10:502
+	Address string `json:"address" yaml:"address"`
+	UnitID  byte   `json:"unitId" yaml:"unitId"`
+	// Generation and Load are the measured output and local demand in MW the run starts from
+	Generation *ModbusRegister `json:"generation" yaml:"generation"`
+	Load       *ModbusRegister `json:"load" yaml:"load"`
+	// Setpoint is the holding register the final setpoint is written to
+	Setpoint *ModbusRegister `json:"setpoint" yaml:"setpoint"`
+}
+
+// ModbusRegister is a value in the registers of a Modbus device, 32-bit values take two registers with the high word first
+type ModbusRegister struct {
+	Register uint16 `json:"register" yaml:"register"`
+	// Table is "holding" (default) or "input", only holding registers can be written
+	Table string `json:"table" yaml:"table"`
+	// Format is "uint16" (default), "int16", "uint32", "int32" or "float32"
+	Format string `json:"format" yaml:"format"`
+	// Scale converts the register value to MW, e.g. 0.001 for a value in kW (default 1)
+	Scale float64 `json:"scale" yaml:"scale"`
+}
+
+// testNetworkIdentity returns the identity of the n-th organization of the fabric-samples test network
+func testNetworkIdentity(n int, port int) Identity {
+	domain := fmt.Sprintf("org%v.example.com", n)
+	return Identity{
+		CryptoPath:   defaultSamplesRoot + "/" + testNetworkOrgsFolder + "/" + domain,
+		MSPID:        fmt.Sprintf("Org%vMSP", n),
+		User:         "User1@" + domain,
+		PeerEndpoint: fmt.Sprintf("localhost:%v", port),
+		GatewayPeer:  "peer0." + domain,
+		EventFilter:  fmt.Sprintf("Org%v", n),
+	}
+}
+
+// builtinOrganizations are the organizations of the fabric-samples test network, Org3 is the one added by addOrg3.sh
+var builtinOrganizations = map[string]Identity{
+	"Org1": testNetworkIdentity(1, 7051),
+	"Org2": testNetworkIdentity(2, 9051),
+	"Org3": testNetworkIdentity(3, 11051),
+}
+
+// defaultConfig connects to the fabric-samples test network as the Org1 user
+func defaultConfig() Config {
+	return Config{
+		Identity:     builtinOrganizations["Org1"],
+		NetworkName:  "mychannel",
+		ContractName: "basic",
+		UserName:     "appUser",
+		WalletPath:   "wallet",
+		KeystorePath: "keystore",
+		Generator:    defaultGenerator,
+		Load:         defaultLoad,
+		Storage:      defaultStorage,
+	}
+}
+
+// selectOrganization switches the configuration to the identity of an organization from the registry
+// the wallet label gets the organization as a suffix, so the identities of several organizations can share a wallet
+func (c *Config) selectOrganization(org string) error {
+	identity, ok := c.Organizations[org]
+	if !ok {
+		identity, ok = builtinOrganizations[org]
+	}
+	if !ok {
+		return fmt.Errorf("unknown organization %q, known are %v", org, c.organizationNames())
+	}
+	if err := validateNeighbors(identity.Neighbors); err != nil {
+		return fmt.Errorf("invalid neighbors of %s: %w", org, err)
+	}
+	c.Identity = identity
+	c.UserName = c.UserName + "@" + org
+	return nil
+}
+
+func (c *Config) organizationNames() []string {
+	var names []string
+	for name := range builtinOrganizations {
+		if _, ok := c.Organizations[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	for name := range c.Organizations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cfg is the configuration in use, loaded by loadConfig at startup
+var cfg = defaultConfig()
+
+// loadConfig reads the configuration file, settings missing from the file keep their default values
+// with an organization given, its identity is taken from the registry
+// the environment variables override both, so that a container can be configured without a file
+func loadConfig(path string, org string) (Config, error) {
+	c, err := readConfig(path)
+	if err != nil {
+		return c, err
+	}
+	if org != "" {
+		if err := c.selectOrganization(org); err != nil {
+			return c, err
+		}
+	}
+	if *participantRole != "" {
+		if err := validateRole(*participantRole); err != nil {
+			return c, err
+		}
+		c.Role = *participantRole
+	}
+	c.applyEnvironment()
+	c.discoverCrypto()
+	return c, nil
+}
+
+func readConfig(path string) (Config, error) {
+	c := defaultConfig()
+	if path == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return c, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&c)
+	} else {
+		err = yaml.UnmarshalStrict(data, &c)
+	}
+	if err != nil {
+		return c, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if err := c.Generator.validate(); err != nil {
+		return c, fmt.Errorf("invalid generator in %s: %w", path, err)
+	}
+	if err := c.TLS.validate(); err != nil {
+		return c, fmt.Errorf("invalid tls in %s: %w", path, err)
+	}
+	if err := validateRole(c.Role); err != nil {
+		return c, fmt.Errorf("invalid role in %s: %w", path, err)
+	}
+	if err := c.Load.validate(); err != nil {
+		return c, fmt.Errorf("invalid load in %s: %w", path, err)
+	}
+	if err := c.Storage.validate(); err != nil {
+		return c, fmt.Errorf("invalid storage in %s: %w", path, err)
+	}
+	if err := validateNeighbors(c.Neighbors); err != nil {
+		return c, fmt.Errorf("invalid neighbors in %s: %w", path, err)
+	}
+	if err := validatePeers(c.Peers); err != nil {
+		return c, fmt.Errorf("invalid peers in %s: %w", path, err)
+	}
+	if err := validateHostAliases(c.HostAliases); err != nil {
+		return c, fmt.Errorf("invalid hostAliases in %s: %w", path, err)
+	}
+	if err := c.Algorithm.validate(); err != nil {
+		return c, fmt.Errorf("invalid algorithm in %s: %w", path, err)
+	}
+	if err := c.Termination.validate(); err != nil {
+		return c, fmt.Errorf("invalid termination in %s: %w", path, err)
+	}
+	if err := c.OPCUA.validate(); err != nil {
+		return c, fmt.Errorf("invalid opcua in %s: %w", path, err)
+	}
+	if err := c.Goose.validate(); err != nil {
+		return c, fmt.Errorf("invalid goose in %s: %w", path, err)
+	}
+	if err := c.Access.validate(); err != nil {
+		return c, fmt.Errorf("invalid access in %s: %w", path, err)
+	}
+	if err := c.Barrier.validate(); err != nil {
+		return c, fmt.Errorf("invalid barrier in %s: %w", path, err)
+	}
+	if err := c.Contract.validate(); err != nil {
+		return c, fmt.Errorf("invalid contract in %s: %w", path, err)
+	}
+	if err := c.Endorsement.validate(); err != nil {
+		return c, fmt.Errorf("invalid endorsement in %s: %w", path, err)
+	}
+	if err := c.Report.validate(); err != nil {
+		return c, fmt.Errorf("invalid report in %s: %w", path, err)
+	}
+	for _, h := range c.Hooks {
+		if err := h.validate(); err != nil {
+			return c, fmt.Errorf("invalid hooks in %s: %w", path, err)
+		}
+	}
+	for _, source := range c.EventSources {
+		if err := source.validate(); err != nil {
+			return c, fmt.Errorf("invalid eventSources in %s: %w", path, err)
+		}
+	}
+	if c.OPCUA.Endpoint != "" && c.Modbus.Address != "" {
+		return c, fmt.Errorf("invalid config file %s: the measurements come from either modbus or opcua", path)
+	}
+	if err := validateChannels(c.Channels); err != nil {
+		return c, fmt.Errorf("invalid channels in %s: %w", path, err)
+	}
+	if err := validateAgents(c.Agents); err != nil {
+		return c, fmt.Errorf("invalid agents in %s: %w", path, err)
+	}
+	if len(c.Agents) > 0 && len(c.Channels) > 0 {
+		return c, fmt.Errorf("invalid config file %s: agents and channels can't be combined", path)
+	}
+	if err := c.Markets.validate(); err != nil {
+		return c, fmt.Errorf("invalid markets in %s: %w", path, err)
+	}
+	if len(c.Markets.Contracts) > 0 && (len(c.Agents) > 0 || len(c.Channels) > 0) {
+		return c, fmt.Errorf("invalid config file %s: markets can't be combined with agents or channels", path)
+	}
+	return c, nil
+}
+
+// cryptoFile returns the configured path taken relative to CryptoPath, or the default if none is configured
+func (c Config) cryptoFile(path string, byDefault string) string {
+	if path == "" {
+		return byDefault
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.CryptoPath, path)
+}
+
+// tlsCertPath returns the CA certificate of the gateway peer's TLS connection
+func (c Config) tlsCertPath() string {
+	return c.cryptoFile(c.TLSCert, filepath.Join(c.CryptoPath, "peers", c.GatewayPeer, "tls", "ca.crt"))
+}
+
+// credPath returns the msp folder of the user's credentials
+func (c Config) credPath() string {
+	return filepath.Join(c.CryptoPath, "users", c.User, "msp")
+}
+
+// certPath returns the certificate of the user
+func (c Config) certPath() string {
+	return c.cryptoFile(c.Certificate, filepath.Join(c.credPath(), "signcerts", c.User+"-cert.pem"))
+}
+
+// keyPath returns the private key of the user or the folder it is kept in
+func (c Config) keyPath() string {
+	return c.cryptoFile(c.PrivateKey, filepath.Join(c.credPath(), "keystore"))
+}
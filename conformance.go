@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/dlclark/regexp2"
+)
+
+var (
+	conformanceMode    = flag.Bool("conformance", false, "check the contract's event names and payloads against what the agent expects, then exit")
+	conformanceTimeout = flag.Duration("conformance-timeout", 30*time.Second, "how long to wait for an event during the conformance checks")
+)
+
+// conformanceResult is the outcome of a single conformance check
+type conformanceResult struct {
+	Name   string
+	Passed bool
+	Detail string
+}
+
+// checkEventConformance verifies that an event name and payload match what the consensus loop expects to parse
+func checkEventConformance(eventFilter string, eventName string, payload string) []conformanceResult {
+	var results []conformanceResult
+
+	nameReg, err := regexp2.Compile(eventFilter, 0)
+	if err != nil {
+		results = append(results, conformanceResult{"event filter compiles", false, err.Error()})
+	} else {
+		matched, _ := nameReg.MatchString(eventName)
+		results = append(results, conformanceResult{"event name matches filter", matched, fmt.Sprintf("name=%q filter=%q", eventName, eventFilter)})
+	}
+
+	update, err := decodePayload(payload)
+	if err != nil {
+		results = append(results, conformanceResult{"payload decodes", false, fmt.Sprintf("%v: payload=%q", err, payload)})
+	} else {
+		results = append(results, conformanceResult{"payload decodes", true, fmt.Sprintf("version %d, Lambda=%s, Mismatch=%s", update.Version, update.lambdaText, update.mismatchText)})
+	}
+
+	return results
+}
+
+// runConformance submits a probe update and checks the next event received from the contract, it returns false if any check fails
+func runConformance(events eventSource, contract contractAPI, eventFilter string, timeout time.Duration) bool {
+	logger.Info("running event conformance checks")
+	reg, notifier, err := events.RegisterEvent(eventFilter)
+	if err != nil {
+		logger.Warnf("Failed to register contract event: %v", err)
+		return false
+	}
+	defer reg()
+
+	_, err = submitTransaction(contract, "SendUpdate", cfg.Contract.updateArguments([]string{"0", "0"}, 0, "")...)
+	if err != nil {
+		logger.Warnf("Failed to submit probe transaction: %s", explainError(err))
+		return false
+	}
+	logger.Info("Probe update submitted, waiting for an event")
+
+	select {
+	case event := <-notifier:
+		return printChecks(checkEventConformance(eventFilter, event.EventName, string(event.Payload)))
+	case <-time.After(timeout):
+		fmt.Printf("[FAIL] event received: no event matching %q within %s\n", eventFilter, timeout)
+		return false
+	}
+}
+
+// printChecks prints a PASS/FAIL line per check, it returns false if any check failed
+func printChecks(results []conformanceResult) bool {
+	passed := true
+	for _, r := range results {
+		status := "PASS"
+		if !r.Passed {
+			status = "FAIL"
+			passed = false
+		}
+		fmt.Printf("[%s] %s: %s\n", status, r.Name, r.Detail)
+	}
+	return passed
+}
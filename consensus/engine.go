@@ -0,0 +1,138 @@
+// Package consensus is the consensus + innovation rule of the economic dispatch the agent was written for, without any
+// I/O: the price follows the neighbors' prices and moves with the mismatch, which tracks the network's power mismatch
+// through the neighbors' mismatches.
+//
+// The agent feeds the Engine with the neighbors' updates it receives from the chaincode events and submits the state
+// the Engine returns, so the math can be tested without a Fabric network.
+package consensus
+
+import "math"
+
+// MinStep is the smallest step of DecreasingStep
+const MinStep = 0.01
+
+// Cost is the cost model of a node, as far as the consensus needs it
+type Cost interface {
+	// Dispatch returns the power at which the marginal cost equals the price lambda, before the limits are applied
+	Dispatch(lambda float64) float64
+}
+
+// Limits are the power limits of a node in MW
+type Limits struct {
+	Min float64
+	Max float64
+}
+
+// Clamp returns the power within the limits
+func (l Limits) Clamp(P float64) float64 {
+	return math.Min(math.Max(P, l.Min), l.Max)
+}
+
+// Neighbor is one neighbor's contribution to a step: its weight in the node's row of the consensus matrix and its
+// latest price and mismatch
+type Neighbor struct {
+	Weight   float64
+	Lambda   float64
+	Mismatch float64
+}
+
+// State is the price, the mismatch and the power of a node after an iteration
+type State struct {
+	Lambda   float64
+	Mismatch float64
+	P        float64
+}
+
+// StepSize returns the step eta the mismatch moves the price by in an iteration, the first iteration is 1
+type StepSize func(iter int) float64
+
+// DecreasingStep is the step 1/iter of the original algorithm, it shrinks with the iterations down to MinStep
+func DecreasingStep(iter int) float64 {
+	eta := 1 / float64(iter)
+	if eta < MinStep {
+		eta = MinStep
+	}
+	return eta
+}
+
+// ConstantStep returns a constant step, which converges faster than DecreasingStep as long as it is small enough for
+// the network
+func ConstantStep(alpha float64) StepSize {
+	return func(int) float64 { return alpha }
+}
+
+// Engine runs the iterations of a node and tells when they have converged
+type Engine struct {
+	schedule Schedule
+	// change and mismatch of the last step, for the convergence check
+	change, mismatch float64
+	// the iteration last computed and the step it took, which a schedule may have changed while searching for it
+	iter int
+	eta  float64
+}
+
+// NewEngine returns an engine with the step size, DecreasingStep if it is nil
+func NewEngine(step StepSize) *Engine {
+	if step == nil {
+		step = DecreasingStep
+	}
+	return NewScheduledEngine(step)
+}
+
+// NewScheduledEngine returns an engine whose steps follow the schedule
+func NewScheduledEngine(schedule Schedule) *Engine {
+	e := &Engine{schedule: schedule}
+	e.Start(math.Inf(1))
+	return e
+}
+
+// Start begins a run from the node's initial mismatch
+func (e *Engine) Start(mismatch float64) {
+	e.change, e.mismatch = math.Inf(1), mismatch
+}
+
+// Update computes iteration iter from the node's state after the last one and the neighbors' latest values.
+// Every neighbor enters with its consensus weight and the node keeps the rest, a single neighbor of weight 0.5 gives
+// the plain average of the two nodes
+func (e *Engine) Update(cost Cost, limits Limits, neighbors []Neighbor, s State, iter int) State {
+	eta := e.schedule.Eta(iter)
+	next := update(cost, limits, neighbors, s, eta)
+	if b, ok := e.schedule.(*BacktrackingStep); ok {
+		for trial := 0; trial < b.Trials && !b.sufficient(s.Mismatch, next.Mismatch, eta); trial++ {
+			eta *= b.Shrink
+			next = update(cost, limits, neighbors, s, eta)
+		}
+	}
+	e.schedule.Observe(iter, next.Mismatch)
+	e.iter, e.eta = iter, eta
+	e.change, e.mismatch = math.Abs(next.Lambda-s.Lambda), next.Mismatch
+	return next
+}
+
+// update is the consensus + innovation rule with the step eta
+func update(cost Cost, limits Limits, neighbors []Neighbor, s State, eta float64) State {
+	self := 1.0
+	var next State
+	for _, n := range neighbors {
+		self -= n.Weight
+		next.Lambda += n.Weight * n.Lambda
+		next.Mismatch += n.Weight * n.Mismatch
+	}
+	next.Lambda += self*s.Lambda + eta*s.Mismatch
+	next.P = limits.Clamp(cost.Dispatch(next.Lambda))
+	next.Mismatch += self*s.Mismatch + s.P - next.P
+	return next
+}
+
+// Converged tells whether the mismatch and the change of the price of the last iteration are both below epsilon
+func (e *Engine) Converged(epsilon float64) bool {
+	return math.Abs(e.mismatch) < epsilon && e.change < epsilon
+}
+
+// Eta returns the step size of iteration iter, the one it took once it is computed
+func (e *Engine) Eta(iter int) float64 {
+	if iter == e.iter && iter > 0 {
+		return e.eta
+	}
+	return e.schedule.Eta(iter)
+}
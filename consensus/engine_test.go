@@ -0,0 +1,170 @@
+package consensus
+
+import (
+	"math"
+	"testing"
+)
+
+// quadratic is the cost a*P^2 of the generators the application was written for
+type quadratic struct {
+	a float64
+}
+
+func (q quadratic) Dispatch(lambda float64) float64 {
+	return lambda / (2 * q.a)
+}
+
+var generator = Limits{Min: 0, Max: 8}
+
+func TestDecreasingStep(t *testing.T) {
+	for _, c := range []struct {
+		iter int
+		eta  float64
+	}{
+		{1, 1},
+		{2, 0.5},
+		{50, 0.02},
+		{100, 0.01},
+		// the step is clamped at MinStep, it never stops moving the price
+		{101, MinStep},
+		{100000, MinStep},
+	} {
+		if eta := DecreasingStep(c.iter); eta != c.eta {
+			t.Errorf("DecreasingStep(%v) = %v, want %v", c.iter, eta, c.eta)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		neighbors []Neighbor
+		state     State
+		iter      int
+		want      State
+	}{
+		{
+			name:  "alone the price moves with the mismatch",
+			state: State{Lambda: 4, Mismatch: 2, P: 2.5},
+			iter:  2,
+			want:  State{Lambda: 5, Mismatch: 1.375, P: 3.125},
+		},
+		{
+			name:      "a neighbor of weight 0.5 averages the two nodes",
+			neighbors: []Neighbor{{Weight: 0.5, Lambda: 6, Mismatch: 1}},
+			state:     State{Lambda: 4, Mismatch: 3, P: 2.5},
+			iter:      1000,
+			want:      State{Lambda: 5.03, Mismatch: 1.35625, P: 3.14375},
+		},
+		{
+			name:  "the power saturates at the upper limit",
+			state: State{Lambda: 12, Mismatch: 10, P: 7.5},
+			iter:  1,
+			want:  State{Lambda: 22, Mismatch: 9.5, P: 8},
+		},
+		{
+			name:  "the power saturates at zero",
+			state: State{Lambda: 1, Mismatch: -3, P: 0.625},
+			iter:  1,
+			want:  State{Lambda: -2, Mismatch: -2.375, P: 0},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			got := NewEngine(nil).Update(quadratic{a: 0.8}, generator, c.neighbors, c.state, c.iter)
+			if math.Abs(got.Lambda-c.want.Lambda) > 1e-9 || math.Abs(got.Mismatch-c.want.Mismatch) > 1e-9 || math.Abs(got.P-c.want.P) > 1e-9 {
+				t.Errorf("Update = %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestConverged(t *testing.T) {
+	e := NewEngine(nil)
+	if e.Converged(0.01) {
+		t.Errorf("a new engine has converged")
+	}
+	e.Start(0)
+	if e.Converged(0.01) {
+		t.Errorf("converged before the first iteration")
+	}
+	// a price that doesn't change with a mismatch left has not converged
+	e.Update(quadratic{a: 0.8}, generator, nil, State{Lambda: 4, Mismatch: 0.005, P: 2.5}, 1000)
+	if !e.Converged(0.01) {
+		t.Errorf("not converged with a change of 0.00005 and a mismatch of 0.005")
+	}
+	e.Update(quadratic{a: 0.8}, generator, nil, State{Lambda: 4, Mismatch: 2, P: 2.5}, 1000)
+	if e.Converged(0.01) {
+		t.Errorf("converged with a mismatch of 2")
+	}
+}
+
+// two generators that share a demand of 10 MW converge to 5 MW each at the price 8, the marginal cost of 5 MW
+func TestTwoNodesConverge(t *testing.T) {
+	nodes := []*Engine{NewEngine(nil), NewEngine(nil)}
+	states := []State{{Lambda: 0, Mismatch: 5, P: 0}, {Lambda: 0, Mismatch: 5, P: 0}}
+	for _, e := range nodes {
+		e.Start(5)
+	}
+	for iter := 1; iter <= 5000; iter++ {
+		next := make([]State, 2)
+		for i, e := range nodes {
+			other := states[1-i]
+			next[i] = e.Update(quadratic{a: 0.8}, generator, []Neighbor{{Weight: 0.5, Lambda: other.Lambda, Mismatch: other.Mismatch}}, states[i], iter)
+		}
+		states = next
+		if nodes[0].Converged(1e-4) && nodes[1].Converged(1e-4) {
+			break
+		}
+	}
+	for i, s := range states {
+		if math.Abs(s.Lambda-8) > 0.01 || math.Abs(s.P-5) > 0.01 {
+			t.Errorf("node %v ended at %+v, want lambda 8 and P 5", i, s)
+		}
+	}
+}
+
+func TestDiminishingStep(t *testing.T) {
+	step := DiminishingStep(1, 1, MinStep)
+	for _, iter := range []int{1, 2, 3, 7, 50, 99, 100, 101, 100000} {
+		if eta, want := step(iter), DecreasingStep(iter); eta != want {
+			t.Errorf("DiminishingStep(1, 1, MinStep)(%v) = %v, DecreasingStep %v", iter, eta, want)
+		}
+	}
+	if eta := DiminishingStep(2, 0.5, 0.1)(16); eta != 0.5 {
+		t.Errorf("DiminishingStep(2, 0.5, 0.1)(16) = %v, want 0.5", eta)
+	}
+}
+
+func TestAdaptiveStep(t *testing.T) {
+	a := NewAdaptiveStep(0.5, 0.1, 0.6, 1.1, 0.5)
+	for _, c := range []struct {
+		mismatch float64
+		eta      float64
+	}{
+		{4, 0.55},
+		// the step grows while the mismatch shrinks, up to the max
+		{2, 0.6},
+		{1, 0.6},
+		// and is cut when it grows, down to the min
+		{3, 0.3},
+		{-5, 0.15},
+		{6, 0.1},
+	} {
+		a.Observe(0, c.mismatch)
+		if eta := a.Eta(0); math.Abs(eta-c.eta) > 1e-12 {
+			t.Errorf("after the mismatch %v the step is %v, want %v", c.mismatch, eta, c.eta)
+		}
+	}
+}
+
+func TestBacktrackingStep(t *testing.T) {
+	// the step 4 overshoots: the price 44 asks for 27.5 MW and turns the mismatch of 10 into -15, the step 2 leaves -2.5
+	e := NewScheduledEngine(&BacktrackingStep{Initial: 4, Shrink: 0.5, C: 1e-4, Trials: 10})
+	next := e.Update(quadratic{a: 0.8}, Limits{Min: 0, Max: 40}, nil, State{Lambda: 4, Mismatch: 10, P: 2.5}, 1)
+	if math.Abs(next.Mismatch+2.5) > 1e-9 {
+		t.Errorf("the mismatch is %v, want -2.5", next.Mismatch)
+	}
+	if eta := e.Eta(1); eta != 2 {
+		t.Errorf("the step taken is %v, want 2", eta)
+	}
+}
@@ -0,0 +1,76 @@
+package consensus
+
+import "math"
+
+// Schedule chooses the step of every iteration. Unlike a StepSize it may learn from the mismatches the iterations
+// leave, e.g. grow the step while the mismatch shrinks
+type Schedule interface {
+	// Eta returns the step iteration iter starts with
+	Eta(iter int) float64
+	// Observe is told the mismatch iteration iter left with the step it took
+	Observe(iter int, mismatch float64)
+}
+
+// Eta makes a StepSize a schedule, which doesn't learn
+func (s StepSize) Eta(iter int) float64 {
+	return s(iter)
+}
+
+func (s StepSize) Observe(int, float64) {}
+
+// DiminishingStep returns the step initial/iter^decay, which shrinks with the iterations down to min.
+// DiminishingStep(1, 1, MinStep) is DecreasingStep
+func DiminishingStep(initial, decay, min float64) StepSize {
+	return func(iter int) float64 {
+		return math.Max(initial/math.Pow(float64(iter), decay), min)
+	}
+}
+
+// AdaptiveStep follows the trend of the mismatch: the step grows by Increase after an iteration that shrank the
+// mismatch and is cut by Decrease after one that grew it, within Min and Max
+type AdaptiveStep struct {
+	Min, Max           float64
+	Increase, Decrease float64
+	eta                float64
+	// last is the absolute mismatch of the previous iteration, infinite before the first
+	last float64
+}
+
+// NewAdaptiveStep returns an adaptive step that starts at initial
+func NewAdaptiveStep(initial, min, max, increase, decrease float64) *AdaptiveStep {
+	return &AdaptiveStep{Min: min, Max: max, Increase: increase, Decrease: decrease, eta: initial, last: math.Inf(1)}
+}
+
+func (a *AdaptiveStep) Eta(int) float64 {
+	return a.eta
+}
+
+func (a *AdaptiveStep) Observe(iter int, mismatch float64) {
+	if math.Abs(mismatch) < a.last {
+		a.eta = math.Min(a.eta*a.Increase, a.Max)
+	} else {
+		a.eta = math.Max(a.eta*a.Decrease, a.Min)
+	}
+	a.last = math.Abs(mismatch)
+}
+
+// BacktrackingStep is an Armijo-style line search on the mismatch: every iteration tries Initial first and shrinks the
+// step by Shrink until the mismatch decreases sufficiently, |next| <= (1 - C*eta)*|mismatch|, for at most Trials
+// shrinks. The last trial is taken if none decreases it enough, e.g. while the neighbors' mismatches grow
+type BacktrackingStep struct {
+	Initial float64
+	Shrink  float64
+	C       float64
+	Trials  int
+}
+
+func (b *BacktrackingStep) Eta(int) float64 {
+	return b.Initial
+}
+
+func (b *BacktrackingStep) Observe(int, float64) {}
+
+// sufficient tells whether the trial with step eta decreased the mismatch enough
+func (b *BacktrackingStep) sufficient(mismatch, next, eta float64) bool {
+	return math.Abs(next) <= (1-b.C*eta)*math.Abs(mismatch)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+
+	"testEvent/fabricagent"
+)
+
+// contractAPI is what the agent calls on the chaincode, *client.Contract implements it
+// the code written against it can be tested with a mock instead of a network
+type contractAPI interface {
+	SubmitTransaction(name string, args ...string) ([]byte, error)
+	EvaluateTransaction(name string, args ...string) ([]byte, error)
+	// Submit and Evaluate take the arguments as options, along with transient data
+	Submit(name string, options ...client.ProposalOption) ([]byte, error)
+	Evaluate(name string, options ...client.ProposalOption) ([]byte, error)
+}
+
+// eventSource delivers the chaincode events whose names match the filter, *gatewayConnection implements it
+// calling the returned function unregisters, which closes the channel
+type eventSource interface {
+	RegisterEvent(eventFilter string, options ...client.ChaincodeEventsOption) (context.CancelFunc, <-chan *client.ChaincodeEvent, error)
+}
+
+func (gw *gatewayConnection) RegisterEvent(eventFilter string, options ...client.ChaincodeEventsOption) (context.CancelFunc, <-chan *client.ChaincodeEvent, error) {
+	return registerEvents(gw, eventFilter, options...)
+}
+
+// invokeTransaction calls a chaincode function, evaluated on a peer without creating a transaction or submitted to the ledger
+// the transient data reaches the chaincode without being recorded on the ledger, e.g. private data
+func invokeTransaction(contract contractAPI, evaluate bool, name string, args []string, transient map[string][]byte) ([]byte, string, error) {
+	options := []client.ProposalOption{client.WithArguments(args...)}
+	if len(transient) > 0 {
+		options = append(options, client.WithTransient(transient))
+	}
+	if !evaluate {
+		options = append(options, endorsementOptions(name)...)
+	}
+	if async, ok := contract.(asyncContract); ok && !evaluate {
+		return submitAsync(async, name, options...)
+	}
+	var result []byte
+	var err error
+	// the arguments alone are passed as they are, transient data and the endorsing organizations as options
+	plain := len(options) == 1
+	switch {
+	case plain && evaluate:
+		result, err = contract.EvaluateTransaction(name, args...)
+	case plain:
+		result, err = contract.SubmitTransaction(name, args...)
+	case evaluate:
+		result, err = contract.Evaluate(name, options...)
+	default:
+		result, err = contract.Submit(name, options...)
+	}
+	return result, "", err
+}
+
+// asyncContract is implemented by *client.Contract, submitting through it tells the ID of the transaction
+type asyncContract = fabricagent.AsyncContract
+
+// submitAsync submits a transaction and waits for its commit like Submit, it also returns the transaction ID
+func submitAsync(contract asyncContract, name string, options ...client.ProposalOption) ([]byte, string, error) {
+	return fabricagent.SubmitAndWait(contract, name, options...)
+}
+
+// parseTransient reads transient data given as key=value pairs
+func parseTransient(pairs []string) (map[string][]byte, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	transient := map[string][]byte{}
+	for _, pair := range pairs {
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid transient data %q, use key=value", pair)
+		}
+		transient[pair[:i]] = []byte(pair[i+1:])
+	}
+	return transient, nil
+}
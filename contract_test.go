@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// mockCall is a transaction the code under test submitted or evaluated
+type mockCall struct {
+	submit bool
+	name   string
+	args   []string
+	// options counts the proposal options of Submit and Evaluate, which the mock can't look into
+	options int
+}
+
+// mockContract records the calls and answers them with the results of respond, a stand-in for the chaincode
+type mockContract struct {
+	calls   []mockCall
+	respond func(name string, args []string) ([]byte, error)
+	// submitted is signalled after every submission, for event sources that react to it
+	submitted chan mockCall
+}
+
+func (m *mockContract) call(submit bool, name string, args []string, options int) ([]byte, error) {
+	c := mockCall{submit: submit, name: name, args: args, options: options}
+	m.calls = append(m.calls, c)
+	if submit && m.submitted != nil {
+		m.submitted <- c
+	}
+	if m.respond == nil {
+		return nil, nil
+	}
+	return m.respond(name, args)
+}
+
+func (m *mockContract) SubmitTransaction(name string, args ...string) ([]byte, error) {
+	return m.call(true, name, args, 0)
+}
+
+func (m *mockContract) EvaluateTransaction(name string, args ...string) ([]byte, error) {
+	return m.call(false, name, args, 0)
+}
+
+func (m *mockContract) Submit(name string, options ...client.ProposalOption) ([]byte, error) {
+	return m.call(true, name, nil, len(options))
+}
+
+func (m *mockContract) Evaluate(name string, options ...client.ProposalOption) ([]byte, error) {
+	return m.call(false, name, nil, len(options))
+}
+
+// mockEvents delivers the events sent to it to a single registration
+type mockEvents struct {
+	events     chan *client.ChaincodeEvent
+	registered string
+}
+
+func newMockEvents() *mockEvents {
+	return &mockEvents{events: make(chan *client.ChaincodeEvent, eventBufferSize)}
+}
+
+func (m *mockEvents) RegisterEvent(eventFilter string, options ...client.ChaincodeEventsOption) (context.CancelFunc, <-chan *client.ChaincodeEvent, error) {
+	if m.registered != "" {
+		return nil, nil, errors.New("already registered")
+	}
+	m.registered = eventFilter
+	return func() { m.registered = "" }, m.events, nil
+}
+
+func TestRunConformanceChecksTheProbeEvent(t *testing.T) {
+	events := newMockEvents()
+	contract := &mockContract{submitted: make(chan mockCall, 1)}
+	go func() {
+		c := <-contract.submitted
+		events.events <- &client.ChaincodeEvent{EventName: "Org2Update", Payload: []byte(fmt.Sprintf("Org2 update: Lambda=%s, Mismatch=%s, end", c.args[0], c.args[1]))}
+	}()
+	if !runConformance(events, contract, "Org2", time.Second) {
+		t.Errorf("a conforming event failed the checks")
+	}
+	if events.registered != "" {
+		t.Errorf("the registration for %q was not cancelled", events.registered)
+	}
+	if len(contract.calls) != 1 || contract.calls[0].name != "SendUpdate" {
+		t.Errorf("calls = %+v, want one SendUpdate", contract.calls)
+	}
+}
+
+func TestRunConformanceFailsWithoutEvent(t *testing.T) {
+	if runConformance(newMockEvents(), &mockContract{}, "Org2", 10*time.Millisecond) {
+		t.Errorf("the checks passed without an event")
+	}
+}
+
+func TestRunConformanceFailsOnSubmitError(t *testing.T) {
+	contract := &mockContract{respond: func(string, []string) ([]byte, error) { return nil, errors.New("connection refused") }}
+	if runConformance(newMockEvents(), contract, "Org2", time.Second) {
+		t.Errorf("the checks passed although the probe was not submitted")
+	}
+}
+
+func TestRichQueryFetchesAllPages(t *testing.T) {
+	defer func(size int, all bool) { *pageSize, *allPages = size, all }(*pageSize, *allPages)
+	*pageSize, *allPages = 2, true
+	pages := map[string]string{
+		"":   `{"records":[{"ID":"a"},{"ID":"b"}],"fetchedRecordsCount":2,"bookmark":"b1"}`,
+		"b1": `{"records":[{"ID":"c"}],"fetchedRecordsCount":1,"bookmark":"b2"}`,
+	}
+	contract := &mockContract{respond: func(name string, args []string) ([]byte, error) {
+		return []byte(pages[args[2]]), nil
+	}}
+	if err := richQuery(contract, `{"selector":{"docType":"update"}}`); err != nil {
+		t.Fatal(err)
+	}
+	var bookmarks []string
+	for _, c := range contract.calls {
+		if c.submit || c.name != queryWithPagesFunction || c.args[1] != "2" {
+			t.Errorf("unexpected call %+v", c)
+		}
+		bookmarks = append(bookmarks, c.args[2])
+	}
+	if want := []string{"", "b1"}; !reflect.DeepEqual(bookmarks, want) {
+		t.Errorf("pages fetched with bookmarks %q, want %q", bookmarks, want)
+	}
+}
+
+func TestStateCommandEvaluates(t *testing.T) {
+	contract := &mockContract{respond: func(string, []string) ([]byte, error) { return []byte(`{"ID":"asset1"}`), nil }}
+	if err := stateCommand(contract, []string{"get", "asset1"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []mockCall{{submit: false, name: readAssetFunction, args: []string{"asset1"}}}
+	if !reflect.DeepEqual(contract.calls, want) {
+		t.Errorf("calls = %+v, want %+v", contract.calls, want)
+	}
+}
+
+func TestEmergencyStopSubmitsTheSafeSetpoint(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer func(p float64) { *safeSetpoint = p }(*safeSetpoint)
+	*safeSetpoint = 1.5
+
+	contract := &mockContract{}
+	emergencyStop(contract, "test")
+	want := []mockCall{{submit: true, name: estopFunction, args: []string{"test", "1.5"}}}
+	if !reflect.DeepEqual(contract.calls, want) {
+		t.Errorf("calls = %+v, want %+v", contract.calls, want)
+	}
+	latch, err := os.ReadFile(estopLatchFile)
+	if err != nil || !strings.Contains(string(latch), "test") {
+		t.Errorf("the emergency stop was not latched: %q, %v", latch, err)
+	}
+}
+
+func TestReplLine(t *testing.T) {
+	defer func(f string) { *auditFile = f }(*auditFile)
+	*auditFile = filepath.Join(t.TempDir(), "audit.jsonl")
+	for _, c := range []struct {
+		line string
+		want mockCall
+	}{
+		{"SendUpdate 1.5 -0.25", mockCall{submit: true, name: "SendUpdate", args: []string{"1.5", "-0.25"}}},
+		{"--evaluate GetAllUpdates", mockCall{submit: false, name: "GetAllUpdates", args: []string{}}},
+		{"--evaluate --transient collection=updates ReadPrivate 'key 1'", mockCall{submit: false, name: "ReadPrivate", options: 2}},
+	} {
+		contract := &mockContract{}
+		if quit, err := replLine(contract, nil, c.line); quit || err != nil {
+			t.Fatalf("line %q: quit %v, error %v", c.line, quit, err)
+		}
+		if len(contract.calls) != 1 || !reflect.DeepEqual(contract.calls[0], c.want) {
+			t.Errorf("line %q: calls = %+v, want %+v", c.line, contract.calls, c.want)
+		}
+	}
+	// only the submitted transaction is audited, evaluations create none
+	entries, err := readAudit(*auditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Function != "SendUpdate" || !reflect.DeepEqual(entries[0].Args, []string{"1.5", "-0.25"}) {
+		t.Errorf("audit log = %+v, want the SendUpdate only", entries)
+	}
+	if quit, _ := replLine(&mockContract{}, nil, "exit"); !quit {
+		t.Errorf("exit did not end the repl")
+	}
+}
+
+func TestReplChecksArguments(t *testing.T) {
+	metadata := &contractMetadata{}
+	if err := json.Unmarshal([]byte(`{"contracts": {"energy": {"transactions": [
+		{"name": "SendUpdate", "parameters": [{"name": "lambda", "schema": {"type": "number"}}, {"name": "mismatch", "schema": {"type": "number"}}]}
+	]}}}`), metadata); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"SendUpdate 1.5", "SendUpdate 1.5 x", "Unknown 1"} {
+		contract := &mockContract{}
+		if _, err := replLine(contract, metadata, line); err == nil || len(contract.calls) != 0 {
+			t.Errorf("line %q was invoked: %+v", line, contract.calls)
+		}
+	}
+	if completions, length := (replCompleter{metadata}).Do([]rune("Sen"), 3); length != 3 || len(completions) != 1 || string(completions[0]) != "dUpdate " {
+		t.Errorf("completions of Sen = %q, %v", completions, length)
+	}
+}
+
+func TestParseTransient(t *testing.T) {
+	transient, err := parseTransient([]string{"a=1", "b=x=y", "c="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]byte{"a": []byte("1"), "b": []byte("x=y"), "c": {}}
+	if !reflect.DeepEqual(transient, want) {
+		t.Errorf("transient = %q, want %q", transient, want)
+	}
+	if _, err := parseTransient([]string{"novalue"}); err == nil {
+		t.Errorf("a pair without = was accepted")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dlclark/regexp2"
+)
+
+// the placeholders of the argument template of an update
+var updatePlaceholders = []string{"{lambda}", "{mismatch}", "{seal}", "{iteration}", "{run}"}
+
+// ContractConfig maps the functions, arguments and events the agent knows onto those of a chaincode that names them
+// differently, so the agent works with it without code changes
+type ContractConfig struct {
+	// Functions maps the chaincode functions of the agent to the names the chaincode has for them, e.g.
+	// {SendUpdate: PostPrice}; functions left out keep their names
+	Functions map[string]string `json:"functions" yaml:"functions"`
+	// UpdateArgs is the template of the arguments of an update, each argument a text with the placeholders {lambda},
+	// {mismatch}, {seal}, {iteration} and {run}, the ID of the run, e.g. ["{mismatch}", "{lambda}"]; an argument that is only a placeholder
+	// without a value, like the seal without -signed-updates, is left out (default: ["{lambda}", "{mismatch}", "{seal}"])
+	UpdateArgs []string `json:"updateArgs" yaml:"updateArgs"`
+	// Events maps the names of the chaincode's events to the names the agent knows them by, in the event filter, the
+	// neighbors and the logs, e.g. {PriceOrg2: Org2}
+	Events map[string]string `json:"events" yaml:"events"`
+	// Payload names the fields of the text payload of a chaincode that writes them differently, e.g. "Price=1.2 | Imbalance=0.3 | end"
+	Payload PayloadFields `json:"payload" yaml:"payload"`
+}
+
+func (c ContractConfig) validate() error {
+	for function, name := range c.Functions {
+		if name == "" {
+			return fmt.Errorf("function %s is mapped to an empty name", function)
+		}
+	}
+	if err := c.Payload.validate(); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if len(c.UpdateArgs) == 0 {
+		return nil
+	}
+	var lambda, mismatch bool
+	for _, arg := range c.UpdateArgs {
+		lambda = lambda || strings.Contains(arg, "{lambda}")
+		mismatch = mismatch || strings.Contains(arg, "{mismatch}")
+	}
+	if !lambda || !mismatch {
+		return errors.New("the updateArgs need the {lambda} and the {mismatch}")
+	}
+	return nil
+}
+
+// PayloadFields are the texts around the values of the text payload, "Lambda=<lambda>, Mismatch=<mismatch>, end"
+type PayloadFields struct {
+	// Lambda and Mismatch are the texts before the values (default Lambda= and Mismatch=)
+	Lambda   string `json:"lambda" yaml:"lambda"`
+	Mismatch string `json:"mismatch" yaml:"mismatch"`
+	// Terminator is the text after a value, the start of ", Mismatch=" or of ", end" (default ,)
+	Terminator string `json:"terminator" yaml:"terminator"`
+}
+
+func (f PayloadFields) validate() error {
+	f = f.withDefaults()
+	// a field within the other would find the other's value too
+	if strings.Contains(f.Mismatch, f.Lambda) || strings.Contains(f.Lambda, f.Mismatch) {
+		return fmt.Errorf("the lambda field %q and the mismatch field %q overlap", f.Lambda, f.Mismatch)
+	}
+	return nil
+}
+
+func (f PayloadFields) withDefaults() PayloadFields {
+	if f.Lambda == "" {
+		f.Lambda = "Lambda="
+	}
+	if f.Mismatch == "" {
+		f.Mismatch = "Mismatch="
+	}
+	if f.Terminator == "" {
+		f.Terminator = ","
+	}
+	return f
+}
+
+// pattern returns the regular expression of the value after the field, a number up to the terminator
+func (f PayloadFields) pattern(field string) string {
+	return `(?<=` + regexp2.Escape(field) + `)[0-9.eE+-]+(?=` + regexp2.Escape(f.Terminator) + `)`
+}
+
+// chaincodeFunction returns the name the chaincode has for a function of the agent
+func chaincodeFunction(name string) string {
+	if mapped, ok := cfg.Contract.Functions[name]; ok {
+		return mapped
+	}
+	return name
+}
+
+// agentEventName returns the name the agent knows a chaincode event by
+func agentEventName(name string) string {
+	if mapped, ok := cfg.Contract.Events[name]; ok {
+		return mapped
+	}
+	return name
+}
+
+// updateArguments returns the arguments of an update, lambda, mismatch and the optional seal, in the order of the template
+func (c ContractConfig) updateArguments(args []string, iteration int, run string) []string {
+	if len(c.UpdateArgs) == 0 || len(args) < 2 {
+		return args
+	}
+	seal := ""
+	if len(args) > 2 {
+		seal = args[2]
+	}
+	values := strings.NewReplacer("{lambda}", args[0], "{mismatch}", args[1], "{seal}", seal, "{iteration}", strconv.Itoa(iteration), "{run}", run)
+	var templated []string
+	for _, arg := range c.UpdateArgs {
+		value := values.Replace(arg)
+		if value == "" && isPlaceholder(arg) {
+			continue
+		}
+		templated = append(templated, value)
+	}
+	return templated
+}
+
+// submissionArgs returns the text arguments of a submission, those of its updates following the template
+func submissionArgs(s *submission) []string {
+	switch s.name {
+	case "SendUpdate":
+		return cfg.Contract.updateArguments(s.args, s.iteration, s.run)
+	case batchFunction:
+		var args []string
+		for _, u := range s.updates {
+			args = append(args, cfg.Contract.updateArguments(u.args, u.iteration, u.run)...)
+		}
+		return args
+	}
+	return s.args
+}
+
+func isPlaceholder(arg string) bool {
+	for _, p := range updatePlaceholders {
+		if arg == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// mapContract maps the agent's names onto a chaincode with a function, arguments and events of its own
+func mapContract(t *testing.T) {
+	t.Helper()
+	cfg.Contract = ContractConfig{
+		Functions:  map[string]string{"SendUpdate": "PostPrice"},
+		UpdateArgs: []string{"{mismatch}", "{lambda}", "it={iteration}", "{seal}"},
+		Events:     map[string]string{"PriceOrg2": "Org2"},
+	}
+	if err := cfg.Contract.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContractMapping(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	mapContract(t)
+	got := submissionArgs(&submission{name: "SendUpdate", args: []string{"6.4", "-0.5"}, iteration: 3})
+	if want := []string{"-0.5", "6.4", "it=3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("arguments = %q, want %q", got, want)
+	}
+	if err := (ContractConfig{UpdateArgs: []string{"{lambda}"}}).validate(); err == nil {
+		t.Errorf("a template without the mismatch was accepted")
+	}
+}
+
+func TestProbeFollowsTheArgumentTemplate(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	mapContract(t)
+	contract := &mockContract{}
+	// the probe is submitted under the chaincode's name, no event answers it here
+	runConformance(newMockEvents(), contract, "Org2", time.Millisecond)
+	if len(contract.calls) != 1 || contract.calls[0].name != "PostPrice" || !reflect.DeepEqual(contract.calls[0].args, []string{"0", "0", "it=0"}) {
+		t.Errorf("the probe was submitted as %+v", contract.calls)
+	}
+}
+
+func TestEventRenaming(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	mapContract(t)
+	if name := agentEventName("PriceOrg2"); name != "Org2" {
+		t.Errorf("event PriceOrg2 is known as %s", name)
+	}
+	if name := agentEventName("Org3"); name != "Org3" {
+		t.Errorf("the unmapped event Org3 is known as %s", name)
+	}
+}
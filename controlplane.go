@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var grpcAddr = flag.String("grpc-addr", "", "address (e.g. :9090) of a gRPC control plane, see controlplane.proto, which then waits for StartOptimization instead of the prompt")
+
+// controlPlane is what the gRPC service needs of the API
+type controlPlane interface {
+	begin() error
+	control(command string) error
+	subscribe() (<-chan apiStatus, func())
+}
+
+// the service is described by hand like the plugin services, its messages are well-known types so that
+// no code is generated from controlplane.proto
+var controlPlaneService = grpc.ServiceDesc{
+	ServiceName: "controlplane.ControlPlane",
+	HandlerType: (*controlPlane)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "StartOptimization",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &emptypb.Empty{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				handle := func(ctx context.Context, req interface{}) (interface{}, error) {
+					if err := srv.(controlPlane).begin(); err != nil {
+						return nil, status.Error(codes.FailedPrecondition, err.Error())
+					}
+					return &emptypb.Empty{}, nil
+				}
+				if interceptor == nil {
+					return handle(ctx, in)
+				}
+				return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/controlplane.ControlPlane/StartOptimization"}, handle)
+			},
+		},
+		{
+			MethodName: "StopOptimization",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &wrapperspb.BoolValue{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				handle := func(ctx context.Context, req interface{}) (interface{}, error) {
+					command := "exit"
+					if req.(*wrapperspb.BoolValue).Value {
+						command = "estop"
+					}
+					if err := srv.(controlPlane).control(command); err != nil {
+						return nil, status.Error(codes.FailedPrecondition, err.Error())
+					}
+					return &emptypb.Empty{}, nil
+				}
+				if interceptor == nil {
+					return handle(ctx, in)
+				}
+				return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/controlplane.ControlPlane/StopOptimization"}, handle)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamIterations",
+			Handler:       streamIterations,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "controlplane.proto",
+}
+
+func streamIterations(srv interface{}, stream grpc.ServerStream) error {
+	if err := stream.RecvMsg(&emptypb.Empty{}); err != nil {
+		return err
+	}
+	updates, cancel := srv.(controlPlane).subscribe()
+	defer cancel()
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			msg, err := statusStruct(update)
+			if err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+			if err := stream.SendMsg(msg); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// statusStruct converts the status to a Struct with the same fields as the JSON of GET /status
+func statusStruct(s apiStatus) (*structpb.Struct, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return structpb.NewStruct(fields)
+}
+
+func (s *apiServer) serveGRPC() {
+	lis, err := net.Listen("tcp", *grpcAddr)
+	if err != nil {
+		logger.Warnf("Failed to serve the gRPC control plane: %v", err)
+		return
+	}
+	server := grpc.NewServer(s.access.serverOptions()...)
+	server.RegisterService(&controlPlaneService, s)
+	go func() {
+		logger.Infof("Serving the gRPC control plane on %s", *grpcAddr)
+		if err := server.Serve(lis); err != nil {
+			logger.Warnf("gRPC control plane stopped: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// the cost models selectable with generator.cost
+const (
+	costQuadratic       = "quadratic"
+	costPiecewiseLinear = "piecewise-linear"
+	costValvePoint      = "valve-point"
+)
+
+// costFunction is the generation cost of the local generator, the dispatch step inverts its marginal cost
+// the quadratic costCurve inverts it analytically, the other models numerically where they must
+type costFunction interface {
+	// cost is the cost of producing P
+	cost(P float64) float64
+	// marginal is the derivative of the cost at P
+	marginal(P float64) float64
+	// dispatch returns the power at which the marginal cost equals the price lambda, the power that maximizes lambda*P - cost(P)
+	dispatch(lambda float64) float64
+}
+
+func (c costCurve) cost(P float64) float64 {
+	return c.A*P*P + c.B*P + c.C + c.Penalty/2*(P-c.Committed)*(P-c.Committed)
+}
+
+// CostPoint is a breakpoint of a piecewise-linear cost
+type CostPoint struct {
+	P    float64 `json:"p" yaml:"p"`
+	Cost float64 `json:"cost" yaml:"cost"`
+}
+
+// piecewiseLinearCost interpolates the cost between breakpoints sorted by power, its marginal cost is the slope of a segment
+type piecewiseLinearCost struct {
+	points []CostPoint
+}
+
+// segment returns the index of the segment P lies on, the first and last segments extend beyond the breakpoints
+func (c piecewiseLinearCost) segment(P float64) int {
+	i := sort.Search(len(c.points), func(i int) bool { return c.points[i].P > P })
+	return int(math.Min(math.Max(float64(i-1), 0), float64(len(c.points)-2)))
+}
+
+func (c piecewiseLinearCost) slope(i int) float64 {
+	return (c.points[i+1].Cost - c.points[i].Cost) / (c.points[i+1].P - c.points[i].P)
+}
+
+func (c piecewiseLinearCost) cost(P float64) float64 {
+	i := c.segment(P)
+	return c.points[i].Cost + c.slope(i)*(P-c.points[i].P)
+}
+
+func (c piecewiseLinearCost) marginal(P float64) float64 {
+	return c.slope(c.segment(P))
+}
+
+// dispatch returns the breakpoint where the slope passes the price, a price equal to a slope takes the segment's upper end
+func (c piecewiseLinearCost) dispatch(lambda float64) float64 {
+	for i := 0; i < len(c.points)-1; i++ {
+		if c.slope(i) > lambda {
+			return c.points[i].P
+		}
+	}
+	return c.points[len(c.points)-1].P
+}
+
+// valvePointCost is the quadratic cost with the ripples of the steam admission valves, a*P^2 + b*P + c + |e*sin(f*(pMin-P))|
+type valvePointCost struct {
+	a, b, c, e, f float64
+	limits        powerLimits
+}
+
+func (v valvePointCost) cost(P float64) float64 {
+	return v.a*P*P + v.b*P + v.c + math.Abs(v.e*math.Sin(v.f*(v.limits.Min-P)))
+}
+
+func (v valvePointCost) marginal(P float64) float64 {
+	s := v.e * math.Sin(v.f*(v.limits.Min-P))
+	ripple := -v.e * v.f * math.Cos(v.f*(v.limits.Min-P))
+	if s < 0 {
+		ripple = -ripple
+	}
+	return 2*v.a*P + v.b + ripple
+}
+
+// dispatch searches the power limits, the marginal cost of the ripples is not monotonic and can't be inverted directly
+func (v valvePointCost) dispatch(lambda float64) float64 {
+	return maximizeProfit(v, lambda, v.limits)
+}
+
+// penalizedCost adds the realtime deviation penalty rho/2*(P-Pc)^2 from the committed power Pc to a cost
+type penalizedCost struct {
+	costFunction
+	penalty, committed float64
+	limits             powerLimits
+}
+
+func (p penalizedCost) cost(P float64) float64 {
+	return p.costFunction.cost(P) + p.penalty/2*(P-p.committed)*(P-p.committed)
+}
+
+func (p penalizedCost) marginal(P float64) float64 {
+	return p.costFunction.marginal(P) + p.penalty*(P-p.committed)
+}
+
+func (p penalizedCost) dispatch(lambda float64) float64 {
+	return maximizeProfit(p, lambda, p.limits)
+}
+
+// withPenalty adds the deviation penalty to a cost, the quadratic curve keeps its analytical dispatch
+func withPenalty(cost costFunction, penalty, committed float64, limits powerLimits) costFunction {
+	if curve, ok := cost.(costCurve); ok {
+		curve.Penalty, curve.Committed = penalty, committed
+		return curve
+	}
+	return penalizedCost{costFunction: cost, penalty: penalty, committed: committed, limits: limits}
+}
+
+// the grid the numerical dispatch starts from, the best point of it is refined by a golden-section search
+const dispatchGrid = 400
+
+// maximizeProfit returns the power within the limits that maximizes lambda*P - cost(P)
+// the grid finds the best of several local maxima, as a nonconvex cost has them
+func maximizeProfit(c costFunction, lambda float64, limits powerLimits) float64 {
+	profit := func(P float64) float64 { return lambda*P - c.cost(P) }
+	step := (limits.Max - limits.Min) / dispatchGrid
+	if step <= 0 {
+		return limits.Min
+	}
+	best := limits.Min
+	for i := 1; i <= dispatchGrid; i++ {
+		if P := limits.Min + float64(i)*step; profit(P) > profit(best) {
+			best = P
+		}
+	}
+	lo, hi := math.Max(best-step, limits.Min), math.Min(best+step, limits.Max)
+	ratio := (math.Sqrt(5) - 1) / 2
+	for hi-lo > 1e-9*math.Max(1, math.Abs(best)) {
+		x1, x2 := hi-ratio*(hi-lo), lo+ratio*(hi-lo)
+		if profit(x1) < profit(x2) {
+			lo = x1
+		} else {
+			hi = x2
+		}
+	}
+	if P := (lo + hi) / 2; profit(P) > profit(best) {
+		return P
+	}
+	return best
+}
+
+// validateCost rejects cost models the dispatch step cannot work with
+func (g GeneratorModel) validateCost() error {
+	switch g.Cost {
+	case "", costQuadratic:
+		// the dispatch step divides by the slope of the marginal cost, so the cost has to be strictly convex
+		if g.A <= 0 {
+			return fmt.Errorf("the cost coefficient a must be positive, got %v", g.A)
+		}
+	case costPiecewiseLinear:
+		if len(g.Points) < 2 {
+			return fmt.Errorf("a piecewise-linear cost needs at least 2 points, got %v", len(g.Points))
+		}
+		c := piecewiseLinearCost{points: g.Points}
+		for i := 1; i < len(g.Points); i++ {
+			if g.Points[i].P <= g.Points[i-1].P {
+				return fmt.Errorf("the points of the cost must be sorted by increasing p, %v follows %v", g.Points[i].P, g.Points[i-1].P)
+			}
+			// the consensus needs a convex cost, the price of each segment at least that of the one before
+			if i > 1 && c.slope(i-1) < c.slope(i-2) {
+				return fmt.Errorf("the cost must be convex, the slope falls after p=%v", g.Points[i-1].P)
+			}
+		}
+	case costValvePoint:
+		if g.A < 0 || g.E < 0 || g.F <= 0 {
+			return fmt.Errorf("a valve-point cost needs a >= 0, e >= 0 and f > 0, got a=%v e=%v f=%v", g.A, g.E, g.F)
+		}
+		if g.PMax <= g.PMin {
+			return fmt.Errorf("a valve-point cost is dispatched within the power limits, pMax %v must exceed pMin %v", g.PMax, g.PMin)
+		}
+	default:
+		return fmt.Errorf("unknown cost %q, use %s, %s or %s", g.Cost, costQuadratic, costPiecewiseLinear, costValvePoint)
+	}
+	return nil
+}
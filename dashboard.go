@@ -0,0 +1,141 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// the dashboard gets the connection health at this interval, the rest as it happens
+const dashboardHealthInterval = 5 * time.Second
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// the upgrader refuses pages from other origins, so a foreign site can't watch or drive the agent through the browser
+var dashboardUpgrader = websocket.Upgrader{}
+
+// watch returns the progress records from now on, a watcher that doesn't keep up misses records rather than holding up the agent
+func (s *apiServer) watch() (<-chan map[string]interface{}, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch := make(chan map[string]interface{}, eventBufferSize)
+	s.watchers[ch] = struct{}{}
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.watchers, ch)
+	}
+}
+
+// progressed hands a progress record to the watchers
+func (s *apiServer) progressed(record map[string]interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.watchers {
+		select {
+		case ch <- record:
+		default:
+		}
+	}
+}
+
+// watchConnection lets the dashboard show the health of the connection
+func (s *apiServer) watchConnection(stats *connectionStats) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = stats
+}
+
+func (s *apiServer) connectionHealth() map[string]interface{} {
+	s.mu.Lock()
+	stats := s.stats
+	s.mu.Unlock()
+	record := map[string]interface{}{"event": "connection", "time": time.Now().Format(time.RFC3339Nano)}
+	if stats != nil {
+		record["counters"] = stats.snapshot()
+		record["sinceLastEvent"] = stats.sinceLastEvent().Seconds()
+	}
+	return record
+}
+
+// handleDashboard serves the page, which draws the live charts from /live
+func (s *apiServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardPage)
+}
+
+// handleLive streams the run over a WebSocket: the history and status first, then every progress record and the connection health
+func (s *apiServer) handleLive(w http.ResponseWriter, r *http.Request) {
+	conn, err := dashboardUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has answered the request already
+		return
+	}
+	defer conn.Close()
+	records, stop := s.watch()
+	defer stop()
+	closed := readUntilClosed(conn)
+
+	s.mu.Lock()
+	status := s.current()
+	s.mu.Unlock()
+	initial := []interface{}{
+		map[string]interface{}{"event": "history", "iterations": s.history.snapshot()},
+		map[string]interface{}{"event": "status", "status": status},
+		s.connectionHealth(),
+	}
+	for _, message := range initial {
+		if err := conn.WriteJSON(message); err != nil {
+			return
+		}
+	}
+	health := time.NewTicker(dashboardHealthInterval)
+	defer health.Stop()
+	for {
+		var message interface{}
+		select {
+		case record := <-records:
+			message = record
+		case <-health.C:
+			message = s.connectionHealth()
+		case <-closed:
+			return
+		}
+		conn.SetWriteDeadline(time.Now().Add(dashboardHealthInterval))
+		if err := conn.WriteJSON(message); err != nil {
+			return
+		}
+	}
+}
+
+// readUntilClosed discards what the other side sends, the returned channel is closed with the connection
+// the pages send nothing, reading only notices that they went away
+func readUntilClosed(conn *websocket.Conn) <-chan struct{} {
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	return closed
+}
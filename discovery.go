@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var fabricSamples = flag.String("fabric-samples", "", "root of the fabric-samples checkout the crypto material of the test network is taken from (default: searched in ../fabric-samples-2.3, ../fabric-samples, ~/fabric-samples and $GOPATH/src/github.com/hyperledger/fabric-samples)")
+
+// the built-in organizations are those of the test network in this fabric-samples checkout, unless another is found
+const (
+	defaultSamplesRoot    = "../fabric-samples-2.3"
+	testNetworkOrgsFolder = "test-network/organizations/peerOrganizations"
+)
+
+// samplesRoots returns the folders searched for a fabric-samples checkout, the -fabric-samples root alone if it is set
+func samplesRoots() []string {
+	if *fabricSamples != "" {
+		return []string{*fabricSamples}
+	}
+	roots := []string{defaultSamplesRoot, "../fabric-samples"}
+	if home, err := os.UserHomeDir(); err == nil {
+		roots = append(roots, filepath.Join(home, "fabric-samples"))
+	}
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			gopath = filepath.Join(home, "go")
+		}
+	}
+	if gopath != "" {
+		roots = append(roots, filepath.Join(gopath, "src", "github.com", "hyperledger", "fabric-samples"))
+	}
+	return roots
+}
+
+// discoverCrypto finds the crypto material of a test network organization in a fabric-samples checkout: a CryptoPath in
+// the default checkout is looked up under the other roots when it doesn't exist. A configured path outside of it is
+// kept as it is. The connection profile of the organization is checked against the gateway peer
+func (c *Config) discoverCrypto() {
+	prefix := filepath.ToSlash(defaultSamplesRoot) + "/"
+	path := filepath.ToSlash(c.CryptoPath)
+	if strings.HasPrefix(path, prefix) && (*fabricSamples != "" || !isDir(c.CryptoPath)) {
+		organization := strings.TrimPrefix(path, prefix)
+		for _, root := range samplesRoots() {
+			if candidate := filepath.Join(root, filepath.FromSlash(organization)); isDir(candidate) {
+				if candidate != c.CryptoPath {
+					logger.Infof("Found the crypto material of %s in %s", c.MSPID, candidate)
+				}
+				c.CryptoPath = candidate
+				break
+			}
+		}
+	}
+	if err := c.checkProfile(); err != nil {
+		logger.Warnf("The connection profile doesn't match the configuration: %v", err)
+	}
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// connectionProfile returns the connection profile the test network generates in the organization folder, e.g.
+// connection-org1.json, or "" if there is none
+func (c Config) connectionProfile() string {
+	for _, ext := range []string{".json", ".yaml"} {
+		matches, _ := filepath.Glob(filepath.Join(c.CryptoPath, "connection-*"+ext))
+		if len(matches) > 0 {
+			return matches[0]
+		}
+	}
+	return ""
+}
+
+// connectionProfileFile is the part of a common connection profile the configuration is checked against
+type connectionProfileFile struct {
+	Peers map[string]struct {
+		URL string `yaml:"url"`
+	} `yaml:"peers"`
+}
+
+// checkProfile tells how the connection profile of the organization disagrees with the gateway peer, nil without a
+// profile. The gateway needs no profile, but one that names another peer or port points at a wrong configuration.
+// Only the port is compared, as the host differs between a container and the host of the test network
+func (c Config) checkProfile() error {
+	path := c.connectionProfile()
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	// a JSON profile is valid YAML
+	var profile connectionProfileFile
+	if err := yaml.Unmarshal(data, &profile); err != nil {
+		return fmt.Errorf("invalid connection profile %s: %w", path, err)
+	}
+	peer, ok := profile.Peers[c.GatewayPeer]
+	if !ok {
+		return fmt.Errorf("%s has no peer %s", path, c.GatewayPeer)
+	}
+	u, err := url.Parse(peer.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url of peer %s in %s: %w", c.GatewayPeer, path, err)
+	}
+	_, port, err := net.SplitHostPort(c.PeerEndpoint)
+	if err == nil && u.Port() != "" && u.Port() != port {
+		return fmt.Errorf("%s reaches %s on port %s, the peer endpoint is %s", path, c.GatewayPeer, u.Port(), c.PeerEndpoint)
+	}
+	return nil
+}
+
+// validateCrypto tells which files of the crypto material are missing: the TLS certificate of the gateway peer and,
+// if credentials are needed to populate the wallet, the certificate and the private key of the user. The key isn't
+// needed with an HSM and neither are the credentials of a user who enrolls with the CA
+func (c Config) validateCrypto(credentials bool) error {
+	files := []string{c.tlsCertPath()}
+	if credentials && (c.CA.URL == "" || c.CA.EnrollmentID == "") {
+		files = append(files, c.certPath())
+		if c.HSM.Library == "" {
+			files = append(files, c.keyPath())
+		}
+	}
+	var missing []string
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	hint := "set cryptoPath"
+	if strings.HasPrefix(filepath.ToSlash(c.CryptoPath), filepath.ToSlash(defaultSamplesRoot)+"/") {
+		hint = "set -fabric-samples to the fabric-samples checkout or cryptoPath"
+	}
+	return errors.New("the crypto material is missing " + strings.Join(missing, ", ") + ", " + hint)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// the chaincode function used to tell the other organizations that this node gave up on the run
+const failureFunction = "SendFailure"
+
+// divergenceDetector watches the size of the mismatch, a run whose mismatch keeps growing won't converge
+type divergenceDetector struct {
+	steps int
+	// trail holds the last steps+1 sizes of the mismatch, oldest first
+	trail []float64
+}
+
+// newDivergenceDetector detects a mismatch growing for the given number of iterations in a row, 0 disables it
+func newDivergenceDetector(steps int) *divergenceDetector {
+	return &divergenceDetector{steps: steps}
+}
+
+// observe records the mismatch of an iteration, it returns true once its size grew in each of the last steps iterations
+func (d *divergenceDetector) observe(mismatch float64) bool {
+	if d.steps <= 0 {
+		return false
+	}
+	size := math.Abs(mismatch)
+	if len(d.trail) > 0 && size <= d.trail[len(d.trail)-1] {
+		d.trail = d.trail[:0]
+	}
+	d.trail = append(d.trail, size)
+	if len(d.trail) > d.steps+1 {
+		d.trail = d.trail[1:]
+	}
+	return len(d.trail) == d.steps+1
+}
+
+// String shows the growing mismatch for the diagnostics
+func (d *divergenceDetector) String() string {
+	sizes := make([]string, len(d.trail))
+	for i, size := range d.trail {
+		sizes[i] = formatValue(size)
+	}
+	return strings.Join(sizes, " -> ")
+}
+
+// reportFailure announces on the chain that the node stopped the run without converging, so the other organizations need not wait for it
+func reportFailure(contract contractAPI, reason string, iter int) {
+	if _, err := submitTransaction(contract, failureFunction, reason, strconv.Itoa(iter)); err != nil {
+		logger.Warnf("Failed to report the failed run: %s", explainError(err))
+		return
+	}
+	logger.Info("Failed run reported to the chain")
+}
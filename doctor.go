@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"google.golang.org/protobuf/proto"
+)
+
+var dryRun = flag.Bool("dry-run", false, "check the wallet identity, the gateway, the channel, the contract and the event registration, print a readiness report and exit without submitting anything")
+
+// doctorCommand runs the readiness checks of -dry-run as a command
+func doctorCommand(args []string) error {
+	if !runDoctor() {
+		return errors.New("the agent is not ready to run the optimization")
+	}
+	return nil
+}
+
+// runDoctor checks everything a run needs before it submits its first update and prints a PASS/FAIL line per check
+// the checks that need an earlier one to pass are skipped when it fails, it returns false if any check failed
+func runDoctor() bool {
+	logger.Info("running readiness checks")
+	results, ok := doctorChecks()
+	passed := printChecks(results)
+	if passed && ok {
+		fmt.Println("Ready: the optimization can be started.")
+		return true
+	}
+	fmt.Println("Not ready: fix the failed checks first.")
+	return false
+}
+
+func doctorChecks() ([]conformanceResult, bool) {
+	var results []conformanceResult
+	fail := func(name string, err error) ([]conformanceResult, bool) {
+		return append(results, conformanceResult{name, false, explainError(err).Error()}), false
+	}
+
+	// the credentials are only read into a wallet that doesn't have the identity yet
+	credentials := true
+	if wallet, err := cfg.wallet(); err == nil {
+		credentials = !wallet.exists(cfg.UserName)
+	}
+	if err := cfg.validateCrypto(credentials); err != nil {
+		return fail("crypto material", err)
+	}
+	detail := "cryptoPath=" + cfg.CryptoPath
+	if profile := cfg.connectionProfile(); profile != "" {
+		detail += " profile=" + profile
+	}
+	results = append(results, conformanceResult{"crypto material", true, detail})
+
+	wallet, err := cfg.openWallet()
+	if err != nil {
+		return fail("wallet identity", err)
+	}
+	id, err := wallet.get(cfg.UserName)
+	if err != nil {
+		return fail("wallet identity", err)
+	}
+	cert, err := identity.CertificateFromPEM([]byte(id.Credentials.Certificate))
+	if err != nil {
+		return fail("wallet identity", err)
+	}
+	results = append(results,
+		conformanceResult{"wallet identity", id.MspID == cfg.MSPID, fmt.Sprintf("label=%s type=%s msp=%s (configured %s) subject=%s", cfg.UserName, id.Type, id.MspID, cfg.MSPID, cert.Subject.CommonName)},
+		conformanceResult{"certificate valid", time.Now().After(cert.NotBefore) && time.Now().Before(cert.NotAfter), fmt.Sprintf("from %s until %s", cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))},
+	)
+
+	gw, contract, err := cfg.connect(wallet)
+	if err != nil {
+		return fail("gateway connection", err)
+	}
+	defer gw.Close()
+	// the chain info of the channel needs the gateway peer to answer and to be joined to the channel
+	data, err := systemContract(gw).EvaluateTransaction("GetChainInfo", cfg.NetworkName)
+	if failureCode(err) == "UNREACHABLE" {
+		return fail("gateway connection", err)
+	}
+	results = append(results, conformanceResult{"gateway connection", true, fmt.Sprintf("peer=%s endpoint=%s", gw.peer.Name, gw.peer.Endpoint)})
+	if err != nil {
+		return fail("channel exists", err)
+	}
+	info := &common.BlockchainInfo{}
+	if err := proto.Unmarshal(data, info); err != nil {
+		return fail("channel exists", err)
+	}
+	results = append(results, conformanceResult{"channel exists", true, fmt.Sprintf("channel=%s height=%v", cfg.NetworkName, info.Height)})
+
+	// a chaincode without the contract API has no metadata, but it answers with a chaincode error rather than not being found
+	_, err = contract.EvaluateTransaction(metadataFunction)
+	switch code := failureCode(err); {
+	case err == nil:
+		results = append(results, conformanceResult{"contract exists", true, fmt.Sprintf("contract=%s, publishes its metadata", cfg.ContractName)})
+	case code == "CHAINCODE_NOT_FOUND" || code == "ACCESS_DENIED" || code == "UNREACHABLE":
+		return fail("contract exists", err)
+	default:
+		results = append(results, conformanceResult{"contract exists", true, fmt.Sprintf("contract=%s, publishes no metadata", cfg.ContractName)})
+	}
+
+	cancel, _, err := registerEvents(gw, cfg.eventFilter())
+	if err != nil {
+		return fail("event listener", err)
+	}
+	cancel()
+	results = append(results, conformanceResult{"event listener", true, fmt.Sprintf("registered and unregistered, filter=%q", cfg.eventFilter())})
+	return results, true
+}
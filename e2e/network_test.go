@@ -0,0 +1,114 @@
+//go:build e2e
+
+// Package e2e runs the agent end to end against the test network of fabric-samples. The tests bring the network up,
+// deploy the chaincode and tear the network down again, so they need Docker, the Fabric binaries of fabric-samples
+// and the source of the chaincode:
+//
+//	E2E_CHAINCODE=/path/to/chaincode go test -tags e2e ./e2e
+//
+// FABRIC_SAMPLES is the fabric-samples folder (default: ../fabric-samples-2.3 next to this repository).
+// E2E_KEEP_NETWORK=1 leaves the network up after the tests, to look at the containers.
+package e2e
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	channelName  = "mychannel"
+	contractName = "basic"
+)
+
+// testNetwork is a running test network of fabric-samples
+type testNetwork struct {
+	// dir is the test-network folder
+	dir string
+}
+
+// organizationsDir returns the folder with the crypto material of an organization, e.g. org1.example.com
+func (n *testNetwork) organizationsDir(domain string) string {
+	return filepath.Join(n.dir, "organizations", "peerOrganizations", domain)
+}
+
+// startNetwork brings the test network up with a channel, deploys the chaincode and tears it down when the test ends
+func startNetwork(t *testing.T) *testNetwork {
+	t.Helper()
+	chaincode := os.Getenv("E2E_CHAINCODE")
+	if chaincode == "" {
+		t.Skip("E2E_CHAINCODE is not set, the end-to-end tests need the source of the chaincode")
+	}
+	chaincode, err := filepath.Abs(chaincode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := os.Getenv("FABRIC_SAMPLES")
+	if samples == "" {
+		samples = filepath.Join("..", "..", "fabric-samples-2.3")
+	}
+	dir, err := filepath.Abs(filepath.Join(samples, "test-network"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "network.sh")); err != nil {
+		t.Skipf("no test network in %s, set FABRIC_SAMPLES: %v", samples, err)
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("the test network needs docker")
+	}
+	n := &testNetwork{dir: dir}
+	// a network left over from an earlier run would keep its old chaincode
+	n.script(t, 2*time.Minute, "down")
+	t.Cleanup(func() {
+		if os.Getenv("E2E_KEEP_NETWORK") != "" {
+			t.Logf("The test network in %s is left up", dir)
+			return
+		}
+		n.script(t, 2*time.Minute, "down")
+	})
+	if err := n.script(t, 5*time.Minute, "up", "createChannel", "-c", channelName); err != nil {
+		t.Fatalf("Failed to bring the test network up: %v", err)
+	}
+	if err := n.script(t, 10*time.Minute, "deployCC", "-c", channelName, "-ccn", contractName, "-ccp", chaincode, "-ccl", "go"); err != nil {
+		t.Fatalf("Failed to deploy the chaincode: %v", err)
+	}
+	return n
+}
+
+// script runs network.sh, its output goes to the test log
+func (n *testNetwork) script(t *testing.T, timeout time.Duration, args ...string) error {
+	t.Helper()
+	t.Logf("network.sh %s", strings.Join(args, " "))
+	cmd := exec.Command("./network.sh", args...)
+	cmd.Dir = n.dir
+	output, err := runWithTimeout(cmd, timeout)
+	if err != nil {
+		t.Logf("%s", output)
+		return err
+	}
+	return nil
+}
+
+// runWithTimeout runs a command and kills it when it takes longer than the timeout
+func runWithTimeout(cmd *exec.Cmd, timeout time.Duration) ([]byte, error) {
+	var output strings.Builder
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		return []byte(output.String()), err
+	case <-time.After(timeout):
+		_ = cmd.Process.Kill()
+		<-done
+		return []byte(output.String()), fmt.Errorf("%s did not finish within %s", cmd.Path, timeout)
+	}
+}
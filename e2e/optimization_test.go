@@ -0,0 +1,245 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the default generator (cost 0.8*P^2) and load (4 MW at 6.4 $/MWh, elasticity 0.2) balance at 4 MW and 6.4 $/MWh:
+// the generator produces lambda/(2*0.8) and the load takes 4 - 0.125*(lambda-6.4)
+const (
+	wantLambda = 6.4
+	wantPower  = 4.0
+	// the agents stop once the mismatch and the price change are below an epsilon of 0.01, so they stop near the
+	// optimum rather than on it
+	tolerance = 0.1
+)
+
+// runTimeout bounds a run of the agents, an optimization of the test network converges within a minute
+const runTimeout = 5 * time.Minute
+
+// progressEvent is a line of the -progress ndjson stream of an agent
+type progressEvent struct {
+	Event     string  `json:"event"`
+	Iteration int     `json:"iteration"`
+	Lambda    float64 `json:"lambda"`
+	Mismatch  float64 `json:"mismatch"`
+	P         float64 `json:"p"`
+	Reason    string  `json:"reason"`
+	Error     string  `json:"error"`
+}
+
+// agent is a running agent of one organization
+type agent struct {
+	org    string
+	cmd    *exec.Cmd
+	events chan progressEvent
+	// exited is closed when the agent has exited with err
+	exited chan struct{}
+	err    error
+	log    *strings.Builder
+}
+
+// buildAgent compiles the agent of this repository into the test's temporary folder
+func buildAgent(t *testing.T) string {
+	t.Helper()
+	binary := filepath.Join(t.TempDir(), "agent")
+	cmd := exec.Command("go", "build", "-o", binary, ".")
+	cmd.Dir = ".."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build the agent: %v\n%s", err, output)
+	}
+	return binary
+}
+
+// startAgent runs the agent as the n-th organization of the network in its own folder, so the agents keep their
+// wallets, checkpoints and results apart
+func startAgent(t *testing.T, network *testNetwork, binary string, n int, role string) *agent {
+	t.Helper()
+	dir := t.TempDir()
+	domain := fmt.Sprintf("org%v.example.com", n)
+	config := map[string]interface{}{
+		"cryptoPath":   network.organizationsDir(domain),
+		"mspId":        fmt.Sprintf("Org%vMSP", n),
+		"user":         "User1@" + domain,
+		"peerEndpoint": fmt.Sprintf("localhost:%v", 7051+2000*(n-1)),
+		"gatewayPeer":  "peer0." + domain,
+		"eventFilter":  fmt.Sprintf("Org%v", n),
+		"networkName":  channelName,
+		"contractName": contractName,
+		"role":         role,
+		// a run that does not converge fails the test instead of running into the timeout
+		"generator": map[string]interface{}{"epsilon": 0.01, "maxIterations": 500},
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	a := &agent{
+		org:    fmt.Sprintf("Org%v", n),
+		events: make(chan progressEvent, 1024),
+		exited: make(chan struct{}),
+		log:    &strings.Builder{},
+	}
+	a.cmd = exec.Command(binary, "-config", configFile, "-yes", "-progress", "ndjson", "-results", filepath.Join(dir, "result.json"))
+	a.cmd.Dir = dir
+	a.cmd.Stderr = a.log
+	stdout, err := a.cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.cmd.Start(); err != nil {
+		t.Fatalf("Failed to start the agent of %s: %v", a.org, err)
+	}
+	go a.read(stdout)
+	t.Cleanup(func() {
+		select {
+		case <-a.exited:
+		default:
+			_ = a.cmd.Process.Kill()
+			<-a.exited
+		}
+		if t.Failed() {
+			t.Logf("Log of %s:\n%s", a.org, a.log.String())
+		}
+	})
+	return a
+}
+
+// read passes the progress events of the agent on until it exits, the prompts on stdout are skipped
+func (a *agent) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var e progressEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			continue
+		}
+		select {
+		case a.events <- e:
+		default:
+		}
+	}
+	close(a.events)
+	a.err = a.cmd.Wait()
+	close(a.exited)
+}
+
+// await returns the first progress event with one of the names, an error when the agent reports a failure or exits
+func (a *agent) await(deadline <-chan time.Time, names ...string) (progressEvent, error) {
+	for {
+		select {
+		case e, ok := <-a.events:
+			if !ok {
+				return progressEvent{}, fmt.Errorf("%s exited before %s", a.org, strings.Join(names, " or "))
+			}
+			for _, name := range names {
+				if e.Event == name {
+					return e, nil
+				}
+			}
+			switch e.Event {
+			case "shutdown":
+				return e, fmt.Errorf("%s stopped at iteration %v: %s", a.org, e.Iteration, e.Reason)
+			case "error":
+				return e, fmt.Errorf("%s failed: %s", a.org, e.Error)
+			}
+		case <-deadline:
+			return progressEvent{}, fmt.Errorf("%s did not report %s within %s", a.org, strings.Join(names, " or "), runTimeout)
+		}
+	}
+}
+
+// result reads the summary the agent wrote with -results
+func (a *agent) result(t *testing.T) map[string]interface{} {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(a.cmd.Dir, "result.json"))
+	if err != nil {
+		t.Fatalf("No result of %s: %v", a.org, err)
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatalf("Invalid result of %s: %v", a.org, err)
+	}
+	return result
+}
+
+func near(got, want float64) bool {
+	return math.Abs(got-want) <= tolerance
+}
+
+// TestTwoAgentOptimization runs a generator of Org1 and a load of Org2 to convergence and checks that they agree on
+// the price and balance the power at the analytic optimum
+func TestTwoAgentOptimization(t *testing.T) {
+	network := startNetwork(t)
+	binary := buildAgent(t)
+	deadline := time.After(runTimeout)
+
+	// the load listens before the generator sends its first update
+	load := startAgent(t, network, binary, 2, "load")
+	if _, err := load.await(deadline, "connected"); err != nil {
+		t.Fatal(err)
+	}
+	generator := startAgent(t, network, binary, 1, "generator")
+
+	converged := map[string]progressEvent{}
+	for _, a := range []*agent{generator, load} {
+		e, err := a.await(deadline, "converged")
+		if err != nil {
+			t.Fatal(err)
+		}
+		converged[a.org] = e
+		t.Logf("%s converged at iteration %v: lambda %v, P %v, mismatch %v", a.org, e.Iteration, e.Lambda, e.P, e.Mismatch)
+	}
+	for _, a := range []*agent{generator, load} {
+		select {
+		case <-a.exited:
+			if a.err != nil {
+				t.Errorf("%s exited with %v", a.org, a.err)
+			}
+		case <-deadline:
+			t.Fatalf("%s did not exit after converging", a.org)
+		}
+	}
+
+	g, l := converged[generator.org], converged[load.org]
+	if !near(g.Lambda, wantLambda) || !near(l.Lambda, wantLambda) {
+		t.Errorf("lambda = %v (Org1), %v (Org2), want %v", g.Lambda, l.Lambda, wantLambda)
+	}
+	if !near(g.Lambda, l.Lambda) {
+		t.Errorf("the organizations disagree on the price: %v and %v", g.Lambda, l.Lambda)
+	}
+	if !near(g.P, wantPower) {
+		t.Errorf("P of the generator = %v, want %v", g.P, wantPower)
+	}
+	if !near(l.P, -wantPower) {
+		t.Errorf("P of the load = %v, want %v", l.P, -wantPower)
+	}
+	if !near(g.P+l.P, 0) {
+		t.Errorf("the power is not balanced: %v + %v", g.P, l.P)
+	}
+	for _, a := range []*agent{generator, load} {
+		result := a.result(t)
+		if power, _ := result["power"].(float64); !near(power, converged[a.org].P) {
+			t.Errorf("the result of %s has the power %v, the converged event %v", a.org, result["power"], converged[a.org].P)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+
+	"testEvent/fabricagent"
+)
+
+var endorsingOrgs = flag.String("endorsing-orgs", "", "comma-separated MSP IDs of the organizations whose peers endorse every transaction, replaces endorsement.organizations (default: the organizations the gateway picks by the endorsement policy)")
+
+// EndorsementConfig targets the endorsement of the transactions at the peers of chosen organizations, instead of those
+// the gateway picks to satisfy the endorsement policy, e.g. to keep the endorsement within the organizations that
+// are up or to satisfy a policy the gateway can't plan for
+type EndorsementConfig struct {
+	// Organizations are the MSP IDs that endorse every transaction
+	Organizations []string `json:"organizations" yaml:"organizations"`
+	// Functions are the MSP IDs endorsing the transactions of a function, by the name of the agent or of the
+	// chaincode, e.g. {SendUpdate: [Org1MSP, Org2MSP]}; they replace the Organizations for it
+	Functions map[string][]string `json:"functions" yaml:"functions"`
+}
+
+func (c EndorsementConfig) validate() error {
+	check := func(orgs []string) error {
+		for _, org := range orgs {
+			if strings.TrimSpace(org) == "" {
+				return errors.New("an endorsing organization has an empty MSP ID")
+			}
+		}
+		return nil
+	}
+	if err := check(c.Organizations); err != nil {
+		return err
+	}
+	for function, orgs := range c.Functions {
+		if len(orgs) == 0 {
+			return fmt.Errorf("function %s has no endorsing organizations", function)
+		}
+		if err := check(orgs); err != nil {
+			return fmt.Errorf("function %s: %w", function, err)
+		}
+	}
+	return nil
+}
+
+// endorsingOrganizations returns the organizations that endorse the function of the agent, none if the gateway picks them
+func endorsingOrganizations(name string) []string {
+	if orgs, ok := cfg.Endorsement.Functions[name]; ok {
+		return orgs
+	}
+	if orgs, ok := cfg.Endorsement.Functions[chaincodeFunction(name)]; ok {
+		return orgs
+	}
+	if *endorsingOrgs != "" {
+		var orgs []string
+		for _, org := range strings.Split(*endorsingOrgs, ",") {
+			orgs = append(orgs, strings.TrimSpace(org))
+		}
+		return orgs
+	}
+	return cfg.Endorsement.Organizations
+}
+
+// endorsementOptions returns the proposal options that target the endorsement of the function
+func endorsementOptions(name string) []client.ProposalOption {
+	if orgs := endorsingOrganizations(name); len(orgs) > 0 {
+		return []client.ProposalOption{client.WithEndorsingOrganizations(orgs...)}
+	}
+	return nil
+}
+
+// submitTransaction submits a transaction of an agent function under the chaincode's name for it, endorsed by the
+// organizations targeted for it
+func submitTransaction(contract contractAPI, name string, args ...string) ([]byte, error) {
+	options := endorsementOptions(name)
+	if len(options) == 0 {
+		return contract.SubmitTransaction(chaincodeFunction(name), args...)
+	}
+	return contract.Submit(chaincodeFunction(name), append(options, client.WithArguments(args...))...)
+}
+
+// endorsementPolicy is the description of the chaincode's endorsement policy, learned on connect, for the explanation
+// of an endorsement failure
+var endorsementPolicy struct {
+	sync.Mutex
+	text string
+}
+
+// learnEndorsementPolicy reads the endorsement policy of the chaincode definition, a policy that can't be had, e.g.
+// without the rights to query _lifecycle, is left out of the explanations
+func learnEndorsementPolicy(gw *gatewayConnection) {
+	definition, err := chaincodeDefinition(gw)
+	if err != nil {
+		return
+	}
+	text, err := describeApplicationPolicy(definition.ValidationParameter)
+	if err != nil {
+		logger.Debugf("Failed to read the endorsement policy: %v", err)
+		return
+	}
+	logger.Debugf("The endorsement policy of %s is %s", cfg.ContractName, text)
+	endorsementPolicy.Lock()
+	endorsementPolicy.text = text
+	endorsementPolicy.Unlock()
+}
+
+// endorsementHint tells which policy an endorsement failure failed to satisfy and which organizations endorsed
+func endorsementHint(err error) string {
+	var hints []string
+	endorsementPolicy.Lock()
+	if endorsementPolicy.text != "" {
+		hints = append(hints, "the policy of "+cfg.ContractName+" is "+endorsementPolicy.text)
+	}
+	endorsementPolicy.Unlock()
+	var failed []string
+	for _, d := range fabricagent.PeerDetails(err) {
+		failed = append(failed, d.MspId)
+	}
+	if len(failed) > 0 {
+		hints = append(hints, "the peers of "+strings.Join(failed, ", ")+" failed to endorse")
+	}
+	if orgs := endorsingOrganizations(""); len(orgs) > 0 {
+		hints = append(hints, "the endorsement was targeted at "+strings.Join(orgs, ", ")+" by -endorsing-orgs or endorsement.organizations, which have to satisfy the policy")
+	} else if len(cfg.Endorsement.Functions) > 0 {
+		hints = append(hints, "check the organizations endorsement.functions targets")
+	}
+	return strings.Join(hints, "; ")
+}
+
+// describeApplicationPolicy renders the validation parameter of a chaincode definition, e.g. OR(Org1MSP.peer, Org2MSP.peer)
+func describeApplicationPolicy(data []byte) (string, error) {
+	policy := &peer.ApplicationPolicy{}
+	if err := proto.Unmarshal(data, policy); err != nil {
+		return "", err
+	}
+	if ref := policy.GetChannelConfigPolicyReference(); ref != "" {
+		return "the channel policy " + ref, nil
+	}
+	envelope := policy.GetSignaturePolicy()
+	if envelope == nil {
+		return "", errors.New("the definition has no endorsement policy")
+	}
+	return describeSignaturePolicy(envelope.GetRule(), envelope.GetIdentities())
+}
+
+func describeSignaturePolicy(rule *common.SignaturePolicy, identities []*msp.MSPPrincipal) (string, error) {
+	if outOf := rule.GetNOutOf(); outOf != nil {
+		var rules []string
+		for _, r := range outOf.GetRules() {
+			text, err := describeSignaturePolicy(r, identities)
+			if err != nil {
+				return "", err
+			}
+			rules = append(rules, text)
+		}
+		switch {
+		case int(outOf.GetN()) == len(rules):
+			return "AND(" + strings.Join(rules, ", ") + ")", nil
+		case outOf.GetN() == 1:
+			return "OR(" + strings.Join(rules, ", ") + ")", nil
+		}
+		return fmt.Sprintf("OutOf(%v, %s)", outOf.GetN(), strings.Join(rules, ", ")), nil
+	}
+	i := int(rule.GetSignedBy())
+	if i < 0 || i >= len(identities) {
+		return "", fmt.Errorf("the policy signs by identity %v of %v", i, len(identities))
+	}
+	principal := identities[i]
+	if principal.GetPrincipalClassification() != msp.MSPPrincipal_ROLE {
+		return principal.GetPrincipalClassification().String(), nil
+	}
+	role := &msp.MSPRole{}
+	if err := proto.Unmarshal(principal.GetPrincipal(), role); err != nil {
+		return "", err
+	}
+	return role.GetMspIdentifier() + "." + strings.ToLower(role.GetRole().String()), nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTargetedEndorsement(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.Endorsement = EndorsementConfig{Functions: map[string][]string{resultFunction: {"Org1MSP", "Org2MSP"}}}
+	contract := &mockContract{}
+	if _, err := submitTransaction(contract, resultFunction, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := submitTransaction(contract, estopFunction, "1"); err != nil {
+		t.Fatal(err)
+	}
+	// the targeted function goes through Submit with its endorsing organizations and arguments as options
+	if len(contract.calls) != 2 || contract.calls[0].options != 2 || contract.calls[1].args[0] != "1" {
+		t.Errorf("the transactions were submitted as %+v", contract.calls)
+	}
+
+	role := func(mspID string) *msp.MSPPrincipal {
+		principal, _ := proto.Marshal(&msp.MSPRole{MspIdentifier: mspID, Role: msp.MSPRole_PEER})
+		return &msp.MSPPrincipal{PrincipalClassification: msp.MSPPrincipal_ROLE, Principal: principal}
+	}
+	signedBy := func(i int32) *common.SignaturePolicy {
+		return &common.SignaturePolicy{Type: &common.SignaturePolicy_SignedBy{SignedBy: i}}
+	}
+	data, _ := proto.Marshal(&peer.ApplicationPolicy{Type: &peer.ApplicationPolicy_SignaturePolicy{SignaturePolicy: &common.SignaturePolicyEnvelope{
+		Rule:       &common.SignaturePolicy{Type: &common.SignaturePolicy_NOutOf_{NOutOf: &common.SignaturePolicy_NOutOf{N: 2, Rules: []*common.SignaturePolicy{signedBy(0), signedBy(1)}}}},
+		Identities: []*msp.MSPPrincipal{role("Org1MSP"), role("Org2MSP")},
+	}}})
+	if text, err := describeApplicationPolicy(data); err != nil || text != "AND(Org1MSP.peer, Org2MSP.peer)" {
+		t.Errorf("the policy is described as %q, %v", text, err)
+	}
+}
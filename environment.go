@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// environmentSettings are the settings a container can pass as environment variables, named as in the fabric-samples applications
+func (c *Config) environmentSettings() map[string]*string {
+	return map[string]*string{
+		"CRYPTO_PATH":          &c.CryptoPath,
+		"CERT_PATH":            &c.Certificate,
+		"KEY_PATH":             &c.PrivateKey,
+		"TLS_CERT_PATH":        &c.TLSCert,
+		"TLS_CLIENT_CERT_PATH": &c.TLS.ClientCert,
+		"TLS_CLIENT_KEY_PATH":  &c.TLS.ClientKey,
+		"TLS_SERVER_NAME":      &c.TLS.ServerName,
+		"PEER_ENDPOINT":        &c.PeerEndpoint,
+		"GATEWAY_PEER":         &c.GatewayPeer,
+		"MSP_ID":               &c.MSPID,
+		"CHANNEL_NAME":         &c.NetworkName,
+		"CHAINCODE_NAME":       &c.ContractName,
+		"EVENT_FILTER":         &c.EventFilter,
+		"WALLET_PATH":          &c.WalletPath,
+		"KEYSTORE_PATH":        &c.KeystorePath,
+		"DATA_DIR":             &c.DataDir,
+		"WALLET_LABEL":         &c.UserName,
+	}
+}
+
+// applyEnvironment overrides the settings with the environment variables that are set
+func (c *Config) applyEnvironment() {
+	for name, setting := range c.environmentSettings() {
+		if value := os.Getenv(name); value != "" {
+			*setting = value
+		}
+	}
+	if os.Getenv("EVENT_FILTER") != "" {
+		c.Events = nil
+	}
+	if os.Getenv("CCP_PATH") != "" {
+		logger.Warn("CCP_PATH is ignored, the gateway peer needs no connection profile; set PEER_ENDPOINT and GATEWAY_PEER instead")
+	}
+	local := c.discoveryAsLocalhost()
+	c.PeerEndpoint = c.translateEndpoint(c.PeerEndpoint, c.GatewayPeer, local)
+	for i, p := range c.Peers {
+		c.Peers[i].Endpoint = c.translateEndpoint(p.Endpoint, p.Name, local)
+	}
+}
+
+// discoveryAsLocalhost tells whether the peers are reached on localhost, as with the test network on the same machine.
+// DISCOVERY_AS_LOCALHOST decides if it is set, then discoveryAsLocalhost of the config. Otherwise the peers are taken to
+// be local outside a container unless the name of the gateway peer is known as a remote host, by an alias or the DNS, so
+// the config of the test network on a laptop works unchanged on a network of devices
+func (c *Config) discoveryAsLocalhost() bool {
+	if value, err := strconv.ParseBool(os.Getenv("DISCOVERY_AS_LOCALHOST")); err == nil {
+		return value
+	}
+	if c.DiscoveryAsLocalhost != nil {
+		return *c.DiscoveryAsLocalhost
+	}
+	if inContainer() {
+		return false
+	}
+	if c.GatewayPeer == "" {
+		return true
+	}
+	if remoteHost(c.alias(c.GatewayPeer)) {
+		logger.Infof("%s is a remote host, the peers are reached by their names instead of localhost; set DISCOVERY_AS_LOCALHOST=true to keep localhost", c.GatewayPeer)
+		return false
+	}
+	return true
+}
+
+// inContainer detects Docker, Podman and Kubernetes
+func inContainer() bool {
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return true
+	}
+	cgroup, err := os.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return false
+	}
+	for _, runtime := range []string{"docker", "kubepods", "containerd", "libpod"} {
+		if strings.Contains(string(cgroup), runtime) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostLookupTimeout bounds the DNS lookup of the gateway peer's name, which doesn't resolve on a laptop without a network
+const hostLookupTimeout = 2 * time.Second
+
+// remoteHost tells whether the host resolves to an address that isn't one of this machine's
+func remoteHost(host string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), hostLookupTimeout)
+	defer cancel()
+	addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return false
+	}
+	for _, address := range addresses {
+		if !localAddress(net.ParseIP(address)) {
+			return true
+		}
+	}
+	return false
+}
+
+// localAddress tells whether the IP is a loopback address or one of the network interfaces
+func localAddress(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() {
+		return true
+	}
+	interfaces, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range interfaces {
+		if network, ok := a.(*net.IPNet); ok && network.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// alias returns the address of the host in hostAliases, the host itself without one
+func (c *Config) alias(host string) string {
+	if address, ok := c.HostAliases[host]; ok {
+		return address
+	}
+	return host
+}
+
+// translateEndpoint returns the endpoint the peer with the name is reached at. Unless the peers are local a localhost
+// endpoint is replaced with the name, which resolves on the container network or the DNS of the network, and a host
+// with an alias is replaced with its address
+func (c *Config) translateEndpoint(endpoint string, name string, local bool) string {
+	if !local {
+		endpoint = containerEndpoint(endpoint, name)
+	}
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	return net.JoinHostPort(c.alias(host), port)
+}
+
+// containerEndpoint replaces a localhost endpoint with the gateway peer's name, which resolves on the container network
+func containerEndpoint(endpoint string, gatewayPeer string) string {
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil || gatewayPeer == "" {
+		return endpoint
+	}
+	if host != "localhost" && !net.ParseIP(host).IsLoopback() {
+		return endpoint
+	}
+	return net.JoinHostPort(gatewayPeer, port)
+}
+
+// validateHostAliases checks that the aliases map names to plain hosts, the port stays that of the endpoint
+func validateHostAliases(aliases map[string]string) error {
+	for name, address := range aliases {
+		if name == "" || address == "" {
+			return fmt.Errorf("the alias %q: %q needs a name and an address", name, address)
+		}
+		if _, _, err := net.SplitHostPort(address); err == nil {
+			return fmt.Errorf("the address %s of %s must not have a port", address, name)
+		}
+	}
+	return nil
+}
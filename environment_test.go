@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestTranslateEndpoint(t *testing.T) {
+	c := Config{HostAliases: map[string]string{"peer0.org1.example.com": "192.168.1.20"}}
+	if got := c.translateEndpoint("localhost:7051", "peer0.org1.example.com", true); got != "localhost:7051" {
+		t.Errorf("a local peer is reached at %s", got)
+	}
+	if got := c.translateEndpoint("localhost:7051", "peer0.org1.example.com", false); got != "192.168.1.20:7051" {
+		t.Errorf("a remote peer is reached at %s", got)
+	}
+	if err := validateHostAliases(map[string]string{"peer0": "10.0.0.1:7051"}); err == nil {
+		t.Error("an alias with a port was accepted")
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// the fitted cost curve is kept here between runs
+const costCurveFile = "cost_curve.json"
+
+var (
+	costSamples   = flag.String("cost-samples", "cost_samples.csv", "CSV file of measured \"P,cost\" rows written by the device driver, used to refit the cost curve before each run")
+	costSmoothing = flag.Float64("cost-smoothing", 0.5, "weight of the newly fitted cost curve against the previous one, between 0 and 1")
+)
+
+// costCurve is the generation cost a*P^2 + b*P + c of the local generator
+// in realtime mode the deviation penalty rho/2*(P-Pc)^2 from the committed power Pc is added to it
+type costCurve struct {
+	A         float64 `json:"a"`
+	B         float64 `json:"b"`
+	C         float64 `json:"c"`
+	Penalty   float64 `json:"-"`
+	Committed float64 `json:"-"`
+}
+
+// marginal returns the marginal cost at the power P
+func (c costCurve) marginal(P float64) float64 {
+	return 2*c.A*P + c.B + c.Penalty*(P-c.Committed)
+}
+
+// dispatch returns the power at which the marginal cost equals the price lambda
+func (c costCurve) dispatch(lambda float64) float64 {
+	return (lambda - c.B + c.Penalty*c.Committed) / (2*c.A + c.Penalty)
+}
+
+// storedCostCurve is the cost curve as it is kept between runs, with the samples that are already fitted into it
+type storedCostCurve struct {
+	costCurve
+	// Samples counts the rows of -cost-samples blended into the curve, a later run fits only the rows appended since
+	Samples int `json:"samples"`
+}
+
+// loadCostCurve returns the stored cost curve, refitted with the measurements taken since the last fit if there are any
+// before any measurement is available the curve of the generator model is used
+func loadCostCurve(model GeneratorModel) costCurve {
+	defaultCostCurve := storedCostCurve{costCurve: model.costCurve()}
+	stored := defaultCostCurve
+	data, err := os.ReadFile(costCurveFile)
+	if err == nil {
+		if err := json.Unmarshal(data, &stored); err != nil {
+			logger.Warnf("Failed to read %s, using the default cost curve: %v", costCurveFile, err)
+			stored = defaultCostCurve
+		}
+	}
+
+	samples, err := readCostSamples(*costSamples)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warnf("Failed to read cost samples: %v", err)
+		}
+		return stored.costCurve
+	}
+	if len(samples) < stored.Samples {
+		// fewer rows than were fitted, the device driver started a new file
+		stored.Samples = 0
+	}
+	fresh := samples[stored.Samples:]
+	if len(fresh) == 0 {
+		return stored.costCurve
+	}
+	fitted, err := fitCostCurve(fresh)
+	if err != nil {
+		logger.Warnf("Keeping the previous cost curve: %v", err)
+		return stored.costCurve
+	}
+
+	alpha := math.Min(math.Max(*costSmoothing, 0), 1)
+	curve := costCurve{
+		A: (1-alpha)*stored.A + alpha*fitted.A,
+		B: (1-alpha)*stored.B + alpha*fitted.B,
+		C: (1-alpha)*stored.C + alpha*fitted.C,
+	}
+	logger.Infof("Cost curve updated from %v new samples: a=%v, b=%v, c=%v", len(fresh), curve.A, curve.B, curve.C)
+
+	data, err = json.MarshalIndent(storedCostCurve{costCurve: curve, Samples: len(samples)}, "", "  ")
+	if err == nil {
+		err = os.WriteFile(costCurveFile, data, 0600)
+	}
+	if err != nil {
+		logger.Warnf("Failed to save the cost curve: %v", err)
+	}
+	return curve
+}
+
+// readCostSamples reads (P, cost) pairs, rows that are not numeric such as a header are skipped
+func readCostSamples(path string) ([][2]float64, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var samples [][2]float64
+	for _, record := range records {
+		if len(record) < 2 {
+			continue
+		}
+		P, errP := strconv.ParseFloat(strings.TrimSpace(record[0]), 64)
+		cost, errCost := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if errP != nil || errCost != nil {
+			continue
+		}
+		samples = append(samples, [2]float64{P, cost})
+	}
+	return samples, nil
+}
+
+// fitCostCurve fits a quadratic cost curve to the samples by least squares
+func fitCostCurve(samples [][2]float64) (costCurve, error) {
+	if len(samples) < 3 {
+		return costCurve{}, fmt.Errorf("at least 3 samples are needed to fit the cost curve, got %v", len(samples))
+	}
+
+	// normal equations of the least squares problem, m[i][j] = sum(P^(i+j)) and v[i] = sum(cost*P^i)
+	var m [3][3]float64
+	var v [3]float64
+	for _, s := range samples {
+		pow := [5]float64{1, s[0], s[0] * s[0], s[0] * s[0] * s[0], s[0] * s[0] * s[0] * s[0]}
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				m[i][j] += pow[i+j]
+			}
+			v[i] += s[1] * pow[i]
+		}
+	}
+
+	// gaussian elimination with partial pivoting
+	for col := 0; col < 3; col++ {
+		pivot := col
+		for row := col + 1; row < 3; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return costCurve{}, fmt.Errorf("the samples do not cover enough different power levels")
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		v[col], v[pivot] = v[pivot], v[col]
+		for row := col + 1; row < 3; row++ {
+			f := m[row][col] / m[col][col]
+			for k := col; k < 3; k++ {
+				m[row][k] -= f * m[col][k]
+			}
+			v[row] -= f * v[col]
+		}
+	}
+	var x [3]float64
+	for row := 2; row >= 0; row-- {
+		x[row] = v[row]
+		for k := row + 1; k < 3; k++ {
+			x[row] -= m[row][k] * x[k]
+		}
+		x[row] /= m[row][row]
+	}
+
+	curve := costCurve{A: x[2], B: x[1], C: x[0]}
+	if curve.A <= 0 {
+		// the local dispatch needs an increasing marginal cost
+		return costCurve{}, fmt.Errorf("fitted cost curve is not convex (a=%v)", curve.A)
+	}
+	return curve, nil
+}
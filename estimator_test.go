@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math"
+	"os"
+	"testing"
+)
+
+func TestCostSamplesAreFittedOnce(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer func(s float64) { *costSmoothing = s }(*costSmoothing)
+	*costSmoothing = 0.5
+	// the samples of 1*P^2, blended into the model's 0.8*P^2
+	rows := "P,cost\n1,1\n2,4\n3,9\n"
+	if err := os.WriteFile(*costSamples, []byte(rows), 0600); err != nil {
+		t.Fatal(err)
+	}
+	model := GeneratorModel{A: 0.8}
+	if curve := loadCostCurve(model); math.Abs(curve.A-0.9) > 1e-9 {
+		t.Fatalf("first fit: a=%v, want 0.9", curve.A)
+	}
+	if curve := loadCostCurve(model); math.Abs(curve.A-0.9) > 1e-9 {
+		t.Errorf("the same samples were blended in again: a=%v", curve.A)
+	}
+	// samples of 2*P^2 appended by the driver are the only ones fitted next
+	rows += "1,2\n2,8\n3,18\n"
+	if err := os.WriteFile(*costSamples, []byte(rows), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if curve := loadCostCurve(model); math.Abs(curve.A-1.45) > 1e-9 {
+		t.Errorf("after new samples: a=%v, want 1.45", curve.A)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// an emergency stop stays latched in this file until it is acknowledged
+	estopLatchFile = "estop.lock"
+	// the chaincode function used to announce an emergency stop to the other organizations
+	estopFunction = "SendEmergencyStop"
+)
+
+var (
+	safeSetpoint = flag.Float64("safe-setpoint", 0, "power setpoint in MW the hardware is driven to on an emergency stop")
+	estopAck     = flag.Bool("estop-ack", false, "acknowledge a latched emergency stop so the agent can rejoin the optimization")
+)
+
+func isEstop(s string) bool {
+	return strings.EqualFold(strings.TrimSpace(s), "estop")
+}
+
+// emergencyStop drives the hardware to the safe setpoint, announces the stop on the chain and latches it until acknowledged
+func emergencyStop(contract contractAPI, reason string) {
+	logger.Errorf("EMERGENCY STOP: %s", reason)
+	progress("error", map[string]interface{}{"error": "emergency stop: " + reason})
+	logger.Infof("Setpoint forced to the safe value %v MW", *safeSetpoint)
+	driveSetpoint(*safeSetpoint)
+	fieldDevice.writeSetpoint(*safeSetpoint)
+	plantServer.writeSetpoint(*safeSetpoint)
+	setpoints.publishSetpoint(setpointMessage{Setpoint: *safeSetpoint, Reason: "emergency stop: " + reason})
+
+	latch := fmt.Sprintf("%s %s\n", time.Now().Format(time.RFC3339), reason)
+	if err := os.WriteFile(estopLatchFile, []byte(latch), 0600); err != nil {
+		logger.Warnf("Failed to latch the emergency stop: %v", err)
+	}
+
+	_, err := submitTransaction(contract, estopFunction, reason, formatValue(*safeSetpoint))
+	if err != nil {
+		logger.Warnf("Failed to submit the emergency stop: %s", explainError(err))
+	} else {
+		logger.Info("Emergency stop submitted to the chain")
+	}
+}
+
+// checkEstopLatch returns false if an emergency stop is latched and the user does not acknowledge it
+func checkEstopLatch() bool {
+	latch, err := os.ReadFile(estopLatchFile)
+	if os.IsNotExist(err) {
+		return true
+	}
+	logger.Warnf("An emergency stop is latched: %s", strings.TrimSpace(string(latch)))
+	// -yes doesn't acknowledge it, rejoining after an emergency stop has to be asked for explicitly
+	if !*estopAck && !ask(tr("Acknowledge the emergency stop and rejoin the optimization? [y/n]")) {
+		return false
+	}
+	if err := os.Remove(estopLatchFile); err != nil {
+		logger.Warnf("Failed to clear the emergency stop: %v", err)
+		return false
+	}
+	logger.Info("Emergency stop acknowledged")
+	return true
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/dlclark/regexp2"
+)
+
+// EventFilterConfig composes the event filter from the parts of the event names instead of writing the regular expression
+// the names are expected as <organization><type><phase>, e.g. Org2Update or Org2UpdateFinal, a part that is not listed matches anything
+type EventFilterConfig struct {
+	// Organizations are the senders whose events are received
+	Organizations []string `json:"organizations" yaml:"organizations"`
+	// Types are the event types following the organization, e.g. Update
+	Types []string `json:"types" yaml:"types"`
+	// Phases are the iteration phases ending the name, e.g. Init or Final; without phases the name ends after the type
+	Phases []string `json:"phases" yaml:"phases"`
+	// ExcludeOwn drops the node's own events, named after its MSP ID without the MSP suffix, so it never consumes its own SendUpdate
+	ExcludeOwn bool `json:"excludeOwn" yaml:"excludeOwn"`
+}
+
+// eventFilterBuilder builds the regular expression of an event filter, the names are matched literally
+type eventFilterBuilder struct {
+	organizations []string
+	types         []string
+	phases        []string
+	excluded      []string
+}
+
+func newEventFilterBuilder() *eventFilterBuilder {
+	return &eventFilterBuilder{}
+}
+
+// organization receives the events of these senders
+func (b *eventFilterBuilder) organization(names ...string) *eventFilterBuilder {
+	b.organizations = append(b.organizations, names...)
+	return b
+}
+
+// eventType receives the events of these types
+func (b *eventFilterBuilder) eventType(names ...string) *eventFilterBuilder {
+	b.types = append(b.types, names...)
+	return b
+}
+
+// phase receives the events of these iteration phases
+func (b *eventFilterBuilder) phase(names ...string) *eventFilterBuilder {
+	b.phases = append(b.phases, names...)
+	return b
+}
+
+// exclude drops the events of these senders, even if they match otherwise
+// an organization whose name starts another one's, like Org1 and Org10, also drops the other's events unless types are given
+func (b *eventFilterBuilder) exclude(organizations ...string) *eventFilterBuilder {
+	b.excluded = append(b.excluded, organizations...)
+	return b
+}
+
+// build returns the filter as a regular expression matching whole event names
+func (b *eventFilterBuilder) build() string {
+	rest := alternatives(b.types, ".*") + alternatives(b.phases, "") + "$"
+	var filter strings.Builder
+	filter.WriteString("^")
+	for _, organization := range b.excluded {
+		filter.WriteString("(?!" + regexp2.Escape(organization) + rest + ")")
+	}
+	filter.WriteString(alternatives(b.organizations, ".*"))
+	filter.WriteString(rest)
+	return filter.String()
+}
+
+// alternatives matches any of the names, or the pattern if there are none
+func alternatives(names []string, any string) string {
+	if len(names) == 0 {
+		return any
+	}
+	escaped := make([]string, len(names))
+	for i, name := range names {
+		escaped[i] = regexp2.Escape(name)
+	}
+	return "(?:" + strings.Join(escaped, "|") + ")"
+}
+
+// eventFilter returns the filter selecting the events the node listens to, composed from Events if it is set
+func (c Config) eventFilter() string {
+	if c.Events == nil {
+		return c.EventFilter
+	}
+	b := newEventFilterBuilder().
+		organization(c.Events.Organizations...).
+		eventType(c.Events.Types...).
+		phase(c.Events.Phases...)
+	if c.Events.ExcludeOwn {
+		b.exclude(strings.TrimSuffix(c.MSPID, "MSP"))
+	}
+	return b.build()
+}
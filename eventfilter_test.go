@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dlclark/regexp2"
+)
+
+func TestEventFilterBuilder(t *testing.T) {
+	for _, c := range []struct {
+		filter  *eventFilterBuilder
+		match   []string
+		noMatch []string
+	}{
+		{
+			newEventFilterBuilder().organization("Org2", "Org3"),
+			[]string{"Org2", "Org3Update"},
+			[]string{"Org1", "Org1Update", "xOrg2"},
+		},
+		{
+			newEventFilterBuilder().organization("Org2").eventType("Update").phase("Init", "Final"),
+			[]string{"Org2UpdateInit", "Org2UpdateFinal"},
+			[]string{"Org2Update", "Org2UpdateRunning", "Org2ResetFinal"},
+		},
+		{
+			newEventFilterBuilder().eventType("Update").exclude("Org1"),
+			[]string{"Org2Update", "Org10Update"},
+			[]string{"Org1Update", "Org2Reset"},
+		},
+		{
+			// metacharacters in the names are matched literally
+			newEventFilterBuilder().organization("Org.1+").eventType("(Update)"),
+			[]string{"Org.1+(Update)"},
+			[]string{"OrgX1(Update)", "Org.11Update"},
+		},
+	} {
+		filter := c.filter.build()
+		reg, err := regexp2.Compile(filter, 0)
+		if err != nil {
+			t.Fatalf("filter %q does not compile: %v", filter, err)
+		}
+		for _, name := range c.match {
+			if matched, _ := reg.MatchString(name); !matched {
+				t.Errorf("filter %q does not match %q", filter, name)
+			}
+		}
+		for _, name := range c.noMatch {
+			if matched, _ := reg.MatchString(name); matched {
+				t.Errorf("filter %q matches %q", filter, name)
+			}
+		}
+	}
+}
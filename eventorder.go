@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+var eventWindow = flag.Int("event-window", 1000, "number of recent events remembered to drop events the peer delivers again")
+
+// eventKey identifies a chaincode event, a transaction can emit one event only but the name is kept for clarity in the logs
+type eventKey struct {
+	block uint64
+	txID  string
+	name  string
+}
+
+// eventSequencer lets every update through once and in ledger order
+// events are delivered again after a reconnect or a replay from the checkpoint, and the events drained from a replaced connection
+// can interleave with those of the new one
+type eventSequencer struct {
+	window int
+	seen   map[eventKey]bool
+	// recent holds the keys in the order they were seen, the oldest is forgotten once the window is full
+	recent []eventKey
+	// newest is the block of the latest update of each sender
+	newest map[string]uint64
+}
+
+func newEventSequencer(window int) *eventSequencer {
+	if window < 1 {
+		window = 1
+	}
+	return &eventSequencer{window: window, seen: map[eventKey]bool{}, newest: map[string]uint64{}}
+}
+
+// admit returns an error for an event that was processed before or is older than the sender's latest update
+func (s *eventSequencer) admit(event *client.ChaincodeEvent) error {
+	key := eventKey{block: event.BlockNumber, txID: event.TransactionID, name: event.EventName}
+	if s.seen[key] {
+		return fmt.Errorf("already processed (tx %s)", event.TransactionID)
+	}
+	if newest, ok := s.newest[event.EventName]; ok && event.BlockNumber < newest {
+		return fmt.Errorf("out of order, an update from block %v was processed already", newest)
+	}
+
+	s.seen[key] = true
+	s.recent = append(s.recent, key)
+	if len(s.recent) > s.window {
+		delete(s.seen, s.recent[0])
+		s.recent = s.recent[1:]
+	}
+	s.newest[event.EventName] = event.BlockNumber
+	return nil
+}
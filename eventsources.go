@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dlclark/regexp2"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+)
+
+// the message buses an event source can read the updates from
+const (
+	sourceKafka = "kafka"
+	sourceNATS  = "nats"
+)
+
+// EventSourceConfig is a message bus that carries the updates of participants that are not on the blockchain. Its
+// messages are combined with the chaincode events as if the chaincode had emitted them, so a hybrid deployment runs a
+// single optimization. A message is an event payload of any version, its name is the Kafka message key or the last
+// token of the NATS subject, e.g. Org4 of updates.Org4, and it has to match the event filter like a chaincode event
+type EventSourceConfig struct {
+	// Type is kafka or nats
+	Type string `json:"type" yaml:"type"`
+	// Brokers are the addresses of the Kafka brokers, e.g. kafka:9092
+	Brokers []string `json:"brokers" yaml:"brokers"`
+	// URL is the address of the NATS server, e.g. nats://nats:4222
+	URL string `json:"url" yaml:"url"`
+	// Topic is the Kafka topic or the NATS subject the updates are published to, a subject may have wildcards, e.g. updates.*
+	Topic string `json:"topic" yaml:"topic"`
+	// Group is the Kafka consumer group, each agent needs a group of its own to receive every update (default: agent-<mspId>)
+	Group string `json:"group" yaml:"group"`
+}
+
+func (c EventSourceConfig) validate() error {
+	switch c.Type {
+	case sourceKafka:
+		if len(c.Brokers) == 0 {
+			return errors.New("a kafka event source needs its brokers")
+		}
+	case sourceNATS:
+		if c.URL == "" {
+			return errors.New("a nats event source needs the url of the server")
+		}
+	default:
+		return fmt.Errorf("unknown event source type %q, use %s or %s", c.Type, sourceKafka, sourceNATS)
+	}
+	if c.Topic == "" {
+		return fmt.Errorf("the %s event source needs a topic", c.Type)
+	}
+	return nil
+}
+
+// offChain tells whether an event came from a message bus rather than from a block, the events of a bus are never
+// checkpointed, as the checkpoint is a position in the ledger
+func offChain(event *client.ChaincodeEvent) bool {
+	return event.BlockNumber == 0 && (strings.HasPrefix(event.TransactionID, sourceKafka+":") || strings.HasPrefix(event.TransactionID, sourceNATS+":"))
+}
+
+// openEventSources returns the event sources of the config, nil without any
+func openEventSources(configs []EventSourceConfig, mspID string) eventSources {
+	var sources eventSources
+	for _, c := range configs {
+		switch c.Type {
+		case sourceKafka:
+			group := c.Group
+			if group == "" {
+				group = "agent-" + mspID
+			}
+			sources = append(sources, &kafkaSource{brokers: c.Brokers, topic: c.Topic, group: group})
+		case sourceNATS:
+			sources = append(sources, &natsSource{url: c.URL, subject: c.Topic, name: "agent-" + mspID})
+		}
+	}
+	return sources
+}
+
+// eventSources are the message buses besides Fabric, their events arrive on one channel
+type eventSources []eventSource
+
+// RegisterEvent listens to the events of all sources, the channel is closed when all of them have ended
+// the options of a chaincode event stream don't apply to a bus, which delivers the messages published from now on
+func (s eventSources) RegisterEvent(eventFilter string, _ ...client.ChaincodeEventsOption) (context.CancelFunc, <-chan *client.ChaincodeEvent, error) {
+	ctx, stop := context.WithCancel(context.Background())
+	cancels := []context.CancelFunc{stop}
+	cancel := func() {
+		for _, c := range cancels {
+			c()
+		}
+	}
+	merged := make(chan *client.ChaincodeEvent, eventBufferSize)
+	var wg sync.WaitGroup
+	for _, source := range s {
+		reg, events, err := source.RegisterEvent(eventFilter)
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		cancels = append(cancels, reg)
+		wg.Add(1)
+		go func(events <-chan *client.ChaincodeEvent) {
+			defer wg.Done()
+			for event := range events {
+				select {
+				case merged <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(events)
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+	return cancel, merged, nil
+}
+
+// filteredEvents passes the events whose names match the filter on until the context is done
+// forward returns false once the registration is cancelled
+func filteredEvents(ctx context.Context, eventFilter string) (forward func(*client.ChaincodeEvent) bool, notifier chan *client.ChaincodeEvent, err error) {
+	filter, err := regexp2.Compile(eventFilter, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid event filter %q: %w", eventFilter, err)
+	}
+	notifier = make(chan *client.ChaincodeEvent, eventBufferSize)
+	return func(event *client.ChaincodeEvent) bool {
+		event.EventName = agentEventName(event.EventName)
+		if matched, _ := filter.MatchString(event.EventName); !matched {
+			return true
+		}
+		select {
+		case notifier <- event:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}, notifier, nil
+}
+
+// kafkaSource reads the updates from a Kafka topic
+type kafkaSource struct {
+	brokers []string
+	topic   string
+	group   string
+}
+
+func (s *kafkaSource) RegisterEvent(eventFilter string, _ ...client.ChaincodeEventsOption) (context.CancelFunc, <-chan *client.ChaincodeEvent, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	forward, notifier, err := filteredEvents(ctx, eventFilter)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	// a new group starts at the end of the topic, the updates of earlier runs are of no use
+	reader := kafka.NewReader(kafka.ReaderConfig{Brokers: s.brokers, Topic: s.topic, GroupID: s.group, StartOffset: kafka.LastOffset})
+	go func() {
+		defer close(notifier)
+		defer reader.Close()
+		for {
+			// the reader retries while the brokers are unreachable, it only fails once it is cancelled
+			m, err := reader.ReadMessage(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Warnf("Kafka topic %s ended: %v", s.topic, err)
+				}
+				return
+			}
+			event := &client.ChaincodeEvent{
+				TransactionID: fmt.Sprintf("%s:%s/%v/%v", sourceKafka, m.Topic, m.Partition, m.Offset),
+				EventName:     string(m.Key),
+				Payload:       m.Value,
+			}
+			if !forward(event) {
+				return
+			}
+		}
+	}()
+	return cancel, notifier, nil
+}
+
+// natsSource subscribes to a NATS subject
+type natsSource struct {
+	url     string
+	subject string
+	name    string
+}
+
+func (s *natsSource) RegisterEvent(eventFilter string, _ ...client.ChaincodeEventsOption) (context.CancelFunc, <-chan *client.ChaincodeEvent, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	forward, notifier, err := filteredEvents(ctx, eventFilter)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	// the client connects in the background and reconnects for as long as the registration lasts, so the optimization
+	// starts while the server is unreachable
+	conn, err := nats.Connect(s.url, nats.Name(s.name), nats.RetryOnFailedConnect(true), nats.MaxReconnects(-1))
+	if err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("failed to connect to NATS at %s: %w", s.url, err)
+	}
+	messages := make(chan *nats.Msg, eventBufferSize)
+	sub, err := conn.ChanSubscribe(s.subject, messages)
+	if err != nil {
+		conn.Close()
+		cancel()
+		return nil, nil, fmt.Errorf("failed to subscribe to %s: %w", s.subject, err)
+	}
+	go func() {
+		defer close(notifier)
+		defer conn.Close()
+		defer sub.Unsubscribe()
+		// the messages of a subject have no position of their own, they are numbered from the registration
+		registered, sequence := time.Now().UnixNano(), 0
+		for {
+			select {
+			case m := <-messages:
+				sequence++
+				tokens := strings.Split(m.Subject, ".")
+				event := &client.ChaincodeEvent{
+					TransactionID: fmt.Sprintf("%s:%s/%v/%v", sourceNATS, m.Subject, registered, sequence),
+					EventName:     tokens[len(tokens)-1],
+					Payload:       m.Data,
+				}
+				if !forward(event) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return cancel, notifier, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// the records /events sends unless the subscriber picks others with ?events=
+var streamedEvents = []string{"event", "iteration", "converged", "shutdown"}
+
+// like the dashboard's, the upgrader refuses pages from other origins, so a foreign site can't watch the run through
+// the browser; tools like notebooks and scripts connect without an Origin header and pass
+var streamUpgrader = websocket.Upgrader{}
+
+// handleEvents streams the received chaincode events and the computed iterations over a WebSocket, one JSON object per message
+// ?events=event,iteration,... selects other progress records
+func (s *apiServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	selected := streamedEvents
+	if list := r.URL.Query().Get("events"); list != "" {
+		selected = strings.Split(list, ",")
+	}
+	wanted := map[string]bool{}
+	for _, event := range selected {
+		wanted[strings.TrimSpace(event)] = true
+	}
+	// watching before the upgrade has been answered, the subscriber misses nothing after it
+	records, stop := s.watch()
+	defer stop()
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	closed := readUntilClosed(conn)
+	for {
+		select {
+		case record := <-records:
+			if !wanted[record["event"].(string)] {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(dashboardHealthInterval))
+			if err := conn.WriteJSON(record); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
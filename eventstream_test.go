@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestEventsRefusesOtherOrigins(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(testServer().handleEvents))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	_, response, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://example.com"}})
+	if err == nil || response == nil || response.StatusCode != http.StatusForbidden {
+		t.Errorf("a page from another origin: got %v", err)
+	}
+	// a notebook or script sends no Origin
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("a tool without an Origin: %v", err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const experimentUsage = "usage: experiment run <scenarios.yaml> [--report <file>]"
+
+// the networks an experiment runs against
+const (
+	experimentSimulator = "simulator"
+	experimentLive      = "live"
+)
+
+// ExperimentFile is the file of "experiment run", the scenarios to sweep
+type ExperimentFile struct {
+	Scenarios []ExperimentScenario `json:"scenarios" yaml:"scenarios"`
+}
+
+// ExperimentScenario sweeps the step sizes, the tolerances and the network sizes of an algorithm, every combination is run
+// Repetitions times
+type ExperimentScenario struct {
+	Name string `json:"name" yaml:"name"`
+	// Mode is "simulator" (default), which iterates generated networks in the process, or "live", which runs the agents
+	// of the config file against the Fabric network
+	Mode      string          `json:"mode" yaml:"mode"`
+	Algorithm AlgorithmConfig `json:"algorithm" yaml:"algorithm"`
+	// StepSizes are the steps of the price update, 0 is the decreasing step of the consensus algorithm, a positive step
+	// is the constant step of gradient tracking or the penalty of ADMM (default: 0)
+	StepSizes []float64 `json:"stepSizes" yaml:"stepSizes"`
+	// Tolerances are the convergence tolerances epsilon (default: the generator's)
+	Tolerances []float64 `json:"tolerances" yaml:"tolerances"`
+	// NetworkSizes are the numbers of nodes of the simulated ring, a live network has the agents of the config file
+	// (default: 4)
+	NetworkSizes []int `json:"networkSizes" yaml:"networkSizes"`
+	// Repetitions is the number of runs of every combination, the simulated networks differ between them (default: 1)
+	Repetitions int `json:"repetitions" yaml:"repetitions"`
+	// MaxIterations ends a run that has not converged (default: 1000)
+	MaxIterations int `json:"maxIterations" yaml:"maxIterations"`
+	// Seed makes the simulated networks reproducible
+	Seed int64 `json:"seed" yaml:"seed"`
+}
+
+func (s ExperimentScenario) validate() error {
+	switch s.Mode {
+	case "", experimentSimulator, experimentLive:
+	default:
+		return fmt.Errorf("unknown mode %q, use %s or %s", s.Mode, experimentSimulator, experimentLive)
+	}
+	if err := s.Algorithm.validate(); err != nil {
+		return err
+	}
+	for _, step := range s.StepSizes {
+		if step < 0 {
+			return fmt.Errorf("the step size must not be negative, got %v", step)
+		}
+	}
+	for _, epsilon := range s.Tolerances {
+		if epsilon <= 0 {
+			return fmt.Errorf("the tolerance must be positive, got %v", epsilon)
+		}
+	}
+	for _, n := range s.NetworkSizes {
+		if n < 2 {
+			return fmt.Errorf("a network needs at least 2 nodes, got %v", n)
+		}
+	}
+	if s.Repetitions < 0 || s.MaxIterations < 0 {
+		return errors.New("repetitions and maxIterations must not be negative")
+	}
+	return nil
+}
+
+// withDefaults fills in the sweeps left out, the tolerance is the generator's of the config file
+func (s ExperimentScenario) withDefaults(epsilon float64) ExperimentScenario {
+	if s.Mode == "" {
+		s.Mode = experimentSimulator
+	}
+	if len(s.StepSizes) == 0 {
+		s.StepSizes = []float64{0}
+	}
+	if len(s.Tolerances) == 0 {
+		s.Tolerances = []float64{epsilon}
+	}
+	if len(s.NetworkSizes) == 0 {
+		s.NetworkSizes = []int{4}
+	}
+	if s.Repetitions == 0 {
+		s.Repetitions = 1
+	}
+	if s.MaxIterations == 0 {
+		s.MaxIterations = 1000
+	}
+	return s
+}
+
+// algorithm returns the algorithm of a step size: the decreasing step of consensus for 0, otherwise the constant step
+// of gradient tracking or, for ADMM, its penalty
+func (s ExperimentScenario) algorithm(step float64) AlgorithmConfig {
+	a := s.Algorithm
+	switch {
+	case a.Name == algorithmADMM:
+		a.Penalty = step
+	case step > 0:
+		a.Name, a.StepSize = algorithmGradientTracking, step
+	default:
+		a.Name = algorithmConsensus
+	}
+	return a
+}
+
+func readExperiment(path string) ([]ExperimentScenario, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	var file ExperimentFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid scenarios file %s: %w", path, err)
+	}
+	if len(file.Scenarios) == 0 {
+		return nil, fmt.Errorf("%s has no scenario", path)
+	}
+	for i, s := range file.Scenarios {
+		if s.Name == "" {
+			file.Scenarios[i].Name = fmt.Sprintf("scenario-%d", i+1)
+		}
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("invalid scenario %s: %w", file.Scenarios[i].Name, err)
+		}
+	}
+	return file.Scenarios, nil
+}
+
+// experimentRun is the outcome of one run of a scenario
+type experimentRun struct {
+	Scenario   string  `json:"scenario"`
+	StepSize   float64 `json:"stepSize"`
+	Tolerance  float64 `json:"tolerance"`
+	Nodes      int     `json:"nodes"`
+	Repetition int     `json:"repetition"`
+	Converged  bool    `json:"converged"`
+	Iterations int     `json:"iterations"`
+	// Price is the mean price of the nodes at the end, PriceSpread the distance of the highest from the lowest
+	Price       float64 `json:"price"`
+	PriceSpread float64 `json:"priceSpread"`
+	// Mismatch is the largest mismatch of a node at the end
+	Mismatch float64       `json:"mismatch"`
+	Elapsed  time.Duration `json:"elapsed"`
+}
+
+// experimentSummary aggregates the runs of one combination of a scenario
+type experimentSummary struct {
+	Scenario       string  `json:"scenario"`
+	Mode           string  `json:"mode"`
+	Algorithm      string  `json:"algorithm"`
+	StepSize       float64 `json:"stepSize"`
+	Tolerance      float64 `json:"tolerance"`
+	Nodes          int     `json:"nodes"`
+	Runs           int     `json:"runs"`
+	Converged      int     `json:"converged"`
+	MeanIterations float64 `json:"meanIterations"`
+	MinIterations  int     `json:"minIterations"`
+	MaxIterations  int     `json:"maxIterations"`
+	MeanElapsed    float64 `json:"meanElapsedSeconds"`
+	MaxPriceSpread float64 `json:"maxPriceSpread"`
+	MaxMismatch    float64 `json:"maxMismatch"`
+}
+
+// summarize aggregates runs, the iterations and the time are those of the converged runs
+func summarize(s ExperimentScenario, step, epsilon float64, nodes int, runs []experimentRun) experimentSummary {
+	summary := experimentSummary{Scenario: s.Name, Mode: s.Mode, Algorithm: s.algorithm(step).Name, StepSize: step, Tolerance: epsilon, Nodes: nodes, Runs: len(runs)}
+	var iterations, elapsed float64
+	for _, r := range runs {
+		summary.MaxPriceSpread = math.Max(summary.MaxPriceSpread, r.PriceSpread)
+		summary.MaxMismatch = math.Max(summary.MaxMismatch, math.Abs(r.Mismatch))
+		if !r.Converged {
+			continue
+		}
+		if summary.Converged == 0 || r.Iterations < summary.MinIterations {
+			summary.MinIterations = r.Iterations
+		}
+		if r.Iterations > summary.MaxIterations {
+			summary.MaxIterations = r.Iterations
+		}
+		summary.Converged++
+		iterations += float64(r.Iterations)
+		elapsed += r.Elapsed.Seconds()
+	}
+	if summary.Converged > 0 {
+		summary.MeanIterations = iterations / float64(summary.Converged)
+		summary.MeanElapsed = elapsed / float64(summary.Converged)
+	}
+	return summary
+}
+
+func (s experimentSummary) String() string {
+	return fmt.Sprintf("%-16s %-18s step %-6v epsilon %-8v nodes %-3d converged %d/%d iterations %.1f [%d, %d]",
+		s.Scenario, s.Algorithm, s.StepSize, s.Tolerance, s.Nodes, s.Converged, s.Runs, s.MeanIterations, s.MinIterations, s.MaxIterations)
+}
+
+// experimentReport is the report of "experiment run"
+type experimentReport struct {
+	Time      time.Time           `json:"time"`
+	Summaries []experimentSummary `json:"summaries"`
+	Runs      []experimentRun     `json:"runs"`
+}
+
+var summaryColumns = []string{"scenario", "mode", "algorithm", "step_size", "tolerance", "nodes", "runs", "converged",
+	"mean_iterations", "min_iterations", "max_iterations", "mean_elapsed_seconds", "max_price_spread", "max_mismatch"}
+
+// save writes the report, a .csv file gets a row of every summary and any other file the JSON report with the runs
+func (r experimentReport) save(path string) error {
+	if !strings.EqualFold(filepath.Ext(path), ".csv") {
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, data, 0600)
+	}
+	f, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if err := w.Write(summaryColumns); err != nil {
+		return err
+	}
+	for _, s := range r.Summaries {
+		err := w.Write([]string{s.Scenario, s.Mode, s.Algorithm, formatValue(s.StepSize), formatValue(s.Tolerance),
+			strconv.Itoa(s.Nodes), strconv.Itoa(s.Runs), strconv.Itoa(s.Converged), formatValue(s.MeanIterations),
+			strconv.Itoa(s.MinIterations), strconv.Itoa(s.MaxIterations), formatValue(s.MeanElapsed),
+			formatValue(s.MaxPriceSpread), formatValue(s.MaxMismatch)})
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// simulatedNode is a node of a simulated network with its model and its state
+type simulatedNode struct {
+	cost      costFunction
+	limits    powerLimits
+	optimizer optimizer
+	neighbors []int
+	weight    float64
+	lambda    float64
+	mismatch  float64
+	P         float64
+}
+
+// simulatedNetwork returns a ring of n nodes with the algorithm, the even nodes are generators with random quadratic
+// costs and the odd ones elastic loads like the default load with random demands, within what the generators can supply
+// the consensus weights are the Metropolis weights of the ring
+func simulatedNetwork(n int, algorithm AlgorithmConfig, rng *rand.Rand) []*simulatedNode {
+	weight := 1.0 / 3
+	if n == 2 {
+		weight = 0.5
+	}
+	nodes := make([]*simulatedNode, n)
+	for i := range nodes {
+		node := &simulatedNode{optimizer: newOptimizer(algorithm), weight: weight}
+		if i%2 == 0 {
+			g := GeneratorModel{A: 0.5 + rng.Float64(), B: rng.Float64(), PMin: 0, PMax: 8}
+			node.cost, node.limits = g.costFunction(), g.limits()
+		} else {
+			l := defaultLoad
+			l.Demand = 2 + 4*rng.Float64()
+			node.cost, node.limits = demandCurve{l}, l.limits()
+			node.P, node.mismatch = -l.Demand, l.Demand
+		}
+		node.neighbors = []int{(i + n - 1) % n, (i + 1) % n}
+		if n == 2 {
+			node.neighbors = node.neighbors[:1]
+		}
+		node.lambda = node.cost.marginal(node.P)
+		node.optimizer.start(node.lambda, node.mismatch, node.P)
+		nodes[i] = node
+	}
+	return nodes
+}
+
+// simulate iterates a simulated network synchronously, every node steps from its neighbors' values of the last iteration,
+// until all nodes have converged or maxIterations
+func simulate(nodes []*simulatedNode, epsilon float64, maxIterations int) experimentRun {
+	start := time.Now()
+	var run experimentRun
+	for iter := 1; iter <= maxIterations; iter++ {
+		type state struct{ lambda, mismatch, P float64 }
+		next := make([]state, len(nodes))
+		for i, node := range nodes {
+			neighbors := make([]neighborUpdate, len(node.neighbors))
+			for k, j := range node.neighbors {
+				neighbors[k] = neighborUpdate{weight: node.weight, lambda: nodes[j].lambda, mismatch: nodes[j].mismatch}
+			}
+			l, m, P := node.optimizer.step(node.cost, node.limits, neighbors, node.lambda, node.mismatch, node.P, iter)
+			next[i] = state{l, m, P}
+		}
+		converged := true
+		for i, node := range nodes {
+			node.lambda, node.mismatch, node.P = next[i].lambda, next[i].mismatch, next[i].P
+			converged = converged && node.optimizer.converged(epsilon)
+		}
+		run.Iterations = iter
+		if converged {
+			run.Converged = true
+			break
+		}
+	}
+	run.Elapsed = time.Since(start)
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, node := range nodes {
+		run.Price += node.lambda / float64(len(nodes))
+		low, high = math.Min(low, node.lambda), math.Max(high, node.lambda)
+		if math.Abs(node.mismatch) > math.Abs(run.Mismatch) {
+			run.Mismatch = node.mismatch
+		}
+	}
+	run.PriceSpread = high - low
+	return run
+}
+
+// runLive runs the agents of the config file once with the algorithm and the tolerance
+// a run has converged if every agent has
+func runLive(base Config, algorithm AlgorithmConfig, epsilon float64, maxIterations int) (experimentRun, error) {
+	if len(base.Agents) == 0 {
+		return experimentRun{}, errors.New("a live experiment runs the agents of the config file, it has none")
+	}
+	base.Algorithm = algorithm
+	base.Generator.Epsilon, base.Generator.MaxIterations = epsilon, maxIterations
+	agents := make([]AgentConfig, len(base.Agents))
+	for i, agent := range base.Agents {
+		if agent.Generator != nil {
+			generator := *agent.Generator
+			generator.Epsilon, generator.MaxIterations = epsilon, maxIterations
+			agent.Generator = &generator
+		}
+		agents[i] = agent
+	}
+	start := time.Now()
+	ran, _ := startAgents(base, agents)
+	run := experimentRun{Nodes: len(agents), Converged: len(ran) == len(agents), Elapsed: time.Since(start)}
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, a := range ran {
+		if a.result == nil {
+			run.Converged = false
+			continue
+		}
+		r := a.result
+		if r.Iterations > run.Iterations {
+			run.Iterations = r.Iterations
+		}
+		run.Price += r.Price / float64(len(ran))
+		low, high = math.Min(low, r.Price), math.Max(high, r.Price)
+		if math.Abs(r.Mismatch) > math.Abs(run.Mismatch) {
+			run.Mismatch = r.Mismatch
+		}
+	}
+	if high >= low {
+		run.PriceSpread = high - low
+	}
+	return run, nil
+}
+
+// runScenario runs every combination of a scenario, the runs of the simulator are seeded from the scenario's seed
+func runScenario(s ExperimentScenario, base Config) ([]experimentSummary, []experimentRun, error) {
+	s = s.withDefaults(base.Generator.Epsilon)
+	sizes := s.NetworkSizes
+	if s.Mode == experimentLive {
+		sizes = []int{len(base.Agents)}
+	}
+	rng := rand.New(rand.NewSource(s.Seed))
+	var summaries []experimentSummary
+	var all []experimentRun
+	for _, step := range s.StepSizes {
+		algorithm := s.algorithm(step)
+		for _, epsilon := range s.Tolerances {
+			for _, n := range sizes {
+				var runs []experimentRun
+				for rep := 1; rep <= s.Repetitions; rep++ {
+					var run experimentRun
+					if s.Mode == experimentLive {
+						var err error
+						if run, err = runLive(base, algorithm, epsilon, s.MaxIterations); err != nil {
+							return nil, nil, err
+						}
+					} else {
+						run = simulate(simulatedNetwork(n, algorithm, rng), epsilon, s.MaxIterations)
+					}
+					run.Scenario, run.StepSize, run.Tolerance, run.Nodes, run.Repetition = s.Name, step, epsilon, n, rep
+					progress("experiment", map[string]interface{}{"scenario": s.Name, "stepSize": step, "tolerance": epsilon, "nodes": n,
+						"repetition": rep, "converged": run.Converged, "iterations": run.Iterations})
+					runs = append(runs, run)
+				}
+				summary := summarize(s, step, epsilon, n, runs)
+				fmt.Println(summary)
+				summaries = append(summaries, summary)
+				all = append(all, runs...)
+			}
+		}
+	}
+	return summaries, all, nil
+}
+
+// experimentCommand runs "experiment run <scenarios.yaml> [--report <file>]"
+func experimentCommand(args []string) error {
+	if len(args) == 0 || args[0] != "run" {
+		return errors.New(experimentUsage)
+	}
+	flags := flag.NewFlagSet("experiment run", flag.ContinueOnError)
+	reportFile := flags.String("report", "experiment-report.json", "file the report is written to, a .csv file gets the summaries only")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	// the scenarios file may come before the flags as well
+	rest := flags.Args()
+	if len(rest) > 0 {
+		if err := flags.Parse(rest[1:]); err != nil {
+			return err
+		}
+	}
+	if len(rest) == 0 || flags.NArg() != 0 {
+		return errors.New(experimentUsage)
+	}
+	scenarios, err := readExperiment(rest[0])
+	if err != nil {
+		return err
+	}
+	for _, s := range scenarios {
+		if s.Mode == experimentLive {
+			if err := checkAgentFlags(); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	base, err := readConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load the configuration: %w", err)
+	}
+	report := experimentReport{Time: time.Now()}
+	for _, s := range scenarios {
+		summaries, runs, err := runScenario(s, base)
+		if err != nil {
+			return fmt.Errorf("scenario %s: %w", s.Name, err)
+		}
+		report.Summaries = append(report.Summaries, summaries...)
+		report.Runs = append(report.Runs, runs...)
+	}
+	if err := report.save(*reportFile); err != nil {
+		return fmt.Errorf("failed to write the report: %w", err)
+	}
+	logger.Infof("Wrote the report of %d runs to %s", len(report.Runs), *reportFile)
+	return nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// blocks and transactions are read through the query system chaincode of the peer
+const qscc = "qscc"
+
+// blockInfo is the readable form of a block
+type blockInfo struct {
+	Number       uint64   `json:"number"`
+	DataHash     string   `json:"dataHash"`
+	PreviousHash string   `json:"previousHash"`
+	Transactions []txInfo `json:"transactions"`
+}
+
+// txInfo is the readable form of a transaction
+type txInfo struct {
+	TxID           string      `json:"txId"`
+	Channel        string      `json:"channel"`
+	Type           string      `json:"type"`
+	Timestamp      time.Time   `json:"timestamp"`
+	CreatorMSP     string      `json:"creatorMsp"`
+	ValidationCode string      `json:"validationCode"`
+	Chaincode      string      `json:"chaincode,omitempty"`
+	Function       string      `json:"function,omitempty"`
+	Args           []string    `json:"args,omitempty"`
+	Reads          []readInfo  `json:"reads,omitempty"`
+	Writes         []writeInfo `json:"writes,omitempty"`
+	Events         []eventInfo `json:"events,omitempty"`
+}
+
+type readInfo struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	Version   string `json:"version,omitempty"`
+}
+
+type writeInfo struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	Value     string `json:"value,omitempty"`
+	IsDelete  bool   `json:"isDelete,omitempty"`
+}
+
+type eventInfo struct {
+	Name    string `json:"name"`
+	Payload string `json:"payload"`
+}
+
+// blockCommand prints the block with the given number
+func blockCommand(gw *gatewayConnection, args []string) error {
+	if len(args) != 2 || args[0] != "get" {
+		return fmt.Errorf("usage: block get <number>")
+	}
+	if _, err := strconv.ParseUint(args[1], 10, 64); err != nil {
+		return fmt.Errorf("invalid block number %q", args[1])
+	}
+	data, err := systemContract(gw).EvaluateTransaction("GetBlockByNumber", cfg.NetworkName, args[1])
+	if err != nil {
+		return fmt.Errorf("failed to get block %s: %w", args[1], explainError(err))
+	}
+	block, err := decodeBlock(data)
+	if err != nil {
+		return err
+	}
+	return printJSON(block)
+}
+
+// txCommand prints the transaction with the given ID
+func txCommand(gw *gatewayConnection, args []string) error {
+	if len(args) != 2 || args[0] != "get" {
+		return fmt.Errorf("usage: tx get <id>")
+	}
+	data, err := systemContract(gw).EvaluateTransaction("GetTransactionByID", cfg.NetworkName, args[1])
+	if err != nil {
+		return fmt.Errorf("failed to get transaction %s: %w", args[1], explainError(err))
+	}
+	processed := &peer.ProcessedTransaction{}
+	if err := proto.Unmarshal(data, processed); err != nil {
+		return fmt.Errorf("failed to decode transaction: %w", err)
+	}
+	tx, err := decodeEnvelope(processed.TransactionEnvelope)
+	if err != nil {
+		return err
+	}
+	tx.ValidationCode = peer.TxValidationCode(processed.ValidationCode).String()
+	return printJSON(tx)
+}
+
+func systemContract(gw *gatewayConnection) *client.Contract {
+	return gw.GetNetwork(cfg.NetworkName).GetContract(qscc)
+}
+
+func printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func decodeBlock(data []byte) (*blockInfo, error) {
+	block := &common.Block{}
+	if err := proto.Unmarshal(data, block); err != nil {
+		return nil, fmt.Errorf("failed to decode block: %w", err)
+	}
+	return readBlock(block)
+}
+
+// readBlock decodes the transactions of a block
+func readBlock(block *common.Block) (*blockInfo, error) {
+	info := &blockInfo{
+		Number:       block.Header.Number,
+		DataHash:     fmt.Sprintf("%x", block.Header.DataHash),
+		PreviousHash: fmt.Sprintf("%x", block.Header.PreviousHash),
+	}
+	// the validation code of every transaction is kept in the block metadata
+	var filter []byte
+	if block.Metadata != nil && len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		filter = block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+	for i, envBytes := range block.Data.Data {
+		env := &common.Envelope{}
+		if err := proto.Unmarshal(envBytes, env); err != nil {
+			return nil, fmt.Errorf("failed to decode transaction %v: %w", i, err)
+		}
+		tx, err := decodeEnvelope(env)
+		if err != nil {
+			return nil, err
+		}
+		if i < len(filter) {
+			tx.ValidationCode = peer.TxValidationCode(filter[i]).String()
+		}
+		info.Transactions = append(info.Transactions, tx)
+	}
+	return info, nil
+}
+
+func decodeEnvelope(env *common.Envelope) (txInfo, error) {
+	var info txInfo
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(env.Payload, payload); err != nil {
+		return info, fmt.Errorf("failed to decode payload: %w", err)
+	}
+	if payload.Header == nil {
+		return info, fmt.Errorf("transaction has no header")
+	}
+	chdr := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.Header.ChannelHeader, chdr); err != nil {
+		return info, fmt.Errorf("failed to decode channel header: %w", err)
+	}
+	info.TxID = chdr.TxId
+	info.Channel = chdr.ChannelId
+	info.Type = common.HeaderType(chdr.Type).String()
+	if chdr.Timestamp != nil {
+		info.Timestamp = chdr.Timestamp.AsTime()
+	}
+
+	shdr := &common.SignatureHeader{}
+	if err := proto.Unmarshal(payload.Header.SignatureHeader, shdr); err == nil {
+		creator := &msp.SerializedIdentity{}
+		if err := proto.Unmarshal(shdr.Creator, creator); err == nil {
+			info.CreatorMSP = creator.Mspid
+		}
+	}
+
+	if common.HeaderType(chdr.Type) != common.HeaderType_ENDORSER_TRANSACTION {
+		return info, nil
+	}
+	tx := &peer.Transaction{}
+	if err := proto.Unmarshal(payload.Data, tx); err != nil {
+		return info, fmt.Errorf("failed to decode transaction: %w", err)
+	}
+	for _, action := range tx.Actions {
+		if err := decodeAction(action, &info); err != nil {
+			return info, err
+		}
+	}
+	return info, nil
+}
+
+func decodeAction(action *peer.TransactionAction, info *txInfo) error {
+	actionPayload := &peer.ChaincodeActionPayload{}
+	if err := proto.Unmarshal(action.Payload, actionPayload); err != nil {
+		return fmt.Errorf("failed to decode action: %w", err)
+	}
+
+	// the function and arguments the transaction was invoked with
+	proposal := &peer.ChaincodeProposalPayload{}
+	if err := proto.Unmarshal(actionPayload.ChaincodeProposalPayload, proposal); err == nil {
+		spec := &peer.ChaincodeInvocationSpec{}
+		if err := proto.Unmarshal(proposal.Input, spec); err == nil && spec.ChaincodeSpec != nil && spec.ChaincodeSpec.Input != nil {
+			for i, arg := range spec.ChaincodeSpec.Input.Args {
+				if i == 0 {
+					info.Function = string(arg)
+				} else {
+					info.Args = append(info.Args, string(arg))
+				}
+			}
+		}
+	}
+
+	if actionPayload.Action == nil {
+		return nil
+	}
+	prp := &peer.ProposalResponsePayload{}
+	if err := proto.Unmarshal(actionPayload.Action.ProposalResponsePayload, prp); err != nil {
+		return fmt.Errorf("failed to decode proposal response: %w", err)
+	}
+	ca := &peer.ChaincodeAction{}
+	if err := proto.Unmarshal(prp.Extension, ca); err != nil {
+		return fmt.Errorf("failed to decode chaincode action: %w", err)
+	}
+	if ca.ChaincodeId != nil {
+		info.Chaincode = ca.ChaincodeId.Name
+	}
+
+	txrw := &rwset.TxReadWriteSet{}
+	if err := proto.Unmarshal(ca.Results, txrw); err == nil {
+		for _, ns := range txrw.NsRwset {
+			kv := &kvrwset.KVRWSet{}
+			if err := proto.Unmarshal(ns.Rwset, kv); err != nil {
+				continue
+			}
+			for _, r := range kv.Reads {
+				read := readInfo{Namespace: ns.Namespace, Key: r.Key}
+				if r.Version != nil {
+					read.Version = fmt.Sprintf("%v:%v", r.Version.BlockNum, r.Version.TxNum)
+				}
+				info.Reads = append(info.Reads, read)
+			}
+			for _, w := range kv.Writes {
+				info.Writes = append(info.Writes, writeInfo{Namespace: ns.Namespace, Key: w.Key, Value: string(w.Value), IsDelete: w.IsDelete})
+			}
+		}
+	}
+
+	event := &peer.ChaincodeEvent{}
+	if err := proto.Unmarshal(ca.Events, event); err == nil && event.EventName != "" {
+		info.Events = append(info.Events, eventInfo{Name: event.EventName, Payload: string(event.Payload)})
+	}
+	return nil
+}
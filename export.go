@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var exportFile = flag.String("export", "", "file every iteration of the run is written to when it ends, for plotting the convergence; a .csv file gets a row per iteration, any other file a JSON array")
+
+// convergencePoint is the state of the node after one iteration
+type convergencePoint struct {
+	Iteration int     `json:"iteration"`
+	Lambda    float64 `json:"lambda"`
+	Mismatch  float64 `json:"mismatch"`
+	P         float64 `json:"p"`
+	Eta       float64 `json:"eta"`
+	// Elapsed is the time since the start of the optimization in seconds
+	Elapsed float64 `json:"elapsed"`
+}
+
+// convergenceLog keeps every iteration of the run in memory, unlike the history it never drops one
+type convergenceLog struct {
+	start  time.Time
+	points []convergencePoint
+}
+
+// newConvergenceLog returns a log that only records anything if -export is set
+func newConvergenceLog(start time.Time) *convergenceLog {
+	if *exportFile == "" {
+		return nil
+	}
+	return &convergenceLog{start: start}
+}
+
+func (c *convergenceLog) add(iter int, lambda, mismatch, P, eta float64) {
+	if c == nil {
+		return
+	}
+	c.points = append(c.points, convergencePoint{
+		Iteration: iter,
+		Lambda:    lambda,
+		Mismatch:  mismatch,
+		P:         P,
+		Eta:       eta,
+		Elapsed:   time.Since(c.start).Seconds(),
+	})
+}
+
+var convergenceColumns = []string{"iteration", "lambda", "mismatch", "p", "eta", "elapsed_seconds"}
+
+// save writes the iterations to the -export file
+func (c *convergenceLog) save(path string) error {
+	if c == nil || path == "" {
+		return nil
+	}
+	if !strings.EqualFold(filepath.Ext(path), ".csv") {
+		data, err := json.MarshalIndent(c.points, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, data, 0600)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if err := w.Write(convergenceColumns); err != nil {
+		return err
+	}
+	for _, p := range c.points {
+		err := w.Write([]string{
+			strconv.Itoa(p.Iteration),
+			formatValue(p.Lambda),
+			formatValue(p.Mismatch),
+			formatValue(p.P),
+			formatValue(p.Eta),
+			formatValue(p.Elapsed),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,191 @@
+package fabricagent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"google.golang.org/grpc/status"
+)
+
+// Failure is a known kind of transaction failure with an actionable explanation
+type Failure struct {
+	// Code names the failure, e.g. MVCC_READ_CONFLICT, it is the status the peers report it with if they have one
+	Code string
+	// Markers are further texts of the errors of the failure
+	Markers []string
+	// Message says what went wrong and Remedy what to do about it
+	Message string
+	Remedy  string
+}
+
+// the failures are matched in order, the first one whose code or marker appears in the error wins
+var Failures = []Failure{
+	{
+		Code:    "ENDORSEMENT_POLICY_FAILURE",
+		Message: "the transaction was not endorsed by enough organizations to satisfy the chaincode's endorsement policy",
+		Remedy:  "check that the peers of every organization required by the policy are running and reachable, and that the chaincode is approved and installed on them",
+	},
+	{
+		Code:    "MVCC_READ_CONFLICT",
+		Message: "another transaction changed a key this transaction read before it was committed",
+		Remedy:  "submit the transaction again; if it keeps happening, avoid updating the same key from several clients at once",
+	},
+	{
+		Code:    "PHANTOM_READ_CONFLICT",
+		Message: "another transaction changed the result of a range query this transaction ran before it was committed",
+		Remedy:  "submit the transaction again",
+	},
+	{
+		Code:    "DUPLICATE_TXID",
+		Message: "a transaction with the same ID is already on the ledger",
+		Remedy:  "create a new transaction instead of resending the old one",
+	},
+	{
+		Code:    "ENDORSEMENT_MISMATCH",
+		Markers: []string{"ProposalResponsePayloads do not match"},
+		Message: "the endorsing peers returned different results for the same transaction",
+		Remedy:  "make the chaincode deterministic, e.g. do not use the local time, random numbers or map iteration order in it",
+	},
+	{
+		Code:    "CHAINCODE_NOT_FOUND",
+		Markers: []string{"could not find chaincode", "chaincode definition for", "cannot get package for chaincode", "not found in channel"},
+		Message: "the chaincode is not deployed on the channel",
+		Remedy:  "deploy the chaincode set as contractName on the channel set as networkName in the configuration, e.g. with the test network's deployCC script",
+	},
+	{
+		Code:    "ACCESS_DENIED",
+		Markers: []string{"access denied", "creator org unknown", "identity is not valid", "certificate signed by unknown authority", "failed to verify certificate"},
+		Message: "the peer rejected this client's identity",
+		Remedy:  "the network was probably recreated with new credentials, clean up the wallet and start again to import the current ones",
+	},
+	{
+		Code:    "NO_ENDORSERS",
+		Markers: []string{"no endorsement combination can be satisfied", "no peers", "discovery"},
+		Message: "the client could not find peers to endorse the transaction",
+		Remedy:  "check that the peers are running and that anchor peers are set on the channel, so the gateway peer can discover them",
+	},
+	{
+		Code:    "UNREACHABLE",
+		Markers: []string{"connection refused", "DeadlineExceeded", "deadline exceeded", "Unavailable", "CONNECTION_FAILED", "no such host", "client connection is closing"},
+		Message: "a peer or orderer could not be reached",
+		Remedy:  "check that the network is up and that the peerEndpoint of the configuration is reachable from this machine",
+	},
+}
+
+// Diagnosis is what a transaction error tells
+type Diagnosis struct {
+	// Failure is the known failure of the error, if it is one
+	Failure *Failure
+	// ChaincodeMessage is the message of a chaincode that rejected the transaction, if it did
+	ChaincodeMessage string
+	// Raw is the error message followed by the errors of the peers behind it
+	Raw string
+}
+
+// Diagnose matches a transaction error against the known failures, the first one whose code or marker appears in the
+// error wins; an error of the chaincode is none of them
+func Diagnose(err error) Diagnosis {
+	d := Diagnosis{Raw: ErrorText(err)}
+	if message, ok := ChaincodeMessage(err); ok {
+		d.ChaincodeMessage = message
+		return d
+	}
+	for i, f := range Failures {
+		if strings.Contains(d.Raw, f.Code) || containsAny(d.Raw, f.Markers) {
+			d.Failure = &Failures[i]
+			break
+		}
+	}
+	return d
+}
+
+// Code returns the code of the known failure, or an empty string
+func (d Diagnosis) Code() string {
+	if d.Failure == nil {
+		return ""
+	}
+	return d.Failure.Code
+}
+
+// Explain turns the diagnosis into a message saying what went wrong and what to do about it, followed by the raw
+// error; the hints are added to the remedy
+func (d Diagnosis) Explain(hints ...string) string {
+	// chaincode errors carry the message the chaincode returned, which is more useful than the wrapping around it
+	if d.ChaincodeMessage != "" {
+		return fmt.Sprintf("the chaincode rejected the transaction: %s; check the function name and arguments\n  cause: %s", d.ChaincodeMessage, d.Raw)
+	}
+	if d.Failure != nil {
+		remedy := d.Failure.Remedy
+		for _, hint := range hints {
+			if hint != "" {
+				remedy += "; " + hint
+			}
+		}
+		return fmt.Sprintf("%s (%s); %s\n  cause: %s", d.Failure.Message, d.Failure.Code, remedy, d.Raw)
+	}
+	if strings.Contains(d.Raw, "chaincode response 500") || strings.Contains(d.Raw, "Chaincode status Code: (500)") {
+		return fmt.Sprintf("the chaincode rejected the transaction; check the function name and arguments\n  cause: %s", d.Raw)
+	}
+	return d.Raw
+}
+
+// Explain turns a transaction error into a message saying what went wrong and what to do about it, followed by the raw error
+func Explain(err error) string {
+	if err == nil {
+		return ""
+	}
+	return Diagnose(err).Explain()
+}
+
+// FailureCode returns the code of the known failure the error is, or an empty string
+func FailureCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	return Diagnose(err).Code()
+}
+
+// PeerDetails returns the errors the peers reported to the gateway peer, which are not part of the error message
+func PeerDetails(err error) []*gateway.ErrorDetail {
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &grpcErr) {
+		return nil
+	}
+	var details []*gateway.ErrorDetail
+	for _, d := range grpcErr.GRPCStatus().Details() {
+		if detail, ok := d.(*gateway.ErrorDetail); ok {
+			details = append(details, detail)
+		}
+	}
+	return details
+}
+
+// ErrorText returns the error message followed by the errors of the peers behind it
+func ErrorText(err error) string {
+	text := err.Error()
+	for _, d := range PeerDetails(err) {
+		text += fmt.Sprintf("\n  peer %s (%s): %s", d.Address, d.MspId, d.Message)
+	}
+	return text
+}
+
+// ChaincodeMessage returns the message of a chaincode that rejected the transaction
+func ChaincodeMessage(err error) (string, bool) {
+	for _, d := range PeerDetails(err) {
+		if i := strings.Index(d.Message, "chaincode response 500, "); i >= 0 {
+			return d.Message[i+len("chaincode response 500, "):], true
+		}
+	}
+	return "", false
+}
+
+func containsAny(s string, markers []string) bool {
+	for _, m := range markers {
+		if strings.Contains(s, m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package fabricagent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dlclark/regexp2"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// EventBufferSize is the number of events buffered like the event channels of the legacy SDK, so a slow client doesn't
+// hold up the peer's stream
+const EventBufferSize = 100
+
+// Subscribe listens to the events of the chaincode whose names match the filter, a regular expression in the syntax
+// of .NET, e.g. with lookarounds. The channel is closed when the stream from the peer ends or the context is done,
+// the options set where reading starts
+func Subscribe(ctx context.Context, network *client.Network, chaincode string, filter string, options ...client.ChaincodeEventsOption) (<-chan *client.ChaincodeEvent, error) {
+	events, err := network.ChaincodeEvents(ctx, chaincode, options...)
+	if err != nil {
+		return nil, err
+	}
+	return FilterEvents(ctx, events, filter, nil)
+}
+
+// FilterEvents forwards the events whose names match the filter, after the rename function, if any, has renamed them.
+// The channel is closed when the events end or the context is done
+func FilterEvents(ctx context.Context, events <-chan *client.ChaincodeEvent, filter string, rename func(string) string) (<-chan *client.ChaincodeEvent, error) {
+	re, err := regexp2.Compile(filter, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event filter %q: %w", filter, err)
+	}
+	notifier := make(chan *client.ChaincodeEvent, EventBufferSize)
+	go func() {
+		defer close(notifier)
+		for event := range events {
+			if rename != nil {
+				event.EventName = rename(event.EventName)
+			}
+			if matched, _ := re.MatchString(event.EventName); !matched {
+				continue
+			}
+			select {
+			case notifier <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return notifier, nil
+}
@@ -0,0 +1,172 @@
+// Package fabricagent is the gateway plumbing of the energy management agent, for other microgrid applications that
+// talk to the same chaincode: a TLS connection to a gateway peer, the file wallet in the format of the Fabric SDKs,
+// the subscription to chaincode events by a regular expression, and transactions that wait for their commit and
+// explain their failures.
+//
+// A client connects with the credentials of a user and gets the contract:
+//
+//	conn, err := fabricagent.Connect(fabricagent.Options{
+//		PeerEndpoint: "localhost:7051",
+//		TLSCACerts:   []string{"peers/peer0.org1.example.com/tls/ca.crt"},
+//		ServerName:   "peer0.org1.example.com",
+//		MSPID:        "Org1MSP",
+//		CertPath:     "users/User1@org1.example.com/msp/signcerts/cert.pem",
+//		KeyPath:      "users/User1@org1.example.com/msp/keystore",
+//		Channel:      "mychannel",
+//		Chaincode:    "basic",
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer conn.Close()
+//	events, err := fabricagent.Subscribe(ctx, conn.Network, "basic", "Org[0-9]+")
+//	result, txID, err := fabricagent.SubmitAndWait(conn.Contract, "SendUpdate", client.WithArguments("Lambda=6.2, Mismatch=0.4, end"))
+//	if err != nil {
+//		log.Print(fabricagent.Explain(err))
+//	}
+//
+// The package has no configuration file, flags or logging of its own, the agent adds those on top of it.
+package fabricagent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Options are the settings of a connection to a gateway peer
+type Options struct {
+	// PeerEndpoint is the host:port of the gateway peer
+	PeerEndpoint string
+	// TLSCACerts are the PEM files of the CA certificates the peer's TLS certificate may be issued by, e.g. its tls/ca.crt
+	TLSCACerts []string
+	// ServerName is the name the peer's TLS certificate is checked against, e.g. peer0.org1.example.com
+	ServerName string
+	// ClientCert and ClientKey authenticate the client to a peer that requires mutual TLS
+	ClientCert string
+	ClientKey  string
+
+	// MSPID, CertPath and KeyPath are the identity the client signs with, the key path may be a keystore folder;
+	// Identity replaces them with an identity of a wallet
+	MSPID    string
+	CertPath string
+	KeyPath  string
+	Identity *Identity
+
+	// Channel and Chaincode select the contract of the connection, a connection without them has no Network or Contract
+	Channel   string
+	Chaincode string
+}
+
+// Connection is a gateway together with the gRPC connection to the peer it runs on
+type Connection struct {
+	*client.Gateway
+	// Conn is the gRPC connection, which a client may share with further gateways
+	Conn *grpc.ClientConn
+	// Network and Contract are those of the channel and the chaincode of the options
+	Network  *client.Network
+	Contract *client.Contract
+}
+
+// Close closes the gateway and its connection to the peer
+func (c *Connection) Close() error {
+	err := c.Gateway.Close()
+	if cerr := c.Conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Connect connects to the gateway peer with the identity of the options
+func Connect(o Options) (*Connection, error) {
+	id := o.Identity
+	if id == nil {
+		cert, key, err := LoadCredentials(o.CertPath, o.KeyPath)
+		if err != nil {
+			return nil, err
+		}
+		id = NewX509Identity(o.MSPID, cert, key)
+	}
+	x509ID, sign, err := id.Signer()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := Dial(o)
+	if err != nil {
+		return nil, err
+	}
+	gateway, err := client.Connect(x509ID, ConnectOptions(sign, conn)...)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to gateway: %w", err)
+	}
+	c := &Connection{Gateway: gateway, Conn: conn}
+	if o.Channel != "" {
+		c.Network = gateway.GetNetwork(o.Channel)
+		if o.Chaincode != "" {
+			c.Contract = c.Network.GetContract(o.Chaincode)
+		}
+	}
+	return c, nil
+}
+
+// Dial opens a TLS connection to the gateway peer of the options
+func Dial(o Options) (*grpc.ClientConn, error) {
+	config, err := TLSConfig(o.TLSCACerts, o.ServerName, o.ClientCert, o.ClientKey)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := grpc.Dial(o.PeerEndpoint, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection to %s: %w", o.PeerEndpoint, err)
+	}
+	return conn, nil
+}
+
+// TLSConfig returns the TLS settings that trust the CA certificates, or PEM bundles of them, and check the peer's
+// certificate against the server name; a client certificate and key are presented to a peer that requires mutual TLS
+func TLSConfig(caCerts []string, serverName string, clientCert string, clientKey string) (*tls.Config, error) {
+	if len(caCerts) == 0 {
+		return nil, errors.New("no TLS CA certificate")
+	}
+	pool := x509.NewCertPool()
+	for _, path := range caCerts {
+		pem, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the TLS certificate: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("invalid TLS certificate %s: no certificate found", path)
+		}
+	}
+	config := &tls.Config{RootCAs: pool, ServerName: serverName, MinVersion: tls.VersionTLS12}
+	if clientCert != "" {
+		certificate, err := tls.LoadX509KeyPair(filepath.Clean(clientCert), filepath.Clean(clientKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the TLS client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// ConnectOptions are the options of client.Connect with the timeouts the agent uses for the calls to the gateway peer
+func ConnectOptions(sign identity.Sign, conn *grpc.ClientConn) []client.ConnectOption {
+	return []client.ConnectOption{
+		client.WithSign(sign),
+		client.WithClientConnection(conn),
+		client.WithEvaluateTimeout(5 * time.Second),
+		client.WithEndorseTimeout(15 * time.Second),
+		client.WithSubmitTimeout(5 * time.Second),
+		client.WithCommitStatusTimeout(1 * time.Minute),
+	}
+}
@@ -0,0 +1,167 @@
+package fabricagent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+func TestWallet(t *testing.T) {
+	w, err := OpenWallet(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Exists("appUser") {
+		t.Fatal("an empty wallet has appUser")
+	}
+	if err := w.Put("appUser", NewX509Identity("Org1MSP", "cert", "key")); err != nil {
+		t.Fatal(err)
+	}
+	id, err := w.Get("appUser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.MspID != "Org1MSP" || id.Type != X509IdentityType || id.Credentials.PrivateKey != "key" {
+		t.Errorf("got %+v", id)
+	}
+	if labels, _ := w.List(); len(labels) != 1 || labels[0] != "appUser" {
+		t.Errorf("got labels %v", labels)
+	}
+	if err := w.Remove("appUser"); err != nil || w.Exists("appUser") {
+		t.Errorf("appUser is still in the wallet: %v", err)
+	}
+}
+
+// writeCredentials writes a self-signed certificate and its key in a keystore folder, as cryptogen does
+func writeCredentials(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "User1@org1.example.com"},
+		DNSNames:              []string{"peer0.org1.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certPath, keystore := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "keystore")
+	if err := os.Mkdir(keystore, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(keystore, "priv_sk"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keystore
+}
+
+func TestConnect(t *testing.T) {
+	certPath, keystore := writeCredentials(t)
+	o := Options{
+		// the gateway is reached only by the first call, so nothing needs to listen
+		PeerEndpoint: "localhost:7051",
+		TLSCACerts:   []string{certPath},
+		ServerName:   "peer0.org1.example.com",
+		MSPID:        "Org1MSP",
+		CertPath:     certPath,
+		KeyPath:      keystore,
+		Channel:      "mychannel",
+		Chaincode:    "basic",
+	}
+	conn, err := Connect(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.Network == nil || conn.Network.Name() != "mychannel" || conn.Contract == nil || conn.Contract.ChaincodeName() != "basic" {
+		t.Errorf("got network %v and contract %v", conn.Network, conn.Contract)
+	}
+	if err := conn.Close(); err != nil {
+		t.Error(err)
+	}
+
+	// a wallet identity replaces the credential files, a connection without a channel has no contract
+	cert, key, err := LoadCredentials(certPath, keystore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.CertPath, o.KeyPath, o.Identity, o.Channel = "", "", NewX509Identity("Org1MSP", cert, key), ""
+	if conn, err = Connect(o); err != nil {
+		t.Fatal(err)
+	}
+	if conn.Network != nil || conn.Contract != nil {
+		t.Error("a connection without a channel has a contract")
+	}
+	conn.Close()
+
+	o.TLSCACerts = nil
+	if _, err := Connect(o); err == nil {
+		t.Error("connected without a TLS CA")
+	}
+	o.TLSCACerts, o.Identity = []string{certPath}, &Identity{MspID: "Org1MSP", Type: "HSM-X.509"}
+	if _, err := Connect(o); err == nil || !strings.Contains(err.Error(), "unsupported identity type") {
+		t.Errorf("an HSM identity: got %v", err)
+	}
+}
+
+func TestFilterEvents(t *testing.T) {
+	events := make(chan *client.ChaincodeEvent, 3)
+	for _, name := range []string{"Org1", "Org2", "Other"} {
+		events <- &client.ChaincodeEvent{EventName: name}
+	}
+	close(events)
+	if _, err := FilterEvents(context.Background(), events, "(", nil); err == nil {
+		t.Error("an invalid filter was accepted")
+	}
+	rename := func(name string) string { return strings.Replace(name, "Other", "Org3", 1) }
+	filtered, err := FilterEvents(context.Background(), events, "^Org(?!1)", rename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for event := range filtered {
+		names = append(names, event.EventName)
+	}
+	if strings.Join(names, ",") != "Org2,Org3" {
+		t.Errorf("got events %v, want Org2 and the renamed Org3", names)
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	d := Diagnose(errors.New("rpc error: code = Aborted desc = failed to commit: MVCC_READ_CONFLICT"))
+	if d.Code() != "MVCC_READ_CONFLICT" {
+		t.Fatalf("got code %q", d.Code())
+	}
+	if text := d.Explain("the key is hot"); !strings.Contains(text, "at once; the key is hot") {
+		t.Errorf("got %q", text)
+	}
+	if code := FailureCode(errors.New("something else")); code != "" {
+		t.Errorf("got code %q", code)
+	}
+}
@@ -0,0 +1,161 @@
+package fabricagent
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// LoadCredentials reads the user's certificate and the private key belonging to it, both PEM encoded
+// the certificate file may be a bundle with the chain after the user's certificate, the key path a single file or a folder of key files
+func LoadCredentials(certPath string, keyPath string) (string, string, error) {
+	cert, certPEM, err := ReadCertificate(certPath)
+	if err != nil {
+		return "", "", err
+	}
+	key, err := FindPrivateKey(keyPath, cert)
+	if err != nil {
+		return "", "", err
+	}
+	// the gateway client only reads PKCS #8 keys, keys in the older formats are converted
+	keyPEM, err := identity.PrivateKeyToPEM(key)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode the private key: %w", err)
+	}
+	return string(certPEM), string(keyPEM), nil
+}
+
+// ReadCertificate returns the first certificate of a PEM file together with its PEM encoding
+func ReadCertificate(path string) (*x509.Certificate, []byte, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the certificate: %w", err)
+	}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid certificate in %s: %w", path, err)
+		}
+		return cert, pem.EncodeToMemory(block), nil
+	}
+	return nil, nil, fmt.Errorf("no certificate in %s", path)
+}
+
+// FindPrivateKey returns the private key of the certificate from a key file or a folder of key files
+// the Fabric CA and cryptogen name the key files after the subject key identifier, the matching file is tried first
+func FindPrivateKey(path string, cert *x509.Certificate) (crypto.PrivateKey, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the private key: %w", err)
+	}
+	files := []string{path}
+	if info.IsDir() {
+		if files, err = keyFiles(path, SubjectKeyIdentifier(cert.PublicKey)); err != nil {
+			return nil, fmt.Errorf("failed to read the keystore: %w", err)
+		}
+	}
+
+	var errs []string
+	for _, file := range files {
+		key, err := matchingKey(file, cert.PublicKey)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if key != nil {
+			return key, nil
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("no private key in %s belongs to the certificate (%s)", path, strings.Join(errs, "; "))
+	}
+	return nil, fmt.Errorf("no private key in %s belongs to the certificate", path)
+}
+
+// keyFiles lists the files of a keystore, the one named after the subject key identifier first
+func keyFiles(dir string, ski string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		file := filepath.Join(dir, e.Name())
+		if ski != "" && strings.HasPrefix(e.Name(), ski) {
+			files = append([]string{file}, files...)
+		} else {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// matchingKey returns the private key in a PEM file that belongs to the public key, nil if there is none
+func matchingKey(path string, public crypto.PublicKey) (crypto.PrivateKey, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			continue
+		}
+		key, err := parsePrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		if signer, ok := key.(crypto.Signer); ok && publicKeysEqual(signer.Public(), public) {
+			return key, nil
+		}
+	}
+	return nil, nil
+}
+
+// parsePrivateKey reads a PKCS #8, SEC 1 (EC) or PKCS #1 (RSA) private key
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unsupported private key format")
+}
+
+func publicKeysEqual(a crypto.PublicKey, b crypto.PublicKey) bool {
+	if key, ok := a.(interface{ Equal(crypto.PublicKey) bool }); ok {
+		return key.Equal(b)
+	}
+	return false
+}
+
+// SubjectKeyIdentifier returns the hex SKI Fabric names key files by, the SHA-256 of the uncompressed EC point
+func SubjectKeyIdentifier(public crypto.PublicKey) string {
+	key, ok := public.(*ecdsa.PublicKey)
+	if !ok {
+		return ""
+	}
+	point := elliptic.Marshal(key.Curve, key.X, key.Y)
+	sum := sha256.Sum256(point)
+	return hex.EncodeToString(sum[:])
+}
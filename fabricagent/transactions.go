@@ -0,0 +1,30 @@
+package fabricagent
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// AsyncContract is implemented by *client.Contract, submitting through it tells the ID of the transaction
+type AsyncContract interface {
+	SubmitAsync(name string, options ...client.ProposalOption) ([]byte, *client.Commit, error)
+}
+
+// SubmitAndWait submits a transaction and waits for its commit like Submit, it also returns the transaction ID, which
+// an invalidated transaction has as well
+func SubmitAndWait(contract AsyncContract, name string, options ...client.ProposalOption) ([]byte, string, error) {
+	result, commit, err := contract.SubmitAsync(name, options...)
+	if err != nil {
+		return nil, "", err
+	}
+	txID := commit.TransactionID()
+	status, err := commit.Status()
+	if err != nil {
+		return result, txID, err
+	}
+	if !status.Successful {
+		return result, txID, fmt.Errorf("transaction %s failed to commit with status code %d (%s)", txID, int32(status.Code), status.Code)
+	}
+	return result, txID, nil
+}
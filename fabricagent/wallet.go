@@ -0,0 +1,138 @@
+package fabricagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// identities are stored one per file, in the format of the wallets of the Fabric SDKs, so existing wallets keep working
+const WalletFileExtension = ".id"
+
+// X509IdentityType is the type of an identity whose private key is in the wallet
+const X509IdentityType = "X.509"
+
+// Identity is an X.509 identity as it is stored in the wallet
+type Identity struct {
+	Version     int    `json:"version"`
+	MspID       string `json:"mspId"`
+	Type        string `json:"type"`
+	Credentials struct {
+		Certificate string `json:"certificate"`
+		PrivateKey  string `json:"privateKey,omitempty"`
+	} `json:"credentials"`
+}
+
+// NewX509Identity returns the identity of the PEM encoded certificate and private key
+func NewX509Identity(mspID string, cert string, key string) *Identity {
+	id := &Identity{Version: 1, MspID: mspID, Type: X509IdentityType}
+	id.Credentials.Certificate = cert
+	id.Credentials.PrivateKey = key
+	return id
+}
+
+// Signer returns the gateway identity and the function signing with the private key of an X.509 identity
+func (id *Identity) Signer() (*identity.X509Identity, identity.Sign, error) {
+	if id.Type != X509IdentityType {
+		return nil, nil, fmt.Errorf("unsupported identity type %q", id.Type)
+	}
+	certificate, err := identity.CertificateFromPEM([]byte(id.Credentials.Certificate))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid certificate: %w", err)
+	}
+	x509ID, err := identity.NewX509Identity(id.MspID, certificate)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := identity.PrivateKeyFromPEM([]byte(id.Credentials.PrivateKey))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	sign, err := identity.NewPrivateKeySign(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return x509ID, sign, nil
+}
+
+// Wallet keeps identities in a folder, under their labels. The agent's wallet reads the same files and can also
+// encrypt them, an encrypted identity can't be read here
+type Wallet struct {
+	Path string
+}
+
+// OpenWallet opens the wallet in the folder, which is created if it doesn't exist
+func OpenWallet(path string) (*Wallet, error) {
+	path = filepath.Clean(path)
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+	return &Wallet{Path: path}, nil
+}
+
+func (w *Wallet) file(label string) string {
+	return filepath.Join(w.Path, label+WalletFileExtension)
+}
+
+// Exists tells whether the wallet has an identity with the label
+func (w *Wallet) Exists(label string) bool {
+	_, err := os.Stat(w.file(label))
+	return err == nil
+}
+
+// Put stores the identity under the label, replacing the one that is there
+func (w *Wallet) Put(label string, id *Identity) error {
+	data, err := json.Marshal(id)
+	if err != nil {
+		return err
+	}
+	return w.Write(label, data)
+}
+
+// Write stores the contents of the identity file of the label as they are, e.g. an identity a wallet on top of this
+// one has encrypted
+func (w *Wallet) Write(label string, data []byte) error {
+	return os.WriteFile(w.file(label), data, 0600)
+}
+
+// Get reads the identity with the label
+func (w *Wallet) Get(label string) (*Identity, error) {
+	data, err := w.Read(label)
+	if err != nil {
+		return nil, err
+	}
+	id := &Identity{}
+	if err := json.Unmarshal(data, id); err != nil {
+		return nil, fmt.Errorf("invalid identity %s in the wallet: %w", label, err)
+	}
+	return id, nil
+}
+
+// Read returns the contents of the identity file of the label as they are stored
+func (w *Wallet) Read(label string) ([]byte, error) {
+	return os.ReadFile(w.file(label))
+}
+
+// List returns the labels of the identities in the wallet
+func (w *Wallet) List() ([]string, error) {
+	files, err := os.ReadDir(w.Path)
+	if err != nil {
+		return nil, err
+	}
+	var labels []string
+	for _, f := range files {
+		if name := f.Name(); strings.HasSuffix(name, WalletFileExtension) {
+			labels = append(labels, strings.TrimSuffix(name, WalletFileExtension))
+		}
+	}
+	return labels, nil
+}
+
+// Remove deletes the identity with the label
+func (w *Wallet) Remove(label string) error {
+	return os.Remove(w.file(label))
+}
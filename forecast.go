@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// periodFunction is the chaincode function of an update of a multi-period run, its first argument is the period and
+// the others are those of SendUpdate. Its event payload carries the period, "Period=<n>, " before the end of a text
+// payload, "period" in the JSON envelope and field 6 of a binary update
+const periodFunction = "SendPeriodUpdate"
+
+var (
+	forecastFile     = flag.String("forecast", "", "CSV file of \"period,demand\" rows or JSON list of {\"period\", \"demand\"} objects, runs the optimization for every period of the forecast in turn")
+	dispatchSchedule = flag.String("dispatch-schedule", "dispatch_schedule.csv", "file the dispatch schedule of a -forecast run is written to")
+)
+
+// forecastPeriod is a period of the demand forecast, the local demand in MW the node serves in it
+type forecastPeriod struct {
+	Period int     `json:"period"`
+	Demand float64 `json:"demand"`
+}
+
+// readForecast reads the periods of a forecast in the order of the file, a .json file is a list of periods and any
+// other a CSV file whose rows don't start with a period, like a header, are skipped
+func readForecast(path string) ([]forecastPeriod, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	var periods []forecastPeriod
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.Unmarshal(data, &periods); err != nil {
+			return nil, fmt.Errorf("invalid forecast %s: %w", path, err)
+		}
+	} else {
+		records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("invalid forecast %s: %w", path, err)
+		}
+		for _, record := range records {
+			if len(record) < 2 {
+				continue
+			}
+			period, err := strconv.Atoi(strings.TrimSpace(record[0]))
+			if err != nil {
+				continue
+			}
+			demand, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid demand %q of period %v in %s", record[1], period, path)
+			}
+			periods = append(periods, forecastPeriod{Period: period, Demand: demand})
+		}
+	}
+	if len(periods) == 0 {
+		return nil, fmt.Errorf("%s has no period", path)
+	}
+	seen := map[int]bool{}
+	for _, p := range periods {
+		if p.Period < 0 {
+			return nil, fmt.Errorf("invalid period %v in %s, the periods start at 0", p.Period, path)
+		}
+		if seen[p.Period] {
+			return nil, fmt.Errorf("period %v is listed twice in %s", p.Period, path)
+		}
+		seen[p.Period] = true
+	}
+	return periods, nil
+}
+
+// periodAgent returns the agent of a period: a load takes the forecast as its demand, the other roles serve it
+// besides their power, so it starts in their mismatch. It uses the regulation signal of the process
+func periodAgent(c Config, p forecastPeriod, regulation *regulationSignal) *Agent {
+	a := newAgent("", c)
+	a.period = p.Period
+	a.regulation = regulation
+	if c.role() == roleLoad {
+		a.cfg.Load.Demand = p.Demand
+	} else {
+		a.demand = p.Demand
+	}
+	return a
+}
+
+// inHorizon tells whether the agent runs a period of a -forecast run, which ends without the prompts of a single run
+// and leaves the setup of the process to runHorizon
+func (a *Agent) inHorizon() bool {
+	return a.period >= 0
+}
+
+// checkPeriod tells why an update of a neighbor doesn't belong to the period the agent runs, nil if it does or if either
+// side runs a single period
+func (a *Agent) checkPeriod(u updatePayload) error {
+	if a.period < 0 || u.Period < 0 || u.Period == a.period {
+		return nil
+	}
+	return fmt.Errorf("the update is for period %v, this node runs period %v", u.Period, a.period)
+}
+
+// scheduleHour returns the hour of the committed schedule the run belongs to, the period of a multi-period run
+func (a *Agent) scheduleHour() int {
+	if a.period >= 0 {
+		return a.period
+	}
+	return runHour()
+}
+
+// periodDispatch is a row of the dispatch schedule
+type periodDispatch struct {
+	forecastPeriod
+	Power      float64
+	Price      float64
+	Iterations int
+}
+
+// runPeriod runs the agent of a period of runHorizon
+var runPeriod = (*Agent).run
+
+// runHorizon runs the optimization of every period of the -forecast in turn, each period converges before the next
+// starts, and writes the dispatch schedule after every period so a failed run keeps the periods it solved. The
+// regulation signal and the MQTT connection are set up once for all periods, and the cleanup is offered at the end
+func runHorizon(c Config) error {
+	if *submitBatch > 1 {
+		return errors.New("-forecast submits every update on its own, it can't be combined with -submit-batch")
+	}
+	if *serveAddr != "" || *grpcAddr != "" {
+		return errors.New("-forecast runs the periods one after the other without waiting for a start, it can't be combined with -serve or -grpc-addr")
+	}
+	periods, err := readForecast(*forecastFile)
+	if err != nil {
+		return err
+	}
+	regulation := startRegulation(c.MQTT)
+	defer regulation.close()
+	if setpoints, err = startMQTT(c.MQTT); err != nil {
+		logger.Warnf("Failed to connect to the MQTT broker, the setpoints are not published: %v", err)
+	}
+	defer setpoints.close()
+	var schedule []periodDispatch
+	for _, p := range periods {
+		logger.Info(tr("Period %v of %v: demand %v MW", p.Period, len(periods), p.Demand))
+		a := periodAgent(c, p, regulation)
+		if err := runPeriod(a); err != nil {
+			return fmt.Errorf("period %v: %w", p.Period, err)
+		}
+		if a.result == nil {
+			return fmt.Errorf("the optimization of period %v ended without converging", p.Period)
+		}
+		schedule = append(schedule, periodDispatch{forecastPeriod: p, Power: a.result.Power, Price: a.result.Price, Iterations: a.result.Iterations})
+		if err := saveDispatchSchedule(*dispatchSchedule, schedule); err != nil {
+			logger.Warnf("Failed to save the dispatch schedule: %v", err)
+		}
+	}
+	fmt.Fprintln(display(), tr("Dispatch schedule:"))
+	for _, d := range schedule {
+		fmt.Fprintf(display(), "  %3d  %10.4f MW  %10.4f $/MWh  (%v iterations)\n", d.Period, d.Power, d.Price, d.Iterations)
+	}
+	offerCleanup()
+	return nil
+}
+
+// saveDispatchSchedule writes the schedule as CSV rows of period, demand, power, price and iterations
+func saveDispatchSchedule(path string, schedule []periodDispatch) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"period", "demand", "power", "price", "iterations"}); err != nil {
+		return err
+	}
+	for _, d := range schedule {
+		row := []string{strconv.Itoa(d.Period), formatValue(d.Demand), formatValue(d.Power), formatValue(d.Price), strconv.Itoa(d.Iterations)}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
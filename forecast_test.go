@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunHorizon(t *testing.T) {
+	dir := t.TempDir()
+	forecast := filepath.Join(dir, "forecast.csv")
+	if err := os.WriteFile(forecast, []byte("period,demand\n0,2\n1,3.5\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func(file, schedule string, run func(*Agent) error) {
+		*forecastFile, *dispatchSchedule, runPeriod = file, schedule, run
+	}(*forecastFile, *dispatchSchedule, runPeriod)
+	*forecastFile, *dispatchSchedule = forecast, filepath.Join(dir, "schedule.csv")
+	var ran []*Agent
+	runPeriod = func(a *Agent) error {
+		ran = append(ran, a)
+		a.result = &ResultSummary{Power: 2 * a.demand, Price: 6, Iterations: 10 + a.period}
+		return nil
+	}
+	if err := runHorizon(defaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 2 || ran[0].period != 0 || ran[1].period != 1 || ran[1].demand != 3.5 || !ran[1].inHorizon() {
+		t.Fatalf("ran the periods %+v", ran)
+	}
+	data, err := os.ReadFile(*dispatchSchedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := strings.Split(strings.TrimSpace(string(data)), "\n"); len(rows) != 3 || rows[2] != "1,3.5,7,6,11" {
+		t.Errorf("got the schedule %q", rows)
+	}
+
+	defer func(addr string) { *serveAddr = addr }(*serveAddr)
+	*serveAddr = ":8080"
+	ran = nil
+	if err := runHorizon(defaultConfig()); err == nil || len(ran) != 0 {
+		t.Errorf("ran %v periods with -serve: %v", len(ran), err)
+	}
+}
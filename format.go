@@ -0,0 +1,18 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+)
+
+var precision = flag.Int("precision", -1, "number of decimals of the submitted values, -1 uses the fewest digits that still read back exactly")
+
+// formatValue formats a value for submission, never using exponent notation since the peers' parsers only accept plain decimals
+func formatValue(x float64) string {
+	s := strconv.FormatFloat(x, 'f', *precision, 64)
+	// negative zero would be sent as "-0"
+	if x == 0 {
+		s = strconv.FormatFloat(0, 'f', *precision, 64)
+	}
+	return s
+}
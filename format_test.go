@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+var formatCases = []float64{0, math.Copysign(0, -1), 1, -1, 6.1319, -4.9055, 1e-7, -2.5e-9, 1.6e21, 123456789.123456789, 1.0 / 3}
+
+func TestFormatValueHasNoExponent(t *testing.T) {
+	for _, x := range formatCases {
+		s := formatValue(x)
+		if strings.ContainsAny(s, "eE") {
+			t.Errorf("formatValue(%v) = %q, uses exponent notation", x, s)
+		}
+		if s == "-0" {
+			t.Errorf("formatValue(%v) = %q, want 0", x, s)
+		}
+	}
+}
+
+func TestFormatValueRoundTrip(t *testing.T) {
+	for _, x := range formatCases {
+		payload := fmt.Sprintf("Org2 update: Lambda=%s, Mismatch=%s, end", formatValue(x), formatValue(-x))
+		update, err := decodePayload(payload)
+		if err != nil {
+			t.Fatalf("failed to decode %q: %v", payload, err)
+		}
+		if update.Lambda != x {
+			t.Errorf("lambda %v read back as %v from %q", x, update.Lambda, payload)
+		}
+		if update.Mismatch != -x {
+			t.Errorf("mismatch %v read back as %v from %q", -x, update.Mismatch, payload)
+		}
+	}
+}
+
+func TestFormatValueFixedPrecision(t *testing.T) {
+	defer func(p int) { *precision = p }(*precision)
+	*precision = 3
+	for _, x := range formatCases {
+		payload := fmt.Sprintf("Lambda=%s, Mismatch=0, end", formatValue(x))
+		if update, err := decodePayload(payload); err != nil || math.Abs(update.Lambda-x) > 0.0005 {
+			t.Errorf("lambda %v read back as %v (%v) from %q", x, update.Lambda, err, payload)
+		}
+	}
+	if s := formatValue(2); s != "2.000" {
+		t.Errorf("formatValue(2) = %q, want 2.000", s)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"google.golang.org/grpc"
+
+	"testEvent/fabricagent"
+)
+
+// events are buffered like the event channels of the legacy SDK, so a slow iteration doesn't hold up the peer's stream
+const eventBufferSize = fabricagent.EventBufferSize
+
+// gatewayConnection is a gateway together with the gRPC connection to the peer it runs on
+type gatewayConnection struct {
+	*client.Gateway
+	conn *grpc.ClientConn
+	// sign signs with the key of the identity, release frees the signer, e.g. the session with the HSM
+	sign    identity.Sign
+	release func() error
+	// channel and chaincode are the ones the gateway was connected for
+	channel   string
+	chaincode string
+	// peer is the peer of the organization the connection went to
+	peer PeerConfig
+	// shared is the connection of a market for its contract, the process closes the connection it shares
+	shared bool
+}
+
+// Close closes the gateway, its connection to the peer and its signer
+func (g *gatewayConnection) Close() error {
+	if g.shared {
+		return nil
+	}
+	err := g.Gateway.Close()
+	if cerr := g.conn.Close(); err == nil {
+		err = cerr
+	}
+	if rerr := g.release(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// newGrpcConnection opens a TLS connection to the gateway peer, with a client certificate if the tls section has one
+func (c Config) newGrpcConnection() (*grpc.ClientConn, error) {
+	return fabricagent.Dial(c.dialOptions())
+}
+
+// gatewayOptions are the timeouts of the calls to the gateway peer
+func gatewayOptions(sign identity.Sign, conn *grpc.ClientConn) []client.ConnectOption {
+	return fabricagent.ConnectOptions(sign, conn)
+}
+
+// registerEvents listens to the chaincode events whose names match the filter, a regular expression
+// the channel is closed when the stream from the peer ends or the returned function is called, the options set where reading starts
+func registerEvents(gw *gatewayConnection, eventFilter string, options ...client.ChaincodeEventsOption) (context.CancelFunc, <-chan *client.ChaincodeEvent, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := gw.GetNetwork(gw.channel).ChaincodeEvents(ctx, gw.chaincode, options...)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	notifier, err := fabricagent.FilterEvents(ctx, events, eventFilter, agentEventName)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return cancel, notifier, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import "fmt"
+
+// GeneratorModel describes the generator or load this node represents in the optimization
+type GeneratorModel struct {
+	// Cost selects the cost model: quadratic (default), piecewise-linear or valve-point
+	Cost string `json:"cost" yaml:"cost"`
+	// A, B and C are the coefficients of the cost a*P^2 + b*P + c, of the quadratic and the valve-point cost
+	A float64 `json:"a" yaml:"a"`
+	B float64 `json:"b" yaml:"b"`
+	C float64 `json:"c" yaml:"c"`
+	// E and F are the amplitude and the frequency of the ripples |e*sin(f*(pMin-P))| of the valve-point cost
+	E float64 `json:"e" yaml:"e"`
+	F float64 `json:"f" yaml:"f"`
+	// Points are the breakpoints of the piecewise-linear cost, sorted by power
+	Points []CostPoint `json:"points" yaml:"points"`
+	// PMin and PMax are the power limits in MW
+	PMin float64 `json:"pMin" yaml:"pMin"`
+	PMax float64 `json:"pMax" yaml:"pMax"`
+	// Epsilon is the convergence tolerance of both the power mismatch and the change of the price
+	Epsilon float64 `json:"epsilon" yaml:"epsilon"`
+	// MaxIterations ends a run that has not converged after this many iterations, 0 never ends it
+	MaxIterations int `json:"maxIterations" yaml:"maxIterations"`
+	// DivergenceSteps ends a run whose mismatch grew in this many iterations in a row, 0 never ends it
+	DivergenceSteps int `json:"divergenceSteps" yaml:"divergenceSteps"`
+	// Network are the losses and the line limits of the node's connection to the grid
+	Network NetworkModel `json:"network" yaml:"network"`
+}
+
+// defaultGenerator is the 0-8 MW generator with the marginal cost 1.6*P the application was written for
+var defaultGenerator = GeneratorModel{A: 0.8, PMin: 0, PMax: 8, Epsilon: 0.01}
+
+// costCurve returns the cost curve of the model, used until one has been fitted to measurements
+func (g GeneratorModel) costCurve() costCurve {
+	return costCurve{A: g.A, B: g.B, C: g.C}
+}
+
+// costFunction returns the cost of the selected model
+func (g GeneratorModel) costFunction() costFunction {
+	switch g.Cost {
+	case costPiecewiseLinear:
+		return piecewiseLinearCost{points: g.Points}
+	case costValvePoint:
+		return valvePointCost{a: g.A, b: g.B, c: g.C, e: g.E, f: g.F, limits: g.limits()}
+	}
+	return g.costCurve()
+}
+
+// quadratic tells whether the model has the quadratic cost, the only one fitted to measurements
+func (g GeneratorModel) quadratic() bool {
+	return g.Cost == "" || g.Cost == costQuadratic
+}
+
+// limits returns the power limits of the model
+func (g GeneratorModel) limits() powerLimits {
+	return powerLimits{Min: g.PMin, Max: g.PMax}
+}
+
+// validate rejects models the update step cannot work with
+func (g GeneratorModel) validate() error {
+	if err := g.validateCost(); err != nil {
+		return err
+	}
+	if g.PMax < g.PMin {
+		return fmt.Errorf("pMax %v is below pMin %v", g.PMax, g.PMin)
+	}
+	if g.Epsilon <= 0 {
+		return fmt.Errorf("epsilon must be positive, got %v", g.Epsilon)
+	}
+	if g.MaxIterations < 0 {
+		return fmt.Errorf("maxIterations must not be negative, got %v", g.MaxIterations)
+	}
+	if g.DivergenceSteps < 0 {
+		return fmt.Errorf("divergenceSteps must not be negative, got %v", g.DivergenceSteps)
+	}
+	if err := g.Network.validate(); err != nil {
+		return fmt.Errorf("invalid network: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const traceUsage = "trace replay <events.jsonl> [--golden <trace.jsonl>] [--out <trace.jsonl>] [--tolerance <x>]"
+
+// capturedEvent is a neighbor's event in a capture: an "event" record of the -progress ndjson stream, or a line with
+// the same fields, e.g. written by a tool that listens to the chaincode events
+type capturedEvent struct {
+	// Event is the type of a progress record, the records of other types than "event" are skipped
+	Event   string `json:"event"`
+	Name    string `json:"name"`
+	Block   uint64 `json:"block"`
+	TxID    string `json:"txId"`
+	Payload string `json:"payload"`
+}
+
+// traceRecord is an iteration of the -trace-iterations file, the inputs l2 and m2 from the neighbors and the state
+// the node computed from them
+type traceRecord struct {
+	Iter int     `json:"iter"`
+	L1   float64 `json:"l1"`
+	L2   float64 `json:"l2"`
+	M1   float64 `json:"m1"`
+	M2   float64 `json:"m2"`
+	P    float64 `json:"P"`
+	Eta  float64 `json:"eta"`
+}
+
+// readCapture reads the neighbors' events of a JSON lines capture in the order they arrived
+func readCapture(r io.Reader) ([]capturedEvent, error) {
+	var events []capturedEvent
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxPayloadSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		// the progress stream has the prompts between its records
+		if !strings.HasPrefix(text, "{") {
+			continue
+		}
+		var e capturedEvent
+		if err := json.Unmarshal([]byte(text), &e); err != nil {
+			return nil, fmt.Errorf("line %v: %w", line, err)
+		}
+		if e.Event != "" && e.Event != "event" {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// readTrace reads the iterations of a -trace-iterations file
+func readTrace(r io.Reader) ([]traceRecord, error) {
+	var records []traceRecord
+	decoder := json.NewDecoder(r)
+	for {
+		var record traceRecord
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("record %v: %w", len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+}
+
+// replayTrace runs the optimization of the config on the captured events, without a network and without the state
+// the agent keeps between runs: it starts from the marginal cost of the initial power, every neighbor has a fresh
+// reputation and neither island mode nor regulation apply. The same capture therefore gives the same iterations on
+// every replay, until the algorithm changes. It stops at convergence like a run
+func replayTrace(c Config, events []capturedEvent) []traceRecord {
+	cost, limits := c.Generator.Network.apply(c.participant())
+	P, m1 := c.initialState()
+	l1 := cost.marginal(P)
+	algorithm := newOptimizer(c.Algorithm)
+	algorithm.start(l1, m1, P)
+	termination := newTerminationPolicy(c.Termination)
+	round := newConsensusRound(c.Neighbors)
+	peers := reputations{}
+	validator := newUpdateValidator()
+	var trace []traceRecord
+	for _, e := range events {
+		update, err := decodePayload(e.Payload)
+		if err != nil {
+			logger.Infof("Skipping event %s from block %v: %v", e.Name, e.Block, err)
+			continue
+		}
+		l2, m2, _, err := validator.check(e.Name, update.Lambda, update.Mismatch, cost)
+		if err != nil {
+			logger.Infof("Skipping event %s from block %v: %v", e.Name, e.Block, err)
+			continue
+		}
+		var neighbors []neighborUpdate
+		if len(c.Neighbors) == 0 {
+			neighbors = []neighborUpdate{{weight: peers.weight(e.Name), lambda: l2, mismatch: m2}}
+		} else {
+			if !round.expects(e.Name) {
+				continue
+			}
+			round.add(e.Name, l2, m2)
+			if !round.complete() {
+				continue
+			}
+			neighbors = round.take(peers)
+			l2, m2 = neighborhoodAverage(neighbors)
+		}
+		iter := len(trace) + 1
+		previous := l1
+		l1, m1, P = algorithm.step(cost, limits, c.Algorithm.Aggregation.aggregate(neighbors), l1, m1, P, iter)
+		trace = append(trace, traceRecord{Iter: iter, L1: l1, L2: l2, M1: m1, M2: m2, P: P, Eta: algorithm.eta(iter)})
+		// a replay takes no time, a time limit never ends it
+		if termination.done(iterationOutcome{lambda: l1, mismatch: m1, P: P, change: l1 - previous, converged: algorithm.converged(c.Generator.Epsilon), epsilon: c.Generator.Epsilon}) {
+			break
+		}
+	}
+	return trace
+}
+
+// compareTrace returns the first iteration of the replay that differs from the golden trace by more than the tolerance,
+// relative to the golden value for values beyond 1
+func compareTrace(replayed, golden []traceRecord, tolerance float64) error {
+	for i := 0; i < len(replayed) && i < len(golden); i++ {
+		got, want := replayed[i], golden[i]
+		for _, v := range []struct {
+			name      string
+			got, want float64
+		}{
+			{"l1", got.L1, want.L1}, {"l2", got.L2, want.L2}, {"m1", got.M1, want.M1},
+			{"m2", got.M2, want.M2}, {"P", got.P, want.P}, {"eta", got.Eta, want.Eta},
+		} {
+			if math.Abs(v.got-v.want) > tolerance*math.Max(1, math.Abs(v.want)) {
+				return fmt.Errorf("iteration %v: %s = %v, the golden trace has %v", want.Iter, v.name, v.got, v.want)
+			}
+		}
+	}
+	if len(replayed) != len(golden) {
+		return fmt.Errorf("the replay ends after %v iterations, the golden trace after %v", len(replayed), len(golden))
+	}
+	return nil
+}
+
+// writeTrace writes the iterations in the format of the -trace-iterations file
+func writeTrace(w io.Writer, trace []traceRecord) error {
+	encoder := json.NewEncoder(w)
+	for _, record := range trace {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func traceCommand(args []string) error {
+	if len(args) < 2 || args[0] != "replay" {
+		return errors.New(traceUsage)
+	}
+	flags := flag.NewFlagSet("trace replay", flag.ContinueOnError)
+	golden := flags.String("golden", "", "-trace-iterations file the replayed iterations have to match")
+	out := flags.String("out", "", "file the replayed iterations are written to, in the format of -trace-iterations (default: stdout without -golden)")
+	tolerance := flags.Float64("tolerance", 1e-9, "largest difference from the golden trace, relative for values beyond 1")
+	if err := flags.Parse(args[2:]); err != nil {
+		return err
+	}
+	file, err := os.Open(filepath.Clean(args[1]))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	events, err := readCapture(file)
+	if err != nil {
+		return fmt.Errorf("invalid capture %s: %w", args[1], err)
+	}
+	trace := replayTrace(cfg, events)
+	switch {
+	case *out != "":
+		f, err := os.Create(filepath.Clean(*out))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := writeTrace(f, trace); err != nil {
+			return err
+		}
+	case *golden == "":
+		return writeTrace(os.Stdout, trace)
+	}
+	if *golden == "" {
+		return nil
+	}
+	f, err := os.Open(filepath.Clean(*golden))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	want, err := readTrace(f)
+	if err != nil {
+		return fmt.Errorf("invalid golden trace %s: %w", *golden, err)
+	}
+	if err := compareTrace(trace, want, *tolerance); err != nil {
+		return err
+	}
+	fmt.Printf("The %v iterations of the replay match the golden trace\n", len(trace))
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "write the golden traces of testdata/golden from the current algorithm")
+
+// TestGoldenTraces replays the captured events of testdata/golden and compares every iteration with the golden trace
+// recorded with the algorithm before, so a change of the numerics shows up as the first iteration it changes.
+// After an intended change, go test -run TestGoldenTraces -update-golden records the new traces
+func TestGoldenTraces(t *testing.T) {
+	captures, err := filepath.Glob(filepath.Join("testdata", "golden", "*.events.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(captures) == 0 {
+		t.Fatal("no captures in testdata/golden")
+	}
+	for _, capture := range captures {
+		name := strings.TrimSuffix(filepath.Base(capture), ".events.jsonl")
+		t.Run(name, func(t *testing.T) {
+			file, err := os.Open(capture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			events, err := readCapture(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			trace := replayTrace(defaultConfig(), events)
+			goldenFile := filepath.Join("testdata", "golden", name+".trace.jsonl")
+			if *updateGolden {
+				f, err := os.Create(goldenFile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				if err := writeTrace(f, trace); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			f, err := os.Open(goldenFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			golden, err := readTrace(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := compareTrace(trace, golden, 1e-12); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestRecordingIsACapture checks that "trace replay" reads the events of a recording as they were received
+func TestRecordingIsACapture(t *testing.T) {
+	var b strings.Builder
+	recorder, err := newEventRecorder(&b, recordJSONL, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := []*client.ChaincodeEvent{
+		{BlockNumber: 7, TransactionID: "tx1", EventName: "Org1", Payload: []byte("Lambda=6.4, Mismatch=-0.5, end")},
+		{BlockNumber: 8, TransactionID: "tx2", EventName: "Org1", Payload: []byte(`{"version":2,"lambda":6.3,"mismatch":0.1}`)},
+	}
+	for _, e := range events {
+		if err := recorder.write(e, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	captured, err := readCapture(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(captured) != len(events) {
+		t.Fatalf("%v events read back, want %v", len(captured), len(events))
+	}
+	for i, e := range events {
+		if c := captured[i]; c.Name != e.EventName || c.Block != e.BlockNumber || c.TxID != e.TransactionID || c.Payload != string(e.Payload) {
+			t.Errorf("event %v read back as %+v", i, c)
+		}
+	}
+}
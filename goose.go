@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// the EtherType of IEC 61850-8-1 GOOSE frames
+const gooseEtherType = 0x88b8
+
+// GooseConfig subscribes to the GOOSE messages of the protection relays, so a grid disturbance such as a feeder trip
+// restarts the optimization with the constraints it leaves the node with
+type GooseConfig struct {
+	// Interface is the network interface the GOOSE multicasts arrive on, e.g. eth1
+	Interface string `json:"interface" yaml:"interface"`
+	// Events are the signals of the data sets that change the constraints of the node
+	Events []GooseEvent `json:"events" yaml:"events"`
+}
+
+// GooseEvent is a boolean of a published data set, while it is true the node runs with the event's constraints
+type GooseEvent struct {
+	// Name identifies the event in the logs (default: GoCBRef)
+	Name string `json:"name" yaml:"name"`
+	// GoCBRef is the reference of the GOOSE control block, e.g. IED1LD0/LLN0$GO$gcb01
+	GoCBRef string `json:"goCBRef" yaml:"goCBRef"`
+	// AppID selects the application identifier of the messages, 0 for any
+	AppID uint16 `json:"appId" yaml:"appId"`
+	// Entry is the index of the signal in the data set, e.g. of the trip of the circuit breaker
+	Entry int `json:"entry" yaml:"entry"`
+	// PMin and PMax bound the power of the node in MW while the event is active, e.g. pMax 0 when the feeder of the
+	// generator tripped
+	PMin *float64 `json:"pMin" yaml:"pMin"`
+	PMax *float64 `json:"pMax" yaml:"pMax"`
+	// Demand is the demand in MW the node has to cover in addition while the event is active, e.g. a load transferred to it
+	Demand float64 `json:"demand" yaml:"demand"`
+}
+
+func (e GooseEvent) name() string {
+	if e.Name == "" {
+		return e.GoCBRef
+	}
+	return e.Name
+}
+
+func (c GooseConfig) validate() error {
+	if c.Interface == "" {
+		if len(c.Events) > 0 {
+			return errors.New("the goose events need the interface they arrive on")
+		}
+		return nil
+	}
+	if len(c.Events) == 0 {
+		return errors.New("goose has no events")
+	}
+	for _, e := range c.Events {
+		if e.GoCBRef == "" {
+			return errors.New("a goose event has no goCBRef")
+		}
+		if e.Entry < 0 {
+			return fmt.Errorf("goose event %s: the entry must not be negative", e.name())
+		}
+		if e.PMin != nil && e.PMax != nil && *e.PMin > *e.PMax {
+			return fmt.Errorf("goose event %s: pMin %v is above pMax %v", e.name(), *e.PMin, *e.PMax)
+		}
+	}
+	return nil
+}
+
+// goosePDU is the part of a GOOSE message the subscriber needs
+type goosePDU struct {
+	appID      uint16
+	goCBRef    string
+	stNum      uint32
+	sqNum      uint32
+	simulation bool
+	// entries are the values of the data set as booleans, a number or a bit string is true unless it is zero
+	entries []bool
+}
+
+// parseGooseFrame decodes an Ethernet frame with a GOOSE message, with or without a VLAN tag
+func parseGooseFrame(frame []byte) (goosePDU, error) {
+	var pdu goosePDU
+	if len(frame) < 14 {
+		return pdu, errors.New("short frame")
+	}
+	etherType, offset := binary.BigEndian.Uint16(frame[12:]), 14
+	if etherType == 0x8100 {
+		if len(frame) < 18 {
+			return pdu, errors.New("short frame")
+		}
+		etherType, offset = binary.BigEndian.Uint16(frame[16:]), 18
+	}
+	if etherType != gooseEtherType {
+		return pdu, fmt.Errorf("not a GOOSE frame, EtherType %#04x", etherType)
+	}
+	// APPID, length and two reserved words come before the APDU
+	header := frame[offset:]
+	if len(header) < 8 {
+		return pdu, errors.New("short GOOSE header")
+	}
+	pdu.appID = binary.BigEndian.Uint16(header)
+	tag, apdu, _, err := berElement(header[8:])
+	if err != nil {
+		return pdu, err
+	}
+	if tag != 0x61 {
+		return pdu, fmt.Errorf("not a goosePdu, tag %#02x", tag)
+	}
+	for len(apdu) > 0 {
+		var value []byte
+		if tag, value, apdu, err = berElement(apdu); err != nil {
+			return pdu, err
+		}
+		switch tag {
+		case 0x80:
+			pdu.goCBRef = string(value)
+		case 0x85:
+			pdu.stNum = uint32(berUnsigned(value))
+		case 0x86:
+			pdu.sqNum = uint32(berUnsigned(value))
+		case 0x87:
+			pdu.simulation = len(value) > 0 && value[0] != 0
+		case 0xab:
+			if pdu.entries, err = gooseEntries(value); err != nil {
+				return pdu, err
+			}
+		}
+	}
+	if pdu.goCBRef == "" {
+		return pdu, errors.New("the goosePdu has no gocbRef")
+	}
+	return pdu, nil
+}
+
+// gooseEntries reads the values of allData
+func gooseEntries(data []byte) ([]bool, error) {
+	var entries []bool
+	for len(data) > 0 {
+		tag, value, rest, err := berElement(data)
+		if err != nil {
+			return nil, err
+		}
+		data = rest
+		nonZero := false
+		switch tag {
+		case 0x84:
+			// the first octet of a bit string counts its unused bits
+			if len(value) > 0 {
+				value = value[1:]
+			}
+		case 0x87:
+			// a floating point value is its exponent width followed by the IEEE 754 value
+			if len(value) == 5 {
+				nonZero = math.Float32frombits(binary.BigEndian.Uint32(value[1:])) != 0
+			} else if len(value) == 9 {
+				nonZero = math.Float64frombits(binary.BigEndian.Uint64(value[1:])) != 0
+			}
+			entries = append(entries, nonZero)
+			continue
+		}
+		for _, b := range value {
+			nonZero = nonZero || b != 0
+		}
+		entries = append(entries, nonZero)
+	}
+	return entries, nil
+}
+
+// berElement splits the first element of BER data into its tag and value, rest is the data after it
+func berElement(data []byte) (tag byte, value []byte, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, errors.New("truncated BER element")
+	}
+	tag, length, offset := data[0], int(data[1]), 2
+	if length&0x80 != 0 {
+		octets := length & 0x7f
+		if octets == 0 || octets > 4 || len(data) < 2+octets {
+			return 0, nil, nil, errors.New("invalid BER length")
+		}
+		length = 0
+		for _, b := range data[2 : 2+octets] {
+			length = length<<8 | int(b)
+		}
+		offset += octets
+	}
+	if length < 0 || len(data) < offset+length {
+		return 0, nil, nil, errors.New("truncated BER element")
+	}
+	return tag, data[offset : offset+length], data[offset+length:], nil
+}
+
+func berUnsigned(value []byte) uint64 {
+	var n uint64
+	for _, b := range value {
+		n = n<<8 | uint64(b)
+	}
+	return n
+}
+
+// gridChange is an event that became active or was cleared
+type gridChange struct {
+	event  GooseEvent
+	active bool
+}
+
+// demand returns the change of the demand the node covers
+func (c gridChange) demand() float64 {
+	if c.active {
+		return c.event.Demand
+	}
+	return -c.event.Demand
+}
+
+// gridEvents follows the GOOSE events, the constraints of the active ones apply to the node
+type gridEvents struct {
+	config  GooseConfig
+	changes chan gridChange
+	closer  func() error
+
+	mu     sync.Mutex
+	active map[int]bool
+}
+
+// subscribeGoose starts listening for the configured events, nil if there are none
+func subscribeGoose(config GooseConfig) (*gridEvents, error) {
+	if config.Interface == "" {
+		return nil, nil
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	frames, closer, err := openGooseSocket(config.Interface)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for GOOSE on %s: %w", config.Interface, err)
+	}
+	g := &gridEvents{config: config, changes: make(chan gridChange, 16), closer: closer, active: map[int]bool{}}
+	go func() {
+		for frame := range frames {
+			pdu, err := parseGooseFrame(frame)
+			if err != nil {
+				logger.Debugf("Ignoring a GOOSE frame: %v", err)
+				continue
+			}
+			g.receive(pdu)
+		}
+	}()
+	logger.Infof("Listening for GOOSE events on %s", config.Interface)
+	return g, nil
+}
+
+// receive passes on the events whose signal changed, the messages of a publisher in simulation are ignored
+func (g *gridEvents) receive(pdu goosePDU) {
+	if pdu.simulation {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, e := range g.config.Events {
+		if e.GoCBRef != pdu.goCBRef || (e.AppID != 0 && e.AppID != pdu.appID) {
+			continue
+		}
+		if e.Entry >= len(pdu.entries) {
+			logger.Warnf("GOOSE event %s: the data set has no entry %v", e.name(), e.Entry)
+			continue
+		}
+		if active := pdu.entries[e.Entry]; active != g.active[i] {
+			g.active[i] = active
+			logger.Infof("GOOSE event %s is %s (stNum %v)", e.name(), map[bool]string{true: "active", false: "cleared"}[active], pdu.stNum)
+			select {
+			case g.changes <- gridChange{event: e, active: active}:
+			default:
+				logger.Warnf("GOOSE event %s dropped, the optimization is not keeping up", e.name())
+			}
+		}
+	}
+}
+
+// C returns the channel of the changes, nil without a subscription
+func (g *gridEvents) C() <-chan gridChange {
+	if g == nil {
+		return nil
+	}
+	return g.changes
+}
+
+// constrain returns the power limits with the constraints of the active events
+func (g *gridEvents) constrain(limits powerLimits) powerLimits {
+	if g == nil {
+		return limits
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, e := range g.config.Events {
+		if !g.active[i] {
+			continue
+		}
+		if e.PMax != nil {
+			limits.Max = math.Min(limits.Max, *e.PMax)
+		}
+		if e.PMin != nil {
+			limits.Min = math.Max(limits.Min, *e.PMin)
+		}
+	}
+	if limits.Min > limits.Max {
+		limits.Min = limits.Max
+	}
+	return limits
+}
+
+func (g *gridEvents) close() {
+	if g == nil {
+		return
+	}
+	if err := g.closer(); err != nil {
+		logger.Warnf("Failed to close the GOOSE socket: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// openGooseSocket receives the GOOSE frames of an interface on a packet socket, which needs CAP_NET_RAW
+// the channel is closed when the socket is
+func openGooseSocket(name string) (<-chan []byte, func() error, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	protocol := htons(gooseEtherType)
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(protocol))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: protocol, Ifindex: iface.Index}); err != nil {
+		unix.Close(fd)
+		return nil, nil, err
+	}
+	// the publishers send to multicast addresses, the interface passes them up only in promiscuous or all-multicast mode
+	membership := unix.PacketMreq{Ifindex: int32(iface.Index), Type: unix.PACKET_MR_ALLMULTI}
+	if err := unix.SetsockoptPacketMreq(fd, unix.SOL_PACKET, unix.PACKET_ADD_MEMBERSHIP, &membership); err != nil {
+		unix.Close(fd)
+		return nil, nil, err
+	}
+	// a receive times out every second, so the reader notices when the socket is to be closed
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Sec: 1}); err != nil {
+		unix.Close(fd)
+		return nil, nil, err
+	}
+	frames := make(chan []byte, 16)
+	done := make(chan struct{})
+	closed := make(chan error, 1)
+	go func() {
+		defer close(frames)
+		buffer := make([]byte, 1600)
+		for {
+			select {
+			case <-done:
+				closed <- unix.Close(fd)
+				return
+			default:
+			}
+			n, _, err := unix.Recvfrom(fd, buffer, 0)
+			switch {
+			case err == unix.EINTR || err == unix.EAGAIN:
+				continue
+			case err != nil:
+				logger.Warnf("GOOSE subscription on %s ended: %v", name, err)
+				<-done
+				closed <- unix.Close(fd)
+				return
+			}
+			select {
+			case frames <- append([]byte(nil), buffer[:n]...):
+			case <-done:
+			}
+		}
+	}()
+	return frames, func() error {
+		close(done)
+		return <-closed
+	}, nil
+}
+
+// htons converts a 16-bit value to network byte order, as the packet socket expects its protocol
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+// openGooseSocket needs the packet sockets of Linux
+func openGooseSocket(name string) (<-chan []byte, func() error, error) {
+	return nil, nil, errors.New("GOOSE subscription is only supported on Linux")
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+var healthWindow = flag.Duration("health-window", 10*time.Minute, "longest time a running optimization may go without an event or a transaction before /healthz reports it as wedged, 0 disables the check")
+
+// agentHealth is what the health checks know about an agent: its connection, its event registration and its last activity
+type agentHealth struct {
+	mu         sync.Mutex
+	gw         *gatewayConnection
+	registered bool
+	running    bool
+	finished   bool
+	// active is the time of the last event or transaction, or the start of the run
+	active time.Time
+}
+
+// healthMonitor keeps the health of the agents of the process, by name
+type healthMonitor struct {
+	mu     sync.Mutex
+	agents map[string]*agentHealth
+}
+
+var health = &healthMonitor{agents: map[string]*agentHealth{}}
+
+// agent returns the health of the named agent, the only agent of a process has no name
+func (m *healthMonitor) agent(name string) *agentHealth {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.agents[name]
+	if !ok {
+		h = &agentHealth{}
+		m.agents[name] = h
+	}
+	return h
+}
+
+// connected records the gateway connection the agent uses now
+func (h *agentHealth) connected(gw *gatewayConnection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.gw = gw
+}
+
+// registration records whether the event listener is registered
+func (h *agentHealth) registration(active bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.registered = active
+}
+
+// start records the start of the optimization, the activity window counts from it
+func (h *agentHealth) start() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.running, h.active = true, time.Now()
+}
+
+// activity records a received event or a committed transaction
+func (h *agentHealth) activity() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.active = time.Now()
+}
+
+// finish records the end of the run, an agent that has finished is neither wedged nor unready while its connection closes
+func (h *agentHealth) finish() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.running, h.finished = false, true
+}
+
+// live returns why the agent is wedged, nil if it isn't
+func (h *agentHealth) live() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.finished {
+		return nil
+	}
+	var problems []string
+	if h.gw != nil && h.gw.conn.GetState() == connectivity.Shutdown {
+		problems = append(problems, "the gateway connection is shut down")
+	}
+	if h.running && *healthWindow > 0 {
+		if idle := time.Since(h.active); idle > *healthWindow {
+			problems = append(problems, fmt.Sprintf("no event or transaction for %s", idle.Round(time.Second)))
+		}
+	}
+	return problems
+}
+
+// ready returns why the agent can't take part in the optimization, nil if it can
+func (h *agentHealth) ready() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.finished {
+		return nil
+	}
+	if h.gw == nil {
+		return []string{"not connected to the gateway"}
+	}
+	var problems []string
+	switch state := h.gw.conn.GetState(); state {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		problems = append(problems, fmt.Sprintf("the gateway connection is %s", state))
+	}
+	if !h.registered {
+		problems = append(problems, "the event listener is not registered")
+	}
+	return problems
+}
+
+// check runs a check on every agent, it returns the problems by agent
+func (m *healthMonitor) check(probe func(*agentHealth) []string) map[string][]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	problems := map[string][]string{}
+	for name, h := range m.agents {
+		if p := probe(h); len(p) > 0 {
+			problems[name] = p
+		}
+	}
+	return problems
+}
+
+// healthHandler answers 200 if the check finds no problem and 503 with the problems otherwise
+// without an agent yet only the liveness check passes, the process is still starting
+func healthHandler(probe func(*agentHealth) []string, needAgent bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		problems := health.check(probe)
+		health.mu.Lock()
+		starting := len(health.agents) == 0
+		health.mu.Unlock()
+		if needAgent && starting {
+			problems[""] = []string{"no agent has started yet"}
+		}
+		if len(problems) == 0 {
+			writeJSON(w, map[string]interface{}{"status": "ok"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{"status": "fail", "problems": problems}); err != nil {
+			logger.Warnf("Failed to write the API response: %v", err)
+		}
+	}
+}
+
+// handleHealth adds /healthz, the liveness check, and /readyz, the readiness check, to a mux
+func handleHealth(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", healthHandler((*agentHealth).live, false))
+	mux.HandleFunc("/readyz", healthHandler((*agentHealth).ready, true))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"sync"
+	"time"
+)
+
+// iterations that no longer fit in memory are appended here, one JSON object per line
+const historySpillFile = "history.jsonl"
+
+var historySize = flag.Int("history-size", 1000, "number of iterations kept in memory, older ones are spilled to "+historySpillFile)
+
+// iterationRecord is what happened in one iteration of the optimization
+type iterationRecord struct {
+	Iteration        int       `json:"iteration"`
+	Time             time.Time `json:"time"`
+	Event            string    `json:"event"`
+	Block            uint64    `json:"block"`
+	Lambda           float64   `json:"lambda"`
+	Mismatch         float64   `json:"mismatch"`
+	P                float64   `json:"p"`
+	NeighborLambda   float64   `json:"neighborLambda"`
+	NeighborMismatch float64   `json:"neighborMismatch"`
+}
+
+// historyRing keeps the latest iterations in a fixed-size ring buffer, the API reads it while the optimization adds to it
+type historyRing struct {
+	mu      sync.Mutex
+	records []iterationRecord
+	start   int
+	size    int
+	spill   *os.File
+}
+
+func newHistoryRing(capacity int) *historyRing {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &historyRing{records: make([]iterationRecord, capacity)}
+}
+
+// add stores a record, spilling the oldest one when the buffer is full
+func (h *historyRing) add(r iterationRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.size < len(h.records) {
+		h.records[(h.start+h.size)%len(h.records)] = r
+		h.size++
+		return
+	}
+	h.spillRecord(h.records[h.start])
+	h.records[h.start] = r
+	h.start = (h.start + 1) % len(h.records)
+}
+
+func (h *historyRing) spillRecord(r iterationRecord) {
+	if h.spill == nil {
+		f, err := os.OpenFile(historySpillFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			logger.Warnf("Failed to open %s, dropping old iterations: %v", historySpillFile, err)
+			return
+		}
+		h.spill = f
+	}
+	if err := json.NewEncoder(h.spill).Encode(r); err != nil {
+		logger.Warnf("Failed to spill iteration %v: %v", r.Iteration, err)
+	}
+}
+
+// snapshot returns the iterations in memory, oldest first
+func (h *historyRing) snapshot() []iterationRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]iterationRecord, 0, h.size)
+	for i := 0; i < h.size; i++ {
+		out = append(out, h.records[(h.start+i)%len(h.records)])
+	}
+	return out
+}
+
+func (h *historyRing) close() {
+	if h.spill != nil {
+		h.spill.Close()
+	}
+}
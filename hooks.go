@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// the lifecycle events a hook can be fired on
+const (
+	hookIteration         = "iteration-complete"
+	hookConvergence       = "convergence"
+	hookSubmissionFailure = "submission-failure"
+	hookReconnect         = "reconnect"
+)
+
+var hookEvents = []string{hookIteration, hookConvergence, hookSubmissionFailure, hookReconnect}
+
+// hookQueueSize is the number of events a hook buffers while its command runs, further events are dropped for it
+const hookQueueSize = 100
+
+// HookConfig runs a command on lifecycle events of the run, e.g. to send an email, switch a relay or call a webhook
+// without changing the agent. The command gets the event as a JSON object on stdin, with the fields of the progress
+// record of the event, and its name in the environment variable AGENT_HOOK
+type HookConfig struct {
+	// Name identifies the hook in the logs (default: the command)
+	Name string `json:"name" yaml:"name"`
+	// On are the events the hook is fired on: iteration-complete, convergence, submission-failure or reconnect
+	On []string `json:"on" yaml:"on"`
+	// Command is the program and its arguments, it is run without a shell
+	Command []string `json:"command" yaml:"command"`
+	// Timeout is the time in seconds after which the command is killed (default 10)
+	Timeout float64 `json:"timeout" yaml:"timeout"`
+}
+
+func (h HookConfig) validate() error {
+	if len(h.Command) == 0 || h.Command[0] == "" {
+		return errors.New("a hook needs its command")
+	}
+	if len(h.On) == 0 {
+		return fmt.Errorf("hook %s is fired on no event", h.name())
+	}
+	for _, event := range h.On {
+		if !firedOn(hookEvents, event) {
+			return fmt.Errorf("hook %s: unknown event %q, use %s", h.name(), event, strings.Join(hookEvents, ", "))
+		}
+	}
+	if h.Timeout < 0 {
+		return fmt.Errorf("hook %s: the timeout must not be negative, got %v", h.name(), h.Timeout)
+	}
+	return nil
+}
+
+// firedOn tells whether the event is one of the events
+func firedOn(events []string, event string) bool {
+	for _, e := range events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (h HookConfig) name() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	return h.Command[0]
+}
+
+// hook runs the command of a HookConfig for its events one after the other, in a goroutine of its own so a slow
+// command never holds up the optimization
+type hook struct {
+	HookConfig
+	events chan map[string]interface{}
+	done   chan struct{}
+}
+
+// hookRunner fires the hooks of an agent, nil if it has none
+type hookRunner struct {
+	hooks []*hook
+	// agent, organization and the run are added to every event
+	agent        string
+	organization string
+	runs         *runTracker
+}
+
+// startHooks starts the hooks of the config
+func startHooks(configs []HookConfig, agent string, organization string, runs *runTracker) *hookRunner {
+	if len(configs) == 0 {
+		return nil
+	}
+	r := &hookRunner{agent: agent, organization: organization, runs: runs}
+	for _, c := range configs {
+		h := &hook{HookConfig: c, events: make(chan map[string]interface{}, hookQueueSize), done: make(chan struct{})}
+		go h.run()
+		r.hooks = append(r.hooks, h)
+	}
+	return r
+}
+
+// fire hands the event to the hooks that are fired on it, without waiting for them
+func (r *hookRunner) fire(event string, fields map[string]interface{}) {
+	if r == nil {
+		return
+	}
+	record := map[string]interface{}{"hook": event, "time": time.Now().Format(time.RFC3339Nano), "organization": r.organization, "run": r.runs.id}
+	if r.agent != "" {
+		record["agent"] = r.agent
+	}
+	for k, v := range fields {
+		record[k] = v
+	}
+	for _, h := range r.hooks {
+		if !firedOn(h.On, event) {
+			continue
+		}
+		select {
+		case h.events <- record:
+		default:
+			logger.Warnf("Hook %s is falling behind, the %s event is dropped", h.name(), event)
+		}
+	}
+}
+
+// close waits for the hooks to run the events fired so far, up to the timeout
+func (r *hookRunner) close(timeout time.Duration) {
+	if r == nil {
+		return
+	}
+	deadline := time.After(timeout)
+	for _, h := range r.hooks {
+		close(h.events)
+	}
+	for _, h := range r.hooks {
+		select {
+		case <-h.done:
+		case <-deadline:
+			logger.Warnf("Hook %s did not finish within %s", h.name(), timeout)
+			return
+		}
+	}
+}
+
+func (h *hook) run() {
+	defer close(h.done)
+	for record := range h.events {
+		if err := h.exec(record); err != nil {
+			countError("hook")
+			logger.Warnf("Hook %s failed on %s: %v", h.name(), record["hook"], err)
+		}
+	}
+}
+
+// exec runs the command with the event on stdin, its output is logged at debug level
+func (h *hook) exec(record map[string]interface{}) error {
+	input, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	timeout := 10 * time.Second
+	if h.Timeout > 0 {
+		timeout = time.Duration(h.Timeout * float64(time.Second))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(append(input, '\n'))
+	cmd.Env = append(os.Environ(), "AGENT_HOOK="+fmt.Sprint(record["hook"]))
+	output, err := cmd.CombinedOutput()
+	if len(output) > 0 {
+		logger.Debugf("Hook %s: %s", h.name(), strings.TrimSpace(string(output)))
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("killed after %s", timeout)
+	}
+	return err
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHooks(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hook.jsonl")
+	config := HookConfig{On: []string{hookConvergence}, Command: []string{"sh", "-c", `cat >> "$0"; echo "$AGENT_HOOK" >> "$0"`, out}}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	hooks := startHooks([]HookConfig{config}, "", "Org1MSP", &runTracker{id: "run"})
+	hooks.fire(hookIteration, map[string]interface{}{"iteration": 1})
+	hooks.fire(hookConvergence, map[string]interface{}{"iteration": 2})
+	hooks.close(5 * time.Second)
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"iteration":2`) || !strings.Contains(lines[0], `"run":"run"`) || lines[1] != hookConvergence {
+		t.Errorf("the hook got %q", lines)
+	}
+	if err := (HookConfig{On: []string{"converged"}, Command: []string{"true"}}).validate(); err == nil {
+		t.Errorf("an unknown event was accepted")
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	language  = flag.String("lang", "", "language of the messages, \"en\" or \"zh\" (default: taken from LC_ALL, LC_MESSAGES or LANG)")
+	localeDir = flag.String("locale-dir", "locales", "folder of locale files, <lang>.json adds a language or overrides the messages and answers of one")
+)
+
+// catalogs translate the English messages, which double as the message keys, into other languages
+// messages missing from a catalog are shown in English
+var catalogs = map[string]map[string]string{
+	"zh": {
+		"Aborting after %v stalls in a row: check that the neighbors are running, that the chaincode emits events matching %q and that the peer is reachable": "连续 %v 次停滞后中止: 请检查邻居是否运行、链码是否发出与 %q 匹配的事件以及节点是否可达",
+		"Acknowledge the emergency stop and rejoin the optimization? [y/n]":                                                                                   "确认紧急停止并重新加入优化? [y/n]",
+		"There is nothing to clean up":           "没有需要清理的内容",
+		"Cleaning up removes:":                   "清理将删除:",
+		"Clean up? [y/n]":                        "清理钱包? [y/n]",
+		"Cleaning up wallet...":                  "正在清理钱包...",
+		"Connection: %s":                         "连接: %s",
+		"Creating wallet":                        "创建钱包",
+		"Discarding event %s from block %v: %v":  "丢弃区块 %[2]v 中的事件 %[1]s: %[3]v",
+		"Event %s in block %v (tx %s): %s":       "区块 %[2]v 中的事件 %[1]s (交易 %[3]s): %[4]s",
+		"Failed to create wallet: %v":            "创建钱包失败: %v",
+		"Failed to load the configuration: %v":   "加载配置失败: %v",
+		"Failed to populate wallet contents: %v": "填充钱包内容失败: %v",
+		"Failed to register contract event: %s":  "注册合约事件失败: %s",
+		"Neighbors %v missed the round deadline of %s at iteration %v, policy %s":                   "邻居 %v 在第 %[3]v 次迭代错过了 %[2]s 的轮次期限, 策略 %[4]s",
+		"No convergence after %v iterations in %s: lambda %v, mismatch %v, P %v":                    "%v 次迭代 (%s) 后仍未收敛: lambda %v, 功率不平衡量 %v, P %v",
+		"The mismatch grew in each of the last %v iterations (%s): lambda %v, P %v at iteration %v": "功率不平衡量在最近 %v 次迭代中持续增大 (%s): 第 %[5]v 次迭代时 lambda %[3]v, P %[4]v",
+		"Ignoring event %s, it is not from a configured neighbor":                                   "忽略事件 %s, 它不是来自已配置的邻居",
+		"Ignoring event %s from block %v, it is this node's own update (tx %s)":                     "忽略区块 %[2]v 中的事件 %[1]s, 它是本节点自己的更新 (交易 %[3]s)",
+		"All %v participants have converged":                                                        "全部 %v 个参与者均已收敛",
+		"The input has ended":                                                                       "输入已结束",
+		"Following the newer run %s of neighbor %s":                                                 "跟随邻居 %[2]s 的较新运行 %[1]s",
+		"Settlement: %.4f MWh delivered at $%.4f/MWh, $%.4f received.":                              "结算：输出 %.4f MWh，价格 $%.4f/MWh，收入 $%.4f。",
+		"Settlement: %.4f MWh consumed at $%.4f/MWh, $%.4f paid.":                                   "结算：消耗 %.4f MWh，价格 $%.4f/MWh，支付 $%.4f。",
+		"Participant %s: price $%.4f/MWh, mismatch %.4f.":                                           "参与者 %s: 电价 $%.4f/MWh, 功率不平衡量 %.4f。",
+		"Please answer %s or %s":                                                                    "请回答 %s 或 %s",
+		"Period %v of %v: demand %v MW":                                                             "时段 %v (共 %v 个): 需求 %v MW",
+		"Dispatch schedule:":                                                                        "调度计划:",
+		"Left the run at iteration %v, handing over a mismatch of %v":                               "已在第 %v 次迭代退出, 移交失配量 %v",
+		"Neighbor %s left the run at iteration %v, taking over a mismatch of %v":                    "邻居 %s 已在第 %v 次迭代退出, 接管失配量 %v",
+		"Neighbor %s rejoined the run at iteration %v":                                              "邻居 %s 已在第 %v 次迭代重新加入",
+		"Ignoring event %s, the neighbor has left the run":                                          "忽略事件 %s, 该邻居已退出",
+		"Converged at iteration %v, waiting for %v to converge":                                     "已在第 %v 次迭代收敛, 等待 %v 收敛",
+		"Initial price %v (%s)":                                                                     "初始价格 %v (%s)",
+		"Iteration %v: dispatch %v MW, regulated setpoint %v MW":                                    "第 %v 次迭代: 调度 %v MW, 调节后设定值 %v MW",
+		"Iteration timing:\n%s":                                                                     "迭代耗时:\n%s",
+		"Neighbor reputations:\n%s":                                                                 "邻居信誉:\n%s",
+		"Next page? [y/n]":                                                                          "下一页? [y/n]",
+		"Not rejoining the optimization until the emergency stop is acknowledged":                   "紧急停止确认之前不会重新加入优化",
+		"No event for %s at iteration %v (%v events so far, largest block jump %v)":                 "第 %[2]v 次迭代 %[1]s 内未收到事件 (已收到 %[3]v 个事件, 最大区块跳跃 %[4]v)",
+		"Page %v (%v records)":                                                                      "第 %v 页 (%v 条记录)",
+		"Result: %s":                                                                                "结果: %s",
+		"Enter %s, help or exit":                                                                    "输入 %s、help 或 exit",
+		"--evaluate queries the function without a transaction, functions lists the functions of the chaincode": "--evaluate 只查询函数而不创建交易，functions 列出链码的函数",
+		"The chaincode publishes no metadata":                                   "链码未发布元数据",
+		"Transaction ID: %s":                                                    "交易ID: %s",
+		"Resuming from iteration %v of %s":                                      "从 %[2]s 的第 %[1]v 次迭代继续",
+		"Shutting down (%s) at iteration %v":                                    "正在关闭 (%s), 当前第 %v 次迭代",
+		"Solve energy management problem with consensus-based algorithm? [y/n]": "使用基于一致性的算法求解能量管理问题? [y/n]",
+		"Solving process ends at iteration %v.":                                 "求解过程在第 %v 次迭代结束。",
+		"Successfully added user %s to wallet!":                                 "已成功将用户 %s 添加到钱包!",
+		"Successfully connected to gateway!":                                    "已成功连接到网关!",
+		"Suspected false data in event %s from block %v: %s":                    "区块 %[2]v 中的事件 %[1]s 疑似虚假数据: %[3]s",
+		"The electricity price is $%.4f/MWh.":                                   "电价为 $%.4f/MWh。",
+		"The optimal power generation is %.4f MW.":                              "最优发电功率为 %.4f MW。",
+		"The power mismatch is %.4f.":                                           "功率不平衡量为 %.4f。",
+		"The regulated setpoint is %v MW.":                                      "调节后的设定值为 %v MW。",
+		"The solving is completed in %s.":                                       "求解用时 %s。",
+		"Type estop at any time for an emergency stop":                          "随时输入 estop 进行紧急停止",
+		"Unknown command %q, type estop for an emergency stop":                  "未知命令 %q, 输入 estop 进行紧急停止",
+		"User %s already exists!":                                               "用户 %s 已存在!",
+		"Waiting for StartOptimization on %s":                                   "等待 %s 上的 StartOptimization",
+		"Waiting for POST /start on %s":                                         "等待 %s 上的 POST /start",
+		"Wallet cleaned up successfully":                                        "钱包清理成功",
+		"Wallet created!":                                                       "钱包已创建!",
+		"application-golang ends":                                               "application-golang 结束",
+		"connecting to gateway":                                                 "连接网关",
+		"getting contract":                                                      "获取合约",
+		"getting network":                                                       "获取网络",
+		"successfully connected to network %s":                                  "已成功连接到网络 %s",
+		"successfully got contract %s":                                          "已成功获取合约 %s",
+	},
+}
+
+// localeAnswers are the words of a language that answer the prompts, besides the English yes, y, no and n
+type localeAnswers struct {
+	yes, no []string
+}
+
+var answers = map[string]localeAnswers{
+	"zh": {yes: []string{"是", "好", "对"}, no: []string{"否", "不"}},
+}
+
+// localeFile is a file of the -locale-dir, e.g. de.json:
+// {"messages": {"Clean up? [y/n]": "Aufräumen? [j/n]"}, "yes": ["ja", "j"], "no": ["nein"]}
+type localeFile struct {
+	Messages map[string]string `json:"messages"`
+	Yes      []string          `json:"yes"`
+	No       []string          `json:"no"`
+}
+
+// loadLocales adds the languages of the locale files to the catalogs, a missing folder leaves the built-in ones
+func loadLocales(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Clean(file))
+		if err != nil {
+			return err
+		}
+		var locale localeFile
+		if err := json.Unmarshal(data, &locale); err != nil {
+			return fmt.Errorf("invalid locale file %s: %w", file, err)
+		}
+		lang := strings.ToLower(strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)))
+		if catalogs[lang] == nil {
+			catalogs[lang] = map[string]string{}
+		}
+		for message, translated := range locale.Messages {
+			catalogs[lang][message] = translated
+		}
+		words := answers[lang]
+		if len(locale.Yes) > 0 {
+			words.yes = locale.Yes
+		}
+		if len(locale.No) > 0 {
+			words.no = locale.No
+		}
+		answers[lang] = words
+	}
+	return nil
+}
+
+// currentLanguage returns the language selected with -lang or the locale of the environment
+func currentLanguage() string {
+	lang := *language
+	if lang == "" {
+		for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+			if lang = os.Getenv(env); lang != "" {
+				break
+			}
+		}
+	}
+	// locales look like zh_CN.UTF-8, only the language part is used
+	lang = strings.ToLower(lang)
+	if i := strings.IndexAny(lang, "_.-@"); i >= 0 {
+		lang = lang[:i]
+	}
+	return lang
+}
+
+// tr translates a message into the current language and formats it with the arguments
+func tr(format string, args ...interface{}) string {
+	if translated, ok := catalogs[currentLanguage()][format]; ok {
+		format = translated
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,19 @@
+package main
+
+import "testEvent/fabricagent"
+
+// loadIdentity reads the user's credentials into a wallet identity, for an HSM identity only the certificate is read
+func loadIdentity(mspID string, certPath string, keyPath string, hsm bool) (*walletIdentity, error) {
+	if hsm {
+		_, certPEM, err := fabricagent.ReadCertificate(certPath)
+		if err != nil {
+			return nil, err
+		}
+		return newHSMIdentity(mspID, string(certPEM)), nil
+	}
+	cert, key, err := fabricagent.LoadCredentials(certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	return newX509Identity(mspID, cert, key), nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+
+	"testEvent/fabricagent"
+)
+
+// the identity types of the wallet, the private key of an HSM identity never leaves the token
+const (
+	x509IdentityType = fabricagent.X509IdentityType
+	hsmIdentityType  = "HSM-X.509"
+)
+
+// identityProvider creates the signing function of an identity from wherever its private key is kept
+type identityProvider interface {
+	// signer returns the signing function and a function releasing it once the connection is closed
+	signer(id *walletIdentity, cert *x509.Certificate) (identity.Sign, func() error, error)
+}
+
+// identityProviders are the providers of the wallet identity types
+var identityProviders = map[string]identityProvider{
+	x509IdentityType: fileKeyProvider{},
+	hsmIdentityType:  pkcs11Provider{},
+}
+
+// fileKeyProvider signs with the private key stored in the wallet
+type fileKeyProvider struct{}
+
+func (fileKeyProvider) signer(id *walletIdentity, cert *x509.Certificate) (identity.Sign, func() error, error) {
+	key, err := identity.PrivateKeyFromPEM([]byte(id.Credentials.PrivateKey))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	sign, err := identity.NewPrivateKeySign(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sign, func() error { return nil }, nil
+}
+
+// signingIdentity returns the identity of the wallet entry, the function signing for it and the function releasing the signer
+func signingIdentity(id *walletIdentity) (*identity.X509Identity, identity.Sign, func() error, error) {
+	provider, ok := identityProviders[id.Type]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unsupported identity type %q", id.Type)
+	}
+	certificate, err := identity.CertificateFromPEM([]byte(id.Credentials.Certificate))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid certificate: %w", err)
+	}
+	x509ID, err := identity.NewX509Identity(id.MspID, certificate)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sign, release, err := provider.signer(id, certificate)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return x509ID, sign, release, nil
+}
+
+// pin returns the user PIN of the token, preferring the HSM_PIN environment variable
+func (h HSMConfig) pin() string {
+	if pin := os.Getenv("HSM_PIN"); pin != "" {
+		return pin
+	}
+	return h.Pin
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// the chaincode function used to tell the other organizations that this node changed its grid mode
+const modeChangeFunction = "SendModeChange"
+
+var (
+	islandFlagFile     = flag.String("island-flag", "", "file the device driver writes \"1\" to when the microgrid is islanded")
+	frequencyFile      = flag.String("frequency-file", "", "file holding the latest measured grid frequency in Hz, islanding is assumed when it leaves the tolerance band")
+	nominalFrequency   = flag.Float64("nominal-frequency", 50, "nominal grid frequency in Hz")
+	frequencyTolerance = flag.Float64("frequency-tolerance", 0.5, "largest frequency deviation in Hz that is still considered grid-connected")
+	islandDemand       = flag.Float64("island-demand", 0, "local demand in MW the node has to cover on its own when islanded")
+	islandMaxPower     = flag.Float64("island-max-power", 0, "upper power limit in MW when islanded, e.g. to keep reserve headroom (0: the generator's pMax)")
+)
+
+// powerLimits are the lower and upper power limits of the node in MW, negative for a load or a charging battery
+type powerLimits struct {
+	Min float64
+	Max float64
+}
+
+func (l powerLimits) clamp(P float64) float64 {
+	return math.Min(math.Max(P, l.Min), l.Max)
+}
+
+// islandDetector tells whether the microgrid is islanded from the device-driver flag, the device driver plugin or the measured frequency
+type islandDetector struct {
+	islanded bool
+	// base are the power limits of the node when grid-connected
+	base powerLimits
+	// events are the grid events of the protection relays, their constraints apply in either mode
+	events *gridEvents
+}
+
+// check returns whether the microgrid is islanded and whether this changed since the last check
+func (d *islandDetector) check() (bool, bool) {
+	islanded := false
+	if *islandFlagFile != "" {
+		if data, err := os.ReadFile(filepath.Clean(*islandFlagFile)); err == nil {
+			islanded = strings.TrimSpace(string(data)) == "1"
+		}
+	}
+	if !islanded {
+		islanded = driverIslanded()
+	}
+	if !islanded && *frequencyFile != "" {
+		if data, err := os.ReadFile(filepath.Clean(*frequencyFile)); err == nil {
+			f, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+			islanded = err == nil && math.Abs(f-*nominalFrequency) > *frequencyTolerance
+		}
+	}
+	changed := islanded != d.islanded
+	d.islanded = islanded
+	return islanded, changed
+}
+
+// limits returns the power limits of the current grid mode and grid events
+func (d *islandDetector) limits() powerLimits {
+	limits := d.base
+	if d.islanded && *islandMaxPower > 0 {
+		limits.Max = math.Min(*islandMaxPower, limits.Max)
+	}
+	return d.events.constrain(limits)
+}
+
+// mode returns the name of the current grid mode as reported to the chain
+func (d *islandDetector) mode() string {
+	if d.islanded {
+		return "island"
+	}
+	return "grid"
+}
+
+// notifyModeChange reports the grid mode of this node on the chain
+func notifyModeChange(contract contractAPI, mode string) {
+	logger.Infof("Switching to %s mode", mode)
+	if _, err := submitTransaction(contract, modeChangeFunction, mode); err != nil {
+		logger.Warnf("Failed to notify the mode change: %s", explainError(err))
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	logLevel        = flag.String("log-level", "info", "lowest level of the log messages shown: debug, info, warn or error")
+	logFormat       = flag.String("log-format", "text", "format of the log on stderr: text or json")
+	traceIterations = flag.String("trace-iterations", "", "JSON lines file every iteration's l1, l2, m1, m2, P and eta are recorded to for post-run analysis")
+)
+
+// logger writes the log to stderr, it logs at info level in text form until setupLogging applies the flags
+var logger = newLogger(zapcore.InfoLevel, "text")
+
+// tracer records the iterations to the -trace-iterations file, it discards them when no file is set
+var tracer = zap.NewNop()
+
+func newLogger(level zapcore.Level, format string) *zap.SugaredLogger {
+	config := zap.NewProductionEncoderConfig()
+	config.EncodeTime = zapcore.ISO8601TimeEncoder
+	var encoder zapcore.Encoder
+	if format == "json" {
+		encoder = zapcore.NewJSONEncoder(config)
+	} else {
+		config.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(config)
+	}
+	// the text log shares the terminal with the status line of a run
+	var sink zapcore.WriteSyncer = zapcore.Lock(os.Stderr)
+	if format != "json" {
+		sink = console
+	}
+	core := zapcore.NewCore(encoder, sink, level)
+	return zap.New(core).Sugar()
+}
+
+// setupLogging applies the logging flags, it is called once the flags are parsed
+func setupLogging() error {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		return fmt.Errorf("invalid log level %q", *logLevel)
+	}
+	if *logFormat != "text" && *logFormat != "json" {
+		return fmt.Errorf("invalid log format %q, use text or json", *logFormat)
+	}
+	logger = newLogger(level, *logFormat)
+
+	if *traceIterations != "" {
+		file, err := os.OpenFile(*traceIterations, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open the iteration trace: %w", err)
+		}
+		config := zap.NewProductionEncoderConfig()
+		config.EncodeTime = zapcore.ISO8601TimeEncoder
+		tracer = zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(config), zapcore.AddSync(file), zapcore.DebugLevel))
+	}
+	return nil
+}
+
+// closeLogging flushes the log and the iteration trace
+func closeLogging() {
+	_ = logger.Sync()
+	_ = tracer.Sync()
+}
+
+// traceIteration records the inputs and results of one iteration
+func traceIteration(iter int, l1, l2, m1, m2, P, eta float64) {
+	tracer.Info("iteration",
+		zap.Int("iter", iter),
+		zap.Float64("l1", l1),
+		zap.Float64("l2", l2),
+		zap.Float64("m1", m1),
+		zap.Float64("m2", m2),
+		zap.Float64("P", P),
+		zap.Float64("eta", eta),
+	)
+}
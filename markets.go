@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+var marketSyncTimeout = flag.Duration("market-sync-timeout", 30*time.Second, "time a market waits for the other markets to finish the previous iteration before it goes on without them")
+
+// MarketsConfig runs an optimization on each of several contracts of the channel side by side, e.g. an energy and a
+// reserve market, sharing the gateway connection of the process. Their iterations go in lockstep and the markets
+// share the capacity of the node
+type MarketsConfig struct {
+	// Capacity is the power in MW the node offers to all markets together, the power of a market is limited to what
+	// the others leave of it (default: no shared limit)
+	Capacity float64 `json:"capacity" yaml:"capacity"`
+	// Contracts are the markets, each on a contract of its own
+	Contracts []MarketConfig `json:"contracts" yaml:"contracts"`
+}
+
+// MarketConfig is a market of the node, the settings it leaves out are those of the config file
+type MarketConfig struct {
+	// Name identifies the market in the logs, e.g. energy or reserve
+	Name string `json:"name" yaml:"name"`
+	// ContractName is the contract of the market
+	ContractName string `json:"contractName" yaml:"contractName"`
+	// EventFilter replaces the event filter of the organization, for a contract that names its events differently
+	EventFilter string `json:"eventFilter" yaml:"eventFilter"`
+	// Role and Generator replace those of the config file, e.g. for the cost of the reserve
+	Role      string          `json:"role" yaml:"role"`
+	Generator *GeneratorModel `json:"generator" yaml:"generator"`
+}
+
+func (c MarketsConfig) validate() error {
+	if c.Capacity < 0 {
+		return fmt.Errorf("the capacity must not be negative, got %v", c.Capacity)
+	}
+	if len(c.Contracts) == 1 {
+		return errors.New("a single market runs without the markets section")
+	}
+	names := map[string]bool{}
+	contracts := map[string]bool{}
+	for _, m := range c.Contracts {
+		if m.Name == "" || m.ContractName == "" {
+			return errors.New("a market needs its name and its contractName")
+		}
+		if names[m.Name] {
+			return fmt.Errorf("market %s is listed twice", m.Name)
+		}
+		names[m.Name] = true
+		if contracts[m.ContractName] {
+			return fmt.Errorf("contract %s has two markets", m.ContractName)
+		}
+		contracts[m.ContractName] = true
+		if err := validateRole(m.Role); err != nil {
+			return fmt.Errorf("invalid role of market %s: %w", m.Name, err)
+		}
+		if m.Generator != nil {
+			if err := m.Generator.validate(); err != nil {
+				return fmt.Errorf("invalid generator of market %s: %w", m.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// config returns the configuration of the market, the file's settings on the market's contract
+func (m MarketConfig) config(base Config) Config {
+	c := base
+	c.ContractName = m.ContractName
+	if m.EventFilter != "" {
+		c.EventFilter, c.Events = m.EventFilter, nil
+	}
+	if m.Role != "" {
+		c.Role = m.Role
+	}
+	if m.Generator != nil {
+		c.Generator = *m.Generator
+	}
+	return c
+}
+
+// runMarkets runs the optimization of every market in a goroutine of its own on the connection of the process until
+// all have ended, false if any of them failed
+func runMarkets(markets MarketsConfig) bool {
+	if err := checkAgentFlags(); err != nil {
+		logger.Errorf("%v", err)
+		return false
+	}
+	wallet, err := cfg.openWallet()
+	if err != nil {
+		logger.Errorf("%v", err)
+		return false
+	}
+	gw, _, err := cfg.connect(wallet)
+	if err != nil {
+		logger.Errorf("%v", err)
+		return false
+	}
+	defer gw.Close()
+	// the markets share the working directory like the agents of the multi-agent mode
+	*checkpointFile, *eventCheckpointFile, *shutdownStateFile, *storageStateFile = "", "", "", ""
+	coordinator := newMarketCoordinator(markets)
+	var wg sync.WaitGroup
+	failed := make(chan string, len(markets.Contracts))
+	for _, m := range markets.Contracts {
+		a := newAgent(m.Name, m.config(cfg))
+		a.shared, a.markets = gw, coordinator
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer coordinator.leave(a.name)
+			if err := a.run(); err != nil {
+				logger.Errorf("Market %s failed: %v", a.name, err)
+				failed <- a.name
+			}
+		}()
+	}
+	wg.Wait()
+	close(failed)
+	return len(failed) == 0
+}
+
+// connect connects the agent to its contract, the agent of a market shares the connection of the process, which it
+// doesn't close
+func (a *Agent) connect(wallet *fileWallet) (*gatewayConnection, *client.Contract, error) {
+	if a.shared == nil {
+		return a.cfg.connect(wallet)
+	}
+	gw := *a.shared
+	gw.chaincode, gw.shared = a.cfg.ContractName, true
+	return &gw, gw.GetNetwork(a.cfg.NetworkName).GetContract(a.cfg.ContractName), nil
+}
+
+// marketCoordinator keeps the markets of the node in lockstep: a market starts an iteration once all others have
+// finished the one before or have ended, and its power is limited to the capacity the others leave. A nil
+// coordinator is the single market of a process
+type marketCoordinator struct {
+	mu       sync.Mutex
+	capacity float64
+	// iterations are the iterations the markets have finished and power their power after it
+	iterations map[string]int
+	power      map[string]float64
+	ended      map[string]bool
+	// changed is closed and replaced whenever a market finishes an iteration or ends
+	changed chan struct{}
+}
+
+func newMarketCoordinator(c MarketsConfig) *marketCoordinator {
+	m := &marketCoordinator{capacity: c.Capacity, iterations: map[string]int{}, power: map[string]float64{}, ended: map[string]bool{}, changed: make(chan struct{})}
+	for _, market := range c.Contracts {
+		m.iterations[market.Name] = 0
+	}
+	return m
+}
+
+// await waits until the other markets have finished the iteration before iter, or for -market-sync-timeout
+func (m *marketCoordinator) await(name string, iter int) {
+	if m == nil {
+		return
+	}
+	timeout := time.NewTimer(*marketSyncTimeout)
+	defer timeout.Stop()
+	for {
+		m.mu.Lock()
+		var behind []string
+		for other, done := range m.iterations {
+			if other != name && !m.ended[other] && done < iter-1 {
+				behind = append(behind, other)
+			}
+		}
+		changed := m.changed
+		m.mu.Unlock()
+		if len(behind) == 0 {
+			return
+		}
+		select {
+		case <-changed:
+		case <-timeout.C:
+			logger.Warnf("Market %s goes on with iteration %v without %v", name, iter, behind)
+			return
+		}
+	}
+}
+
+// finished records that the market has finished the iteration with the power
+func (m *marketCoordinator) finished(name string, iter int, P float64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.iterations[name], m.power[name] = iter, P
+	m.notify()
+}
+
+// leave releases the markets that wait for one that has ended, its power stays reserved
+func (m *marketCoordinator) leave(name string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ended[name] = true
+	m.notify()
+}
+
+func (m *marketCoordinator) notify() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// limits narrows the power limits of the market to the capacity the other markets leave
+func (m *marketCoordinator) limits(name string, l powerLimits) powerLimits {
+	if m == nil || m.capacity == 0 {
+		return l
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	left := m.capacity
+	for other, P := range m.power {
+		if other != name {
+			left -= math.Max(P, 0)
+		}
+	}
+	l.Max = math.Max(math.Min(l.Max, left), l.Min)
+	return l
+}
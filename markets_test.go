@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMarketCoordinator(t *testing.T) {
+	m := newMarketCoordinator(MarketsConfig{Capacity: 10, Contracts: []MarketConfig{{Name: "energy"}, {Name: "reserve"}}})
+	m.finished("energy", 1, 7)
+	if l := m.limits("reserve", powerLimits{Min: 0, Max: 8}); l != (powerLimits{Min: 0, Max: 3}) {
+		t.Errorf("the reserve is limited to %+v", l)
+	}
+	released := make(chan struct{})
+	go func() {
+		// the energy market waits for the reserve to finish its first iteration
+		m.await("energy", 2)
+		close(released)
+	}()
+	select {
+	case <-released:
+		t.Fatal("iteration 2 started before the other market finished iteration 1")
+	case <-time.After(10 * time.Millisecond):
+	}
+	m.finished("reserve", 1, 2)
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("iteration 2 didn't start after the other market finished iteration 1")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// the chaincode functions a node announces itself with: SendJoin (iteration) when it enters a run and SendLeave
+// (iteration, handover, weight) when it stops before convergence. Their events carry a membership envelope, e.g.
+// {"version":2,"membership":"leave","sender":"Org2MSP","iteration":17,"handover":0.3,"weight":0.5}
+const (
+	joinFunction  = "SendJoin"
+	leaveFunction = "SendLeave"
+)
+
+var membershipEnabled = flag.Bool("membership", false, "announce joining and leaving the run on the chain and rebalance the consensus when a neighbor leaves or rejoins mid-run")
+
+// membershipEvent is the payload of a join or leave event
+type membershipEvent struct {
+	Version    int     `json:"version"`
+	Membership string  `json:"membership"`
+	Sender     string  `json:"sender"`
+	Iteration  int     `json:"iteration"`
+	Handover   float64 `json:"handover"`
+	Weight     float64 `json:"weight"`
+}
+
+// decodeMembership reads a join or leave event, ok is false for any other payload, e.g. an update
+func decodeMembership(payload string) (e membershipEvent, ok bool, err error) {
+	payload = strings.TrimSpace(payload)
+	if !strings.HasPrefix(payload, "{") || !strings.Contains(payload, `"membership"`) {
+		return e, false, nil
+	}
+	if err := json.Unmarshal([]byte(payload), &e); err != nil {
+		return e, true, fmt.Errorf("invalid membership event: %w", err)
+	}
+	switch e.Membership {
+	case "join", "leave":
+		return e, true, nil
+	}
+	return e, true, fmt.Errorf("unknown membership %q", e.Membership)
+}
+
+// membership keeps track of the configured neighbors that have left the run, nil without -membership leaves every
+// neighbor in it
+type membership struct {
+	// departed are the event names of the neighbors that announced leaving and have not joined again
+	departed map[string]bool
+}
+
+func newMembership() *membership {
+	if !*membershipEnabled {
+		return nil
+	}
+	return &membership{departed: map[string]bool{}}
+}
+
+// active returns the neighbors that take part in the run, the weight of a departed neighbor stays with the node
+func (m *membership) active(neighbors []Neighbor) []Neighbor {
+	if m == nil || len(m.departed) == 0 {
+		return neighbors
+	}
+	var active []Neighbor
+	for _, n := range neighbors {
+		if !m.departed[n.Event] {
+			active = append(active, n)
+		}
+	}
+	return active
+}
+
+// leave removes the neighbor from the run and returns the part of its handover this node takes: the share of the
+// neighbor's weight for this node in the weight it announced, all of it without configured neighbors. ok is false if
+// the neighbor is not one of this node's or has left already
+func (m *membership) leave(neighbors []Neighbor, e membershipEvent, name string) (handover float64, ok bool) {
+	if m.departed[name] {
+		return 0, false
+	}
+	share := 1.0
+	if len(neighbors) > 0 {
+		share = 0
+		for _, n := range neighbors {
+			if n.Event == name && e.Weight > 0 {
+				share = n.Weight / e.Weight
+			}
+		}
+		if share == 0 {
+			return 0, false
+		}
+	}
+	m.departed[name] = true
+	return e.Handover * share, true
+}
+
+// join puts a departed neighbor back into the run, false if it had not left
+func (m *membership) join(name string) bool {
+	if !m.departed[name] {
+		return false
+	}
+	delete(m.departed, name)
+	return true
+}
+
+// left tells whether the neighbor has left the run
+func (m *membership) left(name string) bool {
+	return m != nil && m.departed[name]
+}
+
+// use makes the round wait for the active neighbors only, an update a departed neighbor sent is dropped from it
+func (m *membership) use(round *consensusRound, neighbors []Neighbor) {
+	round.neighbors = m.active(neighbors)
+	if m == nil {
+		return
+	}
+	for name := range m.departed {
+		delete(round.latest, name)
+		delete(round.previous, name)
+	}
+}
+
+// announceJoin tells the other nodes that this node enters the run
+func (m *membership) announceJoin(contract contractAPI, iter int) {
+	if m == nil {
+		return
+	}
+	if _, err := submitTransaction(contract, joinFunction, strconv.Itoa(iter)); err != nil {
+		logger.Warnf("Failed to announce joining the run: %s", explainError(err))
+	}
+}
+
+// announceLeave hands the part of the mismatch this node holds beyond its own demand over to its neighbors as it
+// leaves, so the mismatches of the nodes that go on still sum to their demand. It returns whether the neighbors took it
+func (m *membership) announceLeave(contract contractAPI, iter int, handover float64, neighbors []Neighbor) bool {
+	if m == nil {
+		return false
+	}
+	var weight float64
+	for _, n := range neighbors {
+		weight += n.Weight
+	}
+	args := []string{strconv.Itoa(iter), formatValue(handover), formatValue(weight)}
+	if _, err := submitTransaction(contract, leaveFunction, args...); err != nil {
+		logger.Warnf("Failed to announce leaving the run: %s", explainError(err))
+		return false
+	}
+	logger.Info(tr("Left the run at iteration %v, handing over a mismatch of %v", iter, handover))
+	return true
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMembership(t *testing.T) {
+	*membershipEnabled = true
+	defer func() { *membershipEnabled = false }()
+	neighbors := []Neighbor{{Event: "Org2", Weight: 0.25}, {Event: "Org3", Weight: 0.25}}
+	members := newMembership()
+	round := newConsensusRound(neighbors)
+	round.add("Org3", 6, -0.5)
+
+	e, ok, err := decodeMembership(`{"version":2,"membership":"leave","sender":"Org3MSP","iteration":17,"handover":0.6,"weight":0.5}`)
+	if !ok || err != nil {
+		t.Fatalf("decodeMembership = %v, %v", ok, err)
+	}
+	// Org3 splits its handover among its neighbors by their weights, this node has 0.25 of 0.5
+	handover, left := members.leave(neighbors, e, "Org3")
+	if !left || math.Abs(handover-0.3) > 1e-12 {
+		t.Errorf("leave = %v, %v, want 0.3, true", handover, left)
+	}
+	if _, again := members.leave(neighbors, e, "Org3"); again {
+		t.Errorf("a neighbor left twice")
+	}
+	members.use(round, neighbors)
+	if len(round.neighbors) != 1 || round.neighbors[0].Event != "Org2" || !round.empty() {
+		t.Errorf("the round waits for %v with %v, want Org2 only", round.neighbors, round.latest)
+	}
+	if !members.join("Org3") || members.left("Org3") {
+		t.Errorf("Org3 did not rejoin")
+	}
+	members.use(round, neighbors)
+	if len(round.neighbors) != 2 {
+		t.Errorf("the round waits for %v after the rejoin", round.neighbors)
+	}
+	if _, ok, _ := decodeMembership(`{"version":2,"lambda":6.4,"mismatch":-0.5}`); ok {
+		t.Errorf("an update was read as a membership event")
+	}
+
+	contract := &mockContract{}
+	if !members.announceLeave(contract, 9, 0.5, neighbors) {
+		t.Fatalf("the leave was not announced")
+	}
+	if c := contract.calls[0]; c.name != leaveFunction || !reflect.DeepEqual(c.args, []string{"9", formatValue(0.5), formatValue(0.5)}) {
+		t.Errorf("announced %s %q", c.name, c.args)
+	}
+}
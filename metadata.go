@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dlclark/regexp2"
+)
+
+// chaincodes written with the contract API answer this function with a description of themselves
+const metadataFunction = "org.hyperledger.fabric:GetMetadata"
+
+// contractMetadata is the part of the contract API metadata the client uses
+type contractMetadata struct {
+	Contracts map[string]struct {
+		Name         string             `json:"name"`
+		Transactions []functionMetadata `json:"transactions"`
+		// the contract API has no standard place for events, chaincodes that document them list them here
+		Events []struct {
+			Name string `json:"name"`
+		} `json:"events"`
+	} `json:"contracts"`
+}
+
+type functionMetadata struct {
+	Name       string   `json:"name"`
+	Tag        []string `json:"tag"`
+	Parameters []struct {
+		Name   string          `json:"name"`
+		Schema json.RawMessage `json:"schema"`
+	} `json:"parameters"`
+	// Returns is the schema of the response, absent for a function that returns nothing
+	Returns json.RawMessage `json:"returns"`
+}
+
+// fetchMetadata queries the metadata of the contract, chaincodes that don't use the contract API fail here
+func fetchMetadata(contract contractAPI) (*contractMetadata, error) {
+	result, err := contract.EvaluateTransaction(metadataFunction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the contract metadata: %w", explainError(err))
+	}
+	metadata := &contractMetadata{}
+	if err := json.Unmarshal(result, metadata); err != nil {
+		return nil, fmt.Errorf("unexpected contract metadata: %w", err)
+	}
+	return metadata, nil
+}
+
+// functions returns the names of the transactions of all contracts in the chaincode
+func (m *contractMetadata) functions() []string {
+	var names []string
+	for _, c := range m.Contracts {
+		for _, t := range c.Transactions {
+			names = append(names, t.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// eventNames returns the documented event names, if the chaincode documents any
+func (m *contractMetadata) eventNames() []string {
+	var names []string
+	for _, c := range m.Contracts {
+		for _, e := range c.Events {
+			names = append(names, e.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkEventFilter warns if the event filter matches none of the events the chaincode documents
+func checkEventFilter(contract contractAPI, eventFilter string) {
+	metadata, err := fetchMetadata(contract)
+	if err != nil {
+		// most chaincodes don't publish metadata, there is nothing to check against then
+		return
+	}
+	events := metadata.eventNames()
+	if len(events) == 0 {
+		return
+	}
+	reg, err := regexp2.Compile(eventFilter, 0)
+	if err != nil {
+		logger.Warnf("The event filter %q is not a valid regular expression: %v", eventFilter, err)
+		return
+	}
+	for _, name := range events {
+		if matched, _ := reg.MatchString(name); matched {
+			return
+		}
+	}
+	logger.Warnf("The event filter %q matches none of the events the chaincode documents: %v", eventFilter, events)
+}
+
+// function returns the metadata of the function, false for a function the chaincode doesn't publish
+// a name like "energy:SendUpdate" selects the function of one of the contracts of the chaincode
+func (m *contractMetadata) function(name string) (functionMetadata, bool) {
+	contractName := ""
+	if i := strings.Index(name, ":"); i >= 0 {
+		contractName, name = name[:i], name[i+1:]
+	}
+	for key, c := range m.Contracts {
+		if contractName != "" && key != contractName && c.Name != contractName {
+			continue
+		}
+		for _, t := range c.Transactions {
+			if t.Name == name {
+				return t, true
+			}
+		}
+	}
+	return functionMetadata{}, false
+}
+
+// signature returns the parameters of the function with their types, e.g. " <lambda:number> <mismatch:number>"
+func (m *contractMetadata) signature(name string) string {
+	f, _ := m.function(name)
+	var s strings.Builder
+	for _, p := range f.Parameters {
+		fmt.Fprintf(&s, " <%s:%s>", p.Name, schemaType(p.Schema))
+	}
+	return s.String()
+}
+
+// check fails for an unknown function, a wrong number of arguments or an argument that doesn't fit the type of its parameter
+// without metadata every call is let through
+func (m *contractMetadata) check(name string, args []string) error {
+	if m == nil {
+		return nil
+	}
+	f, ok := m.function(name)
+	if !ok {
+		return fmt.Errorf("the chaincode has no function %s, see contract describe", name)
+	}
+	if len(args) != len(f.Parameters) {
+		return fmt.Errorf("%s takes %v arguments:%s", name, len(f.Parameters), m.signature(name))
+	}
+	for i, p := range f.Parameters {
+		var err error
+		switch schemaType(p.Schema) {
+		case "number":
+			_, err = strconv.ParseFloat(args[i], 64)
+		case "integer":
+			_, err = strconv.ParseInt(args[i], 10, 64)
+		case "boolean":
+			_, err = strconv.ParseBool(args[i])
+		}
+		if err != nil {
+			return fmt.Errorf("argument %s of %s must be a %s, got %q", p.Name, name, schemaType(p.Schema), args[i])
+		}
+	}
+	return nil
+}
+
+// schemaType returns the type of a JSON schema, "string" if it has none
+func schemaType(schema json.RawMessage) string {
+	var s struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(schema, &s) != nil || s.Type == "" {
+		return "string"
+	}
+	return s.Type
+}
+
+// describe prints the contracts of the chaincode with their transactions, the parameters with their schemas and the response
+func (m *contractMetadata) describe() {
+	var names []string
+	for name := range m.Contracts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println(name)
+		transactions := m.Contracts[name].Transactions
+		sort.Slice(transactions, func(i, j int) bool { return transactions[i].Name < transactions[j].Name })
+		for _, t := range transactions {
+			fmt.Printf("  %s%s", t.Name, m.signature(name+":"+t.Name))
+			if len(t.Returns) > 0 {
+				fmt.Printf(" -> %s", schemaType(t.Returns))
+			}
+			if len(t.Tag) > 0 {
+				fmt.Printf("  [%s]", strings.Join(t.Tag, ", "))
+			}
+			fmt.Println()
+			for _, p := range t.Parameters {
+				if len(p.Schema) > 0 {
+					fmt.Printf("      %s: %s\n", p.Name, compactJSON(p.Schema))
+				}
+			}
+		}
+	}
+}
+
+// compactJSON returns the JSON on one line, as it came if it can't be compacted
+func compactJSON(data []byte) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, data); err != nil {
+		return string(data)
+	}
+	return b.String()
+}
+
+// contractCommand runs "contract functions", "contract events" and "contract describe"
+// functions and events print one name per line so the output can feed shell completion
+func contractCommand(contract contractAPI, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: contract functions | contract events | contract describe")
+	}
+	metadata, err := fetchMetadata(contract)
+	if err != nil {
+		return err
+	}
+	var names []string
+	switch args[0] {
+	case "functions":
+		names = metadata.functions()
+	case "events":
+		names = metadata.eventNames()
+	case "describe":
+		metadata.describe()
+		return nil
+	default:
+		return fmt.Errorf("unknown contract command %q, use functions, events or describe", args[0])
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var metricsAddr = flag.String("metrics-addr", "", "address (e.g. :9100) to serve Prometheus metrics on at /metrics, empty disables them")
+
+// the metrics are kept in their own registry, so nothing else linked into the binary shows up on the endpoint
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	lambdaGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "agent_lambda",
+		Help: "Current price lambda of this node in $/MWh.",
+	})
+	mismatchGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "agent_mismatch_mw",
+		Help: "Current power mismatch estimate of this node in MW.",
+	})
+	powerGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "agent_power_mw",
+		Help: "Current dispatched power of this node in MW.",
+	})
+	iterationGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "agent_iteration",
+		Help: "Iteration of the current run.",
+	})
+	convergedCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "agent_runs_converged_total",
+		Help: "Runs of the optimization that converged.",
+	})
+	eventsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "agent_events_received_total",
+		Help: "Chaincode events received, by event name.",
+	}, []string{"event"})
+	submitLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "agent_submit_latency_seconds",
+		Help:    "Time SendUpdate takes from submission until it is committed.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+	})
+	eventLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "agent_event_latency_seconds",
+		Help:    "Time from this node's last update until a neighbor's event arrives.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 12),
+	})
+	commitStatuses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "agent_commit_status_total",
+		Help: "Commit statuses of the submitted transactions, by validation code.",
+	}, []string{"code"})
+	iterationPhase = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "agent_iteration_phase_seconds",
+		Help:    "Time an iteration spends in a phase: wait for the events, compute, submit until ordered, commit.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 4, 10),
+	}, []string{"phase"})
+	peerFailovers = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "agent_peer_failovers_total",
+		Help: "Connections made to a backup peer because the peers before it were unreachable.",
+	})
+	queueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "agent_pipeline_queue_depth",
+		Help: "Events or updates waiting in a stage of the pipeline: received, decoded, submit or commit.",
+	}, []string{"stage"})
+	errorsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "agent_errors_total",
+		Help: "Errors by kind: submit, invalidated, discarded, suspicious, forged, stall, stream, late.",
+	}, []string{"kind"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		lambdaGauge, mismatchGauge, powerGauge, iterationGauge, convergedCounter,
+		eventsCounter, submitLatency, eventLatency, commitStatuses, iterationPhase, peerFailovers, errorsCounter, queueDepth,
+		prometheus.NewGoCollector(),
+	)
+}
+
+// startMetrics serves the metrics endpoint in the background if -metrics-addr is set
+func startMetrics() {
+	if *metricsAddr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	handleHealth(mux)
+	go func() {
+		logger.Infof("Serving metrics on %s/metrics", *metricsAddr)
+		if err := http.ListenAndServe(*metricsAddr, mux); err != nil {
+			logger.Warnf("Metrics endpoint stopped: %v", err)
+		}
+	}()
+}
+
+// observeState records the state the run published in the metrics and hands it to the API
+func observeState(state StateSnapshot) {
+	iterationGauge.Set(float64(state.Iteration))
+	lambdaGauge.Set(state.Lambda)
+	mismatchGauge.Set(state.Mismatch)
+	powerGauge.Set(state.P)
+	api.observe()
+}
+
+// countError counts an error of the given kind
+func countError(kind string) {
+	errorsCounter.WithLabelValues(kind).Inc()
+}
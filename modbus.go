@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// modbusTimeout bounds a request to the device, the connection is opened again on the next request after a failure
+const modbusTimeout = 5 * time.Second
+
+// the Modbus functions the agent uses
+const (
+	modbusReadHolding   = 0x03
+	modbusReadInput     = 0x04
+	modbusWriteMultiple = 0x10
+)
+
+// modbusDevice reads the measurements of an inverter or meter and writes its setpoint over Modbus TCP
+type modbusDevice struct {
+	config ModbusConfig
+	mu     sync.Mutex
+	conn   net.Conn
+	// transaction numbers the requests, the device echoes it in the response
+	transaction uint16
+}
+
+// fieldDevice is the Modbus device, nil unless one is configured
+var fieldDevice *modbusDevice
+
+// openModbus checks the configured registers, nil if no device is configured
+// the connection is opened with the first request, and again after a failed one
+func openModbus(config ModbusConfig) (*modbusDevice, error) {
+	if config.Address == "" {
+		return nil, nil
+	}
+	for name, r := range map[string]*ModbusRegister{"generation": config.Generation, "load": config.Load, "setpoint": config.Setpoint} {
+		if r == nil {
+			continue
+		}
+		if _, err := r.words(); err != nil {
+			return nil, fmt.Errorf("modbus %s register: %w", name, err)
+		}
+		if r.Table != "" && r.Table != "holding" && r.Table != "input" {
+			return nil, fmt.Errorf("modbus %s register: unknown table %q, use holding or input", name, r.Table)
+		}
+	}
+	if config.Setpoint != nil && config.Setpoint.Table == "input" {
+		return nil, fmt.Errorf("modbus setpoint register: input registers can't be written")
+	}
+	return &modbusDevice{config: config}, nil
+}
+
+// seed returns the power and mismatch a new run starts from: the measured generation, and the load it doesn't cover
+// the values are kept if a register is not configured or can't be read
+func (d *modbusDevice) seed(P, m float64) (float64, float64) {
+	if d == nil {
+		return P, m
+	}
+	if d.config.Generation != nil {
+		generation, err := d.read(d.config.Generation)
+		if err != nil {
+			logger.Warnf("Failed to read the generation from the Modbus device: %v", err)
+		} else {
+			// the mismatch is the demand the generation doesn't cover, it keeps its share of the demand when P moves
+			m += P - generation
+			P = generation
+		}
+	}
+	if d.config.Load != nil {
+		load, err := d.read(d.config.Load)
+		if err != nil {
+			logger.Warnf("Failed to read the load from the Modbus device: %v", err)
+		} else {
+			m += load
+		}
+	}
+	return P, m
+}
+
+// writeSetpoint writes the setpoint in MW to the holding register, if one is configured
+func (d *modbusDevice) writeSetpoint(P float64) {
+	if d == nil || d.config.Setpoint == nil {
+		return
+	}
+	if err := d.write(d.config.Setpoint, P); err != nil {
+		logger.Warnf("Failed to write setpoint %v MW to the Modbus device: %v", P, err)
+		return
+	}
+	logger.Infof("Setpoint %v MW written to the Modbus device", P)
+}
+
+func (d *modbusDevice) read(r *ModbusRegister) (float64, error) {
+	words, _ := r.words()
+	function := byte(modbusReadHolding)
+	if r.Table == "input" {
+		function = modbusReadInput
+	}
+	request := make([]byte, 4)
+	binary.BigEndian.PutUint16(request, r.Register)
+	binary.BigEndian.PutUint16(request[2:], words)
+	response, err := d.request(function, request)
+	if err != nil {
+		return 0, err
+	}
+	if len(response) != 1+2*int(words) || int(response[0]) != 2*int(words) {
+		return 0, fmt.Errorf("register %v: invalid response of %v bytes", r.Register, len(response))
+	}
+	return r.decode(response[1:]) * r.scale(), nil
+}
+
+func (d *modbusDevice) write(r *ModbusRegister, value float64) error {
+	data, err := r.encode(value / r.scale())
+	if err != nil {
+		return err
+	}
+	request := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint16(request, r.Register)
+	binary.BigEndian.PutUint16(request[2:], uint16(len(data)/2))
+	request[4] = byte(len(data))
+	_, err = d.request(modbusWriteMultiple, append(request, data...))
+	return err
+}
+
+// request sends a request to the device and returns the data of its response
+func (d *modbusDevice) request(function byte, data []byte) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.conn == nil {
+		conn, err := net.DialTimeout("tcp", d.config.Address, modbusTimeout)
+		if err != nil {
+			return nil, err
+		}
+		d.conn = conn
+	}
+	response, err := d.exchange(function, data)
+	if err != nil {
+		// the stream may be out of step after a failure, the next request starts on a new connection
+		d.conn.Close()
+		d.conn = nil
+	}
+	return response, err
+}
+
+// exchange writes a request with its MBAP header and reads the matching response
+func (d *modbusDevice) exchange(function byte, data []byte) ([]byte, error) {
+	d.transaction++
+	frame := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint16(frame, d.transaction)
+	// the protocol identifier at 2 is 0 for Modbus
+	binary.BigEndian.PutUint16(frame[4:], uint16(2+len(data)))
+	frame[6], frame[7] = d.config.UnitID, function
+	if err := d.conn.SetDeadline(time.Now().Add(modbusTimeout)); err != nil {
+		return nil, err
+	}
+	if _, err := d.conn.Write(append(frame, data...)); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(d.conn, header); err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint16(header[4:]))
+	if length < 2 || length > 254 {
+		return nil, fmt.Errorf("invalid Modbus response length %v", length)
+	}
+	response := make([]byte, length-2)
+	if _, err := io.ReadFull(d.conn, response); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint16(header) != d.transaction {
+		return nil, errors.New("the Modbus response belongs to another request")
+	}
+	if header[7] == function|0x80 {
+		if len(response) == 0 {
+			return nil, errors.New("modbus exception")
+		}
+		return nil, fmt.Errorf("modbus exception %v", response[0])
+	}
+	if header[7] != function {
+		return nil, fmt.Errorf("modbus response to function %v instead of %v", header[7], function)
+	}
+	return response, nil
+}
+
+func (d *modbusDevice) close() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.conn != nil {
+		d.conn.Close()
+		d.conn = nil
+	}
+}
+
+func (r *ModbusRegister) scale() float64 {
+	if r.Scale == 0 {
+		return 1
+	}
+	return r.Scale
+}
+
+// words returns the number of registers the value takes
+func (r *ModbusRegister) words() (uint16, error) {
+	switch r.Format {
+	case "", "uint16", "int16":
+		return 1, nil
+	case "uint32", "int32", "float32":
+		return 2, nil
+	}
+	return 0, fmt.Errorf("unknown format %q, use uint16, int16, uint32, int32 or float32", r.Format)
+}
+
+// decode reads the value from the big-endian register contents
+func (r *ModbusRegister) decode(data []byte) float64 {
+	switch r.Format {
+	case "int16":
+		return float64(int16(binary.BigEndian.Uint16(data)))
+	case "uint32":
+		return float64(binary.BigEndian.Uint32(data))
+	case "int32":
+		return float64(int32(binary.BigEndian.Uint32(data)))
+	case "float32":
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	}
+	return float64(binary.BigEndian.Uint16(data))
+}
+
+// encode returns the register contents of the value, rounded to an integer for the integer formats
+func (r *ModbusRegister) encode(value float64) ([]byte, error) {
+	words, _ := r.words()
+	data := make([]byte, 2*words)
+	if r.Format == "float32" {
+		binary.BigEndian.PutUint32(data, math.Float32bits(float32(value)))
+		return data, nil
+	}
+	value = math.Round(value)
+	var min, max float64
+	switch r.Format {
+	case "", "uint16":
+		min, max = 0, math.MaxUint16
+	case "int16":
+		min, max = math.MinInt16, math.MaxInt16
+	case "uint32":
+		min, max = 0, math.MaxUint32
+	case "int32":
+		min, max = math.MinInt32, math.MaxInt32
+	}
+	if value < min || value > max {
+		return nil, fmt.Errorf("%v does not fit a %s register", value, r.Format)
+	}
+	if words == 1 {
+		binary.BigEndian.PutUint16(data, uint16(int64(value)))
+	} else {
+		binary.BigEndian.PutUint32(data, uint32(int64(value)))
+	}
+	return data, nil
+}
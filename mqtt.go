@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// mqttTimeout bounds the wait for the broker, a broker that is down must not hold up the optimization
+const mqttTimeout = 10 * time.Second
+
+// setpointMessage is the JSON payload published to the MQTT topics
+type setpointMessage struct {
+	Organization string `json:"organization"`
+	Iteration    int    `json:"iteration"`
+	// P is the dispatch of the optimization and Setpoint what the hardware is driven to, after regulation or an emergency stop
+	P        float64   `json:"p"`
+	Setpoint float64   `json:"setpoint"`
+	Lambda   float64   `json:"lambda"`
+	Mismatch float64   `json:"mismatch"`
+	Reason   string    `json:"reason"`
+	Time     time.Time `json:"time"`
+}
+
+// mqttPublisher publishes the setpoints to the hardware controllers
+type mqttPublisher struct {
+	client mqtt.Client
+	config MQTTConfig
+	// pending tracks the publications still waiting for the broker, they are given time to finish on close
+	pending sync.WaitGroup
+}
+
+// setpoints is the MQTT publisher, nil unless a broker is configured
+var setpoints *mqttPublisher
+
+// startMQTT connects to the configured broker, nil if there is none
+// the connection is retried in the background, so the optimization starts while the broker is unreachable
+func startMQTT(config MQTTConfig) (*mqttPublisher, error) {
+	if config.Broker == "" {
+		return nil, nil
+	}
+	opts, err := mqttOptions(config, config.clientID())
+	if err != nil {
+		return nil, err
+	}
+	p := &mqttPublisher{client: mqtt.NewClient(opts), config: config}
+	if err := connectMQTT(p.client, config); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// subscribeRegulation receives the regulation signal from the regulation topic of the broker
+// the agent subscribes with a client of its own, so the signal keeps arriving while the publisher is closed between
+// the periods of a -forecast run; it subscribes again after every reconnect
+func subscribeRegulation(config MQTTConfig, r *regulationSignal) (mqtt.Client, error) {
+	if config.Broker == "" {
+		return nil, fmt.Errorf("the regulation topic %s has no MQTT broker", config.RegulationTopic)
+	}
+	opts, err := mqttOptions(config, config.clientID()+"-regulation")
+	if err != nil {
+		return nil, err
+	}
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		logger.Infof("Receiving the regulation signal from %s on %s", config.Broker, config.RegulationTopic)
+		client.Subscribe(config.RegulationTopic, config.QoS, func(_ mqtt.Client, msg mqtt.Message) {
+			r.set(string(msg.Payload()), time.Now())
+		})
+	})
+	client := mqtt.NewClient(opts)
+	if err := connectMQTT(client, config); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// mqttOptions are the settings of a client of the broker, reconnecting in the background
+func mqttOptions(config MQTTConfig, clientID string) (*mqtt.ClientOptions, error) {
+	if config.QoS > 2 {
+		return nil, fmt.Errorf("invalid MQTT QoS %v", config.QoS)
+	}
+	opts := mqtt.NewClientOptions().AddBroker(config.Broker)
+	opts.SetClientID(clientID)
+	opts.SetUsername(config.Username)
+	opts.SetPassword(config.password())
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+	opts.SetConnectTimeout(mqttTimeout)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	opts.SetConnectRetryInterval(*retryInitial)
+	opts.SetMaxReconnectInterval(*retryMaxDelay)
+	opts.SetOnConnectHandler(func(mqtt.Client) {
+		logger.Infof("Connected to the MQTT broker %s", config.Broker)
+	})
+	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		logger.Warnf("Lost the connection to the MQTT broker, reconnecting: %v", err)
+	})
+	return opts, nil
+}
+
+// connectMQTT connects the client, a broker that doesn't answer in time is left to the retries in the background
+func connectMQTT(client mqtt.Client, config MQTTConfig) error {
+	if token := client.Connect(); !token.WaitTimeout(mqttTimeout) {
+		logger.Warnf("The MQTT broker %s is not reachable yet, retrying in the background", config.Broker)
+	} else if err := token.Error(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// clientID returns the client ID of the agent, by default derived from its MSP
+func (c MQTTConfig) clientID() string {
+	if c.ClientID != "" {
+		return c.ClientID
+	}
+	return "agent-" + cfg.MSPID
+}
+
+// password returns the password of the broker, preferring the MQTT_PASSWORD environment variable
+func (c MQTTConfig) password() string {
+	if password := os.Getenv("MQTT_PASSWORD"); password != "" {
+		return password
+	}
+	return c.Password
+}
+
+// tlsConfig returns the TLS settings of the broker, nil if none are configured, a tls:// broker is then verified with the system roots
+func (c MQTTConfig) tlsConfig() (*tls.Config, error) {
+	if c.CACert == "" && c.Certificate == "" {
+		return nil, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.CACert != "" {
+		pem, err := os.ReadFile(filepath.Clean(c.CACert))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA certificate of the MQTT broker: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", c.CACert)
+		}
+		config.RootCAs = pool
+	}
+	if c.Certificate != "" {
+		cert, err := tls.LoadX509KeyPair(c.Certificate, c.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the MQTT client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// publishSetpoint publishes the final setpoint of a run, retained so that a controller connecting later still gets it
+func (p *mqttPublisher) publishSetpoint(msg setpointMessage) {
+	if p == nil || p.config.SetpointTopic == "" {
+		return
+	}
+	p.publish(p.config.SetpointTopic, true, msg)
+}
+
+// publishIteration publishes the setpoint of an iteration if an iteration topic is configured
+func (p *mqttPublisher) publishIteration(msg setpointMessage) {
+	if p == nil || p.config.IterationTopic == "" {
+		return
+	}
+	p.publish(p.config.IterationTopic, false, msg)
+}
+
+func (p *mqttPublisher) publish(topic string, retained bool, msg setpointMessage) {
+	msg.Organization, msg.Time = cfg.MSPID, time.Now()
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		logger.Warnf("Failed to encode the setpoint: %v", err)
+		return
+	}
+	token := p.client.Publish(topic, p.config.QoS, retained, payload)
+	p.pending.Add(1)
+	go func() {
+		defer p.pending.Done()
+		if !token.WaitTimeout(mqttTimeout) {
+			logger.Warnf("Timed out publishing the setpoint %v MW to %s", msg.Setpoint, topic)
+		} else if err := token.Error(); err != nil {
+			logger.Warnf("Failed to publish the setpoint %v MW to %s: %v", msg.Setpoint, topic, err)
+		}
+	}()
+}
+
+// close waits for the pending publications and disconnects
+func (p *mqttPublisher) close() {
+	if p == nil {
+		return
+	}
+	p.pending.Wait()
+	p.client.Disconnect(250)
+}
@@ -0,0 +1,138 @@
+package main
+
+import "fmt"
+
+// Neighbor is a peer organization this node exchanges consensus updates with
+type Neighbor struct {
+	// Event is the name of the chaincode events the neighbor's updates arrive as
+	Event string `json:"event" yaml:"event"`
+	// Weight is the neighbor's entry in this node's row of the doubly-stochastic consensus matrix,
+	// the node keeps 1 minus the sum of its neighbors' weights for itself
+	Weight float64 `json:"weight" yaml:"weight"`
+	// Certificate is the PEM file of the certificate the neighbor signs its updates with, for -signed-updates
+	Certificate string `json:"certificate" yaml:"certificate"`
+}
+
+// validateNeighbors checks that the weights form a valid row of the consensus matrix
+// that the columns sum to 1 as well can only be checked across all organizations
+func validateNeighbors(neighbors []Neighbor) error {
+	seen := map[string]bool{}
+	var sum float64
+	for _, n := range neighbors {
+		if n.Event == "" {
+			return fmt.Errorf("a neighbor has no event name")
+		}
+		if seen[n.Event] {
+			return fmt.Errorf("neighbor %s is listed twice", n.Event)
+		}
+		seen[n.Event] = true
+		if n.Weight <= 0 {
+			return fmt.Errorf("neighbor %s needs a positive weight, got %v", n.Event, n.Weight)
+		}
+		sum += n.Weight
+	}
+	if sum >= 1 {
+		return fmt.Errorf("the neighbor weights sum to %v, they must leave a positive weight for the node itself", sum)
+	}
+	return nil
+}
+
+// neighborUpdate is one neighbor's contribution to the consensus step
+type neighborUpdate struct {
+	weight   float64
+	lambda   float64
+	mismatch float64
+}
+
+// neighborhoodAverage returns the weighted average of the neighbors' values, as recorded in the history
+func neighborhoodAverage(updates []neighborUpdate) (float64, float64) {
+	var weights, lambda, mismatch float64
+	for _, u := range updates {
+		weights += u.weight
+		lambda += u.weight * u.lambda
+		mismatch += u.weight * u.mismatch
+	}
+	if weights == 0 {
+		return 0, 0
+	}
+	return lambda / weights, mismatch / weights
+}
+
+// consensusRound collects the latest update of every configured neighbor, an iteration runs once all of them reported
+type consensusRound struct {
+	neighbors []Neighbor
+	latest    map[string]neighborUpdate
+	// previous is the last update each neighbor sent in an earlier round, for a round that ends without it
+	previous map[string]neighborUpdate
+}
+
+func newConsensusRound(neighbors []Neighbor) *consensusRound {
+	return &consensusRound{neighbors: neighbors, latest: map[string]neighborUpdate{}, previous: map[string]neighborUpdate{}}
+}
+
+// expects tells whether the events of this name come from a configured neighbor
+func (r *consensusRound) expects(event string) bool {
+	for _, n := range r.neighbors {
+		if n.Event == event {
+			return true
+		}
+	}
+	return false
+}
+
+// add keeps the update of a neighbor, a second update in the same round replaces the first
+func (r *consensusRound) add(event string, lambda, mismatch float64) {
+	r.latest[event] = neighborUpdate{lambda: lambda, mismatch: mismatch}
+}
+
+// complete tells whether every neighbor has reported in this round
+func (r *consensusRound) complete() bool {
+	return len(r.latest) == len(r.neighbors)
+}
+
+// take returns the updates of the round with their weights scaled by the neighbors' reputation and starts the next round
+// weight taken from a distrusted neighbor goes to the node itself, so the row still sums to 1
+func (r *consensusRound) take(peers reputations) []neighborUpdate {
+	updates := make([]neighborUpdate, 0, len(r.neighbors))
+	for _, n := range r.neighbors {
+		u := r.latest[n.Event]
+		u.weight = n.Weight * peers.score(n.Event)
+		updates = append(updates, u)
+	}
+	r.next()
+	return updates
+}
+
+// empty tells whether no neighbor has reported in this round yet
+func (r *consensusRound) empty() bool {
+	return len(r.latest) == 0
+}
+
+// takeLate ends a round that ran out of time, the neighbors that did not report are handled by the policy:
+// with lateLast their update of an earlier round is used again, with lateSkip they are left out and their weight stays with the node
+// it also returns the neighbors that did not report
+func (r *consensusRound) takeLate(peers reputations, policy string) ([]neighborUpdate, []string) {
+	var updates []neighborUpdate
+	var late []string
+	for _, n := range r.neighbors {
+		u, ok := r.latest[n.Event]
+		if !ok {
+			late = append(late, n.Event)
+			if u, ok = r.previous[n.Event]; !ok || policy != lateLast {
+				continue
+			}
+		}
+		u.weight = n.Weight * peers.score(n.Event)
+		updates = append(updates, u)
+	}
+	r.next()
+	return updates, late
+}
+
+// next starts a new round, remembering the updates of this one
+func (r *consensusRound) next() {
+	for event, u := range r.latest {
+		r.previous[event] = u
+	}
+	r.latest = map[string]neighborUpdate{}
+}
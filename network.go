@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// NetworkModel is how the power of the node reaches the others over the grid, its losses and the lines it loads, in
+// the generator config. The losses are taken into account by the penalty factor of the classic loss-aware economic
+// dispatch: the node dispatches where its marginal cost times the factor meets the price, so a node with high losses
+// produces less. The lines limit the power of the node to what keeps their DC power flow within their limits
+type NetworkModel struct {
+	// PenaltyFactor is the penalty factor of the losses, 1/(1 - dPloss/dP), 0 or 1 without losses
+	PenaltyFactor float64 `json:"penaltyFactor" yaml:"penaltyFactor"`
+	// LossSensitivity is the change of the losses of the grid with the power of the node, dPloss/dP, which gives the
+	// penalty factor when it isn't set
+	LossSensitivity float64 `json:"lossSensitivity" yaml:"lossSensitivity"`
+	// Lines are the lines whose flow the power of the node changes
+	Lines []LineConstraint `json:"lines" yaml:"lines"`
+}
+
+// LineConstraint is a line of the DC power flow, its flow is Flow + Sensitivity*P
+type LineConstraint struct {
+	Name string `json:"name" yaml:"name"`
+	// Sensitivity is the power transfer distribution factor of the node on the line, MW of flow per MW of its power
+	Sensitivity float64 `json:"sensitivity" yaml:"sensitivity"`
+	// Flow is the flow of the line in MW without the power of the node
+	Flow float64 `json:"flow" yaml:"flow"`
+	// Limit is the limit of the flow in MW in either direction
+	Limit float64 `json:"limit" yaml:"limit"`
+}
+
+func (n NetworkModel) validate() error {
+	if n.PenaltyFactor < 0 {
+		return fmt.Errorf("the penaltyFactor must not be negative, got %v", n.PenaltyFactor)
+	}
+	if n.PenaltyFactor != 0 && n.LossSensitivity != 0 {
+		return fmt.Errorf("set either the penaltyFactor or the lossSensitivity, not both")
+	}
+	if n.LossSensitivity >= 1 {
+		return fmt.Errorf("the lossSensitivity must be below 1, got %v", n.LossSensitivity)
+	}
+	for i, l := range n.Lines {
+		name := l.Name
+		if name == "" {
+			name = fmt.Sprint(i)
+		}
+		if l.Limit <= 0 {
+			return fmt.Errorf("the limit of line %s must be positive, got %v", name, l.Limit)
+		}
+	}
+	return nil
+}
+
+// penaltyFactor returns the penalty factor of the losses, 1 without them
+func (n NetworkModel) penaltyFactor() float64 {
+	if n.PenaltyFactor > 0 {
+		return n.PenaltyFactor
+	}
+	return 1 / (1 - n.LossSensitivity)
+}
+
+// limits narrows the power limits to those that keep the flow of every line within its limit. A line the node can't
+// keep within its limit, as the flow without it already exceeds the limit too far, is left out with a warning
+func (n NetworkModel) limits(l powerLimits) powerLimits {
+	for _, line := range n.Lines {
+		if line.Sensitivity == 0 {
+			continue
+		}
+		lo := (-line.Limit - line.Flow) / line.Sensitivity
+		hi := (line.Limit - line.Flow) / line.Sensitivity
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		narrowed := powerLimits{Min: math.Max(l.Min, lo), Max: math.Min(l.Max, hi)}
+		if narrowed.Min > narrowed.Max {
+			logger.Warnf("The power of the node can't keep line %s within its limit of %v MW, the line is left out", line.Name, line.Limit)
+			continue
+		}
+		l = narrowed
+	}
+	return l
+}
+
+// apply returns the cost and the limits of the node in the network
+func (n NetworkModel) apply(cost costFunction, limits powerLimits) (costFunction, powerLimits) {
+	if pf := n.penaltyFactor(); pf != 1 {
+		cost = lossCost{costFunction: cost, factor: pf}
+	}
+	return cost, n.limits(limits)
+}
+
+// lossCost is a cost seen through the penalty factor of the losses: the price at the node is the price of the network
+// divided by the factor, so the marginal cost it offers is its own times the factor. The cost stays that of the
+// generation, e.g. for the settlement
+type lossCost struct {
+	costFunction
+	factor float64
+}
+
+func (c lossCost) marginal(P float64) float64 {
+	return c.factor * c.costFunction.marginal(P)
+}
+
+func (c lossCost) dispatch(lambda float64) float64 {
+	return c.costFunction.dispatch(lambda / c.factor)
+}
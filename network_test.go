@@ -0,0 +1,19 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNetworkModel(t *testing.T) {
+	network := NetworkModel{LossSensitivity: 0.2, Lines: []LineConstraint{{Name: "L1", Sensitivity: 0.5, Flow: 1, Limit: 3}}}
+	cost, limits := network.apply(costCurve{A: 0.8}, powerLimits{Min: 0, Max: 8})
+	// the flow 1 + 0.5*P stays within 3 up to P = 4
+	if limits != (powerLimits{Min: 0, Max: 4}) {
+		t.Errorf("limits = %+v", limits)
+	}
+	// the marginal cost 1.6*P times the factor 1.25 meets the price 4 at P = 2
+	if P := cost.dispatch(4); math.Abs(P-2) > 1e-9 {
+		t.Errorf("dispatch(4) = %v, want 2", P)
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+)
+
+// opcuaTimeout bounds the connection to the server and a request to it
+const opcuaTimeout = 10 * time.Second
+
+// OPCUAConfig selects the OPC UA server of the substation or the DER controller and the nodes of its measurements,
+// a node that is not configured is not used
+type OPCUAConfig struct {
+	// Endpoint is the URL of the server, e.g. opc.tcp://192.168.1.20:4840
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// SecurityPolicy is the policy of the secure channel, e.g. Basic256Sha256 (default: None)
+	SecurityPolicy string `json:"securityPolicy" yaml:"securityPolicy"`
+	// SecurityMode is None (default), Sign or SignAndEncrypt
+	SecurityMode string `json:"securityMode" yaml:"securityMode"`
+	// Certificate and PrivateKey are the application instance certificate of the agent, needed by a secure channel
+	Certificate string `json:"certificate" yaml:"certificate"`
+	PrivateKey  string `json:"privateKey" yaml:"privateKey"`
+	// Username and Password log in to the server, anonymously without them
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+	// Generation and Load are the measured output and local demand in MW the run starts from
+	Generation *OPCUANode `json:"generation" yaml:"generation"`
+	Load       *OPCUANode `json:"load" yaml:"load"`
+	// Setpoint is the node the final setpoint is written to
+	Setpoint *OPCUANode `json:"setpoint" yaml:"setpoint"`
+}
+
+// OPCUANode is a numeric variable of the server
+type OPCUANode struct {
+	// NodeID is the node in the string form of OPC UA, e.g. ns=2;s=Feeder1.P
+	NodeID string `json:"nodeId" yaml:"nodeId"`
+	// Type is the data type the setpoint is written as: double (default), float, int16, int32, uint16 or uint32
+	Type string `json:"type" yaml:"type"`
+	// Scale converts the value to MW, e.g. 0.001 for a value in kW (default 1)
+	Scale float64 `json:"scale" yaml:"scale"`
+}
+
+func (n *OPCUANode) scale() float64 {
+	if n.Scale == 0 {
+		return 1
+	}
+	return n.Scale
+}
+
+// variant returns the value in the data type of the node
+func (n *OPCUANode) variant(value float64) (*ua.Variant, error) {
+	switch n.Type {
+	case "", "double":
+		return ua.NewVariant(value)
+	case "float":
+		return ua.NewVariant(float32(value))
+	case "int16":
+		return ua.NewVariant(int16(value))
+	case "int32":
+		return ua.NewVariant(int32(value))
+	case "uint16":
+		return ua.NewVariant(uint16(value))
+	case "uint32":
+		return ua.NewVariant(uint32(value))
+	}
+	return nil, fmt.Errorf("unknown type %q, use double, float, int16, int32, uint16 or uint32", n.Type)
+}
+
+// validate checks the security settings and the nodes
+func (c OPCUAConfig) validate() error {
+	if c.Endpoint == "" {
+		return nil
+	}
+	switch c.SecurityMode {
+	case "", "None", "Sign", "SignAndEncrypt":
+	default:
+		return fmt.Errorf("unknown security mode %q, use None, Sign or SignAndEncrypt", c.SecurityMode)
+	}
+	if c.secure() && (c.Certificate == "" || c.PrivateKey == "") {
+		return errors.New("a secure channel needs the certificate and the privateKey of the agent")
+	}
+	for name, n := range map[string]*OPCUANode{"generation": c.Generation, "load": c.Load, "setpoint": c.Setpoint} {
+		if n == nil {
+			continue
+		}
+		if _, err := ua.ParseNodeID(n.NodeID); err != nil {
+			return fmt.Errorf("opcua %s node: %w", name, err)
+		}
+		if _, err := n.variant(0); err != nil {
+			return fmt.Errorf("opcua %s node: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (c OPCUAConfig) secure() bool {
+	return c.SecurityPolicy != "" && c.SecurityPolicy != "None"
+}
+
+func (c OPCUAConfig) policy() string {
+	if c.SecurityPolicy == "" {
+		return "None"
+	}
+	return c.SecurityPolicy
+}
+
+func (c OPCUAConfig) mode() string {
+	if c.SecurityMode == "" {
+		return "None"
+	}
+	return c.SecurityMode
+}
+
+// opcuaServer reads the measurements from an OPC UA server and writes the setpoint to it
+type opcuaServer struct {
+	config OPCUAConfig
+	mu     sync.Mutex
+	client *opcua.Client
+}
+
+// plantServer is the OPC UA server, nil unless one is configured
+var plantServer *opcuaServer
+
+// openOPCUA checks the configured nodes, nil if no server is configured
+// the session is opened with the first request, and again after a failed one
+func openOPCUA(config OPCUAConfig) (*opcuaServer, error) {
+	if config.Endpoint == "" {
+		return nil, nil
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return &opcuaServer{config: config}, nil
+}
+
+// connect opens a session with the endpoint of the server that has the configured security
+func (s *opcuaServer) connect(ctx context.Context) (*opcua.Client, error) {
+	endpoints, err := opcua.GetEndpoints(ctx, s.config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := opcua.SelectEndpoint(endpoints, s.config.policy(), ua.MessageSecurityModeFromString(s.config.mode()))
+	if endpoint == nil {
+		return nil, fmt.Errorf("the server has no endpoint with security policy %s and mode %s", s.config.policy(), s.config.mode())
+	}
+	options := []opcua.Option{opcua.SecurityPolicy(s.config.policy()), opcua.SecurityModeString(s.config.mode())}
+	if s.config.Certificate != "" {
+		options = append(options, opcua.CertificateFile(s.config.Certificate), opcua.PrivateKeyFile(s.config.PrivateKey))
+	}
+	authentication := ua.UserTokenTypeAnonymous
+	if s.config.Username != "" {
+		authentication = ua.UserTokenTypeUserName
+		options = append(options, opcua.AuthUsername(s.config.Username, s.config.Password))
+	} else {
+		options = append(options, opcua.AuthAnonymous())
+	}
+	options = append(options, opcua.SecurityFromEndpoint(endpoint, authentication))
+	client := opcua.NewClient(s.config.Endpoint, options...)
+	if err := client.Connect(ctx); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// seed returns the power and mismatch a new run starts from, like the Modbus device does
+// the values are kept if a node is not configured or can't be read
+func (s *opcuaServer) seed(P, m float64) (float64, float64) {
+	if s == nil {
+		return P, m
+	}
+	if s.config.Generation != nil {
+		generation, err := s.read(s.config.Generation)
+		if err != nil {
+			logger.Warnf("Failed to read the generation from the OPC UA server: %v", err)
+		} else {
+			// the mismatch is the demand the generation doesn't cover, it keeps its share of the demand when P moves
+			m += P - generation
+			P = generation
+		}
+	}
+	if s.config.Load != nil {
+		load, err := s.read(s.config.Load)
+		if err != nil {
+			logger.Warnf("Failed to read the load from the OPC UA server: %v", err)
+		} else {
+			m += load
+		}
+	}
+	return P, m
+}
+
+// writeSetpoint writes the setpoint in MW to its node, if one is configured
+func (s *opcuaServer) writeSetpoint(P float64) {
+	if s == nil || s.config.Setpoint == nil {
+		return
+	}
+	if err := s.write(s.config.Setpoint, P); err != nil {
+		logger.Warnf("Failed to write setpoint %v MW to the OPC UA server: %v", P, err)
+		return
+	}
+	logger.Infof("Setpoint %v MW written to the OPC UA server", P)
+}
+
+func (s *opcuaServer) read(n *OPCUANode) (float64, error) {
+	id, err := ua.ParseNodeID(n.NodeID)
+	if err != nil {
+		return 0, err
+	}
+	var value float64
+	err = s.request(func(ctx context.Context, client *opcua.Client) error {
+		response, err := client.ReadWithContext(ctx, &ua.ReadRequest{
+			NodesToRead:        []*ua.ReadValueID{{NodeID: id, AttributeID: ua.AttributeIDValue}},
+			TimestampsToReturn: ua.TimestampsToReturnNeither,
+		})
+		if err != nil {
+			return err
+		}
+		if len(response.Results) != 1 {
+			return fmt.Errorf("node %s: %v results", n.NodeID, len(response.Results))
+		}
+		result := response.Results[0]
+		if result.Status != ua.StatusOK {
+			return fmt.Errorf("node %s: %w", n.NodeID, result.Status)
+		}
+		if value, err = numericValue(result.Value); err != nil {
+			return fmt.Errorf("node %s: %w", n.NodeID, err)
+		}
+		return nil
+	})
+	return value * n.scale(), err
+}
+
+func (s *opcuaServer) write(n *OPCUANode, value float64) error {
+	id, err := ua.ParseNodeID(n.NodeID)
+	if err != nil {
+		return err
+	}
+	variant, err := n.variant(value / n.scale())
+	if err != nil {
+		return err
+	}
+	return s.request(func(ctx context.Context, client *opcua.Client) error {
+		response, err := client.WriteWithContext(ctx, &ua.WriteRequest{
+			NodesToWrite: []*ua.WriteValue{{
+				NodeID:      id,
+				AttributeID: ua.AttributeIDValue,
+				Value:       &ua.DataValue{EncodingMask: ua.DataValueValue, Value: variant},
+			}},
+		})
+		if err != nil {
+			return err
+		}
+		if len(response.Results) != 1 {
+			return fmt.Errorf("node %s: %v results", n.NodeID, len(response.Results))
+		}
+		if status := response.Results[0]; status != ua.StatusOK {
+			return fmt.Errorf("node %s: %w", n.NodeID, status)
+		}
+		return nil
+	})
+}
+
+// request runs a request in the session, which is opened first if there is none; a failed request closes the session
+// so the next one starts a new one
+func (s *opcuaServer) request(do func(ctx context.Context, client *opcua.Client) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), opcuaTimeout)
+	defer cancel()
+	if s.client == nil {
+		client, err := s.connect(ctx)
+		if err != nil {
+			return err
+		}
+		s.client = client
+	}
+	err := do(ctx, s.client)
+	if err != nil {
+		s.client.Close()
+		s.client = nil
+	}
+	return err
+}
+
+// numericValue converts the value of a variable to float64
+func numericValue(v *ua.Variant) (float64, error) {
+	if v == nil {
+		return 0, errors.New("no value")
+	}
+	switch x := v.Value().(type) {
+	case float64:
+		return x, nil
+	case float32:
+		return float64(x), nil
+	case int8:
+		return float64(x), nil
+	case int16:
+		return float64(x), nil
+	case int32:
+		return float64(x), nil
+	case int64:
+		return float64(x), nil
+	case uint8:
+		return float64(x), nil
+	case uint16:
+		return float64(x), nil
+	case uint32:
+		return float64(x), nil
+	case uint64:
+		return float64(x), nil
+	}
+	return 0, fmt.Errorf("the value %v is not a number", v.Value())
+}
+
+func (s *opcuaServer) close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+	}
+}
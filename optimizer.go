@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"testEvent/consensus"
+)
+
+// the algorithms selectable with algorithm.name in the config
+const (
+	algorithmConsensus        = "consensus"
+	algorithmGradientTracking = "gradient-tracking"
+	algorithmADMM             = "admm"
+)
+
+// AlgorithmConfig selects the distributed algorithm and its parameters, all nodes of a network have to use the same one
+// because the meaning of the lambda and mismatch values they exchange depends on it
+type AlgorithmConfig struct {
+	// Name is "consensus" (default), "gradient-tracking" or "admm"
+	Name string `json:"name" yaml:"name"`
+	// StepSize is the constant step of gradient tracking (default 0.1)
+	StepSize float64 `json:"stepSize" yaml:"stepSize"`
+	// Penalty is the penalty parameter c of ADMM on the disagreement with the neighbors (default 0.5)
+	Penalty float64 `json:"penalty" yaml:"penalty"`
+	// Proximal is the weight rho of ADMM keeping the price near its last value, it damps the linearized step (default 1)
+	Proximal float64 `json:"proximal" yaml:"proximal"`
+	// Step selects the schedule of the step eta of consensus and gradient-tracking
+	Step StepConfig `json:"step" yaml:"step"`
+	// Aggregation selects how the neighbors' values are combined
+	Aggregation AggregationConfig `json:"aggregation" yaml:"aggregation"`
+}
+
+// the schedules of the step size selectable with algorithm.step.schedule
+const (
+	scheduleConstant     = "constant"
+	scheduleDiminishing  = "diminishing"
+	scheduleAdaptive     = "adaptive"
+	scheduleBacktracking = "backtracking"
+)
+
+// StepConfig selects how the step eta the mismatch moves the price by changes over a run. The step decides much of
+// how fast the consensus + innovation rule converges, and whether it does: too large a step oscillates
+type StepConfig struct {
+	// Schedule is "constant", "diminishing", "adaptive" or "backtracking" (default: diminishing for consensus, constant
+	// for gradient-tracking)
+	Schedule string `json:"schedule" yaml:"schedule"`
+	// Initial is the step of the first iteration, and the constant step (default: the stepSize of gradient-tracking or
+	// 0.1 for constant, 1 otherwise)
+	Initial float64 `json:"initial" yaml:"initial"`
+	// Min and Max bound the diminishing and the adaptive step (default 0.01 and 1)
+	Min float64 `json:"min" yaml:"min"`
+	Max float64 `json:"max" yaml:"max"`
+	// Decay is the power of the diminishing step initial/iter^decay (default 1)
+	Decay float64 `json:"decay" yaml:"decay"`
+	// Increase and Decrease scale the adaptive step after an iteration that shrank or grew the mismatch
+	// (default 1.1 and 0.5)
+	Increase float64 `json:"increase" yaml:"increase"`
+	Decrease float64 `json:"decrease" yaml:"decrease"`
+	// Shrink scales the step of a backtracking trial that didn't decrease the mismatch enough, at most Trials times
+	// per iteration (default 0.5 and 10)
+	Shrink float64 `json:"shrink" yaml:"shrink"`
+	Trials int     `json:"trials" yaml:"trials"`
+	// SufficientDecrease is the Armijo constant c of backtracking, a trial is taken once it leaves at most
+	// (1 - c*eta) of the mismatch (default 1e-4)
+	SufficientDecrease float64 `json:"sufficientDecrease" yaml:"sufficientDecrease"`
+}
+
+func (c StepConfig) validate() error {
+	switch c.Schedule {
+	case "", scheduleConstant, scheduleDiminishing, scheduleAdaptive, scheduleBacktracking:
+	default:
+		return fmt.Errorf("unknown step schedule %q, use %s, %s, %s or %s", c.Schedule, scheduleConstant, scheduleDiminishing, scheduleAdaptive, scheduleBacktracking)
+	}
+	if c.Initial < 0 || c.Min < 0 || c.Max < 0 || c.Decay < 0 || c.Increase < 0 || c.Decrease < 0 || c.SufficientDecrease < 0 || c.Trials < 0 {
+		return errors.New("the parameters of the step must not be negative")
+	}
+	if c.Max > 0 && c.Min > c.Max {
+		return fmt.Errorf("the step's min %v is above its max %v", c.Min, c.Max)
+	}
+	if c.Shrink < 0 || c.Shrink >= 1 {
+		return fmt.Errorf("the shrink of the backtracking step must be below 1, not %v", c.Shrink)
+	}
+	return nil
+}
+
+// orDefault returns the value, or the default if it is not set
+func orDefault(value, defaultValue float64) float64 {
+	if value == 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// schedule returns the configured schedule of the step, the algorithm's own if none is configured
+func (c StepConfig) schedule(algorithm string, stepSize float64) consensus.Schedule {
+	name := c.Schedule
+	if name == "" {
+		name = scheduleDiminishing
+		if algorithm == algorithmGradientTracking {
+			name = scheduleConstant
+		}
+	}
+	initial := orDefault(c.Initial, 1)
+	switch name {
+	case scheduleConstant:
+		return consensus.ConstantStep(orDefault(c.Initial, orDefault(stepSize, 0.1)))
+	case scheduleAdaptive:
+		return consensus.NewAdaptiveStep(initial, orDefault(c.Min, consensus.MinStep), orDefault(c.Max, 1), orDefault(c.Increase, 1.1), orDefault(c.Decrease, 0.5))
+	case scheduleBacktracking:
+		trials := c.Trials
+		if trials == 0 {
+			trials = 10
+		}
+		return &consensus.BacktrackingStep{Initial: initial, Shrink: orDefault(c.Shrink, 0.5), C: orDefault(c.SufficientDecrease, 1e-4), Trials: trials}
+	}
+	// the defaults are the DecreasingStep of the original algorithm
+	return consensus.DiminishingStep(initial, orDefault(c.Decay, 1), orDefault(c.Min, consensus.MinStep))
+}
+
+// optimizer is a distributed algorithm for the economic dispatch
+// the price, mismatch and power are kept by the caller, which checkpoints them and moves the mismatch on a change of the grid mode
+type optimizer interface {
+	// start begins a run from the initial price, mismatch and power
+	start(lambda, mismatch, P float64)
+	// step returns the price, mismatch and power of the iteration from the neighbors' latest values
+	step(cost costFunction, limits powerLimits, neighbors []neighborUpdate, lambda, mismatch, P float64, iter int) (float64, float64, float64)
+	// converged tells whether the last step is within the tolerance
+	converged(epsilon float64) bool
+	// eta is the step size of the iteration, as recorded in the trace
+	eta(iter int) float64
+}
+
+func (a AlgorithmConfig) validate() error {
+	switch a.Name {
+	case "", algorithmConsensus, algorithmGradientTracking, algorithmADMM:
+	default:
+		return fmt.Errorf("unknown algorithm %q, use %s, %s or %s", a.Name, algorithmConsensus, algorithmGradientTracking, algorithmADMM)
+	}
+	if a.StepSize < 0 || a.Penalty < 0 || a.Proximal < 0 {
+		return fmt.Errorf("the parameters of the algorithm must not be negative")
+	}
+	if a.Name == algorithmADMM && a.Step != (StepConfig{}) {
+		return errors.New("admm has no step schedule, its steps are set by penalty and proximal")
+	}
+	if err := a.Aggregation.validate(); err != nil {
+		return err
+	}
+	return a.Step.validate()
+}
+
+// newOptimizer returns the configured algorithm
+func newOptimizer(a AlgorithmConfig) optimizer {
+	switch a.Name {
+	case algorithmADMM:
+		o := &admmOptimizer{penalty: a.Penalty, proximal: a.Proximal}
+		if o.penalty == 0 {
+			o.penalty = 0.5
+		}
+		if o.proximal == 0 {
+			o.proximal = 1
+		}
+		return o
+	}
+	return &trackingOptimizer{engine: consensus.NewScheduledEngine(a.Step.schedule(a.Name, a.StepSize))}
+}
+
+// trackingOptimizer is the consensus + innovation rule the application was written for, its math is the engine of
+// the consensus package. "consensus" uses the shrinking step of DecreasingStep, "gradient-tracking" a constant step,
+// which converges faster as long as it is small enough for the network, unless algorithm.step selects another schedule
+type trackingOptimizer struct {
+	engine *consensus.Engine
+}
+
+// engineCost lets the engine dispatch with the cost model of the node
+type engineCost struct {
+	costFunction
+}
+
+func (c engineCost) Dispatch(lambda float64) float64 {
+	return c.dispatch(lambda)
+}
+
+func (o *trackingOptimizer) start(lambda, mismatch, P float64) {
+	o.engine.Start(mismatch)
+}
+
+func (o *trackingOptimizer) step(cost costFunction, limits powerLimits, neighbors []neighborUpdate, l1, m1, P float64, iter int) (float64, float64, float64) {
+	updates := make([]consensus.Neighbor, len(neighbors))
+	for i, n := range neighbors {
+		updates[i] = consensus.Neighbor{Weight: n.weight, Lambda: n.lambda, Mismatch: n.mismatch}
+	}
+	next := o.engine.Update(engineCost{cost}, consensus.Limits(limits), updates, consensus.State{Lambda: l1, Mismatch: m1, P: P}, iter)
+	return next.Lambda, next.Mismatch, next.P
+}
+
+func (o *trackingOptimizer) converged(epsilon float64) bool {
+	return o.engine.Converged(epsilon)
+}
+
+func (o *trackingOptimizer) eta(iter int) float64 {
+	return o.engine.Eta(iter)
+}
+
+// admmOptimizer is a linearized decentralized ADMM on the dual problem: the nodes agree on the price while each one's
+// multiplier y collects the disagreement with its neighbors. The mismatch is the node's own demand minus its power,
+// which neighbors don't use; the network is balanced once the prices agree and every mismatch equals its multiplier,
+// since the multipliers sum to zero with symmetric weights.
+// The multiplier is not checkpointed, a resumed run starts it from zero again
+type admmOptimizer struct {
+	penalty, proximal float64
+	y                 float64
+	// change, disagreement and residual of the last step, for the convergence check
+	change, disagreement, residual float64
+}
+
+func (o *admmOptimizer) start(lambda, mismatch, P float64) {
+	o.y = 0
+	o.change, o.disagreement, o.residual = math.Inf(1), math.Inf(1), math.Inf(1)
+}
+
+func (o *admmOptimizer) step(cost costFunction, limits powerLimits, neighbors []neighborUpdate, l1, m1, P float64, iter int) (float64, float64, float64) {
+	// the demand is what the mismatch leaves of it besides the power, a change of the grid mode moves it with the mismatch
+	demand := m1 + P
+	var weights, pull float64
+	o.disagreement = 0
+	for _, n := range neighbors {
+		// the multiplier grows with the disagreement of the neighbors' latest prices
+		o.y += o.penalty * n.weight * (l1 - n.lambda)
+		weights += n.weight
+		pull += n.weight * (l1 + n.lambda)
+		o.disagreement = math.Max(o.disagreement, math.Abs(l1-n.lambda))
+	}
+	// the minimizer of the linearized local dual with the penalty on the disagreement and the proximal term,
+	// the local dual's gradient at l1 is -m1, so the price rises while the node lacks power
+	ltemp := (o.penalty*pull + o.proximal*l1 + m1 - o.y) / (2*o.penalty*weights + o.proximal)
+	Ptemp := limits.clamp(cost.dispatch(ltemp))
+	mtemp := demand - Ptemp
+	o.change, o.residual = math.Abs(ltemp-l1), math.Abs(mtemp-o.y)
+	return ltemp, mtemp, Ptemp
+}
+
+func (o *admmOptimizer) converged(epsilon float64) bool {
+	return o.change < epsilon && o.disagreement < epsilon && o.residual < epsilon
+}
+
+func (o *admmOptimizer) eta(iter int) float64 {
+	return o.penalty
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/dlclark/regexp2"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// ownTransactions remembers the transactions of the node's own updates, so their events are not taken for a neighbor's
+// the submission queue adds them from its worker while the consensus loop checks the events
+type ownTransactions struct {
+	mu  sync.Mutex
+	ids map[string]bool
+	// recent holds the IDs in the order they were sent, the oldest is forgotten once -event-window is exceeded
+	recent []string
+}
+
+func newOwnTransactions() *ownTransactions {
+	return &ownTransactions{ids: map[string]bool{}}
+}
+
+// sent records a transaction before it is submitted, its event can arrive before the commit status
+func (o *ownTransactions) sent(txID string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.ids[txID] {
+		return
+	}
+	o.ids[txID] = true
+	o.recent = append(o.recent, txID)
+	if len(o.recent) > *eventWindow {
+		delete(o.ids, o.recent[0])
+		o.recent = o.recent[1:]
+	}
+}
+
+func (o *ownTransactions) contains(txID string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.ids[txID]
+}
+
+// getSender returns the MSP ID a chaincode may put into the payload as "Sender=<mspId>,", empty if there is none
+func getSender(payload string) string {
+	reg := regexp2.MustCompile("(?<=Sender=)[^,]+(?=,)", 0)
+	value, _ := reg.FindStringMatch(payload)
+	if value == nil {
+		return ""
+	}
+	return strings.TrimSpace(value.String())
+}
+
+// ownEvent tells whether the event was caused by the agent's own update
+// the transactions sent by the agent identify it, after a restart only a Sender field in the payload does
+func (a *Agent) ownEvent(event *client.ChaincodeEvent) bool {
+	if a.own.contains(event.TransactionID) {
+		return true
+	}
+	return getSender(string(event.Payload)) == a.cfg.MSPID
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var payloadMinVersion = flag.Int("payload-min-version", 1, "oldest version of the event payload accepted from the neighbors, raise it once every chaincode emits the newer format")
+
+// updatePayload is a neighbor's update as decoded from the payload of its event, whatever the version of the format
+type updatePayload struct {
+	Version  int
+	Lambda   float64
+	Mismatch float64
+	// lambdaText and mismatchText are the values as they were written, the seal of a signed update covers them
+	lambdaText   string
+	mismatchText string
+	// Iteration is the neighbor's iteration, -1 if the payload doesn't tell
+	Iteration int
+	// Period is the period of a multi-period run the update is for, -1 if the payload doesn't tell
+	Period int
+	// Run is the ID of the sender's run, empty if the payload doesn't tell
+	Run string
+	// Sender is the organization that sent the update, empty if the payload doesn't tell
+	Sender string
+	// Seal is the signature of the update with -signed-updates, empty if it has none
+	Seal string
+}
+
+// payloadDecoder decodes the payload of an event of one version of the format, of a batch only the latest update
+type payloadDecoder func(payload string) (updatePayload, error)
+
+// payloadDecoders are the formats of the event payload by version. A new format of the chaincode gets a decoder here,
+// so agents and chaincodes of different versions work together while they are upgraded one by one
+var payloadDecoders = map[int]payloadDecoder{
+	1: decodeTextPayload,
+	2: decodeEnvelopePayload,
+	3: decodeBinaryPayload,
+}
+
+// payloadEnvelope is the payload from version 2 on, a JSON object that carries the version of its format
+// the event of SendUpdateBatch is a JSON array of them
+type payloadEnvelope struct {
+	Version   int         `json:"version"`
+	Lambda    json.Number `json:"lambda"`
+	Mismatch  json.Number `json:"mismatch"`
+	Iteration *int        `json:"iteration"`
+	Period    *int        `json:"period"`
+	Run       string      `json:"run"`
+	Sender    string      `json:"sender"`
+	Signature string      `json:"signature"`
+}
+
+// decodePayload decodes the latest update of an event payload with the decoder of its version
+// it fails rather than returning zeros for a payload it can't read
+func decodePayload(payload string) (updatePayload, error) {
+	version, err := payloadVersion(payload)
+	if err != nil {
+		return updatePayload{}, err
+	}
+	if version < *payloadMinVersion {
+		return updatePayload{}, fmt.Errorf("payload version %d is older than -payload-min-version %d", version, *payloadMinVersion)
+	}
+	decode, ok := payloadDecoders[version]
+	if !ok {
+		return updatePayload{}, fmt.Errorf("unsupported payload version %d, the agent is older than the chaincode", version)
+	}
+	return decode(payload)
+}
+
+// payloadVersion returns the version of the format: an envelope carries it, the text of the first chaincode is version 1,
+// a binary payload starts with it
+func payloadVersion(payload string) (int, error) {
+	if len(payload) > 0 && payload[0] < '\t' {
+		return int(payload[0]), nil
+	}
+	envelope, isEnvelope, err := latestEnvelope(payload)
+	if !isEnvelope {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if envelope.Version < 2 {
+		return 0, errors.New("the payload envelope has no version")
+	}
+	return envelope.Version, nil
+}
+
+// latestEnvelope decodes the envelope of a single update or the last one of a batch, isEnvelope is false for a text payload
+func latestEnvelope(payload string) (envelope payloadEnvelope, isEnvelope bool, err error) {
+	payload = strings.TrimSpace(payload)
+	decoder := json.NewDecoder(strings.NewReader(payload))
+	decoder.UseNumber()
+	switch {
+	case strings.HasPrefix(payload, "{"):
+		err = decoder.Decode(&envelope)
+	case strings.HasPrefix(payload, "["):
+		var batch []payloadEnvelope
+		if err = decoder.Decode(&batch); err == nil {
+			if len(batch) == 0 {
+				return envelope, true, errors.New("the batch has no update")
+			}
+			envelope = batch[len(batch)-1]
+		}
+	default:
+		return envelope, false, nil
+	}
+	if err != nil {
+		return envelope, true, fmt.Errorf("invalid payload envelope: %w", err)
+	}
+	return envelope, true, nil
+}
+
+// decodeTextPayload reads version 1, "Lambda=<lambda>, Mismatch=<mismatch>, end" with the fields of contract.payload, where "Iteration=<n>, ",
+// "Period=<n>, " and "Run=<id>, " may come before the end and "Signature=<seal>" anywhere; the updates of a batch are separated by ';'
+func decodeTextPayload(payload string) (updatePayload, error) {
+	payload = latestUpdate(payload)
+	u := updatePayload{Version: 1, Iteration: -1, Period: -1, Seal: payloadField(sealPattern, payload)}
+	fields := cfg.Contract.Payload.withDefaults()
+	u.lambdaText = payloadField(fields.pattern(fields.Lambda), payload)
+	u.mismatchText = payloadField(fields.pattern(fields.Mismatch), payload)
+	if iteration := payloadField(`(?<=Iteration=)[0-9]+`, payload); iteration != "" {
+		u.Iteration, _ = strconv.Atoi(iteration)
+	}
+	if period := payloadField(`(?<=Period=)[0-9]+`, payload); period != "" {
+		u.Period, _ = strconv.Atoi(period)
+	}
+	u.Run = payloadField(`(?<=Run=)[0-9a-fA-F-]+`, payload)
+	return u, u.parse()
+}
+
+// decodeEnvelopePayload reads version 2, the JSON envelope
+func decodeEnvelopePayload(payload string) (updatePayload, error) {
+	envelope, _, err := latestEnvelope(payload)
+	if err != nil {
+		return updatePayload{}, err
+	}
+	u := updatePayload{
+		Version:      envelope.Version,
+		lambdaText:   envelope.Lambda.String(),
+		mismatchText: envelope.Mismatch.String(),
+		Iteration:    -1,
+		Period:       -1,
+		Sender:       envelope.Sender,
+		Run:          envelope.Run,
+		Seal:         envelope.Signature,
+	}
+	if envelope.Iteration != nil {
+		u.Iteration = *envelope.Iteration
+	}
+	if envelope.Period != nil {
+		u.Period = *envelope.Period
+	}
+	return u, u.parse()
+}
+
+// parse reads the values from their text, a missing one is an error
+func (u *updatePayload) parse() error {
+	var err error
+	if u.lambdaText == "" {
+		return errors.New("unreadable payload: Lambda not found")
+	}
+	if u.Lambda, err = strconv.ParseFloat(u.lambdaText, 64); err != nil {
+		return fmt.Errorf("unreadable payload: Lambda %q is not a number", u.lambdaText)
+	}
+	if u.mismatchText == "" {
+		return errors.New("unreadable payload: Mismatch not found")
+	}
+	if u.Mismatch, err = strconv.ParseFloat(u.mismatchText, 64); err != nil {
+		return fmt.Errorf("unreadable payload: Mismatch %q is not a number", u.mismatchText)
+	}
+	return nil
+}
+
+// parseCommand decodes a sample payload like the payload of a neighbor's event and prints what the agent reads from
+// it, to find out why the payloads of a chaincode aren't understood
+func parseCommand(args []string) error {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	sample := flags.String("sample", "", "the payload of an event, e.g. \"Lambda=6.2, Mismatch=0.4, end\"")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *sample == "" {
+		return errors.New("usage: parse --sample <payload>")
+	}
+	version, err := payloadVersion(*sample)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("version:          %d\n", version)
+	if version == 1 {
+		fields := cfg.Contract.Payload.withDefaults()
+		if n := len(strings.Split(strings.TrimRight(*sample, "; "), ";")); n > 1 {
+			fmt.Printf("batch:            %d updates, the last one is read\n", n)
+		}
+		fmt.Printf("lambda pattern:   %s\n", fields.pattern(fields.Lambda))
+		fmt.Printf("mismatch pattern: %s\n", fields.pattern(fields.Mismatch))
+	}
+	u, err := decodePayload(*sample)
+	fmt.Printf("lambda:           %s\n", orNone(u.lambdaText))
+	fmt.Printf("mismatch:         %s\n", orNone(u.mismatchText))
+	if err != nil {
+		if version == 1 {
+			return fmt.Errorf("%w, set contract.payload to the fields the chaincode writes", err)
+		}
+		return err
+	}
+	if u.Iteration >= 0 {
+		fmt.Printf("iteration:        %d\n", u.Iteration)
+	}
+	if u.Period >= 0 {
+		fmt.Printf("period:           %d\n", u.Period)
+	}
+	for _, f := range []struct{ name, value string }{{"run", u.Run}, {"sender", u.Sender}, {"signature", u.Seal}} {
+		if f.value != "" {
+			fmt.Printf("%-17s %s\n", f.name+":", f.value)
+		}
+	}
+	return nil
+}
+
+func orNone(text string) string {
+	if text == "" {
+		return "not found"
+	}
+	return text
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDecodePayloadVersions(t *testing.T) {
+	for _, c := range []struct {
+		payload   string
+		version   int
+		lambda    float64
+		mismatch  float64
+		iteration int
+		period    int
+	}{
+		{"Org2 update: Lambda=6.4, Mismatch=-0.5, end", 1, 6.4, -0.5, -1, -1},
+		{"Lambda=6, Mismatch=1, end; Lambda=6.2, Mismatch=0.5, Iteration=7, end", 1, 6.2, 0.5, 7, -1},
+		{"Lambda=6.2, Mismatch=0.5, Iteration=7, Period=13, end", 1, 6.2, 0.5, 7, 13},
+		{`{"version":2,"lambda":6.4,"mismatch":-0.5,"iteration":3,"sender":"Org2"}`, 2, 6.4, -0.5, 3, -1},
+		{`{"version":2,"lambda":6.4,"mismatch":-0.5,"iteration":3,"period":0}`, 2, 6.4, -0.5, 3, 0},
+		{`[{"version":2,"lambda":6,"mismatch":1},{"version":2,"lambda":6.2,"mismatch":0.5}]`, 2, 6.2, 0.5, -1, -1},
+	} {
+		update, err := decodePayload(c.payload)
+		if err != nil {
+			t.Errorf("failed to decode %q: %v", c.payload, err)
+			continue
+		}
+		if update.Version != c.version || update.Lambda != c.lambda || update.Mismatch != c.mismatch || update.Iteration != c.iteration || update.Period != c.period {
+			t.Errorf("%q decoded as %+v", c.payload, update)
+		}
+	}
+	// the period of a binary update is field 6, period 0 is sent as well
+	data, err := encodeUpdates([]*submission{{args: []string{"6.4", "-0.5"}, iteration: 3}}, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update, err := decodePayload(string(data)); err != nil || update.Period != 0 || update.Iteration != 3 {
+		t.Errorf("binary update decoded as %+v, %v", update, err)
+	}
+	// a payload that can't be read is an error, not an update of zeros
+	for _, payload := range []string{"Org2 update", "Lambda=abc, Mismatch=1, end", `{"lambda":1,"mismatch":2}`, `{"version":9,"lambda":1,"mismatch":2}`, `{"version":2,"lambda":1}`} {
+		if update, err := decodePayload(payload); err == nil {
+			t.Errorf("%q decoded as %+v, want an error", payload, update)
+		}
+	}
+}
+
+func TestPayloadFields(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.Contract.Payload = PayloadFields{Lambda: "Price=", Mismatch: "Imbalance=", Terminator: " |"}
+	u, err := decodePayload("Price=6.2 | Imbalance=-0.4 | end")
+	if err != nil || u.Lambda != 6.2 || u.Mismatch != -0.4 {
+		t.Errorf("decoded %+v, %v", u, err)
+	}
+	if err := (PayloadFields{Lambda: "P=", Mismatch: "dP="}).validate(); err == nil {
+		t.Errorf("overlapping payload fields were accepted")
+	}
+}
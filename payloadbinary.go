@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// the encodings of the updates, selected with -payload-encoding
+const (
+	payloadText         = "text"
+	payloadProtobuf     = "protobuf"
+	payloadProtobufGzip = "protobuf-gzip"
+)
+
+var payloadEncoding = flag.String("payload-encoding", payloadText, "how the updates are passed to the chaincode: \"text\" as their values, \"protobuf\" as one binary argument in the version 3 format of payload.proto, \"protobuf-gzip\" compressed as well; the chaincode emits the binary argument as the event payload")
+
+// binaryPayloadVersion is the first version of the binary payloads, a version byte and a compression byte followed by
+// the Updates message of payload.proto; a text or JSON payload never starts with a byte that low
+const binaryPayloadVersion = 3
+
+// the compressions of the message of a binary payload
+const (
+	compressionNone = 0
+	compressionGzip = 1
+)
+
+// a compressed payload may not expand beyond this, so a malicious event can't exhaust the memory
+const maxPayloadSize = 1 << 20
+
+func validatePayloadEncoding() error {
+	switch *payloadEncoding {
+	case payloadText, payloadProtobuf, payloadProtobufGzip:
+		return nil
+	}
+	return fmt.Errorf("invalid -payload-encoding %q, use %s, %s or %s", *payloadEncoding, payloadText, payloadProtobuf, payloadProtobufGzip)
+}
+
+func binaryPayload() bool {
+	return *payloadEncoding != payloadText
+}
+
+// sealText is the text of a value that the seal of an update covers. A binary payload carries the value itself rather
+// than its text, so its seal covers the shortest decimal that reads back exactly, which the neighbors recover from it
+func sealText(arg string) string {
+	if !binaryPayload() {
+		return arg
+	}
+	value, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return arg
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// payloadArgs returns the arguments the chaincode gets for a submission, with a binary -payload-encoding the updates
+// become a single argument in the version 3 format, with the period of a multi-period run unless it is -1
+func payloadArgs(s *submission, period int) ([]string, error) {
+	if !binaryPayload() {
+		return submissionArgs(s), nil
+	}
+	var updates []*submission
+	switch s.name {
+	case "SendUpdate":
+		updates = []*submission{s}
+	case batchFunction:
+		updates = s.updates
+	default:
+		return s.args, nil
+	}
+	data, err := encodeUpdates(updates, period, *payloadEncoding == payloadProtobufGzip)
+	if err != nil {
+		return nil, err
+	}
+	return []string{string(data)}, nil
+}
+
+// encodeUpdates writes the updates in the binary format, the fields are those of Update in payload.proto
+func encodeUpdates(updates []*submission, period int, compress bool) ([]byte, error) {
+	var message []byte
+	for _, s := range updates {
+		if len(s.args) < 2 {
+			return nil, fmt.Errorf("the update of iteration %v has no values", s.iteration)
+		}
+		lambda, err := strconv.ParseFloat(s.args[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lambda %q: %w", s.args[0], err)
+		}
+		mismatch, err := strconv.ParseFloat(s.args[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mismatch %q: %w", s.args[1], err)
+		}
+		var update []byte
+		update = protowire.AppendTag(update, 1, protowire.Fixed64Type)
+		update = protowire.AppendFixed64(update, math.Float64bits(lambda))
+		update = protowire.AppendTag(update, 2, protowire.Fixed64Type)
+		update = protowire.AppendFixed64(update, math.Float64bits(mismatch))
+		update = protowire.AppendTag(update, 3, protowire.VarintType)
+		update = protowire.AppendVarint(update, uint64(s.iteration))
+		if len(s.args) > 2 {
+			update = protowire.AppendTag(update, 5, protowire.BytesType)
+			update = protowire.AppendString(update, s.args[2])
+		}
+		if period >= 0 {
+			update = protowire.AppendTag(update, 6, protowire.VarintType)
+			update = protowire.AppendVarint(update, uint64(period))
+		}
+		if s.run != "" {
+			update = protowire.AppendTag(update, 7, protowire.BytesType)
+			update = protowire.AppendString(update, s.run)
+		}
+		message = protowire.AppendTag(message, 1, protowire.BytesType)
+		message = protowire.AppendBytes(message, update)
+	}
+	if !compress {
+		return append([]byte{binaryPayloadVersion, compressionNone}, message...), nil
+	}
+	var b bytes.Buffer
+	b.Write([]byte{binaryPayloadVersion, compressionGzip})
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(message); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// decodeBinaryPayload reads version 3, the latest update of the Updates message
+func decodeBinaryPayload(payload string) (updatePayload, error) {
+	if len(payload) < 2 {
+		return updatePayload{}, errors.New("truncated binary payload")
+	}
+	message := []byte(payload[2:])
+	switch payload[1] {
+	case compressionNone:
+	case compressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(message))
+		if err != nil {
+			return updatePayload{}, fmt.Errorf("invalid compressed payload: %w", err)
+		}
+		if message, err = io.ReadAll(io.LimitReader(r, maxPayloadSize+1)); err != nil {
+			return updatePayload{}, fmt.Errorf("invalid compressed payload: %w", err)
+		}
+		if len(message) > maxPayloadSize {
+			return updatePayload{}, fmt.Errorf("the payload expands beyond %v bytes", maxPayloadSize)
+		}
+	default:
+		return updatePayload{}, fmt.Errorf("unknown compression %d of the binary payload", payload[1])
+	}
+	var latest []byte
+	err := consumeFields(message, func(number protowire.Number, typ protowire.Type, value []byte) {
+		if number == 1 && typ == protowire.BytesType {
+			latest = value
+		}
+	})
+	if err != nil {
+		return updatePayload{}, err
+	}
+	if latest == nil {
+		return updatePayload{}, errors.New("the batch has no update")
+	}
+	u := updatePayload{Version: int(payload[0]), Iteration: -1, Period: -1}
+	var hasLambda, hasMismatch bool
+	err = consumeFields(latest, func(number protowire.Number, typ protowire.Type, value []byte) {
+		switch {
+		case number == 1 && typ == protowire.Fixed64Type:
+			u.Lambda, hasLambda = fixed64Value(value), true
+		case number == 2 && typ == protowire.Fixed64Type:
+			u.Mismatch, hasMismatch = fixed64Value(value), true
+		case number == 3 && typ == protowire.VarintType:
+			iteration, _ := protowire.ConsumeVarint(value)
+			u.Iteration = int(iteration)
+		case number == 4 && typ == protowire.BytesType:
+			u.Sender = string(value)
+		case number == 5 && typ == protowire.BytesType:
+			u.Seal = string(value)
+		case number == 6 && typ == protowire.VarintType:
+			period, _ := protowire.ConsumeVarint(value)
+			u.Period = int(period)
+		case number == 7 && typ == protowire.BytesType:
+			u.Run = string(value)
+		}
+	})
+	if err != nil {
+		return updatePayload{}, err
+	}
+	// the text of the values is what a seal covers, and what parse reads them from like those of the other versions
+	if hasLambda && !math.IsNaN(u.Lambda) && !math.IsInf(u.Lambda, 0) {
+		u.lambdaText = strconv.FormatFloat(u.Lambda, 'f', -1, 64)
+	}
+	if hasMismatch && !math.IsNaN(u.Mismatch) && !math.IsInf(u.Mismatch, 0) {
+		u.mismatchText = strconv.FormatFloat(u.Mismatch, 'f', -1, 64)
+	}
+	return u, u.parse()
+}
+
+// consumeFields passes the fields of a protobuf message to the function, the value of a varint or fixed field as its
+// encoding and that of a length-delimited field without its length
+func consumeFields(message []byte, field func(number protowire.Number, typ protowire.Type, value []byte)) error {
+	for len(message) > 0 {
+		number, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return fmt.Errorf("invalid binary payload: %w", protowire.ParseError(n))
+		}
+		message = message[n:]
+		n = protowire.ConsumeFieldValue(number, typ, message)
+		if n < 0 {
+			return fmt.Errorf("invalid binary payload: %w", protowire.ParseError(n))
+		}
+		value := message[:n]
+		if typ == protowire.BytesType {
+			value, _ = protowire.ConsumeBytes(value)
+		}
+		field(number, typ, value)
+		message = message[n:]
+	}
+	return nil
+}
+
+func fixed64Value(value []byte) float64 {
+	bits, _ := protowire.ConsumeFixed64(value)
+	return math.Float64frombits(bits)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var peerTimeout = flag.Duration("peer-timeout", 5*time.Second, "time a peer has to accept the connection before the next one of the organization's peers is tried, with backup peers in the config")
+
+// PeerConfig is a further peer of the organization the agent fails over to when the ones before it are unreachable
+type PeerConfig struct {
+	// Endpoint is the address of the peer, e.g. peer1.org1.example.com:8051
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// Name is the name of the peer, its TLS certificate has to be issued for this name
+	Name string `json:"name" yaml:"name"`
+	// TLSCert is the CA certificate the peer's TLS certificate is checked against, relative paths are taken relative to
+	// CryptoPath (default: the ca.crt in the tls folder of Name)
+	TLSCert string `json:"tlsCert" yaml:"tlsCert"`
+}
+
+func validatePeers(peers []PeerConfig) error {
+	for i, p := range peers {
+		if p.Endpoint == "" || p.Name == "" {
+			return fmt.Errorf("peer %v needs an endpoint and a name", i+1)
+		}
+	}
+	return nil
+}
+
+// peers returns the peers of the organization in the order they are tried, the gateway peer first
+func (c Config) peers() []PeerConfig {
+	return append([]PeerConfig{{Endpoint: c.PeerEndpoint, Name: c.GatewayPeer, TLSCert: c.TLSCert}}, c.Peers...)
+}
+
+// withPeer returns the config with the peer as its gateway peer
+func (c Config) withPeer(p PeerConfig) Config {
+	c.PeerEndpoint, c.GatewayPeer, c.TLSCert = p.Endpoint, p.Name, p.TLSCert
+	return c
+}
+
+// dialPeers connects to the first of the organization's peers that accepts the connection within -peer-timeout
+// A reconnection tries the gateway peer first again, so the agent returns to it once it is back
+func (c Config) dialPeers() (*grpc.ClientConn, PeerConfig, error) {
+	peers := c.peers()
+	if len(peers) == 1 {
+		// a single peer is dialed without waiting, as its failures show in the first call anyway
+		conn, err := c.newGrpcConnection()
+		return conn, peers[0], err
+	}
+	var failures []string
+	for i, p := range peers {
+		peer := c.withPeer(p)
+		config, err := peer.tlsConfig()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", p.Name, err))
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), *peerTimeout)
+		conn, err := grpc.DialContext(ctx, p.Endpoint, grpc.WithTransportCredentials(credentials.NewTLS(config)), grpc.WithBlock())
+		cancel()
+		if err != nil {
+			logger.Warnf("Peer %s at %s is unreachable: %v", p.Name, p.Endpoint, err)
+			failures = append(failures, fmt.Sprintf("%s: %v", p.Name, err))
+			continue
+		}
+		if i > 0 {
+			peerFailovers.Inc()
+			logger.Warnf("Failing over to peer %s at %s", p.Name, p.Endpoint)
+		}
+		return conn, p, nil
+	}
+	return nil, PeerConfig{}, fmt.Errorf("none of the %v peers of the organization is reachable: %s", len(peers), strings.Join(failures, "; "))
+}
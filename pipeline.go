@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	decodeWorkers  = flag.Int("decode-workers", 2, "number of workers decoding the payloads of the received events ahead of the optimization")
+	pipelineBuffer = flag.Int("pipeline-buffer", eventBufferSize, "events decoded or being decoded ahead of the optimization, further events wait in the event stream")
+)
+
+// decodedEvent is a received event with its payload decoded, err tells why it couldn't be
+type decodedEvent struct {
+	*client.ChaincodeEvent
+	update updatePayload
+	err    error
+	// ctx is the trace of the event, from its receipt on
+	ctx context.Context
+}
+
+// decodeStage decodes the events of a registration on -decode-workers workers and passes them on in the order they
+// arrived, so the optimization only steps while the next payloads are decoded. At most -pipeline-buffer events are
+// held, beyond that the stage stops reading and the events wait in the buffer of the registration.
+// The channel is closed after the last event once the registration's channel is closed. The spans of the events are
+// tagged with the organization that received them
+func decodeStage(events <-chan *client.ChaincodeEvent, organization string) <-chan *decodedEvent {
+	buffer := *pipelineBuffer
+	if buffer < 1 {
+		buffer = 1
+	}
+	workers := *decodeWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	// order holds a slot per event in the order they arrived, each is filled by the worker decoding the event
+	order := make(chan chan *decodedEvent, buffer)
+	out := make(chan *decodedEvent, buffer)
+	busy := make(chan struct{}, workers)
+	go func() {
+		defer close(order)
+		for event := range events {
+			queueDepth.WithLabelValues("received").Set(float64(len(events)))
+			ctx, span := traceReceipt(event, organization, time.Now())
+			slot := make(chan *decodedEvent, 1)
+			order <- slot
+			busy <- struct{}{}
+			go func(event *client.ChaincodeEvent) {
+				defer func() { <-busy }()
+				_, decoding := spans.Start(ctx, "decode", trace.WithAttributes(organizationAttribute(organization)))
+				update, err := decodePayload(string(event.Payload))
+				if err != nil {
+					decoding.RecordError(err)
+				}
+				decoding.End()
+				span.End()
+				slot <- &decodedEvent{ChaincodeEvent: event, update: update, err: err, ctx: ctx}
+			}(event)
+		}
+	}()
+	go func() {
+		defer close(out)
+		for slot := range order {
+			out <- <-slot
+			queueDepth.WithLabelValues("decoded").Set(float64(len(out)))
+		}
+	}()
+	return out
+}
+
+// registerDecoded registers for the events like registerEvents and decodes them in a stage of their own
+func registerDecoded(gw *gatewayConnection, eventFilter string, options ...client.ChaincodeEventsOption) (context.CancelFunc, <-chan *decodedEvent, error) {
+	reg, notifier, err := registerEvents(gw, eventFilter, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reg, decodeStage(notifier, gw.Identity().MspID()), nil
+}
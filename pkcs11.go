@@ -0,0 +1,49 @@
+//go:build pkcs11
+// +build pkcs11
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+
+	"testEvent/fabricagent"
+)
+
+// the PKCS#11 module can only be initialized once in a process, all connections share the factory
+var (
+	hsmFactory     *identity.HSMSignerFactory
+	hsmFactoryErr  error
+	hsmFactoryOnce sync.Once
+)
+
+// pkcs11Provider signs with a key kept in the PKCS#11 token configured under hsm
+// the key is found by its CKA_ID, which Fabric sets to the subject key identifier of the certificate
+type pkcs11Provider struct{}
+
+func (pkcs11Provider) signer(id *walletIdentity, cert *x509.Certificate) (identity.Sign, func() error, error) {
+	hsmFactoryOnce.Do(func() {
+		hsmFactory, hsmFactoryErr = identity.NewHSMSignerFactory(cfg.HSM.Library)
+	})
+	if hsmFactoryErr != nil {
+		return nil, nil, fmt.Errorf("failed to load the PKCS#11 module %s: %w", cfg.HSM.Library, hsmFactoryErr)
+	}
+	ski, err := hex.DecodeString(fabricagent.SubjectKeyIdentifier(cert.PublicKey))
+	if err != nil || len(ski) == 0 {
+		return nil, nil, errors.New("HSM identities need an ECDSA certificate")
+	}
+	sign, release, err := hsmFactory.NewHSMSigner(identity.HSMSignerOptions{
+		Label:      cfg.HSM.Label,
+		Pin:        cfg.HSM.pin(),
+		Identifier: string(ski),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open the key in token %s: %w", cfg.HSM.Label, err)
+	}
+	return sign, release, nil
+}
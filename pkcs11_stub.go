@@ -0,0 +1,18 @@
+//go:build !pkcs11
+// +build !pkcs11
+
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// pkcs11Provider stands in for the PKCS#11 support, which needs cgo and is only built with -tags pkcs11
+type pkcs11Provider struct{}
+
+func (pkcs11Provider) signer(id *walletIdentity, cert *x509.Certificate) (identity.Sign, func() error, error) {
+	return nil, nil, errors.New("this binary has no PKCS#11 support, build it with -tags pkcs11 to use HSM identities")
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+
+	"testEvent/agentplugin"
+)
+
+var (
+	pluginsFile   = flag.String("plugins", "", "JSON file declaring the event handler and device driver plugins to start, see agentplugin")
+	pluginTimeout = flag.Duration("plugin-timeout", 5*time.Second, "time a plugin has to answer a call before the agent goes on without it, 0 waits as long as it takes")
+)
+
+// pluginSpec declares one plugin, the command is started by the agent and serves the plugin over gRPC
+type pluginSpec struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+// deviceDriver is the device driver plugin, nil if none is configured
+var deviceDriver agentplugin.DeviceDriver
+
+// loadPlugins starts the plugins declared in -plugins and returns the event handlers among them
+// the device driver, if any, is kept in deviceDriver; plugin.CleanupClients stops them all again
+func loadPlugins() ([]*eventHandler, error) {
+	if *pluginsFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(*pluginsFile))
+	if err != nil {
+		return nil, err
+	}
+	var specs []pluginSpec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("invalid plugin file %s: %w", *pluginsFile, err)
+	}
+
+	var handlers []*eventHandler
+	for _, spec := range specs {
+		if spec.Type != agentplugin.KindEventHandler && spec.Type != agentplugin.KindDeviceDriver {
+			return nil, fmt.Errorf("plugin %s has unknown type %q, use %q or %q", spec.Name, spec.Type, agentplugin.KindEventHandler, agentplugin.KindDeviceDriver)
+		}
+		if spec.Type == agentplugin.KindDeviceDriver && deviceDriver != nil {
+			return nil, fmt.Errorf("plugin %s is a second device driver, only one is supported", spec.Name)
+		}
+		raw, err := startPlugin(spec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start plugin %s: %w", spec.Name, err)
+		}
+		logger.Infof("Started %s plugin %s", spec.Type, spec.Name)
+		switch spec.Type {
+		case agentplugin.KindEventHandler:
+			handlers = append(handlers, pluginHandler(spec.Name, raw.(agentplugin.EventHandler)))
+		case agentplugin.KindDeviceDriver:
+			deviceDriver = raw.(agentplugin.DeviceDriver)
+		}
+	}
+	return handlers, nil
+}
+
+func startPlugin(spec pluginSpec) (interface{}, error) {
+	client := plugin.NewClient(&plugin.ClientConfig{
+		HandshakeConfig:  agentplugin.Handshake,
+		Plugins:          agentplugin.ClientPlugins(*pluginTimeout),
+		Cmd:              exec.Command(spec.Command, spec.Args...),
+		AllowedProtocols: []plugin.Protocol{plugin.ProtocolGRPC},
+		Managed:          true,
+		// go-plugin traces every step by default, only problems are worth showing next to the agent's output
+		Logger: hclog.New(&hclog.LoggerOptions{Name: "plugin", Level: hclog.Warn}),
+	})
+	rpcClient, err := client.Client()
+	if err != nil {
+		client.Kill()
+		return nil, err
+	}
+	raw, err := rpcClient.Dispense(spec.Type)
+	if err != nil {
+		client.Kill()
+		return nil, err
+	}
+	return raw, nil
+}
+
+// pluginHandler runs an event handler plugin on the worker pool
+func pluginHandler(name string, handler agentplugin.EventHandler) *eventHandler {
+	return &eventHandler{
+		name: name,
+		handle: func(event *client.ChaincodeEvent) {
+			err := handler.HandleEvent(agentplugin.Event{
+				Name:        event.EventName,
+				TxID:        event.TransactionID,
+				BlockNumber: event.BlockNumber,
+				Payload:     event.Payload,
+			})
+			if err != nil {
+				pluginFailed(err, "Plugin %s failed to handle event %s", name, event.EventName)
+			}
+		},
+	}
+}
+
+// pluginFailed logs the failed call of a plugin, a call that ran into -plugin-timeout is also counted as a plugin error
+func pluginFailed(err error, format string, args ...interface{}) {
+	if errors.Is(err, agentplugin.ErrTimeout) {
+		countError("plugin")
+		logger.Warnf(format+": no answer within -plugin-timeout %v", append(args, *pluginTimeout)...)
+		return
+	}
+	logger.Warnf(format+": %v", append(args, err)...)
+}
+
+// driveSetpoint writes the setpoint to the device driver plugin, if there is one
+func driveSetpoint(P float64) {
+	if deviceDriver == nil {
+		return
+	}
+	if err := deviceDriver.WriteSetpoint(P); err != nil {
+		pluginFailed(err, "Failed to write setpoint %v MW to the device", P)
+	}
+}
+
+// driverIslanded tells whether the device driver plugin reports the microgrid as islanded
+func driverIslanded() bool {
+	if deviceDriver == nil {
+		return false
+	}
+	measurements, err := deviceDriver.Measurements()
+	if err != nil {
+		pluginFailed(err, "Failed to read the device measurements")
+		return false
+	}
+	if measurements["islanded"] == 1 {
+		return true
+	}
+	f, ok := measurements["frequency"]
+	return ok && math.Abs(f-*nominalFrequency) > *frequencyTolerance
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var progressFormat = flag.String("progress", "", "write progress to stdout in a machine-readable format, \"ndjson\" writes one JSON object per line")
+
+// progressNDJSON is the -progress format that writes one JSON object per line
+const progressNDJSON = "ndjson"
+
+var progressMu sync.Mutex
+
+func validateProgressFormat() error {
+	switch *progressFormat {
+	case "", progressNDJSON:
+		return nil
+	}
+	return fmt.Errorf("unknown progress format %q, use %s", *progressFormat, progressNDJSON)
+}
+
+// display is where the messages for the user go: stdout, or stderr while stdout carries the -progress stream or the
+// JSON summary of -report-format
+func display() io.Writer {
+	if *progressFormat == progressNDJSON || cfg.Report.format() == reportJSON {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// progress writes one significant event (connected, iteration, submitted, converged, error) to stdout when -progress=ndjson
+// the dashboard of the API gets it too
+func progress(event string, fields map[string]interface{}) {
+	if *progressFormat != progressNDJSON && api == nil {
+		return
+	}
+	record := map[string]interface{}{"event": event, "time": time.Now().Format(time.RFC3339Nano)}
+	for k, v := range fields {
+		record[k] = v
+	}
+	api.progressed(record)
+	if *progressFormat != progressNDJSON {
+		return
+	}
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	json.NewEncoder(os.Stdout).Encode(record)
+}
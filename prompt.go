@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// the answers of the prompts can be given with flags or, for services and containers, environment variables
+var (
+	assumeYes   = flag.Bool("yes", envBool("AGENT_YES"), "answer yes to the prompts: start the optimization, clean up and fetch all pages (env AGENT_YES); a latched emergency stop still needs -estop-ack")
+	autoStart   = flag.Bool("auto-start", envBool("AGENT_AUTO_START"), "start the optimization without asking (env AGENT_AUTO_START)")
+	autoCleanup = flag.Bool("auto-cleanup", envBool("AGENT_AUTO_CLEANUP"), "remove the wallet and the keystore after the run without asking (env AGENT_AUTO_CLEANUP)")
+)
+
+// envBool reads a boolean environment variable like "1" or "true", false if it is unset or invalid
+func envBool(name string) bool {
+	value, err := strconv.ParseBool(os.Getenv(name))
+	return err == nil && value
+}
+
+// interactive tells whether stdin is a terminal, as a systemd service or in a container without -t it is not
+func interactive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm asks a yes/no question unless the answer is given by a flag or -yes
+func confirm(question string, given bool) bool {
+	if given || *assumeYes {
+		fmt.Fprintln(display(), "-> "+question+" y")
+		return true
+	}
+	return ask(question)
+}
+
+// promptAttempts is how often a question is asked when the answer is neither yes nor no, the last invalid answer is no
+const promptAttempts = 3
+
+// ask asks a yes/no question on the terminal, without one nobody can answer and the answer is no
+// an empty answer is no as well, any other answer that is neither yes nor no asks the question again
+func ask(question string) bool {
+	if !interactive() {
+		fmt.Fprintln(display(), "-> "+question+" n")
+		return false
+	}
+	for attempt := 1; ; attempt++ {
+		fmt.Fprintln(display(), "-> "+question)
+		answer := strings.TrimSpace(catchOneInput())
+		if answer == "" {
+			return false
+		}
+		if yes, ok := parseAnswer(answer); ok {
+			return yes
+		}
+		if attempt == promptAttempts {
+			return false
+		}
+		yes, no := answerWords()
+		fmt.Fprintln(display(), tr("Please answer %s or %s", yes[0], no[0]))
+	}
+}
+
+// answerWords returns the words that answer the prompts in the current language, followed by the English ones
+func answerWords() (yes, no []string) {
+	words := answers[currentLanguage()]
+	yes = append(append(yes, words.yes...), "yes", "y")
+	no = append(append(no, words.no...), "no", "n")
+	return yes, no
+}
+
+// parseAnswer reads the answer to a yes/no question without surrounding spaces and case, ok is false if it is neither
+func parseAnswer(s string) (yes bool, ok bool) {
+	s = strings.TrimSpace(s)
+	yesWords, noWords := answerWords()
+	for _, w := range yesWords {
+		if strings.EqualFold(s, w) {
+			return true, true
+		}
+	}
+	for _, w := range noWords {
+		if strings.EqualFold(s, w) {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+func isYes(s string) bool {
+	yes, ok := parseAnswer(s)
+	return ok && yes
+}
+
+func isNo(s string) bool {
+	yes, ok := parseAnswer(s)
+	return ok && !yes
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseAnswer(t *testing.T) {
+	defer func(lang string) { *language = lang }(*language)
+	*language = "zh"
+	for answer, want := range map[string]bool{"y": true, " YES ": true, "No": false, "n\r": false, "是": true, "否": false} {
+		if yes, ok := parseAnswer(answer); !ok || yes != want {
+			t.Errorf("parseAnswer(%q) = %v, %v, want %v", answer, yes, ok, want)
+		}
+	}
+	for _, answer := range []string{"", "maybe", "yess"} {
+		if _, ok := parseAnswer(answer); ok {
+			t.Errorf("%q was taken as an answer", answer)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+var (
+	retryMax      = flag.Int("retry-max", 6, "retries of a failed SendUpdate or event registration before giving up")
+	retryInitial  = flag.Duration("retry-initial", 500*time.Millisecond, "delay before the first retry, doubled with every further retry")
+	retryMaxDelay = flag.Duration("retry-max-delay", 30*time.Second, "longest delay between two retries")
+	retryCodes    = flag.String("retry-codes", "UNREACHABLE,NO_ENDORSERS,MVCC_READ_CONFLICT,PHANTOM_READ_CONFLICT,ENDORSEMENT_POLICY_FAILURE", "comma-separated failures a submission is retried on, as named in the error explanations")
+)
+
+// retryDelay returns the delay before the given retry, growing exponentially with random jitter
+// so that nodes that lost the network together don't all come back at the same moment
+func retryDelay(attempt int) time.Duration {
+	d := *retryInitial
+	for i := 0; i < attempt && d < *retryMaxDelay; i++ {
+		d *= 2
+	}
+	if d > *retryMaxDelay {
+		d = *retryMaxDelay
+	}
+	// full delay halved plus a random part of the other half
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// transientFailure tells whether a failed transaction is worth retrying and whether the connection should be replaced for it
+func transientFailure(err error) (retry bool, reconnect bool) {
+	code := failureCode(err)
+	if code == "" {
+		return false, false
+	}
+	for _, c := range strings.Split(*retryCodes, ",") {
+		if strings.TrimSpace(c) == code {
+			return true, code == "UNREACHABLE" || code == "NO_ENDORSERS"
+		}
+	}
+	return false, false
+}
+
+// registerWithRetry registers for the events again after the stream closed, with the same backoff as the submissions
+func registerWithRetry(gw *gatewayConnection, eventFilter string) (context.CancelFunc, <-chan *decodedEvent, error) {
+	for attempt := 0; ; attempt++ {
+		reg, notifier, err := registerDecoded(gw, eventFilter, replayOptions()...)
+		if err == nil || attempt >= *retryMax {
+			return reg, notifier, err
+		}
+		delay := retryDelay(attempt)
+		logger.Warnf("Failed to register contract event, retrying in %s: %v", delay.Round(time.Millisecond), err)
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+const recordUsage = "record [--event <filter>] [--out <file>] [--format jsonl|csv] [--start <block>]"
+
+// the formats of a recording
+const (
+	recordJSONL = "jsonl"
+	recordCSV   = "csv"
+)
+
+// recordedEvent is a line of a JSON lines recording, a capturedEvent with the time it was received, so "trace replay"
+// reads a recording like the progress stream of a run
+type recordedEvent struct {
+	capturedEvent
+	Time time.Time `json:"time"`
+}
+
+var recordColumns = []string{"time", "block", "txId", "name", "payload"}
+
+// eventRecorder writes the events to a recording, every event is flushed so a recorder that is killed keeps them
+type eventRecorder struct {
+	w       io.Writer
+	csv     *csv.Writer
+	records int
+}
+
+// newEventRecorder returns a recorder of the format, a new CSV recording starts with the header
+func newEventRecorder(w io.Writer, format string, newFile bool) (*eventRecorder, error) {
+	r := &eventRecorder{w: w}
+	switch format {
+	case recordJSONL:
+	case recordCSV:
+		r.csv = csv.NewWriter(w)
+		if !newFile {
+			break
+		}
+		if err := r.csv.Write(recordColumns); err != nil {
+			return nil, err
+		}
+		r.csv.Flush()
+	default:
+		return nil, fmt.Errorf("unknown format %q, use %s or %s", format, recordJSONL, recordCSV)
+	}
+	return r, nil
+}
+
+// write records an event received at the time
+func (r *eventRecorder) write(event *client.ChaincodeEvent, received time.Time) error {
+	r.records++
+	if r.csv != nil {
+		row := []string{received.Format(time.RFC3339Nano), strconv.FormatUint(event.BlockNumber, 10), event.TransactionID, event.EventName, string(event.Payload)}
+		if err := r.csv.Write(row); err != nil {
+			return err
+		}
+		r.csv.Flush()
+		return r.csv.Error()
+	}
+	data, err := json.Marshal(recordedEvent{
+		capturedEvent: capturedEvent{Event: "event", Name: event.EventName, Block: event.BlockNumber, TxID: event.TransactionID, Payload: string(event.Payload)},
+		Time:          received,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.w.Write(append(data, '\n'))
+	return err
+}
+
+// recordCommand writes the chaincode events matching the filter to a recording until it is interrupted, without
+// taking part in the optimization, e.g. to capture the updates of other organizations for "trace replay"
+func recordCommand(args []string) error {
+	flags := flag.NewFlagSet("record", flag.ContinueOnError)
+	eventFilter := flags.String("event", cfg.eventFilter(), "regular expression selecting the events to record")
+	out := flags.String("out", "", "file the events are appended to (default: stdout)")
+	format := flags.String("format", "", "format of the recording, "+recordJSONL+" or "+recordCSV+" (default: from the extension of --out, else "+recordJSONL+")")
+	start := flags.Int64("start", -1, "block to record the events from, the events of earlier blocks are replayed (default: the next block)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(flags.Args()) > 0 {
+		return fmt.Errorf("usage: %s", recordUsage)
+	}
+	if *format == "" {
+		*format = recordJSONL
+		if strings.EqualFold(filepath.Ext(*out), ".csv") {
+			*format = recordCSV
+		}
+	}
+	w, newFile := io.Writer(os.Stdout), true
+	if *out != "" {
+		_, err := os.Stat(*out)
+		newFile = os.IsNotExist(err)
+		f, err := os.OpenFile(filepath.Clean(*out), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	recorder, err := newEventRecorder(w, *format, newFile)
+	if err != nil {
+		return err
+	}
+	var options []client.ChaincodeEventsOption
+	if *start >= 0 {
+		options = append(options, client.WithStartBlock(uint64(*start)))
+	}
+	return connected(func(gw *gatewayConnection, contract *client.Contract, args []string) error {
+		reg, notifier, err := registerEvents(gw, *eventFilter, options...)
+		if err != nil {
+			return fmt.Errorf("failed to register contract event: %w", explainError(err))
+		}
+		defer reg()
+		logger.Infof("Recording the events matching %q, interrupt to stop", *eventFilter)
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		defer signal.Stop(interrupt)
+		for {
+			select {
+			case event, ok := <-notifier:
+				if !ok || event == nil {
+					return fmt.Errorf("the event stream was closed after %v events", recorder.records)
+				}
+				if err := recorder.write(event, time.Now()); err != nil {
+					return fmt.Errorf("failed to record the event: %w", err)
+				}
+			case <-interrupt:
+				logger.Infof("Recorded %v events", recorder.records)
+				return nil
+			}
+		}
+	})(nil)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+var (
+	regulationUDP      = flag.String("regulation-udp", "", "UDP address (e.g. :9999) to receive the regulation signal on, one number in [-1, 1] per datagram")
+	regulationFile     = flag.String("regulation-file", "", "file holding the latest regulation signal in [-1, 1], polled every -regulation-interval")
+	regulationInterval = flag.Duration("regulation-interval", 200*time.Millisecond, "polling interval of -regulation-file")
+	regulationGain     = flag.Float64("regulation-gain", 1, "setpoint bias in MW for a regulation signal of 1")
+	regulationLimit    = flag.Float64("regulation-limit", 0.5, "largest setpoint bias in MW the regulation signal may cause")
+	regulationStale    = flag.Duration("regulation-stale", 10*time.Second, "a regulation signal older than this no longer biases the setpoint, 0 keeps the last one")
+)
+
+// regulationSignal holds the latest value of the external regulation signal
+type regulationSignal struct {
+	mu       sync.Mutex
+	value    float64
+	received time.Time
+
+	// driving serializes the writes of the setpoint, between the rounds the ticker drives the dispatch of the last one
+	driving    sync.Mutex
+	dispatched bool
+	dispatch   float64
+	limits     powerLimits
+	driven     float64
+
+	// the sources and the ticker end when done is closed
+	done      chan struct{}
+	closeOnce sync.Once
+	conn      net.PacketConn
+	client    mqtt.Client
+}
+
+// startRegulation starts listening for the regulation signal on the configured sources, it returns nil if none is configured
+func startRegulation(config MQTTConfig) *regulationSignal {
+	if *regulationUDP == "" && *regulationFile == "" && config.RegulationTopic == "" {
+		return nil
+	}
+	r := &regulationSignal{done: make(chan struct{})}
+	if *regulationUDP != "" {
+		conn, err := net.ListenPacket("udp", *regulationUDP)
+		if err != nil {
+			logger.Warnf("Failed to listen for the regulation signal: %v", err)
+		} else {
+			logger.Infof("Listening for the regulation signal on %s", conn.LocalAddr())
+			r.conn = conn
+			go r.readUDP(conn)
+		}
+	}
+	if *regulationFile != "" {
+		go r.pollFile(*regulationFile, *regulationInterval)
+	}
+	if config.RegulationTopic != "" {
+		client, err := subscribeRegulation(config, r)
+		if err != nil {
+			logger.Warnf("Failed to subscribe to the regulation signal: %v", err)
+		} else {
+			r.client = client
+		}
+	}
+	go r.tick(*regulationInterval)
+	return r
+}
+
+func (r *regulationSignal) readUDP(conn net.PacketConn) {
+	buf := make([]byte, 64)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			logger.Warnf("Stopped receiving the regulation signal: %v", err)
+			return
+		}
+		r.set(string(buf[:n]), time.Now())
+	}
+}
+
+// pollFile reads the signal from the file, it was received when the file was last written
+func (r *regulationSignal) pollFile(path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	path = filepath.Clean(path)
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.done:
+			return
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		r.set(string(data), info.ModTime())
+	}
+}
+
+func (r *regulationSignal) set(s string, received time.Time) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(value) {
+		return
+	}
+	r.mu.Lock()
+	r.value = math.Min(math.Max(value, -1), 1)
+	r.received = received
+	r.mu.Unlock()
+}
+
+// bias returns the setpoint bias caused by the latest regulation signal, none once the signal is older than
+// -regulation-stale
+func (r *regulationSignal) bias() float64 {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if *regulationStale > 0 && time.Since(r.received) > *regulationStale {
+		return 0
+	}
+	b := r.value * *regulationGain
+	return math.Min(math.Max(b, -*regulationLimit), *regulationLimit)
+}
+
+// setpoint returns the power the generator should produce, the dispatch P biased by the regulation signal within the power limits
+func (r *regulationSignal) setpoint(P float64, limits powerLimits) float64 {
+	return limits.clamp(P + r.bias())
+}
+
+// follow drives the device to the setpoint of the dispatch P of a round, until the next round the ticker keeps it
+// following the regulation signal
+func (r *regulationSignal) follow(P float64, limits powerLimits) {
+	if r == nil {
+		driveSetpoint(limits.clamp(P))
+		return
+	}
+	r.driving.Lock()
+	defer r.driving.Unlock()
+	r.dispatched, r.dispatch, r.limits = true, P, limits
+	r.driven = r.setpoint(P, limits)
+	driveSetpoint(r.driven)
+}
+
+// tick drives the setpoint of the last dispatch every interval in which the regulation signal changed it
+func (r *regulationSignal) tick(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.done:
+			return
+		}
+		r.driving.Lock()
+		if r.dispatched {
+			if setpoint := r.setpoint(r.dispatch, r.limits); setpoint != r.driven {
+				r.driven = setpoint
+				driveSetpoint(setpoint)
+			}
+		}
+		r.driving.Unlock()
+	}
+}
+
+// stop ends the regulation of the setpoint between the rounds at the end of a run, or before an emergency stop drives
+// the safe setpoint; the signal is still received, e.g. for the next period of a -forecast run
+func (r *regulationSignal) stop() {
+	if r == nil {
+		return
+	}
+	r.driving.Lock()
+	r.dispatched = false
+	r.driving.Unlock()
+}
+
+// close stops the regulation and stops receiving the signal
+func (r *regulationSignal) close() {
+	if r == nil {
+		return
+	}
+	r.stop()
+	r.closeOnce.Do(func() {
+		close(r.done)
+		if r.conn != nil {
+			_ = r.conn.Close()
+		}
+		if r.client != nil {
+			r.client.Disconnect(250)
+		}
+	})
+}
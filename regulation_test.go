@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRegulationClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agc")
+	if err := os.WriteFile(path, []byte("0.5\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func(udp, file string, interval time.Duration) {
+		*regulationUDP, *regulationFile, *regulationInterval = udp, file, interval
+	}(*regulationUDP, *regulationFile, *regulationInterval)
+	*regulationUDP, *regulationFile, *regulationInterval = "127.0.0.1:0", path, 10*time.Millisecond
+	r := startRegulation(MQTTConfig{})
+	deadline := time.Now().Add(5 * time.Second)
+	for r.bias() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if bias := r.bias(); bias != 0.5 {
+		t.Errorf("bias: got %v", bias)
+	}
+	r.close()
+	r.close()
+	if err := r.conn.SetDeadline(time.Now()); err == nil {
+		t.Error("the UDP listener is still open")
+	}
+	select {
+	case <-r.done:
+	default:
+		t.Error("the ticker and the file poller are still running")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// the reliability counters of the last run are written here
+const connectionStatsFile = "connection_stats.json"
+
+// connectionCounters are the reliability figures of the connection and the event stream
+type connectionCounters struct {
+	Reconnects       int           `json:"reconnects"`
+	ReconnectTime    time.Duration `json:"reconnectTimeTotal"`
+	AverageReconnect time.Duration `json:"averageReconnect"`
+	StreamErrors     int           `json:"streamErrors"`
+	Events           int           `json:"events"`
+	EventGapTotal    time.Duration `json:"eventGapTotal"`
+	AverageEventGap  time.Duration `json:"averageEventGap"`
+	EventGapMax      time.Duration `json:"eventGapMax"`
+	LargestBlockJump uint64        `json:"largestBlockJump"`
+}
+
+// connectionStats counts what went wrong with the connection and the event stream, so chronic network problems between sites are visible
+type connectionStats struct {
+	mu        sync.Mutex
+	c         connectionCounters
+	lastEvent time.Time
+	lastBlock uint64
+}
+
+func newConnectionStats() *connectionStats {
+	return &connectionStats{lastEvent: time.Now()}
+}
+
+// event records a received event, the gap is the time since the previous one (or since the start)
+func (s *connectionStats) event(block uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	gap := time.Since(s.lastEvent)
+	s.lastEvent = time.Now()
+	s.c.Events++
+	s.c.EventGapTotal += gap
+	if gap > s.c.EventGapMax {
+		s.c.EventGapMax = gap
+	}
+	if s.lastBlock > 0 && block > s.lastBlock && block-s.lastBlock > s.c.LargestBlockJump {
+		s.c.LargestBlockJump = block - s.lastBlock
+	}
+	s.lastBlock = block
+}
+
+func (s *connectionStats) streamError() {
+	s.mu.Lock()
+	s.c.StreamErrors++
+	s.mu.Unlock()
+}
+
+// reconnected records a reconnection that took d
+func (s *connectionStats) reconnected(d time.Duration) {
+	s.mu.Lock()
+	s.c.Reconnects++
+	s.c.ReconnectTime += d
+	s.mu.Unlock()
+}
+
+// snapshot returns a copy of the counters with the averages filled in
+func (s *connectionStats) snapshot() connectionCounters {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.c
+	if c.Reconnects > 0 {
+		c.AverageReconnect = c.ReconnectTime / time.Duration(c.Reconnects)
+	}
+	if c.Events > 0 {
+		c.AverageEventGap = c.EventGapTotal / time.Duration(c.Events)
+	}
+	return c
+}
+
+// sinceLastEvent is the time since the last event, or since the start if none arrived yet
+func (s *connectionStats) sinceLastEvent() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Since(s.lastEvent)
+}
+
+func (s *connectionStats) String() string {
+	c := s.snapshot()
+	return fmt.Sprintf("%v events (average gap %s, largest gap %s, largest block jump %v), %v stream errors, %v reconnects (average %s)",
+		c.Events, c.AverageEventGap, c.EventGapMax, c.LargestBlockJump, c.StreamErrors, c.Reconnects, c.AverageReconnect)
+}
+
+func (s *connectionStats) save() error {
+	c := s.snapshot()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(connectionStatsFile, data, 0600)
+}
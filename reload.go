@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+)
+
+var configWatchInterval = flag.Duration("config-watch-interval", 0, "how often the config file is checked for changes of the tunable parameters, 0 reloads them only on SIGHUP")
+
+// configReloader tells when the tunable parameters are to be read again from the config file: on SIGHUP, and with
+// -config-watch-interval when the file changes
+type configReloader struct {
+	reloads chan struct{}
+	signals chan os.Signal
+	done    chan struct{}
+}
+
+// newConfigReloader returns nil without a config file, there is nothing to reload then
+func newConfigReloader() *configReloader {
+	if *configFile == "" {
+		return nil
+	}
+	r := &configReloader{reloads: make(chan struct{}, 1), signals: make(chan os.Signal, 1), done: make(chan struct{})}
+	signal.Notify(r.signals, syscall.SIGHUP)
+	var ticks <-chan time.Time
+	var ticker *time.Ticker
+	if *configWatchInterval > 0 {
+		ticker = time.NewTicker(*configWatchInterval)
+		ticks = ticker.C
+	}
+	// the config file is noticed to change like the certificate, by its modification time
+	watcher := newCertWatcher(*configFile)
+	go func() {
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+		for {
+			select {
+			case <-r.signals:
+			case <-ticks:
+				if !watcher.changed() {
+					continue
+				}
+			case <-r.done:
+				return
+			}
+			select {
+			case r.reloads <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return r
+}
+
+// C returns the channel of the reloads, nil without a reloader
+func (r *configReloader) C() <-chan struct{} {
+	if r == nil {
+		return nil
+	}
+	return r.reloads
+}
+
+func (r *configReloader) stop() {
+	if r == nil {
+		return
+	}
+	signal.Stop(r.signals)
+	close(r.done)
+}
+
+// reloadTunables reads the config file again and returns the current config with the parameters that can change during a
+// run taken from it: the convergence tolerances, the neighbor weights and the models of the generator, load or battery
+// changed lists what changed; the connection settings, the role and the algorithm keep their values until a restart
+func reloadTunables(current Config) (next Config, changed []string, err error) {
+	fresh, err := loadConfig(*configFile, *organization)
+	if err != nil {
+		return current, nil, err
+	}
+	if *channelName != "" {
+		if _, err := fresh.selectChannel(*channelName); err != nil {
+			return current, nil, err
+		}
+	}
+	next = current
+	if !reflect.DeepEqual(fresh.Generator, current.Generator) {
+		next.Generator = fresh.Generator
+		changed = append(changed, "generator")
+	}
+	if !reflect.DeepEqual(fresh.Load, current.Load) {
+		next.Load = fresh.Load
+		changed = append(changed, "load")
+	}
+	// the state of charge is the battery's, not a parameter
+	fresh.Storage.SoC = current.Storage.SoC
+	if !reflect.DeepEqual(fresh.Storage, current.Storage) {
+		next.Storage = fresh.Storage
+		changed = append(changed, "storage")
+	}
+	if !reflect.DeepEqual(fresh.Neighbors, current.Neighbors) {
+		if err := sameNeighbors(current.Neighbors, fresh.Neighbors); err != nil {
+			return current, nil, err
+		}
+		next.Neighbors = fresh.Neighbors
+		changed = append(changed, "neighbor weights")
+	}
+	if fresh.PeerEndpoint != current.PeerEndpoint || fresh.NetworkName != current.NetworkName || fresh.ContractName != current.ContractName ||
+		fresh.MSPID != current.MSPID || fresh.UserName != current.UserName || fresh.eventFilter() != current.eventFilter() {
+		logger.Warn("The connection settings changed in the config file, they take effect after a restart")
+	}
+	if fresh.role() != current.role() || !reflect.DeepEqual(fresh.Algorithm, current.Algorithm) {
+		logger.Warn("The role or the algorithm changed in the config file, they take effect after a restart")
+	}
+	return next, changed, nil
+}
+
+// sameNeighbors fails unless the reloaded neighbors are the current ones, only their weights can change during a run
+// as the rounds wait for the updates of exactly these neighbors
+func sameNeighbors(current, fresh []Neighbor) error {
+	if len(current) != len(fresh) {
+		return errors.New("the neighbors can't be added or removed during a run, only their weights can change")
+	}
+	for i := range current {
+		if current[i].Event != fresh[i].Event || current[i].Certificate != fresh[i].Certificate {
+			return fmt.Errorf("neighbor %s can't be replaced during a run, only its weight can change", current[i].Event)
+		}
+	}
+	return nil
+}
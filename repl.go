@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+var replHistory = flag.String("repl-history", ".app_history", "file the lines typed in the repl are kept in for the next session, empty keeps no history")
+
+// invocation is a chaincode call as typed on the command line or in the repl: [--evaluate] [--transient key=value]... <function> [args...]
+type invocation struct {
+	evaluate  bool
+	transient map[string][]byte
+	function  string
+	args      []string
+}
+
+const invocationUsage = "[--evaluate] [--transient key=value]... <function> [args...]"
+
+func parseInvocation(name string, args []string) (invocation, error) {
+	var i invocation
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.BoolVar(&i.evaluate, "evaluate", false, "evaluate the function on a peer without creating a transaction")
+	var pairs []string
+	flags.Func("transient", "transient data as key=value, passed to the chaincode without being recorded on the ledger; can be repeated", func(pair string) error {
+		pairs = append(pairs, pair)
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return i, err
+	}
+	if flags.NArg() == 0 {
+		return i, fmt.Errorf("usage: %s %s", name, invocationUsage)
+	}
+	transient, err := parseTransient(pairs)
+	if err != nil {
+		return i, err
+	}
+	i.transient, i.function, i.args = transient, flags.Arg(0), flags.Args()[1:]
+	return i, nil
+}
+
+// run invokes the function and prints the result, a submitted transaction is audited
+func (i invocation) run(contract contractAPI) error {
+	result, txID, err := invokeTransaction(contract, i.evaluate, i.function, i.args, i.transient)
+	if !i.evaluate {
+		auditInvocation(i.function, i.args, txID, result, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to invoke %s: %w", i.function, explainError(err))
+	}
+	if txID != "" {
+		fmt.Println(tr("Transaction ID: %s", txID))
+	}
+	fmt.Println(tr("Result: %s", prettyResult(result)))
+	return nil
+}
+
+// the commands of the repl besides the functions of the chaincode
+var replCommands = []string{"help", "functions", "exit"}
+
+// replCommand reads chaincode calls line by line, with the history of earlier sessions and completion of the functions
+// a chaincode that publishes its metadata has the number and the types of the arguments checked before the call
+func replCommand(contract contractAPI, args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: repl")
+	}
+	metadata, err := fetchMetadata(contract)
+	if err != nil {
+		logger.Warnf("Functions are neither completed nor checked: %v", err)
+		metadata = nil
+	}
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:       "> ",
+		HistoryFile:  *replHistory,
+		AutoComplete: replCompleter{metadata},
+	})
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+	fmt.Println(tr("Enter %s, help or exit", invocationUsage))
+	for {
+		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		quit, err := replLine(contract, metadata, line)
+		if err != nil {
+			fmt.Println(err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// replLine runs a line of the repl, it returns true on exit
+func replLine(contract contractAPI, metadata *contractMetadata, line string) (bool, error) {
+	words, err := splitWords(line)
+	if err != nil || len(words) == 0 {
+		return false, err
+	}
+	switch {
+	case isExit(words[0]) || words[0] == "quit":
+		return true, nil
+	case words[0] == "help":
+		fmt.Println(invocationUsage)
+		fmt.Println(tr("--evaluate queries the function without a transaction, functions lists the functions of the chaincode"))
+		return false, nil
+	case words[0] == "functions":
+		if metadata == nil {
+			return false, errors.New(tr("The chaincode publishes no metadata"))
+		}
+		for _, name := range metadata.functions() {
+			fmt.Println(name + metadata.signature(name))
+		}
+		return false, nil
+	}
+	call, err := parseInvocation("", words)
+	if err != nil {
+		return false, err
+	}
+	if err := metadata.check(call.function, call.args); err != nil {
+		return false, err
+	}
+	return false, call.run(contract)
+}
+
+// splitWords splits a line at the spaces outside of quotes, so an argument can hold spaces or be empty
+func splitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote %c", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// replCompleter completes the options, the commands of the repl and the functions of the chaincode
+type replCompleter struct {
+	metadata *contractMetadata
+}
+
+func (c replCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	before := string(line[:pos])
+	words, err := splitWords(before)
+	if err != nil {
+		return nil, 0
+	}
+	// the word under the cursor, empty after a space
+	current := ""
+	if len(words) > 0 && !strings.HasSuffix(before, " ") {
+		current, words = words[len(words)-1], words[:len(words)-1]
+	}
+	var candidates []string
+	switch {
+	case strings.HasPrefix(current, "-"):
+		candidates = []string{"--evaluate", "--transient"}
+	case len(words) > 0 && words[len(words)-1] == "--transient":
+		return nil, 0
+	case functionGiven(words):
+		return nil, 0
+	default:
+		if len(words) == 0 {
+			candidates = append(candidates, replCommands...)
+		}
+		if c.metadata != nil {
+			candidates = append(candidates, c.metadata.functions()...)
+		}
+	}
+	sort.Strings(candidates)
+	var completions [][]rune
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, current) {
+			completions = append(completions, []rune(strings.TrimPrefix(candidate, current)+" "))
+		}
+	}
+	return completions, len([]rune(current))
+}
+
+// functionGiven tells whether the words before the cursor already name the function, the rest are its arguments
+func functionGiven(words []string) bool {
+	for i := 0; i < len(words); i++ {
+		switch {
+		case words[i] == "--transient" || words[i] == "-transient":
+			i++
+		case strings.HasPrefix(words[i], "-"):
+		default:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+var (
+	eventCheckpointFile = flag.String("event-checkpoint", "event_checkpoint.json", "file the position of the last processed event is kept in, -resume replays the events after it; empty to disable")
+	startBlock          = flag.Int64("start-block", -1, "replay the events from this block on instead of listening from the newest block")
+)
+
+// eventReplay keeps track of the last processed event, so that events missed while the node was offline
+// or while it registered again are read from the ledger instead of being lost
+type eventReplay struct {
+	checkpointer *client.FileCheckpointer
+	// started is set once an event of this run was checkpointed, from then on every registration continues from the checkpoint
+	started bool
+}
+
+// replay is the event position of the optimization, nil when the commands run or checkpoints are disabled
+var replay *eventReplay
+
+// openEventReplay opens the event checkpoint of the previous runs
+func openEventReplay() (*eventReplay, error) {
+	if *eventCheckpointFile == "" {
+		return nil, nil
+	}
+	checkpointer, err := client.NewFileCheckpointer(*eventCheckpointFile)
+	if err != nil {
+		return nil, err
+	}
+	return &eventReplay{checkpointer: checkpointer}, nil
+}
+
+// replayOptions returns where the next registration for events starts reading
+func replayOptions() []client.ChaincodeEventsOption {
+	var options []client.ChaincodeEventsOption
+	switch {
+	case replay != nil && replay.started:
+		options = append(options, client.WithCheckpoint(replay.checkpointer))
+	case *startBlock >= 0:
+		options = append(options, client.WithStartBlock(uint64(*startBlock)))
+	case replay != nil && *resume:
+		// only a resumed run catches up, a new run must not act on the updates of the previous one
+		options = append(options, client.WithCheckpoint(replay.checkpointer))
+	}
+	return options
+}
+
+// commit checkpoints the event an update was computed from, once the update is committed
+func (r *eventReplay) commit(event *client.ChaincodeEvent) error {
+	if r == nil || event == nil || offChain(event) {
+		return nil
+	}
+	if err := r.checkpointer.CheckpointChaincodeEvent(event); err != nil {
+		return err
+	}
+	r.started = true
+	return nil
+}
+
+func (r *eventReplay) close() {
+	if r != nil {
+		r.checkpointer.Close()
+	}
+}
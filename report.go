@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var reportFormat = flag.String("report-format", "", "format of the summary printed at the end of a converged run, replaces report.format: text, json or markdown")
+
+// the formats of the summary of a run
+const (
+	reportText     = "text"
+	reportJSON     = "json"
+	reportMarkdown = "markdown"
+)
+
+// ReportConfig selects how the summary of a converged run is printed
+type ReportConfig struct {
+	// Format is text (default), the sentences of the summary; json, the summary as -results writes it, for downstream
+	// tools; or markdown, tables to paste into a paper or a lab notebook
+	Format string `json:"format" yaml:"format"`
+}
+
+func (c ReportConfig) validate() error {
+	return validateReportFormat(c.Format)
+}
+
+func validateReportFormat(format string) error {
+	switch format {
+	case "", reportText, reportJSON, reportMarkdown:
+		return nil
+	}
+	return fmt.Errorf("unknown report format %q, use %s, %s or %s", format, reportText, reportJSON, reportMarkdown)
+}
+
+// format returns the format of the summary, -report-format before the config
+func (c ReportConfig) format() string {
+	if *reportFormat != "" {
+		return *reportFormat
+	}
+	if c.Format == "" {
+		return reportText
+	}
+	return c.Format
+}
+
+// ParticipantResult is the last update of a participant of the run as the ledger has it
+type ParticipantResult struct {
+	Name     string  `json:"name"`
+	Lambda   float64 `json:"lambda"`
+	Mismatch float64 `json:"mismatch"`
+	// Iteration is the participant's iteration of the update, -1 if its payload doesn't tell
+	Iteration int `json:"iteration"`
+}
+
+// participantResults reads the last updates of all participants from GetLatestUpdates, none if the chaincode doesn't
+// have the function
+func participantResults(contract contractAPI) []ParticipantResult {
+	events, err := latestUpdates(contract, "")
+	if err != nil {
+		logger.Debugf("The final values of the participants are not in the summary: %v", err)
+		return nil
+	}
+	var participants []ParticipantResult
+	for _, e := range events {
+		if e.err != nil {
+			continue
+		}
+		participants = append(participants, ParticipantResult{Name: e.EventName, Lambda: e.update.Lambda, Mismatch: e.update.Mismatch, Iteration: e.update.Iteration})
+	}
+	return participants
+}
+
+// write writes the summary in the format
+func (r ResultSummary) write(w io.Writer, format string) error {
+	switch format {
+	case reportJSON:
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case reportMarkdown:
+		return r.writeMarkdown(w)
+	}
+	fmt.Fprintln(w, tr("Solving process ends at iteration %v.", r.Iterations))
+	fmt.Fprintln(w, tr("The optimal power generation is %.4f MW.", r.Power))
+	fmt.Fprintln(w, tr("The electricity price is $%.4f/MWh.", r.Price))
+	fmt.Fprintln(w, tr("The power mismatch is %.4f.", r.Mismatch))
+	fmt.Fprintln(w, tr("The solving is completed in %s.", r.Elapsed))
+	for _, p := range r.Participants {
+		fmt.Fprintln(w, tr("Participant %s: price $%.4f/MWh, mismatch %.4f.", p.Name, p.Lambda, p.Mismatch))
+	}
+	return nil
+}
+
+// writeMarkdown writes the summary as markdown tables: the result, the final values of the participants and the
+// timing of the phases of the iterations
+func (r ResultSummary) writeMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Run %s\n\n", r.Run)
+	b.WriteString("| | |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Organization | %s |\n", r.Organization)
+	fmt.Fprintf(&b, "| Iterations | %v |\n", r.Iterations)
+	fmt.Fprintf(&b, "| Power (MW) | %.4f |\n", r.Power)
+	fmt.Fprintf(&b, "| Price ($/MWh) | %.4f |\n", r.Price)
+	fmt.Fprintf(&b, "| Mismatch (MW) | %.4f |\n", r.Mismatch)
+	fmt.Fprintf(&b, "| Setpoint (MW) | %.4f |\n", r.Setpoint)
+	fmt.Fprintf(&b, "| Elapsed | %s |\n", r.Elapsed)
+	if len(r.Participants) > 0 {
+		b.WriteString("\n### Participants\n\n| Participant | Price ($/MWh) | Mismatch (MW) | Iteration |\n|---|---|---|---|\n")
+		for _, p := range r.Participants {
+			iteration := "-"
+			if p.Iteration >= 0 {
+				iteration = fmt.Sprint(p.Iteration)
+			}
+			fmt.Fprintf(&b, "| %s | %.4f | %.4f | %s |\n", p.Name, p.Lambda, p.Mismatch, iteration)
+		}
+	}
+	if len(r.Timing) > 0 {
+		b.WriteString("\n### Timing\n\n| Phase | Count | Mean | p50 | p90 | p99 | Max |\n|---|---|---|---|---|---|---|\n")
+		for _, phase := range timingPhases {
+			if t, ok := r.Timing[phase]; ok {
+				fmt.Fprintf(&b, "| %s | %v | %s | %s | %s | %s | %s |\n", phase, t.Count, t.Mean, t.P50, t.P90, t.P99, t.Max)
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
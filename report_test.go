@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportFormats(t *testing.T) {
+	r := ResultSummary{Organization: "Org1MSP", Run: "r1", Iterations: 42, Power: 120, Price: 6.5, Mismatch: 0.001, Elapsed: 3 * time.Second,
+		Participants: []ParticipantResult{{Name: "Org2", Lambda: 6.5, Mismatch: -0.002, Iteration: 41}, {Name: "Org3", Lambda: 6.5, Iteration: -1}}}
+	var text, markdown, data bytes.Buffer
+	if err := r.write(&text, reportText); err != nil || !strings.Contains(text.String(), "Participant Org3: price $6.5000/MWh") {
+		t.Errorf("got text %q: %v", text.String(), err)
+	}
+	if err := r.write(&markdown, reportMarkdown); err != nil || !strings.Contains(markdown.String(), "| Org2 | 6.5000 | -0.0020 | 41 |\n| Org3 | 6.5000 | 0.0000 | - |") {
+		t.Errorf("got markdown %q: %v", markdown.String(), err)
+	}
+	if err := r.write(&data, reportJSON); err != nil {
+		t.Fatal(err)
+	}
+	var decoded ResultSummary
+	if err := json.Unmarshal(data.Bytes(), &decoded); err != nil || len(decoded.Participants) != 2 || decoded.Iterations != 42 {
+		t.Errorf("got %+v from %s: %v", decoded, data.String(), err)
+	}
+	if err := validateReportFormat("html"); err == nil {
+		t.Error("the html format was accepted")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// the reputation of the neighboring organizations is kept here between runs
+const reputationFile = "reputation.json"
+
+var (
+	reputationTimeout = flag.Duration("reputation-timeout", 10*time.Second, "a neighbor update arriving later than this after our own update counts as untimely")
+	reputationMemory  = flag.Float64("reputation-memory", 0.8, "weight of the previous reputation score against the latest message, between 0 and 1")
+)
+
+// peerReputation is the reputation of one neighboring organization, identified by the name of its events
+type peerReputation struct {
+	Score       float64   `json:"score"`
+	Messages    int       `json:"messages"`
+	Implausible int       `json:"implausible"`
+	Late        int       `json:"late"`
+	LastSeen    time.Time `json:"lastSeen"`
+}
+
+// reputations scores neighbors on the plausibility and timeliness of their messages
+type reputations map[string]*peerReputation
+
+func loadReputations() reputations {
+	r := reputations{}
+	data, err := os.ReadFile(reputationFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warnf("Failed to read %s: %v", reputationFile, err)
+		}
+		return r
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		logger.Warnf("Failed to read %s, starting with fresh reputations: %v", reputationFile, err)
+		return reputations{}
+	}
+	return r
+}
+
+func (r reputations) save() error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(reputationFile, data, 0600)
+}
+
+// record scores one message of a peer, delay is the time since our own last update
+func (r reputations) record(peer string, plausible bool, delay time.Duration) {
+	p, ok := r[peer]
+	if !ok {
+		// new peers start with full trust
+		p = &peerReputation{Score: 1}
+		r[peer] = p
+	}
+	timely := delay <= *reputationTimeout
+	score := 0.0
+	if plausible {
+		score += 0.7
+	} else {
+		p.Implausible++
+	}
+	if timely {
+		score += 0.3
+	} else {
+		p.Late++
+	}
+	p.Messages++
+	p.LastSeen = time.Now()
+	p.Score = *reputationMemory*p.Score + (1-*reputationMemory)*score
+}
+
+// score returns the reputation of a peer, 1 for a peer not seen yet
+func (r reputations) score(peer string) float64 {
+	p, ok := r[peer]
+	if !ok {
+		return 1
+	}
+	return p.Score
+}
+
+// weight returns the consensus weight of a peer, 0.5 for a fully trusted peer in the two-node average
+func (r reputations) weight(peer string) float64 {
+	return 0.5 * r.score(peer)
+}
+
+// NeighborReputation is the reputation of a neighbor as the state of the run reports it
+type NeighborReputation struct {
+	Event string  `json:"event"`
+	Score float64 `json:"score"`
+	// Weight is the weight of the neighbor's updates in the iterations, its configured weight scaled by its score or
+	// half of its score in the two-node average
+	Weight      float64 `json:"weight"`
+	Messages    int     `json:"messages"`
+	Implausible int     `json:"implausible"`
+	Late        int     `json:"late"`
+}
+
+// neighbors returns the reputations of the configured neighbors and of every other peer seen, ordered by event name
+func (r reputations) neighbors(configured []Neighbor) []NeighborReputation {
+	weights := map[string]float64{}
+	for _, n := range configured {
+		weights[n.Event] = n.Weight * r.score(n.Event)
+	}
+	for peer := range r {
+		if _, ok := weights[peer]; !ok {
+			weights[peer] = r.weight(peer)
+		}
+	}
+	neighbors := make([]NeighborReputation, 0, len(weights))
+	for event, weight := range weights {
+		n := NeighborReputation{Event: event, Score: r.score(event), Weight: weight}
+		if p, ok := r[event]; ok {
+			n.Messages, n.Implausible, n.Late = p.Messages, p.Implausible, p.Late
+		}
+		neighbors = append(neighbors, n)
+	}
+	sort.Slice(neighbors, func(i, j int) bool { return neighbors[i].Event < neighbors[j].Event })
+	return neighbors
+}
+
+func (r reputations) String() string {
+	peers := make([]string, 0, len(r))
+	for peer := range r {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	s := ""
+	for _, peer := range peers {
+		p := r[peer]
+		s += fmt.Sprintf("%s: score %.2f, %v messages, %v implausible, %v late\n", peer, p.Score, p.Messages, p.Implausible, p.Late)
+	}
+	return s
+}
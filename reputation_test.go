@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNeighborReputations(t *testing.T) {
+	peers := reputations{}
+	peers.record("org2", false, time.Hour)
+	peers.record("org3", true, 0)
+	neighbors := peers.neighbors([]Neighbor{{Event: "org2", Weight: 0.3}, {Event: "org4", Weight: 0.2}})
+	if len(neighbors) != 3 {
+		t.Fatalf("got %+v", neighbors)
+	}
+	org2, org3, org4 := neighbors[0], neighbors[1], neighbors[2]
+	if org2.Event != "org2" || org2.Score >= 1 || org2.Weight != 0.3*org2.Score || org2.Implausible != 1 || org2.Late != 1 {
+		t.Errorf("configured neighbor: got %+v", org2)
+	}
+	// a peer that isn't configured counts in the two-node average
+	if org3.Event != "org3" || org3.Weight != 0.5*org3.Score || org3.Messages != 1 {
+		t.Errorf("peer: got %+v", org3)
+	}
+	if org4.Event != "org4" || org4.Score != 1 || org4.Weight != 0.2 || org4.Messages != 0 {
+		t.Errorf("neighbor not seen yet: got %+v", org4)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	resultsFile  = flag.String("results", "", "file the result of a converged run is written to, a row is appended to a .csv file, any other file gets the JSON summary")
+	recordResult = flag.Bool("record-result", true, "submit the result of a converged run to the ledger with RecordResult")
+)
+
+// resultFunction is the chaincode function that records the result of a converged run on the ledger, its arguments are
+// the power, the price, the mismatch, the iterations and the elapsed seconds
+const resultFunction = "RecordResult"
+
+// ResultSummary is the outcome of a converged run
+type ResultSummary struct {
+	Organization string    `json:"organization"`
+	Run          string    `json:"run"`
+	Time         time.Time `json:"time"`
+	Iterations   int       `json:"iterations"`
+	Power        float64   `json:"power"`
+	Price        float64   `json:"price"`
+	Mismatch     float64   `json:"mismatch"`
+	// Elapsed is a duration, nanoseconds in JSON, ElapsedSeconds is the same time in seconds
+	Elapsed        time.Duration `json:"elapsed"`
+	ElapsedSeconds float64       `json:"elapsedSeconds"`
+	// Setpoint is the power after the regulation bias, it equals Power without a regulation signal
+	Setpoint float64 `json:"setpoint"`
+	// Timing breaks the iterations down into their phases, it is left out of the .csv row
+	Timing map[string]PhaseTiming `json:"timing,omitempty"`
+	// Participants are the final values of all participants if the ledger has them, they are left out of the .csv row
+	Participants []ParticipantResult `json:"participants,omitempty"`
+}
+
+// print shows the summary to the user in the format of -report-format. The JSON summary is alone on stdout, unless
+// stdout carries the -progress stream
+func (r ResultSummary) print(format string) {
+	w := display()
+	if format == reportJSON && *progressFormat != progressNDJSON {
+		w = os.Stdout
+	}
+	if err := r.write(w, format); err != nil {
+		logger.Warnf("Failed to print the result: %v", err)
+	}
+}
+
+var resultColumns = []string{"organization", "time", "iterations", "power", "price", "mismatch", "elapsed_seconds", "setpoint"}
+
+// save writes the summary to the -results file
+func (r ResultSummary) save(path string) error {
+	if path == "" {
+		return nil
+	}
+	if !strings.EqualFold(filepath.Ext(path), ".csv") {
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, data, 0600)
+	}
+
+	_, err := os.Stat(path)
+	newFile := os.IsNotExist(err)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if newFile {
+		if err := w.Write(resultColumns); err != nil {
+			return err
+		}
+	}
+	err = w.Write([]string{
+		r.Organization,
+		r.Time.Format(time.RFC3339),
+		strconv.Itoa(r.Iterations),
+		formatValue(r.Power),
+		formatValue(r.Price),
+		formatValue(r.Mismatch),
+		formatValue(r.Elapsed.Seconds()),
+		formatValue(r.Setpoint),
+	})
+	if err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// record submits the result to the ledger, so the agreed dispatch can be audited there
+func (r ResultSummary) record(contract contractAPI) error {
+	if !*recordResult {
+		return nil
+	}
+	_, err := submitTransaction(contract, resultFunction, formatValue(r.Power), formatValue(r.Price), formatValue(r.Mismatch), strconv.Itoa(r.Iterations), formatValue(r.Elapsed.Seconds()))
+	return err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strconv"
+)
+
+// the rich-query functions of chaincodes backed by CouchDB, as in the ledger-queries sample
+const (
+	queryFunction          = "QueryAssets"
+	queryWithPagesFunction = "QueryAssetsWithPagination"
+)
+
+var (
+	pageSize = flag.Int("page-size", 0, "number of records per page of a rich query, 0 returns all records at once")
+	allPages = flag.Bool("all-pages", false, "fetch every page of a paginated rich query without asking")
+)
+
+// queryPage is one page of a paginated rich query
+type queryPage struct {
+	Records             json.RawMessage `json:"records"`
+	FetchedRecordsCount int             `json:"fetchedRecordsCount"`
+	Bookmark            string          `json:"bookmark"`
+}
+
+// richQuery sends a CouchDB selector query to the chaincode and prints the result, page by page if -page-size is set
+func richQuery(contract contractAPI, query string) error {
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(query), &parsed); err != nil {
+		return fmt.Errorf("the query is not valid JSON: %w", err)
+	}
+	if _, ok := parsed["selector"]; !ok {
+		return fmt.Errorf("the query has no selector")
+	}
+
+	if *pageSize <= 0 {
+		result, err := contract.EvaluateTransaction(chaincodeFunction(queryFunction), query)
+		if err != nil {
+			return fmt.Errorf("failed to run the query: %w", explainError(err))
+		}
+		fmt.Println(prettyResult(result))
+		return nil
+	}
+
+	bookmark := ""
+	for page := 1; ; page++ {
+		result, err := contract.EvaluateTransaction(chaincodeFunction(queryWithPagesFunction), query, strconv.Itoa(*pageSize), bookmark)
+		if err != nil {
+			return fmt.Errorf("failed to run the query: %w", explainError(err))
+		}
+		var p queryPage
+		if err := json.Unmarshal(result, &p); err != nil {
+			return fmt.Errorf("unexpected page format: %w", err)
+		}
+		fmt.Println("-> " + tr("Page %v (%v records)", page, p.FetchedRecordsCount))
+		fmt.Println(prettyResult(p.Records))
+
+		// the last page is shorter than the page size or has no bookmark to continue from
+		if p.FetchedRecordsCount < *pageSize || p.Bookmark == "" {
+			return nil
+		}
+		bookmark = p.Bookmark
+		if !confirm(tr("Next page? [y/n]"), *allPages) {
+			return nil
+		}
+	}
+}
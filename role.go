@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// the roles a node can take in the microgrid, selected with -role or role in the config
+const (
+	roleGenerator = "generator"
+	roleLoad      = "load"
+	roleStorage   = "storage"
+)
+
+var participantRole = flag.String("role", "", "part the node takes in the optimization: generator, load or storage (default: role of the config file, generator)")
+
+func validateRole(role string) error {
+	switch role {
+	case "", roleGenerator, roleLoad, roleStorage:
+		return nil
+	}
+	return fmt.Errorf("unknown role %q, use %s, %s or %s", role, roleGenerator, roleLoad, roleStorage)
+}
+
+// LoadModel describes a flexible load, which takes part with the negative power -D of its demand
+// the demand falls linearly as the price rises, with the given elasticity at the reference price
+type LoadModel struct {
+	// Demand is the demand in MW at the reference price
+	Demand float64 `json:"demand" yaml:"demand"`
+	// Price is the reference price
+	Price float64 `json:"price" yaml:"price"`
+	// Elasticity is the relative fall of the demand per relative rise of the price at the reference price, 0 for a fixed demand
+	Elasticity float64 `json:"elasticity" yaml:"elasticity"`
+	// MinDemand and MaxDemand are the limits of the demand in MW
+	MinDemand float64 `json:"minDemand" yaml:"minDemand"`
+	MaxDemand float64 `json:"maxDemand" yaml:"maxDemand"`
+}
+
+// defaultLoad is a 4 MW load at the price the default generator produces 4 MW at
+var defaultLoad = LoadModel{Demand: 4, Price: 6.4, Elasticity: 0.2, MaxDemand: 8}
+
+func (l LoadModel) validate() error {
+	if l.Demand < 0 || l.MinDemand < 0 {
+		return fmt.Errorf("the demand must not be negative")
+	}
+	if l.Elasticity < 0 {
+		return fmt.Errorf("the elasticity must not be negative, got %v", l.Elasticity)
+	}
+	if l.Elasticity > 0 && l.Price <= 0 {
+		return fmt.Errorf("an elastic load needs a positive reference price, got %v", l.Price)
+	}
+	if l.MaxDemand < l.MinDemand || l.Demand < l.MinDemand || l.Demand > l.MaxDemand {
+		return fmt.Errorf("the demand %v must lie within minDemand %v and maxDemand %v", l.Demand, l.MinDemand, l.MaxDemand)
+	}
+	return nil
+}
+
+// limits returns the power limits of the load, the negative limits of its demand
+func (l LoadModel) limits() powerLimits {
+	return powerLimits{Min: -l.MaxDemand, Max: 0 - l.MinDemand}
+}
+
+// demandCurve is the cost of a load, the utility of the demand D = -P it forgoes: its marginal cost at P is the price
+// at which the load would demand -P
+type demandCurve struct {
+	LoadModel
+}
+
+// slope is the fall of the demand per unit of price
+func (d demandCurve) slope() float64 {
+	return d.Elasticity * d.Demand / d.Price
+}
+
+func (d demandCurve) cost(P float64) float64 {
+	if d.slope() == 0 {
+		return d.Price * P
+	}
+	// the integral of the marginal cost from P = 0
+	return (d.Price+d.Demand/d.slope())*P + P*P/(2*d.slope())
+}
+
+func (d demandCurve) marginal(P float64) float64 {
+	if d.slope() == 0 {
+		return d.Price
+	}
+	return d.Price + (d.Demand+P)/d.slope()
+}
+
+func (d demandCurve) dispatch(lambda float64) float64 {
+	return -(d.Demand - d.slope()*(lambda-d.Price))
+}
+
+// role returns the role of the node, the generator unless another one is configured
+func (c Config) role() string {
+	if c.Role == "" {
+		return roleGenerator
+	}
+	return c.Role
+}
+
+// initialState returns the power and the mismatch a new run starts from: a load starts from its demand at the reference price,
+// which the other nodes have yet to cover
+func (c Config) initialState() (float64, float64) {
+	if c.role() == roleLoad {
+		return -c.Load.Demand, c.Load.Demand
+	}
+	return 0, 0
+}
+
+// participant returns the cost and the power limits of the node in its role
+func (c Config) participant() (costFunction, powerLimits) {
+	switch c.role() {
+	case roleLoad:
+		return demandCurve{c.Load}, c.Load.limits()
+	case roleStorage:
+		return c.Storage.cost(), c.Storage.limits()
+	}
+	return c.Generator.costFunction(), c.Generator.limits()
+}
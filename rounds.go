@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+// the policies for a neighbor that misses the deadline of a round
+const (
+	lateLast = "last"
+	lateSkip = "skip"
+)
+
+var (
+	roundTimeout = flag.Duration("round-timeout", 0, "longest time an iteration waits for the configured neighbors after the first of them reported, 0 waits for all of them")
+	latePolicy   = flag.String("late-policy", lateLast, "how a neighbor missing the -round-timeout counts: \""+lateLast+"\" uses its last known update, \""+lateSkip+"\" leaves it out of the iteration")
+)
+
+// validateLatePolicy checks the -late-policy flag
+func validateLatePolicy() error {
+	if *latePolicy != lateLast && *latePolicy != lateSkip {
+		return fmt.Errorf("unknown -late-policy %q, use %s or %s", *latePolicy, lateLast, lateSkip)
+	}
+	return nil
+}
+
+// roundDeadline fires when a round has been open for -round-timeout, so one slow or offline neighbor can't hold up the iteration
+type roundDeadline struct {
+	timer   *time.Timer
+	running bool
+}
+
+func newRoundDeadline() *roundDeadline {
+	return &roundDeadline{}
+}
+
+// C is the channel the deadline is delivered on, nil while no round is open or the deadline is disabled
+func (d *roundDeadline) C() <-chan time.Time {
+	if !d.running {
+		return nil
+	}
+	return d.timer.C
+}
+
+// start opens the round's deadline unless it is already running
+func (d *roundDeadline) start() {
+	if d.running || *roundTimeout <= 0 {
+		return
+	}
+	if d.timer == nil {
+		d.timer = time.NewTimer(*roundTimeout)
+	} else {
+		d.timer.Reset(*roundTimeout)
+	}
+	d.running = true
+}
+
+// stop ends the deadline once the round is complete, or after it fired
+func (d *roundDeadline) stop() {
+	if !d.running {
+		return
+	}
+	if !d.timer.Stop() {
+		select {
+		case <-d.timer.C:
+		default:
+		}
+	}
+	d.running = false
+}
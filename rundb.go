@@ -0,0 +1,436 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+var runsDatabase = flag.String("runs-db", "", "database every run is recorded in with its parameters, participants, iterations and transactions: a postgres:// URL or the file of a SQLite database (built with -tags sqlite); empty disables it")
+
+// the outcome of a run that hasn't ended, or whose process ended without saying how
+const runRunning = "running"
+
+// runStore keeps the runs in a SQLite or Postgres database, so the data of long experiments outlives the device
+type runStore struct {
+	db       *sql.DB
+	postgres bool
+}
+
+// openRunStore opens the database of the runs and creates its tables, nil if there is none
+func openRunStore(dsn string) (*runStore, error) {
+	if dsn == "" {
+		return nil, nil
+	}
+	s := &runStore{postgres: strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")}
+	driver := "postgres"
+	if !s.postgres {
+		driver = "sqlite3"
+		if !driverRegistered(driver) {
+			return nil, errors.New("this build has no SQLite, build with -tags sqlite or use a postgres:// URL")
+		}
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if !s.postgres {
+		// a SQLite file has a single writer, the connections would only wait for each other
+		db.SetMaxOpenConns(1)
+	}
+	s.db = db
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func driverRegistered(name string) bool {
+	for _, driver := range sql.Drivers() {
+		if driver == name {
+			return true
+		}
+	}
+	return false
+}
+
+// migrate creates the tables that don't exist yet, the statements are the same for both databases but for the types
+// of the run IDs and the times
+func (s *runStore) migrate() error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "TIMESTAMP"
+	if s.postgres {
+		id, timestamp = "BIGSERIAL PRIMARY KEY", "TIMESTAMPTZ"
+	}
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS runs (
+			id ` + id + `,
+			organization TEXT NOT NULL,
+			channel TEXT NOT NULL,
+			contract TEXT NOT NULL,
+			role TEXT NOT NULL,
+			algorithm TEXT NOT NULL,
+			parameters TEXT NOT NULL,
+			participants TEXT NOT NULL,
+			started ` + timestamp + ` NOT NULL,
+			finished ` + timestamp + `,
+			outcome TEXT NOT NULL,
+			iterations BIGINT NOT NULL DEFAULT 0,
+			lambda DOUBLE PRECISION NOT NULL DEFAULT 0,
+			mismatch DOUBLE PRECISION NOT NULL DEFAULT 0,
+			power DOUBLE PRECISION NOT NULL DEFAULT 0
+		)`,
+		`CREATE TABLE IF NOT EXISTS iterations (
+			run_id BIGINT NOT NULL REFERENCES runs(id),
+			iteration BIGINT NOT NULL,
+			time ` + timestamp + ` NOT NULL,
+			event TEXT NOT NULL,
+			block BIGINT NOT NULL,
+			lambda DOUBLE PRECISION NOT NULL,
+			mismatch DOUBLE PRECISION NOT NULL,
+			power DOUBLE PRECISION NOT NULL,
+			neighbor_lambda DOUBLE PRECISION NOT NULL,
+			neighbor_mismatch DOUBLE PRECISION NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS iterations_run ON iterations (run_id, iteration)`,
+		`CREATE TABLE IF NOT EXISTS transactions (
+			run_id BIGINT NOT NULL REFERENCES runs(id),
+			iteration BIGINT NOT NULL,
+			time ` + timestamp + ` NOT NULL,
+			function TEXT NOT NULL,
+			tx_id TEXT NOT NULL,
+			error TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS transactions_run ON transactions (run_id, iteration)`,
+	}
+	for _, statement := range statements {
+		if _, err := s.db.Exec(statement); err != nil {
+			return fmt.Errorf("failed to create the tables of the runs: %w", err)
+		}
+	}
+	return nil
+}
+
+// bind numbers the ? placeholders of a statement for Postgres, SQLite takes them as they are
+func (s *runStore) bind(query string) string {
+	if !s.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (s *runStore) close() {
+	if s == nil {
+		return
+	}
+	if err := s.db.Close(); err != nil {
+		logger.Warnf("Failed to close the database of the runs: %v", err)
+	}
+}
+
+// storedRun is a run of the database
+type storedRun struct {
+	ID           int64
+	Organization string
+	Channel      string
+	Contract     string
+	Role         string
+	Algorithm    string
+	// Parameters and Participants are JSON: the models and the algorithm, the organization and its neighbors
+	Parameters   string
+	Participants string
+	Started      time.Time
+	Finished     sql.NullTime
+	// Outcome is converged, the reason a run was shut down, or running
+	Outcome    string
+	Iterations int
+	Lambda     float64
+	Mismatch   float64
+	Power      float64
+}
+
+const runColumns = "id, organization, channel, contract, role, algorithm, parameters, participants, started, finished, outcome, iterations, lambda, mismatch, power"
+
+func scanRun(row interface{ Scan(...interface{}) error }) (storedRun, error) {
+	var r storedRun
+	err := row.Scan(&r.ID, &r.Organization, &r.Channel, &r.Contract, &r.Role, &r.Algorithm, &r.Parameters, &r.Participants,
+		&r.Started, &r.Finished, &r.Outcome, &r.Iterations, &r.Lambda, &r.Mismatch, &r.Power)
+	return r, err
+}
+
+// runRecorder writes a run to the database, in the background so the optimization never waits for it
+type runRecorder struct {
+	store  *runStore
+	id     int64
+	writes chan func() error
+	done   chan struct{}
+}
+
+// begin records the start of a run, nil if there is no database or the run can't be recorded
+func (s *runStore) begin(run storedRun) *runRecorder {
+	if s == nil {
+		return nil
+	}
+	var id int64
+	err := s.db.QueryRow(s.bind(`INSERT INTO runs (organization, channel, contract, role, algorithm, parameters, participants, started, outcome)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+		run.Organization, run.Channel, run.Contract, run.Role, run.Algorithm, run.Parameters, run.Participants, run.Started.UTC(), runRunning).Scan(&id)
+	if err != nil {
+		logger.Warnf("Failed to record the run in the database: %v", err)
+		return nil
+	}
+	logger.Infof("Recording the run as run %v", id)
+	r := &runRecorder{store: s, id: id, writes: make(chan func() error, 256), done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		for write := range r.writes {
+			if err := write(); err != nil {
+				logger.Warnf("Failed to record run %v in the database: %v", r.id, err)
+			}
+		}
+	}()
+	return r
+}
+
+// iteration records an iteration of the run
+func (r *runRecorder) iteration(record iterationRecord) {
+	if r == nil {
+		return
+	}
+	r.writes <- func() error {
+		_, err := r.store.db.Exec(r.store.bind(`INSERT INTO iterations (run_id, iteration, time, event, block, lambda, mismatch, power, neighbor_lambda, neighbor_mismatch)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+			r.id, record.Iteration, record.Time.UTC(), record.Event, int64(record.Block), record.Lambda, record.Mismatch, record.P, record.NeighborLambda, record.NeighborMismatch)
+		return err
+	}
+}
+
+// transaction records the transaction of a submission, a failed one with its error
+func (r *runRecorder) transaction(s *submitResult) {
+	if r == nil {
+		return
+	}
+	failure := ""
+	if s.err != nil {
+		failure = explainError(s.err).Error()
+	}
+	iteration, name, txID, at := s.iteration, s.name, s.txID, time.Now().UTC()
+	r.writes <- func() error {
+		_, err := r.store.db.Exec(r.store.bind(`INSERT INTO transactions (run_id, iteration, time, function, tx_id, error) VALUES (?, ?, ?, ?, ?, ?)`),
+			r.id, iteration, at, name, txID, failure)
+		return err
+	}
+}
+
+// finish records how the run ended and waits until everything is written
+func (r *runRecorder) finish(outcome string, iteration int, lambda, mismatch, P float64) {
+	if r == nil {
+		return
+	}
+	finished := time.Now().UTC()
+	r.writes <- func() error {
+		_, err := r.store.db.Exec(r.store.bind(`UPDATE runs SET finished = ?, outcome = ?, iterations = ?, lambda = ?, mismatch = ?, power = ? WHERE id = ?`),
+			finished, outcome, iteration, lambda, mismatch, P, r.id)
+		return err
+	}
+	close(r.writes)
+	<-r.done
+}
+
+// recordRun records the start of the agent's run with the parameters and participants of its config
+func (a *Agent) recordRun(store *runStore, started time.Time) *runRecorder {
+	if store == nil {
+		return nil
+	}
+	parameters := map[string]interface{}{"algorithm": a.cfg.Algorithm, "generator": a.cfg.Generator}
+	switch a.cfg.role() {
+	case roleLoad:
+		parameters["load"] = a.cfg.Load
+	case roleStorage:
+		parameters["storage"] = a.cfg.Storage
+	}
+	participants := map[string]interface{}{"organization": a.cfg.MSPID, "neighbors": a.cfg.Neighbors}
+	algorithm := a.cfg.Algorithm.Name
+	if algorithm == "" {
+		algorithm = algorithmConsensus
+	}
+	return store.begin(storedRun{
+		Organization: a.cfg.MSPID,
+		Channel:      a.cfg.NetworkName,
+		Contract:     a.cfg.ContractName,
+		Role:         a.cfg.role(),
+		Algorithm:    algorithm,
+		Parameters:   marshalRunField(parameters),
+		Participants: marshalRunField(participants),
+		Started:      started,
+	})
+}
+
+func marshalRunField(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+const runsUsage = "usage: runs list [--last <n>] | runs show <id> [--iterations] [--transactions]"
+
+// runsCommand lists the recorded runs or shows one of them
+func runsCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(runsUsage)
+	}
+	if *runsDatabase == "" {
+		return errors.New("no database of the runs, set -runs-db")
+	}
+	store, err := openRunStore(*runsDatabase)
+	if err != nil {
+		return err
+	}
+	defer store.close()
+	switch args[0] {
+	case "list":
+		flags := flag.NewFlagSet("runs list", flag.ContinueOnError)
+		last := flags.Int("last", 20, "only the last n runs, 0 for all")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		return store.list(*last)
+	case "show":
+		if len(args) < 2 {
+			return errors.New(runsUsage)
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid run ID %q", args[1])
+		}
+		flags := flag.NewFlagSet("runs show", flag.ContinueOnError)
+		iterations := flags.Bool("iterations", true, "print the iterations of the run")
+		transactions := flags.Bool("transactions", true, "print the transactions of the run")
+		if err := flags.Parse(args[2:]); err != nil {
+			return err
+		}
+		return store.show(id, *iterations, *transactions)
+	}
+	return errors.New(runsUsage)
+}
+
+// list prints the last runs, oldest first
+func (s *runStore) list(last int) error {
+	query := "SELECT " + runColumns + " FROM runs ORDER BY id DESC"
+	if last > 0 {
+		query += " LIMIT " + strconv.Itoa(last)
+	}
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var runs []storedRun
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return err
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		fmt.Println(runs[i])
+	}
+	return nil
+}
+
+func (r storedRun) String() string {
+	return fmt.Sprintf("%-5v %s  %s on %s/%s  %s (%s)  %s after %v iterations  lambda %s  P %s",
+		r.ID, r.Started.Local().Format(time.RFC3339), r.Organization, r.Channel, r.Contract, r.Role, r.Algorithm,
+		r.Outcome, r.Iterations, formatValue(r.Lambda), formatValue(r.Power))
+}
+
+// show prints a run with its parameters, and its iterations and transactions if asked for
+func (s *runStore) show(id int64, iterations, transactions bool) error {
+	run, err := scanRun(s.db.QueryRow(s.bind("SELECT "+runColumns+" FROM runs WHERE id = ?"), id))
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no run %v", id)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(run)
+	if run.Finished.Valid {
+		fmt.Printf("finished:     %s (%s)\n", run.Finished.Time.Local().Format(time.RFC3339), run.Finished.Time.Sub(run.Started).Round(time.Millisecond))
+	}
+	fmt.Printf("mismatch:     %s\n", formatValue(run.Mismatch))
+	fmt.Printf("parameters:   %s\n", run.Parameters)
+	fmt.Printf("participants: %s\n", run.Participants)
+	if iterations {
+		rows, err := s.db.Query(s.bind(`SELECT iteration, time, event, block, lambda, mismatch, power, neighbor_lambda, neighbor_mismatch
+			FROM iterations WHERE run_id = ? ORDER BY iteration`), id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		fmt.Println("iterations:")
+		for rows.Next() {
+			var r iterationRecord
+			var block int64
+			if err := rows.Scan(&r.Iteration, &r.Time, &r.Event, &block, &r.Lambda, &r.Mismatch, &r.P, &r.NeighborLambda, &r.NeighborMismatch); err != nil {
+				return err
+			}
+			fmt.Printf("  %-5v %s  %s (block %v)  lambda %s  mismatch %s  P %s  neighbors lambda %s mismatch %s\n",
+				r.Iteration, r.Time.Local().Format(time.RFC3339), r.Event, block, formatValue(r.Lambda), formatValue(r.Mismatch),
+				formatValue(r.P), formatValue(r.NeighborLambda), formatValue(r.NeighborMismatch))
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	if transactions {
+		rows, err := s.db.Query(s.bind(`SELECT iteration, time, function, tx_id, error FROM transactions WHERE run_id = ? ORDER BY time`), id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		fmt.Println("transactions:")
+		for rows.Next() {
+			var iteration int
+			var at time.Time
+			var function, txID, failure string
+			if err := rows.Scan(&iteration, &at, &function, &txID, &failure); err != nil {
+				return err
+			}
+			outcome := "ok"
+			if failure != "" {
+				outcome = "FAILED: " + failure
+			}
+			if txID == "" {
+				txID = "-"
+			}
+			fmt.Printf("  %-5v %s  %s  tx %s  %s\n", iteration, at.Local().Format(time.RFC3339), function, txID, outcome)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
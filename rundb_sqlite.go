@@ -0,0 +1,7 @@
+//go:build sqlite
+// +build sqlite
+
+package main
+
+// the SQLite driver needs cgo, so it is only built in with -tags sqlite
+import _ "github.com/mattn/go-sqlite3"
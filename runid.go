@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"time"
+)
+
+var runID = flag.String("run-id", "", "ID of the run the node takes part in, updates of other runs are discarded (default: a new time-ordered ID, the node follows the newest run of its neighbors)")
+
+// newRunID returns a random UUID of version 7, which starts with the time in milliseconds, so the text of a later ID
+// sorts after that of an earlier one
+func newRunID() string {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixMilli())<<16)
+	if _, err := rand.Read(id[6:]); err != nil {
+		logger.Warnf("Failed to make a random run ID: %v", err)
+	}
+	id[6] = id[6]&0x0f | 0x70
+	id[8] = id[8]&0x3f | 0x80
+	text := hex.EncodeToString(id[:])
+	return fmt.Sprintf("%s-%s-%s-%s-%s", text[:8], text[8:12], text[12:16], text[16:20], text[20:])
+}
+
+// runTracker keeps the ID of the run the node takes part in. The nodes that start a run together make their IDs
+// independently, the one that started last has the newest and the others follow it, while the updates of the older
+// runs, e.g. of a run that was aborted, are discarded. An ID given with -run-id is kept
+type runTracker struct {
+	id    string
+	fixed bool
+}
+
+func newRunTracker() *runTracker {
+	if *runID != "" {
+		return &runTracker{id: *runID, fixed: true}
+	}
+	return &runTracker{id: newRunID()}
+}
+
+// admit tells why an update of another run is discarded, an update without an ID is from a node that doesn't send
+// one and is admitted. followed is true when the node follows the newer run of the update from now on
+func (r *runTracker) admit(id string) (followed bool, err error) {
+	if id == "" || id == r.id {
+		return false, nil
+	}
+	if r.fixed || id < r.id {
+		return false, fmt.Errorf("the update is of run %s, this node takes part in run %s", id, r.id)
+	}
+	r.id = id
+	return true, nil
+}
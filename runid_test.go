@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunTrackerFollowsTheNewestRun(t *testing.T) {
+	older := newRunID()
+	time.Sleep(2 * time.Millisecond)
+	runs := newRunTracker()
+	if len(runs.id) != 36 || runs.id <= older {
+		t.Fatalf("run ID %s doesn't sort after the earlier %s", runs.id, older)
+	}
+	if _, err := runs.admit(older); err == nil {
+		t.Errorf("an update of an older run was admitted")
+	}
+	if followed, err := runs.admit(""); followed || err != nil {
+		t.Errorf("an update without a run ID was not admitted: %v", err)
+	}
+	newer := runs.id[:35] + "z"
+	update, err := decodePayload(`{"version":2,"lambda":6.4,"mismatch":-0.5,"run":"` + newer + `"}`)
+	if err != nil || update.Run != newer {
+		t.Fatalf("the run of the envelope decoded as %q, %v", update.Run, err)
+	}
+	if followed, err := runs.admit(update.Run); !followed || err != nil || runs.id != newer {
+		t.Errorf("the newer run %s was not followed: %v", newer, err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StateSnapshot is the state of an agent's optimization at one point, as GET /state reports it
+type StateSnapshot struct {
+	Name      string  `json:"name,omitempty"`
+	Iteration int     `json:"iteration"`
+	Lambda    float64 `json:"lambda"`
+	Mismatch  float64 `json:"mismatch"`
+	P         float64 `json:"p"`
+	// Terminate is set once the node has converged and the barrier lets it leave the run
+	Terminate bool `json:"terminate"`
+	// Neighbors are the reputations of the neighbors and the weights of their updates
+	Neighbors []NeighborReputation `json:"neighbors,omitempty"`
+	Updated   time.Time            `json:"updated"`
+}
+
+// State is the state of an agent's optimization. The loop of the run publishes it after every change and the APIs,
+// the metrics and the dashboard read it while the loop runs: a snapshot is stored as a whole, so a reader never sees
+// the price of one iteration with the power of another
+type State struct {
+	name  string
+	value atomic.Value
+}
+
+func newState(name string) *State {
+	s := &State{name: name}
+	s.value.Store(StateSnapshot{Name: name, Updated: time.Now()})
+	return s
+}
+
+// Snapshot returns the state last published
+func (s *State) Snapshot() StateSnapshot {
+	return s.value.Load().(StateSnapshot)
+}
+
+// publish replaces the state, only the loop of the agent's run writes it
+func (s *State) publish(iter int, lambda, mismatch, P float64, terminate bool, neighbors []NeighborReputation) {
+	s.value.Store(StateSnapshot{Name: s.name, Iteration: iter, Lambda: lambda, Mismatch: mismatch, P: P, Terminate: terminate, Neighbors: neighbors, Updated: time.Now()})
+}
+
+// stateRegistry keeps the states of the agents of the process, by name
+type stateRegistry struct {
+	mu     sync.Mutex
+	agents map[string]*State
+}
+
+var states = &stateRegistry{agents: map[string]*State{}}
+
+// agent returns the state of the named agent, the only agent of a process has no name
+func (r *stateRegistry) agent(name string) *State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.agents[name]
+	if !ok {
+		s = newState(name)
+		r.agents[name] = s
+	}
+	return s
+}
+
+// snapshots returns the states of all agents, ordered by name
+func (r *stateRegistry) snapshots() []StateSnapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snapshots := make([]StateSnapshot, 0, len(r.agents))
+	for _, s := range r.agents {
+		snapshots = append(snapshots, s.Snapshot())
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Name < snapshots[j].Name })
+	return snapshots
+}
+
+// observe publishes the state of the run and the neighbors' reputations after a change, the metrics and the API
+// status are updated from it
+func (a *Agent) observe(iter int, lambda, mismatch, P float64, terminate bool, peers reputations) {
+	a.state.publish(iter, lambda, mismatch, P, terminate, peers.neighbors(a.cfg.Neighbors))
+	observeState(a.state.Snapshot())
+}
+
+// handleState answers GET /state with the snapshots of the agents of the process
+func handleState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, states.snapshots())
+}
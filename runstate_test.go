@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestStateSnapshot(t *testing.T) {
+	s := newState("org1")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 1000; i++ {
+			s.publish(i, float64(i), -float64(i), 2*float64(i), i == 1000, nil)
+		}
+	}()
+	for {
+		snapshot := s.Snapshot()
+		if snapshot.Lambda != float64(snapshot.Iteration) || snapshot.P != 2*snapshot.Lambda {
+			t.Fatalf("torn snapshot %+v", snapshot)
+		}
+		select {
+		case <-done:
+			if snapshot = s.Snapshot(); !snapshot.Terminate || snapshot.Name != "org1" {
+				t.Errorf("got %+v after the last iteration", snapshot)
+			}
+			return
+		default:
+		}
+	}
+}
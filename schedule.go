@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// the day-ahead dispatch is committed here, one power value per hour
+const committedScheduleFile = "committed_schedule.json"
+
+const (
+	modeDayAhead = "dayahead"
+	modeRealTime = "realtime"
+)
+
+var (
+	operatingMode    = flag.String("mode", modeDayAhead, "operating mode: \"dayahead\" commits the converged power to the schedule, \"realtime\" penalizes deviations from it")
+	scheduleHour     = flag.Int("schedule-hour", -1, "hour of the committed schedule this run belongs to (default: the current hour)")
+	deviationPenalty = flag.Float64("deviation-penalty", 1, "weight rho of the penalty rho/2*(P-Pc)^2 for deviating from the committed power Pc in realtime mode")
+)
+
+// committedSchedule maps the hour of the day to the committed power
+type committedSchedule map[string]float64
+
+// runHour returns the hour of the schedule the current run belongs to
+func runHour() int {
+	if *scheduleHour >= 0 {
+		return *scheduleHour
+	}
+	return time.Now().Hour()
+}
+
+func loadCommittedSchedule() (committedSchedule, error) {
+	schedule := committedSchedule{}
+	data, err := os.ReadFile(committedScheduleFile)
+	if os.IsNotExist(err) {
+		return schedule, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &schedule)
+	return schedule, err
+}
+
+// commitPower stores the day-ahead result of the given hour
+func commitPower(hour int, P float64) error {
+	schedule, err := loadCommittedSchedule()
+	if err != nil {
+		return err
+	}
+	schedule[strconv.Itoa(hour)] = P
+	data, err := json.MarshalIndent(schedule, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(committedScheduleFile, data, 0600)
+}
+
+// committedPower returns the day-ahead result of the given hour
+func committedPower(hour int) (float64, error) {
+	schedule, err := loadCommittedSchedule()
+	if err != nil {
+		return 0, err
+	}
+	P, ok := schedule[strconv.Itoa(hour)]
+	if !ok {
+		return 0, fmt.Errorf("no committed power for hour %v in %s", hour, committedScheduleFile)
+	}
+	return P, nil
+}
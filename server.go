@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var serveAddr = flag.String("serve", "", "address (e.g. :8080) of an HTTP API to monitor and control the optimization, which then waits for POST /start instead of the prompt")
+
+// the states of the optimization reported by GET /status
+const (
+	stateWaiting   = "waiting"
+	stateRunning   = "running"
+	stateConverged = "converged"
+	stateStopped   = "stopped"
+)
+
+// apiStatus is the answer of GET /status
+type apiStatus struct {
+	State     string  `json:"state"`
+	Reason    string  `json:"reason,omitempty"`
+	Iteration int     `json:"iteration"`
+	Lambda    float64 `json:"lambda"`
+	Mismatch  float64 `json:"mismatch"`
+	P         float64 `json:"p"`
+	// Neighbors are the reputations of the neighbors, as in the state of the run
+	Neighbors []NeighborReputation `json:"neighbors,omitempty"`
+	Started   *time.Time           `json:"started,omitempty"`
+	Updated   time.Time            `json:"updated"`
+}
+
+// apiServer lets the device be monitored and controlled over HTTP or gRPC instead of the prompts
+type apiServer struct {
+	mu sync.Mutex
+	// status is how far the run is, the values of its iteration are read from state
+	status  apiStatus
+	state   *State
+	history *historyRing
+	start   chan struct{}
+	// controls carries the commands of the running optimization, like the lines typed on stdin
+	controls chan string
+	// subscribers receive the status after every iteration, they are closed when the run has ended
+	subscribers map[chan apiStatus]struct{}
+	ended       bool
+	// watchers receive every progress record, for the dashboard
+	watchers map[chan map[string]interface{}]struct{}
+	stats    *connectionStats
+	// access checks the roles of the clients, nil lets every client do everything
+	access *accessControl
+}
+
+// api is the HTTP and gRPC API, nil unless -serve or -grpc-addr is set
+var api *apiServer
+
+// startAPI serves the APIs in the background if -serve or -grpc-addr is set, to the clients the access config allows.
+// They report the state of the run and its history
+func startAPI(state *State, history *historyRing, config AccessConfig) (*apiServer, error) {
+	if *serveAddr == "" && *grpcAddr == "" {
+		return nil, nil
+	}
+	access, err := newAccessControl(config)
+	if err != nil {
+		return nil, err
+	}
+	s := &apiServer{
+		access:      access,
+		status:      apiStatus{State: stateWaiting, Updated: time.Now()},
+		state:       state,
+		history:     history,
+		start:       make(chan struct{}),
+		controls:    make(chan string, 1),
+		subscribers: map[chan apiStatus]struct{}{},
+		watchers:    map[chan map[string]interface{}]struct{}{},
+	}
+	if *serveAddr != "" {
+		s.serveHTTP()
+	}
+	if *grpcAddr != "" {
+		s.serveGRPC()
+	}
+	return s, nil
+}
+
+func (s *apiServer) serveHTTP() {
+	mux := http.NewServeMux()
+	// viewers read the run, only operators start and stop it; the health checks stay open for the probes
+	mux.HandleFunc("/status", s.access.require(accessViewer, s.handleStatus))
+	mux.HandleFunc("/history", s.access.require(accessViewer, s.handleHistory))
+	mux.HandleFunc("/state", s.access.require(accessViewer, handleState))
+	mux.HandleFunc("/start", s.access.require(accessOperator, s.handleStart))
+	mux.HandleFunc("/stop", s.access.require(accessOperator, s.handleControl("exit")))
+	mux.HandleFunc("/estop", s.access.require(accessOperator, s.handleControl("estop")))
+	mux.HandleFunc("/", s.access.require(accessViewer, s.handleDashboard))
+	mux.HandleFunc("/live", s.access.require(accessViewer, s.handleLive))
+	mux.HandleFunc("/events", s.access.require(accessViewer, s.handleEvents))
+	handleHealth(mux)
+	server := &http.Server{Addr: *serveAddr, Handler: mux, TLSConfig: s.access.tlsConfig()}
+	go func() {
+		logger.Infof("Serving the API on %s", *serveAddr)
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil {
+			logger.Warnf("API stopped: %v", err)
+		}
+	}()
+}
+
+// waitStart blocks until the optimization is started over the API, false if the agent is stopped first
+func (s *apiServer) waitStart() bool {
+	if *serveAddr != "" {
+		fmt.Fprintln(display(), "-> "+tr("Waiting for POST /start on %s", *serveAddr))
+	} else {
+		fmt.Fprintln(display(), "-> "+tr("Waiting for StartOptimization on %s", *grpcAddr))
+	}
+	ctx, stop := shutdownContext()
+	defer stop()
+	select {
+	case <-s.start:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// observe hands the status to the subscribers once the run has published its state
+func (s *apiServer) observe() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.publish()
+}
+
+// current returns the status with the values of the iteration the run published last, the caller holds mu
+func (s *apiServer) current() apiStatus {
+	status := s.status
+	if s.state == nil {
+		return status
+	}
+	snapshot := s.state.Snapshot()
+	status.Iteration, status.Lambda, status.Mismatch, status.P = snapshot.Iteration, snapshot.Lambda, snapshot.Mismatch, snapshot.P
+	status.Neighbors = snapshot.Neighbors
+	if snapshot.Updated.After(status.Updated) {
+		status.Updated = snapshot.Updated
+	}
+	return status
+}
+
+// finished records how the run ended, an empty reason means it converged
+func (s *apiServer) finished(reason string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.State, s.status.Reason = stateConverged, reason
+	if reason != "" {
+		s.status.State = stateStopped
+	}
+	s.status.Updated = time.Now()
+	s.publish()
+	for ch := range s.subscribers {
+		close(ch)
+	}
+	s.subscribers, s.ended = nil, true
+}
+
+// publish hands the status to the subscribers, one that doesn't keep up misses updates rather than holding up the optimization
+func (s *apiServer) publish() {
+	status := s.current()
+	for ch := range s.subscribers {
+		select {
+		case ch <- status:
+		default:
+		}
+	}
+}
+
+// subscribe returns the current status followed by the status after every iteration until the run has ended
+func (s *apiServer) subscribe() (<-chan apiStatus, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch := make(chan apiStatus, eventBufferSize)
+	ch <- s.current()
+	if s.ended {
+		close(ch)
+		return ch, func() {}
+	}
+	s.subscribers[ch] = struct{}{}
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// begin starts the optimization waiting for it, it fails if the optimization is not waiting
+func (s *apiServer) begin() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status.State != stateWaiting {
+		// a finished run is not started again, the agent is restarted for the next one
+		return errors.New("the optimization is " + s.status.State)
+	}
+	now := time.Now()
+	s.status.State, s.status.Started, s.status.Updated = stateRunning, &now, now
+	close(s.start)
+	return nil
+}
+
+// control passes a command to the running optimization, it fails if the optimization is not running
+func (s *apiServer) control(command string) error {
+	s.mu.Lock()
+	state := s.status.State
+	s.mu.Unlock()
+	if state != stateRunning {
+		return errors.New("the optimization is " + state)
+	}
+	select {
+	case s.controls <- command:
+		return nil
+	default:
+		return errors.New("a command is already pending")
+	}
+}
+
+func (s *apiServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.Lock()
+	status := s.current()
+	s.mu.Unlock()
+	writeJSON(w, status)
+}
+
+func (s *apiServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.history.snapshot())
+}
+
+func (s *apiServer) handleStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.begin(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleControl passes a command to the running optimization
+func (s *apiServer) handleControl(command string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := s.control(command); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Warnf("Failed to write the API response: %v", err)
+	}
+}
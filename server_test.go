@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testServer is an API waiting for the start, as startAPI makes it without serving
+func testServer() *apiServer {
+	return &apiServer{
+		status:      apiStatus{State: stateWaiting, Updated: time.Now()},
+		state:       newState(""),
+		history:     newHistoryRing(10),
+		start:       make(chan struct{}),
+		controls:    make(chan string, 1),
+		subscribers: map[chan apiStatus]struct{}{},
+		watchers:    map[chan map[string]interface{}]struct{}{},
+	}
+}
+
+// post sends the request to the handler and returns the status code
+func post(handler http.HandlerFunc, method, path string) int {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(method, path, nil))
+	return w.Code
+}
+
+func TestControlAPI(t *testing.T) {
+	s := testServer()
+	stop, estop := s.handleControl("exit"), s.handleControl("estop")
+	if code := post(s.handleStart, http.MethodGet, "/start"); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /start: got %v", code)
+	}
+	if code := post(stop, http.MethodGet, "/stop"); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /stop: got %v", code)
+	}
+	if code := post(stop, http.MethodPost, "/stop"); code != http.StatusConflict {
+		t.Errorf("/stop while waiting: got %v", code)
+	}
+	if code := post(s.handleStart, http.MethodPost, "/start"); code != http.StatusAccepted {
+		t.Fatalf("/start: got %v", code)
+	}
+	select {
+	case <-s.start:
+	default:
+		t.Error("/start didn't start the optimization")
+	}
+	if code := post(s.handleStart, http.MethodPost, "/start"); code != http.StatusConflict {
+		t.Errorf("/start twice: got %v", code)
+	}
+	if code := post(stop, http.MethodPost, "/stop"); code != http.StatusAccepted {
+		t.Errorf("/stop while running: got %v", code)
+	}
+	// the run hasn't taken the first command yet
+	if code := post(estop, http.MethodPost, "/estop"); code != http.StatusConflict {
+		t.Errorf("a second pending command: got %v", code)
+	}
+	if command := <-s.controls; command != "exit" {
+		t.Errorf("the run got %q", command)
+	}
+	s.finished("exit command")
+	if code := post(estop, http.MethodPost, "/estop"); code != http.StatusConflict {
+		t.Errorf("/estop after the run: got %v", code)
+	}
+}
+
+func TestStatusReadsTheState(t *testing.T) {
+	s := testServer()
+	s.state.publish(7, 6.5, 0.25, 3, false, []NeighborReputation{{Event: "Org2", Score: 1, Weight: 0.5}})
+	w := httptest.NewRecorder()
+	s.handleStatus(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var status apiStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.State != stateWaiting || status.Iteration != 7 || status.Lambda != 6.5 || status.P != 3 || len(status.Neighbors) != 1 {
+		t.Errorf("got %+v", status)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// settlementFunction is the chaincode function a settlement is submitted with, its arguments are the run, the power,
+// the price, the hours, the energy and the amount
+const settlementFunction = "SubmitSettlement"
+
+var (
+	settle           = flag.Bool("settle", false, "submit the settlement of a converged run to the ledger with SubmitSettlement")
+	settlementReport = flag.String("settlement-report", "", "file the settlement of a converged run is appended to, a row of a .csv file or a JSON line for any other file")
+	settlementHours  = flag.Float64("settlement-hours", 1, "hours the converged power is delivered for at the price, the length of the dispatch period")
+)
+
+// Settlement is what a participant is paid or pays for the converged dispatch of a run at the consensus price
+type Settlement struct {
+	Organization string    `json:"organization"`
+	Run          string    `json:"run"`
+	Role         string    `json:"role"`
+	Time         time.Time `json:"time"`
+	Power        float64   `json:"power"`
+	Price        float64   `json:"price"`
+	Hours        float64   `json:"hours"`
+	// Energy is the energy in MWh the node delivers, negative for the energy it consumes
+	Energy float64 `json:"energy"`
+	// Amount is the money the node is paid for its energy at the price, negative for what it pays
+	Amount float64 `json:"amount"`
+	// Cost is the cost of the node's power over the hours, of its cost function
+	Cost float64 `json:"cost"`
+	// Surplus is the amount less the cost, the profit of a generator
+	Surplus float64 `json:"surplus"`
+}
+
+// settleResult prices the converged power of the result, delivered for -settlement-hours
+func settleResult(r ResultSummary, role string, cost costFunction) Settlement {
+	hours := *settlementHours
+	s := Settlement{
+		Organization: r.Organization,
+		Run:          r.Run,
+		Role:         role,
+		Time:         r.Time,
+		Power:        r.Power,
+		Price:        r.Price,
+		Hours:        hours,
+		Energy:       r.Power * hours,
+		Cost:         cost.cost(r.Power) * hours,
+	}
+	s.Amount = s.Price * s.Energy
+	s.Surplus = s.Amount - s.Cost
+	return s
+}
+
+func (s Settlement) print() {
+	if s.Amount >= 0 {
+		fmt.Fprintln(display(), tr("Settlement: %.4f MWh delivered at $%.4f/MWh, $%.4f received.", s.Energy, s.Price, s.Amount))
+	} else {
+		fmt.Fprintln(display(), tr("Settlement: %.4f MWh consumed at $%.4f/MWh, $%.4f paid.", -s.Energy, s.Price, -s.Amount))
+	}
+}
+
+// settled reports, records and submits the settlement as the flags ask
+func (s Settlement) settled(contract contractAPI) {
+	if !*settle && *settlementReport == "" {
+		return
+	}
+	s.print()
+	progress("settlement", map[string]interface{}{"energy": s.Energy, "price": s.Price, "amount": s.Amount, "surplus": s.Surplus})
+	if err := s.save(*settlementReport); err != nil {
+		logger.Warnf("Failed to write the settlement report: %v", err)
+	}
+	if !*settle {
+		return
+	}
+	args := []string{s.Run, formatValue(s.Power), formatValue(s.Price), formatValue(s.Hours), formatValue(s.Energy), formatValue(s.Amount)}
+	if _, err := submitTransaction(contract, settlementFunction, args...); err != nil {
+		logger.Warnf("Failed to submit the settlement: %s", explainError(err))
+	}
+}
+
+var settlementColumns = []string{"organization", "run", "role", "time", "power", "price", "hours", "energy", "amount", "cost", "surplus"}
+
+// save appends the settlement to the report
+func (s Settlement) save(path string) error {
+	if path == "" {
+		return nil
+	}
+	_, err := os.Stat(path)
+	newFile := os.IsNotExist(err)
+	f, err := os.OpenFile(filepath.Clean(path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if !strings.EqualFold(filepath.Ext(path), ".csv") {
+		data, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(append(data, '\n'))
+		return err
+	}
+	w := csv.NewWriter(f)
+	if newFile {
+		if err := w.Write(settlementColumns); err != nil {
+			return err
+		}
+	}
+	err = w.Write([]string{
+		s.Organization,
+		s.Run,
+		s.Role,
+		s.Time.Format(time.RFC3339),
+		formatValue(s.Power),
+		formatValue(s.Price),
+		formatValue(s.Hours),
+		formatValue(s.Energy),
+		formatValue(s.Amount),
+		formatValue(s.Cost),
+		formatValue(s.Surplus),
+	})
+	if err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSettlement(t *testing.T) {
+	defer func(s bool) { *settle = s }(*settle)
+	*settle = true
+	r := ResultSummary{Organization: "Org1MSP", Run: "run", Power: 2, Price: 10}
+	s := settleResult(r, roleGenerator, costCurve{A: 1, B: 2})
+	if s.Energy != 2 || s.Amount != 20 || s.Cost != 8 || s.Surplus != 12 {
+		t.Errorf("settlement = %+v", s)
+	}
+	contract := &mockContract{}
+	s.settled(contract)
+	if len(contract.calls) != 1 || contract.calls[0].name != settlementFunction || !reflect.DeepEqual(contract.calls[0].args, []string{"run", "2", "10", "1", "2", "20"}) {
+		t.Errorf("the settlement was submitted as %+v", contract.calls)
+	}
+}
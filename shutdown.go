@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var shutdownStateFile = flag.String("shutdown-state", "shutdown_state.json", "file the optimization state is written to when the agent is stopped mid-run, empty to skip it")
+
+// optimizationState is the state of a run that has not converged
+type optimizationState struct {
+	Iteration int       `json:"iteration"`
+	Lambda    float64   `json:"lambda"`
+	Mismatch  float64   `json:"mismatch"`
+	P         float64   `json:"p"`
+	Islanded  bool      `json:"islanded,omitempty"`
+	Time      time.Time `json:"time"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// shutdownContext is cancelled on SIGINT or SIGTERM, so the agent can unregister and close the gateway before it exits
+func shutdownContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// saveOptimizationState writes the state of an interrupted run to the -shutdown-state file
+func saveOptimizationState(state optimizationState) error {
+	if *shutdownStateFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*shutdownStateFile, data, 0600)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dlclark/regexp2"
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+var (
+	signedUpdates = flag.Bool("signed-updates", false, "sign the lambda and mismatch of every update with the wallet key and drop the neighbors' updates whose signature doesn't verify against the certificate of the neighbor")
+	sealMaxAge    = flag.Duration("seal-max-age", 10*time.Minute, "with -signed-updates, drop the neighbors' updates signed longer ago than this, or this far in the future")
+)
+
+// the field of a version 1 payload the chaincode echoes the seal of an update in, the third argument of SendUpdate
+const sealPattern = `(?<=Signature=)[0-9]+\.-?[0-9]+\.[A-Za-z0-9+/=]*\.[A-Za-z0-9+/=]+`
+
+// sealedMessage is what the seal of an update signs: its values, the run and the period it belongs to, so it can't be
+// tagged with another, and the time stamp, which keeps an old update from being replayed
+func sealedMessage(lambda, mismatch, run string, period int, stamp int64) []byte {
+	return []byte(fmt.Sprintf("Lambda=%s, Mismatch=%s, Run=%s, Period=%d, Time=%d", lambda, mismatch, run, period, stamp))
+}
+
+// updateArgs returns the arguments of SendUpdate of the run and period, with -signed-updates the seal
+// "<time>.<period>.<run in base64>.<signature>" follows the values
+// an update that can't be signed is sent without a seal, the neighbors drop it rather than the node stopping
+func updateArgs(gw *gatewayConnection, lambda, mismatch float64, run string, period int) []string {
+	args := []string{formatValue(lambda), formatValue(mismatch)}
+	if !*signedUpdates {
+		return args
+	}
+	stamp := time.Now().UnixNano()
+	digest := sha256.Sum256(sealedMessage(sealText(args[0]), sealText(args[1]), run, period, stamp))
+	signature, err := gw.sign(digest[:])
+	if err != nil {
+		logger.Warnf("Failed to sign the update, it is sent without a signature: %v", err)
+		return args
+	}
+	return append(args, formatSeal(stamp, period, run, signature))
+}
+
+// formatSeal writes the seal of an update as the neighbors read it
+func formatSeal(stamp int64, period int, run string, signature []byte) string {
+	return strings.Join([]string{strconv.FormatInt(stamp, 10), strconv.Itoa(period), base64.StdEncoding.EncodeToString([]byte(run)), base64.StdEncoding.EncodeToString(signature)}, ".")
+}
+
+// updateVerifier checks the seals of the neighbors' updates against their certificates
+type updateVerifier struct {
+	keys map[string]interface{}
+	// latest is the time stamp of each neighbor's latest update, an older one is a replay
+	latest map[string]int64
+}
+
+// newUpdateVerifier reads the certificates of the neighbors, nil unless -signed-updates is set
+func newUpdateVerifier(neighbors []Neighbor) (*updateVerifier, error) {
+	if !*signedUpdates {
+		return nil, nil
+	}
+	if len(neighbors) == 0 {
+		return nil, errors.New("-signed-updates needs the neighbors and their certificates in the config")
+	}
+	v := &updateVerifier{keys: map[string]interface{}{}, latest: map[string]int64{}}
+	for _, n := range neighbors {
+		if n.Certificate == "" {
+			return nil, fmt.Errorf("neighbor %s has no certificate to verify its updates with", n.Event)
+		}
+		pem, err := os.ReadFile(filepath.Clean(n.Certificate))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the certificate of neighbor %s: %w", n.Event, err)
+		}
+		certificate, err := identity.CertificateFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate of neighbor %s: %w", n.Event, err)
+		}
+		if err := checkCertificateKey(certificate); err != nil {
+			return nil, fmt.Errorf("invalid certificate of neighbor %s: %w", n.Event, err)
+		}
+		v.keys[n.Event] = certificate.PublicKey
+	}
+	return v, nil
+}
+
+// verify fails unless the update carries a valid seal of its lambda and mismatch by the neighbor, signed within
+// -seal-max-age. The run and period of the seal have to be those of the payload, which takes them from the seal if it
+// doesn't tell them itself
+func (v *updateVerifier) verify(name string, update *updatePayload) error {
+	if v == nil {
+		return nil
+	}
+	key, ok := v.keys[name]
+	if !ok {
+		return fmt.Errorf("no certificate for %s", name)
+	}
+	seal := update.Seal
+	if seal == "" {
+		return errors.New("the update is not signed")
+	}
+	parts := strings.Split(seal, ".")
+	if len(parts) != 4 {
+		return fmt.Errorf("invalid seal %q", seal)
+	}
+	stamp, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid time stamp %q", parts[0])
+	}
+	period, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return fmt.Errorf("invalid period %q", parts[1])
+	}
+	run, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("invalid run: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	digest := sha256.Sum256(sealedMessage(update.lambdaText, update.mismatchText, string(run), period, stamp))
+	if !verifySignature(key, digest[:], signature) {
+		return errors.New("the signature doesn't match the certificate of the neighbor")
+	}
+	if update.Run != "" && update.Run != string(run) {
+		return fmt.Errorf("the update is tagged with run %s, it was signed for run %s", update.Run, run)
+	}
+	if update.Period >= 0 && update.Period != period {
+		return fmt.Errorf("the update is tagged with period %v, it was signed for period %v", update.Period, period)
+	}
+	signed := time.Unix(0, stamp)
+	if age := time.Since(signed); *sealMaxAge > 0 && (age > *sealMaxAge || age < -*sealMaxAge) {
+		return fmt.Errorf("the update was signed at %s, not within -seal-max-age %v", signed.Format(time.RFC3339Nano), *sealMaxAge)
+	}
+	update.Run, update.Period = string(run), period
+	if stamp <= v.latest[name] {
+		return fmt.Errorf("the update was signed at %s, not after the latest one of the neighbor, it is a replay", time.Unix(0, stamp).Format(time.RFC3339Nano))
+	}
+	v.latest[name] = stamp
+	return nil
+}
+
+// verifySignature checks a signature of the digest the way the signers of the gateway produce it
+func verifySignature(key interface{}, digest, signature []byte) bool {
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest, signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, digest, signature)
+	}
+	return false
+}
+
+// payloadField returns the first match of the pattern in the payload, empty if there is none
+func payloadField(pattern, payload string) string {
+	reg, err := regexp2.Compile(pattern, 0)
+	if err != nil {
+		return ""
+	}
+	match, _ := reg.FindStringMatch(payload)
+	if match == nil {
+		return ""
+	}
+	return match.String()
+}
+
+// checkCertificateKey fails for a certificate whose key the seals can't be verified with
+func checkCertificateKey(certificate *x509.Certificate) error {
+	switch certificate.PublicKey.(type) {
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+		return nil
+	}
+	return fmt.Errorf("unsupported key type %T", certificate.PublicKey)
+}
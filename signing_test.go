@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+	"time"
+)
+
+// sealUpdate signs the values of the run and period with the key the way updateArgs does, the payload tells neither
+func sealUpdate(t *testing.T, key *ecdsa.PrivateKey, lambda, mismatch, run string, period int, stamp int64) updatePayload {
+	t.Helper()
+	digest := sha256.Sum256(sealedMessage(lambda, mismatch, run, period, stamp))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return updatePayload{lambdaText: lambda, mismatchText: mismatch, Period: -1, Seal: formatSeal(stamp, period, run, signature)}
+}
+
+func TestUpdateVerifier(t *testing.T) {
+	neighbor, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UnixNano()
+	v := &updateVerifier{keys: map[string]interface{}{"Org2": &neighbor.PublicKey}, latest: map[string]int64{}}
+	first := sealUpdate(t, neighbor, "6.1", "-0.2", "run-2", 3, now)
+	if err := v.verify("Org2", &first); err != nil {
+		t.Fatalf("a valid seal was refused: %v", err)
+	}
+	if first.Run != "run-2" || first.Period != 3 {
+		t.Errorf("the run and period of the seal weren't taken over: %+v", first)
+	}
+	forged := sealUpdate(t, other, "6.1", "-0.2", "run-2", 3, now+1)
+	if err := v.verify("Org2", &forged); err == nil {
+		t.Error("a seal of another key was accepted")
+	}
+	replayed := sealUpdate(t, neighbor, "6.1", "-0.2", "run-2", 3, now)
+	if err := v.verify("Org2", &replayed); err == nil {
+		t.Error("a replayed seal was accepted")
+	}
+	stale := sealUpdate(t, neighbor, "6.1", "-0.2", "run-2", 3, now-1)
+	if err := v.verify("Org2", &stale); err == nil {
+		t.Error("a stale time stamp was accepted")
+	}
+	// an update of an earlier run, replayed into a new one whose verifier has seen nothing yet
+	earlier := sealUpdate(t, neighbor, "6.1", "-0.2", "run-1", 3, now-int64(2**sealMaxAge))
+	if err := (&updateVerifier{keys: v.keys, latest: map[string]int64{}}).verify("Org2", &earlier); err == nil {
+		t.Error("an update signed before -seal-max-age was accepted")
+	}
+	retagged := sealUpdate(t, neighbor, "6.1", "-0.2", "run-2", 3, now+2)
+	retagged.Period = 4
+	if err := v.verify("Org2", &retagged); err == nil {
+		t.Error("an update tagged with another period was accepted")
+	}
+	retagged = sealUpdate(t, neighbor, "6.1", "-0.2", "run-2", 3, now+3)
+	retagged.Run = "run-3"
+	if err := v.verify("Org2", &retagged); err == nil {
+		t.Error("an update tagged with another run was accepted")
+	}
+	altered := sealUpdate(t, neighbor, "6.1", "-0.2", "run-2", 3, now+4)
+	altered.lambdaText = "6.10"
+	if err := v.verify("Org2", &altered); err == nil {
+		t.Error("an altered lambda text was accepted")
+	}
+	unsealed := updatePayload{lambdaText: "6.1", mismatchText: "-0.2"}
+	if err := v.verify("Org2", &unsealed); err == nil {
+		t.Error("an update without a seal was accepted")
+	}
+	unknown := sealUpdate(t, neighbor, "6.1", "-0.2", "run-2", 3, now+5)
+	if err := v.verify("Org3", &unknown); err == nil {
+		t.Error("an update of a neighbor without a certificate was accepted")
+	}
+	newer := sealUpdate(t, neighbor, "6.2", "-0.1", "run-2", 3, now+6)
+	newer.Run, newer.Period = "run-2", 3
+	if err := v.verify("Org2", &newer); err != nil {
+		t.Errorf("a newer valid seal was refused: %v", err)
+	}
+}
+
+func TestSealInTextPayload(t *testing.T) {
+	seal := formatSeal(time.Now().UnixNano(), -1, "0190a1b2-c3d4-7e5f-8a9b-0c1d2e3f4a5b", []byte{1, 2, 3})
+	if got := payloadField(sealPattern, "Lambda=6.1, Mismatch=-0.2, Signature="+seal+", "); got != seal {
+		t.Errorf("read the seal %q from the payload, want %q", got, seal)
+	}
+}
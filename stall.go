@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"time"
+)
+
+var (
+	iterationTimeout = flag.Duration("iteration-timeout", 2*time.Minute, "time to wait for the next neighbor event before the iteration counts as stalled, 0 waits forever")
+	stallReregister  = flag.Bool("stall-reregister", true, "register the event listener again after a stall")
+	stallLimit       = flag.Int("stall-limit", 5, "consecutive stalls after which the run is aborted")
+)
+
+// stallDetector fires when no event arrived for -iteration-timeout, other wake-ups of the loop such as commands don't reset it
+type stallDetector struct {
+	timer    *time.Timer
+	timeouts int
+}
+
+// newStallDetector starts the timeout, it never fires if -iteration-timeout is 0
+func newStallDetector() *stallDetector {
+	d := &stallDetector{}
+	if *iterationTimeout > 0 {
+		d.timer = time.NewTimer(*iterationTimeout)
+	}
+	return d
+}
+
+// C is the channel the timeout is delivered on, nil when disabled
+func (d *stallDetector) C() <-chan time.Time {
+	if d.timer == nil {
+		return nil
+	}
+	return d.timer.C
+}
+
+// received restarts the timeout after an event
+func (d *stallDetector) received() {
+	d.timeouts = 0
+	d.restart()
+}
+
+// stalled counts a timeout and restarts it, it returns true once -stall-limit timeouts happened in a row
+func (d *stallDetector) stalled() bool {
+	d.timeouts++
+	d.restart()
+	return d.timeouts >= *stallLimit
+}
+
+func (d *stallDetector) restart() {
+	if d.timer == nil {
+		return
+	}
+	if !d.timer.Stop() {
+		// the timer may have fired without being received, drain it so Reset starts clean
+		select {
+		case <-d.timer.C:
+		default:
+		}
+	}
+	d.timer.Reset(*iterationTimeout)
+}
+
+func (d *stallDetector) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
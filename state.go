@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// the read-only functions of the asset-transfer chaincode used for the state commands
+const (
+	readAssetFunction    = "ReadAsset"
+	getAllAssetsFunction = "GetAllAssets"
+)
+
+// getAsset reads one key of the world state, the query is evaluated on a peer and creates no transaction
+func getAsset(contract contractAPI, key string) ([]byte, error) {
+	result, err := contract.EvaluateTransaction(chaincodeFunction(readAssetFunction), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, explainError(err))
+	}
+	return result, nil
+}
+
+// getAllAssets reads every asset of the world state
+func getAllAssets(contract contractAPI) ([]byte, error) {
+	result, err := contract.EvaluateTransaction(chaincodeFunction(getAllAssetsFunction))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read all assets: %w", explainError(err))
+	}
+	return result, nil
+}
+
+// prettyResult indents a JSON result and leaves anything else as it is
+func prettyResult(data []byte) string {
+	if !json.Valid(data) {
+		return string(data)
+	}
+	return formatJSON(data)
+}
+
+// stateCommand runs "state get <key>", "state all" and "state query <selector>"
+func stateCommand(contract contractAPI, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: state get <key> | state all | state query <selector>")
+	}
+	var result []byte
+	var err error
+	switch args[0] {
+	case "get":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: state get <key>")
+		}
+		result, err = getAsset(contract, args[1])
+	case "all":
+		result, err = getAllAssets(contract)
+	case "query":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: state query '{\"selector\":{...}}'")
+		}
+		return richQuery(contract, args[1])
+	default:
+		return fmt.Errorf("unknown state command %q, use get, all or query", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(prettyResult(result))
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+var quiet = flag.Bool("quiet", false, "no live status line on the terminal during a run")
+
+// statusWindow is the number of recent iterations the contraction rate of the mismatch is estimated from
+const statusWindow = 10
+
+// statusConsole is stderr with the live status line of a run at its bottom: a log entry clears the line, is written
+// and the line is drawn again below it, so the two don't run into each other
+type statusConsole struct {
+	mu   sync.Mutex
+	line string
+}
+
+var console = &statusConsole{}
+
+func (c *statusConsole) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.line != "" {
+		os.Stderr.WriteString("\r\033[K")
+	}
+	n, err := os.Stderr.Write(p)
+	if c.line != "" {
+		os.Stderr.WriteString(c.line)
+	}
+	return n, err
+}
+
+func (c *statusConsole) Sync() error {
+	return nil
+}
+
+// show replaces the status line
+func (c *statusConsole) show(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.line = line
+	os.Stderr.WriteString("\r\033[K" + line)
+}
+
+// clear removes the status line, e.g. before the summary of the run is printed
+func (c *statusConsole) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.line != "" {
+		os.Stderr.WriteString("\r\033[K")
+		c.line = ""
+	}
+}
+
+// statusLine shows the progress of a run on the terminal: the iteration, the mismatch, the iterations and the time
+// it is estimated to take until convergence and the time elapsed. It is nil without a terminal or with -quiet
+type statusLine struct {
+	start      time.Time
+	epsilon    float64
+	mismatches []float64
+	drawn      time.Time
+}
+
+// newStatusLine returns the status line of a run, if stderr is a terminal the log is written to as text
+func newStatusLine(start time.Time, epsilon float64) *statusLine {
+	if *quiet || *logFormat != "text" || !terminal(os.Stderr) {
+		return nil
+	}
+	return &statusLine{start: start, epsilon: epsilon}
+}
+
+func terminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// update shows the iteration, redrawn at most every 100 ms so fast runs don't flood the terminal
+func (s *statusLine) update(iter int, mismatch float64) {
+	if s == nil {
+		return
+	}
+	s.mismatches = append(s.mismatches, math.Abs(mismatch))
+	if len(s.mismatches) > statusWindow {
+		s.mismatches = s.mismatches[1:]
+	}
+	if time.Since(s.drawn) < 100*time.Millisecond {
+		return
+	}
+	s.drawn = time.Now()
+	elapsed := time.Since(s.start)
+	eta := "estimating"
+	if remaining, ok := iterationsToConvergence(s.mismatches, s.epsilon); ok {
+		perIteration := elapsed / time.Duration(iter)
+		eta = fmt.Sprintf("~%v iterations (%s)", remaining, (time.Duration(remaining) * perIteration).Round(time.Second))
+	} else if len(s.mismatches) >= 3 {
+		eta = "not contracting"
+	}
+	console.show(fmt.Sprintf("iteration %v  |mismatch| %s  converging in %s  elapsed %s", iter, formatValue(math.Abs(mismatch)), eta, elapsed.Round(time.Second)))
+}
+
+// done removes the status line at the end of the run
+func (s *statusLine) done() {
+	if s == nil {
+		return
+	}
+	console.clear()
+}
+
+// iterationsToConvergence estimates the iterations until the absolute mismatch falls below epsilon from its average
+// contraction over the recent iterations, false while it doesn't contract
+func iterationsToConvergence(mismatches []float64, epsilon float64) (int, bool) {
+	n := len(mismatches)
+	if n < 3 || epsilon <= 0 {
+		return 0, false
+	}
+	first, last := mismatches[0], mismatches[n-1]
+	if last < epsilon {
+		return 0, true
+	}
+	if first <= 0 || last >= first {
+		return 0, false
+	}
+	rate := math.Pow(last/first, 1/float64(n-1))
+	return int(math.Ceil(math.Log(epsilon/last) / math.Log(rate))), true
+}
@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestIterationsToConvergence(t *testing.T) {
+	if _, ok := iterationsToConvergence([]float64{1, 0.5}, 0.01); ok {
+		t.Error("estimated from two iterations")
+	}
+	if _, ok := iterationsToConvergence([]float64{1, 2, 4}, 0.01); ok {
+		t.Error("estimated a growing mismatch")
+	}
+	// the mismatch halves every iteration, from 0.25 it takes 5 more to fall below 0.01
+	if n, ok := iterationsToConvergence([]float64{1, 0.5, 0.25}, 0.01); !ok || n != 5 {
+		t.Errorf("got %v iterations, %v", n, ok)
+	}
+}
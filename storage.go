@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var storageStateFile = flag.String("storage-state", "storage_state.json", "file a battery keeps its state of charge in between runs, one per operating mode; empty starts every run from the soc of the config")
+
+// StorageModel describes a battery, which discharges with a positive power and charges with a negative one
+// the state of charge limits how much it can charge or discharge over the dispatch interval
+type StorageModel struct {
+	// Capacity is the energy content in MWh between an empty and a full battery
+	Capacity float64 `json:"capacity" yaml:"capacity"`
+	// SoC is the state of charge at the start of the run, a fraction of the capacity, until one has been kept by a run
+	SoC float64 `json:"soc" yaml:"soc"`
+	// SoCMin and SoCMax are the limits of the state of charge
+	SoCMin float64 `json:"socMin" yaml:"socMin"`
+	SoCMax float64 `json:"socMax" yaml:"socMax"`
+	// MaxCharge and MaxDischarge are the power limits in MW at the grid connection
+	MaxCharge    float64 `json:"maxCharge" yaml:"maxCharge"`
+	MaxDischarge float64 `json:"maxDischarge" yaml:"maxDischarge"`
+	// ChargeEfficiency is the share of the charging power that is stored, DischargeEfficiency the share of the stored energy
+	// that reaches the grid when discharging
+	ChargeEfficiency    float64 `json:"chargeEfficiency" yaml:"chargeEfficiency"`
+	DischargeEfficiency float64 `json:"dischargeEfficiency" yaml:"dischargeEfficiency"`
+	// Interval is the duration in hours the dispatched power is held for
+	Interval float64 `json:"interval" yaml:"interval"`
+	// Value is the price of the stored energy, the battery discharges above it and charges below it, less the losses
+	Value float64 `json:"value" yaml:"value"`
+	// A is the coefficient of the wear cost a*P^2
+	A float64 `json:"a" yaml:"a"`
+}
+
+// defaultStorage is a 4 MWh battery at half charge that charges and discharges 2 MW for an hour
+var defaultStorage = StorageModel{
+	Capacity: 4, SoC: 0.5, SoCMin: 0.1, SoCMax: 0.9, MaxCharge: 2, MaxDischarge: 2,
+	ChargeEfficiency: 0.95, DischargeEfficiency: 0.95, Interval: 1, Value: 6.4, A: 0.8,
+}
+
+func (s StorageModel) validate() error {
+	if s.Capacity <= 0 {
+		return fmt.Errorf("the capacity must be positive, got %v", s.Capacity)
+	}
+	if s.SoCMin < 0 || s.SoCMax > 1 || s.SoCMin > s.SoCMax {
+		return fmt.Errorf("the limits of the state of charge must satisfy 0 <= socMin <= socMax <= 1, got %v and %v", s.SoCMin, s.SoCMax)
+	}
+	if s.SoC < 0 || s.SoC > 1 {
+		return fmt.Errorf("the state of charge must lie between 0 and 1, got %v", s.SoC)
+	}
+	if s.MaxCharge < 0 || s.MaxDischarge < 0 {
+		return fmt.Errorf("the power limits must not be negative")
+	}
+	if s.ChargeEfficiency <= 0 || s.ChargeEfficiency > 1 || s.DischargeEfficiency <= 0 || s.DischargeEfficiency > 1 {
+		return fmt.Errorf("the efficiencies must lie in (0, 1], got %v and %v", s.ChargeEfficiency, s.DischargeEfficiency)
+	}
+	if s.Interval <= 0 {
+		return fmt.Errorf("the interval must be positive, got %v", s.Interval)
+	}
+	// the dispatch step divides by the slope of the marginal cost
+	if s.A <= 0 {
+		return fmt.Errorf("the wear cost coefficient a must be positive, got %v", s.A)
+	}
+	return nil
+}
+
+// limits returns the power the battery can charge and discharge over the interval without leaving the limits of the state of charge
+// a state of charge outside the limits only lets the battery move back towards them
+func (s StorageModel) limits() powerLimits {
+	discharge := math.Max(0, (s.SoC-s.SoCMin)*s.Capacity*s.DischargeEfficiency/s.Interval)
+	charge := math.Max(0, (s.SoCMax-s.SoC)*s.Capacity/(s.ChargeEfficiency*s.Interval))
+	return powerLimits{Min: -math.Min(s.MaxCharge, charge), Max: math.Min(s.MaxDischarge, discharge)}
+}
+
+// after returns the state of charge at the end of the interval the power P is held for
+func (s StorageModel) after(P float64) float64 {
+	energy := P * s.Interval
+	if P > 0 {
+		return s.SoC - energy/s.DischargeEfficiency/s.Capacity
+	}
+	return s.SoC - energy*s.ChargeEfficiency/s.Capacity
+}
+
+// cost returns the wear cost together with the value of the stored energy the power takes or gives
+func (s StorageModel) cost() costFunction {
+	return batteryCost{a: s.A, discharge: s.Value / s.DischargeEfficiency, charge: s.Value * s.ChargeEfficiency}
+}
+
+// batteryCost is the cost a*P^2 + discharge*P of discharging and a*P^2 + charge*P of charging, the losses between the
+// two prices make the battery idle while the price lies between them
+type batteryCost struct {
+	a, discharge, charge float64
+}
+
+func (b batteryCost) cost(P float64) float64 {
+	if P > 0 {
+		return b.a*P*P + b.discharge*P
+	}
+	return b.a*P*P + b.charge*P
+}
+
+func (b batteryCost) marginal(P float64) float64 {
+	if P > 0 {
+		return 2*b.a*P + b.discharge
+	}
+	if P < 0 {
+		return 2*b.a*P + b.charge
+	}
+	// between the prices of charging and discharging, the price at which the battery starts either
+	return (b.charge + b.discharge) / 2
+}
+
+func (b batteryCost) dispatch(lambda float64) float64 {
+	switch {
+	case lambda > b.discharge:
+		return (lambda - b.discharge) / (2 * b.a)
+	case lambda < b.charge:
+		return (lambda - b.charge) / (2 * b.a)
+	}
+	return 0
+}
+
+// storageStates are the states of charge kept between runs by operating mode: the day-ahead runs plan the hours
+// one after the other, the real-time runs follow the battery as it is operated
+type storageStates map[string]storageState
+
+type storageState struct {
+	SoC  float64   `json:"soc"`
+	Time time.Time `json:"time"`
+}
+
+func loadStorageStates() (storageStates, error) {
+	states := storageStates{}
+	data, err := os.ReadFile(filepath.Clean(*storageStateFile))
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &states)
+	return states, err
+}
+
+// resumeStorage returns the battery with the state of charge the last run of the operating mode left it in
+func resumeStorage(model StorageModel) StorageModel {
+	if *storageStateFile == "" {
+		return model
+	}
+	states, err := loadStorageStates()
+	if err != nil {
+		logger.Warnf("Failed to read %s, starting from the configured state of charge: %v", *storageStateFile, err)
+		return model
+	}
+	if state, ok := states[*operatingMode]; ok {
+		model.SoC = state.SoC
+		logger.Infof("Continuing from the state of charge %.3f of %s", state.SoC, state.Time.Format(time.RFC3339))
+	}
+	return model
+}
+
+// keepStorage stores the state of charge the battery reaches with the converged power, for the next run of the operating mode
+func keepStorage(model StorageModel, P float64) error {
+	if *storageStateFile == "" {
+		return nil
+	}
+	states, err := loadStorageStates()
+	if err != nil {
+		return err
+	}
+	states[*operatingMode] = storageState{SoC: model.after(P), Time: time.Now()}
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*storageStateFile, data, 0600)
+}
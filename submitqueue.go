@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+var (
+	submitQueueSize = flag.Int("submit-queue", 16, "updates waiting to be submitted, the optimization waits for the queue when it is full")
+	submitInterval  = flag.Duration("submit-interval", 0, "shortest time between two update transactions, the updates queue up in between; 0 submits them as fast as they commit")
+	submitBatch     = flag.Int("submit-batch", 1, "largest number of queued updates submitted together in one SendUpdateBatch transaction, 1 submits every update on its own")
+)
+
+// batchFunction is the chaincode function of several updates in one transaction, its arguments are those of the updates
+// one after the other; its event lists the updates in the same order, each like the payload of SendUpdate, separated by ';'
+const batchFunction = "SendUpdateBatch"
+
+// submission is an update waiting in the queue, with the state that is checkpointed once it is committed
+type submission struct {
+	name      string
+	args      []string
+	iteration int
+	// run is the ID of the run the update belongs to, for the {run} of the argument template and the binary payload
+	run   string
+	state optimizationState
+	// event is the event the update was computed from, it is checkpointed with it so a resumed run continues after it
+	event *client.ChaincodeEvent
+	// trace is the trace of the iteration the update was computed in, nil for a transaction outside the pipeline
+	trace context.Context
+	// updates are the updates a SendUpdateBatch submission sends
+	updates []*submission
+}
+
+// submitResult reports a submission that was committed or failed for good
+type submitResult struct {
+	*submission
+	txID string
+	// result is the response of the chaincode
+	result []byte
+	err    error
+	// started is when the submission left the queue, ordered when the orderer accepted its transaction and finished
+	// when it was committed; ordered is zero if the transaction never reached the orderer
+	started, ordered, finished time.Time
+	// superseded is set with -commit-wait async for an invalidated update that isn't submitted again because the update
+	// of a later iteration was ordered meanwhile
+	superseded bool
+}
+
+// submitQueue submits the updates in order on a worker of its own, so the optimization goes on receiving events
+// while an update waits for its commit or is retried
+type submitQueue struct {
+	jobs    chan *submission
+	results chan *submitResult
+	// reconnects asks the optimization for a new connection when the network is unreachable, the worker retries on it
+	reconnects chan struct{}
+	// commits are the ordered transactions waiting for their commit with -commit-wait async, nil otherwise
+	commits chan *pendingCommit
+	// inflight counts the submissions whose result is not in results yet
+	inflight sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+	// own remembers the transactions of the updates, so their events are not taken for a neighbor's
+	own *ownTransactions
+	// period is the period of a -forecast run the updates are sent with SendPeriodUpdate for, -1 for a single period
+	period int
+
+	// held is a submission taken from the queue that didn't fit the last batch, it is submitted next
+	held *submission
+	// last is when the last transaction was submitted, for -submit-interval
+	last time.Time
+
+	mu       sync.Mutex
+	gw       *gatewayConnection
+	contract *client.Contract
+}
+
+func newSubmitQueue(own *ownTransactions, gw *gatewayConnection, contract *client.Contract, size, period int) *submitQueue {
+	if size < 1 {
+		size = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	// the results never outnumber the queue, the batch in progress and the update held back from it,
+	// so the worker doesn't wait for them to be read
+	results := size + *submitBatch + 1
+	if *commitWait == commitWaitAsync {
+		// and the batches waiting for their commit, with the one whose commit is awaited
+		results += (size + 1) * *submitBatch
+	}
+	q := &submitQueue{
+		jobs:       make(chan *submission, size),
+		results:    make(chan *submitResult, results),
+		reconnects: make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+		own:        own,
+		period:     period,
+		gw:         gw,
+		contract:   contract,
+	}
+	if *commitWait == commitWaitAsync {
+		q.commits = make(chan *pendingCommit, size)
+		go q.commitLoop()
+	}
+	go q.run()
+	return q
+}
+
+// enqueue adds an update to the queue, it waits while the queue is full
+func (q *submitQueue) enqueue(s *submission) {
+	q.inflight.Add(1)
+	select {
+	case q.jobs <- s:
+	default:
+		logger.Warnf("The submission queue is full, waiting before queueing the update of iteration %v", s.iteration)
+		q.jobs <- s
+	}
+	queueDepth.WithLabelValues("submit").Set(float64(len(q.jobs)))
+}
+
+// C returns the channel of the results, in the order of the submissions
+func (q *submitQueue) C() <-chan *submitResult {
+	return q.results
+}
+
+// wait returns the results of all submissions not read from C yet, after waiting for the ones still in the queue
+func (q *submitQueue) wait() []*submitResult {
+	q.inflight.Wait()
+	var results []*submitResult
+	for {
+		select {
+		case r := <-q.results:
+			results = append(results, r)
+		default:
+			return results
+		}
+	}
+}
+
+// use switches the submissions to a new connection, a submission running on the old one is retried on it
+func (q *submitQueue) use(gw *gatewayConnection, contract *client.Contract) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.gw, q.contract = gw, contract
+}
+
+func (q *submitQueue) connection() (*gatewayConnection, *client.Contract) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.gw, q.contract
+}
+
+// close stops the worker, the submissions left in the queue are dropped
+func (q *submitQueue) close() {
+	q.cancel()
+	close(q.jobs)
+}
+
+func (q *submitQueue) run() {
+	if q.commits != nil {
+		defer close(q.commits)
+	}
+	for {
+		s := q.held
+		if s == nil {
+			var ok bool
+			if s, ok = <-q.jobs; !ok {
+				return
+			}
+		}
+		q.held = nil
+		q.throttle()
+		batch := q.collect(s)
+		queueDepth.WithLabelValues("submit").Set(float64(len(q.jobs)))
+		started := time.Now()
+		sent := batchOf(batch)
+		tx, err := &orderedTransaction{}, q.ctx.Err()
+		if err == nil {
+			// with -commit-wait async only the ordering is waited for here, the commit loop waits for the commit
+			tx, err = q.submit(sent, nil, q.commits == nil)
+		}
+		q.last = time.Now()
+		if q.commits != nil {
+			q.commits <- &pendingCommit{batch: batch, sent: sent, tx: tx, err: err, started: started}
+			queueDepth.WithLabelValues("commit").Set(float64(len(q.commits)))
+			continue
+		}
+		q.report(batch, tx, err, started, false)
+	}
+}
+
+// report reports the result of the transaction of a batch, every update of the batch reports it so each is
+// checkpointed and audited on its own
+func (q *submitQueue) report(batch []*submission, tx *orderedTransaction, err error, started time.Time, superseded bool) {
+	finished := time.Now()
+	for _, s := range batch {
+		q.results <- &submitResult{submission: s, txID: tx.txID, result: tx.result, err: err, started: started, ordered: tx.ordered, finished: finished, superseded: superseded}
+		q.inflight.Done()
+	}
+}
+
+// throttle waits until -submit-interval has passed since the last transaction, the updates queue up meanwhile
+func (q *submitQueue) throttle() {
+	wait := time.Until(q.last.Add(*submitInterval))
+	if wait <= 0 {
+		return
+	}
+	select {
+	case <-time.After(wait):
+	case <-q.ctx.Done():
+	}
+}
+
+// collect adds the updates waiting in the queue to the batch of s, up to -submit-batch of them
+// it never waits for an update, a batch only gathers those that queued up while the last transaction was in progress
+func (q *submitQueue) collect(s *submission) []*submission {
+	batch := []*submission{s}
+	for len(batch) < *submitBatch && s.name == "SendUpdate" {
+		select {
+		case next, ok := <-q.jobs:
+			if !ok {
+				return batch
+			}
+			if next.name != s.name {
+				q.held = next
+				return batch
+			}
+			batch = append(batch, next)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// batchOf returns the submission that sends the updates of the batch, a single update is sent as it is
+func batchOf(batch []*submission) *submission {
+	if len(batch) == 1 {
+		return batch[0]
+	}
+	logger.Infof("Submitting the updates of iterations %v to %v in one transaction", batch[0].iteration, batch[len(batch)-1].iteration)
+	var args []string
+	for _, s := range batch {
+		args = append(args, s.args...)
+	}
+	return &submission{name: batchFunction, args: args, iteration: batch[len(batch)-1].iteration, updates: batch}
+}
+
+// submit submits an update, retrying transient failures with backoff, and with wait until it is committed
+// the endorsed transaction is sent again as it is until it has a commit status, so an update that reached the orderer
+// before the answer was lost is not committed twice; only a transaction that was invalidated, e.g. by an MVCC read
+// conflict, is endorsed again as a new one. prepared is a transaction to send again first, nil endorses a new one
+func (q *submitQueue) submit(s *submission, prepared []byte, wait bool) (*orderedTransaction, error) {
+	args, err := payloadArgs(s, q.period)
+	if err != nil {
+		return &orderedTransaction{}, err
+	}
+	name := s.name
+	if q.period >= 0 && name == "SendUpdate" {
+		name, args = periodFunction, append([]string{strconv.Itoa(q.period)}, args...)
+	}
+	for attempt := 0; ; attempt++ {
+		gw, contract := q.connection()
+		tx, next, err := orderPrepared(q.own, gw, contract, prepared, name, args...)
+		if err == nil && wait {
+			if err = tx.wait(); invalidated(err) {
+				next = nil
+			}
+		}
+		if err == nil {
+			return tx, nil
+		}
+		prepared = next
+		retry, reconnect := transientFailure(err)
+		if !retry || attempt >= *retryMax {
+			return tx, err
+		}
+		delay := retryDelay(attempt)
+		logger.Warnf("Failed to submit %s, retrying in %s: %s", name, delay.Round(time.Millisecond), explainError(err))
+		countError("submit")
+		if current, _ := q.connection(); reconnect && current == gw {
+			select {
+			case q.reconnects <- struct{}{}:
+			default:
+			}
+		}
+		select {
+		case <-time.After(delay):
+		case <-q.ctx.Done():
+			return &orderedTransaction{txID: tx.txID}, q.ctx.Err()
+		}
+	}
+}
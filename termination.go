@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// the criteria selectable with termination.criterion
+const (
+	criterionAbsolute  = "absolute"
+	criterionRelative  = "relative"
+	criterionWindow    = "window"
+	criterionTimeLimit = "time-limit"
+	criterionAll       = "all"
+	criterionAny       = "any"
+)
+
+// TerminationConfig selects when a run has converged, a single criterion or a composite of the criteria of its
+// policies. Without it a run converges by the absolute check of the algorithm with the epsilon of the generator section
+type TerminationConfig struct {
+	// Criterion is absolute (default), relative, window, time-limit, or all or any of the policies
+	Criterion string `json:"criterion" yaml:"criterion"`
+	// Tolerance is that of the relative and the window criterion (default: the epsilon of the generator section)
+	Tolerance float64 `json:"tolerance" yaml:"tolerance"`
+	// Window is the number of iterations the window criterion averages over (default 10)
+	Window int `json:"window" yaml:"window"`
+	// TimeLimit is the wall-clock time in seconds after which the time-limit criterion ends the run
+	TimeLimit float64 `json:"timeLimit" yaml:"timeLimit"`
+	// Policies are the criteria of all and any
+	Policies []TerminationConfig `json:"policies" yaml:"policies"`
+}
+
+func (c TerminationConfig) validate() error {
+	if c.Tolerance < 0 {
+		return fmt.Errorf("the tolerance must not be negative, got %v", c.Tolerance)
+	}
+	switch c.Criterion {
+	case "", criterionAbsolute, criterionRelative:
+	case criterionWindow:
+		if c.Window < 0 {
+			return fmt.Errorf("the window must not be negative, got %v", c.Window)
+		}
+	case criterionTimeLimit:
+		if c.TimeLimit <= 0 {
+			return fmt.Errorf("the time-limit criterion needs a positive timeLimit, got %v", c.TimeLimit)
+		}
+	case criterionAll, criterionAny:
+		if len(c.Policies) == 0 {
+			return fmt.Errorf("%s needs its policies", c.Criterion)
+		}
+		for i, p := range c.Policies {
+			if err := p.validate(); err != nil {
+				return fmt.Errorf("policy %v of %s: %w", i+1, c.Criterion, err)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown criterion %q, use %s, %s, %s, %s, %s or %s", c.Criterion, criterionAbsolute, criterionRelative, criterionWindow, criterionTimeLimit, criterionAll, criterionAny)
+	}
+	if len(c.Policies) > 0 {
+		return errors.New("only all and any have policies")
+	}
+	return nil
+}
+
+// iterationOutcome is what a TerminationPolicy judges an iteration by
+type iterationOutcome struct {
+	lambda, mismatch, P float64
+	// change is the change of the price in the iteration
+	change float64
+	// converged is the algorithm's own check with the epsilon
+	converged bool
+	epsilon   float64
+	elapsed   time.Duration
+}
+
+// TerminationPolicy tells whether a run has converged after an iteration, it is given every iteration in turn
+type TerminationPolicy interface {
+	done(o iterationOutcome) bool
+}
+
+// newTerminationPolicy returns the policy of the config
+func newTerminationPolicy(c TerminationConfig) TerminationPolicy {
+	switch c.Criterion {
+	case criterionRelative:
+		return relativeTermination{tolerance: c.Tolerance}
+	case criterionWindow:
+		window := c.Window
+		if window == 0 {
+			window = 10
+		}
+		return &windowTermination{tolerance: c.Tolerance, size: window}
+	case criterionTimeLimit:
+		return timeLimitTermination{limit: time.Duration(c.TimeLimit * float64(time.Second))}
+	case criterionAll, criterionAny:
+		p := compositeTermination{all: c.Criterion == criterionAll}
+		for _, policy := range c.Policies {
+			p.policies = append(p.policies, newTerminationPolicy(policy))
+		}
+		return p
+	}
+	return absoluteTermination{}
+}
+
+// tolerance returns the tolerance of a criterion, the epsilon if it has none
+func tolerance(t float64, o iterationOutcome) float64 {
+	if t > 0 {
+		return t
+	}
+	return o.epsilon
+}
+
+// absoluteTermination is the check of the algorithm, the mismatch and the change of the price below the epsilon
+type absoluteTermination struct{}
+
+func (absoluteTermination) done(o iterationOutcome) bool {
+	return o.converged
+}
+
+// relativeTermination compares the mismatch with the power and the change of the price with the price, each scale
+// at least 1 so a node near zero power or price isn't held to an ever smaller tolerance
+type relativeTermination struct {
+	tolerance float64
+}
+
+func (r relativeTermination) done(o iterationOutcome) bool {
+	t := tolerance(r.tolerance, o)
+	return math.Abs(o.mismatch) < t*math.Max(math.Abs(o.P), 1) && math.Abs(o.change) < t*math.Max(math.Abs(o.lambda), 1)
+}
+
+// windowTermination averages the absolute mismatch and change of the price over the last iterations, so a run that
+// oscillates around the optimum converges once the oscillation is small on average
+type windowTermination struct {
+	tolerance         float64
+	size              int
+	mismatch, changes []float64
+}
+
+func (w *windowTermination) done(o iterationOutcome) bool {
+	w.mismatch = append(w.mismatch, math.Abs(o.mismatch))
+	w.changes = append(w.changes, math.Abs(o.change))
+	if len(w.mismatch) > w.size {
+		w.mismatch, w.changes = w.mismatch[1:], w.changes[1:]
+	}
+	if len(w.mismatch) < w.size {
+		return false
+	}
+	t := tolerance(w.tolerance, o)
+	return mean(w.mismatch) < t && mean(w.changes) < t
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// timeLimitTermination ends the run with its current dispatch once it has run for the limit
+type timeLimitTermination struct {
+	limit time.Duration
+}
+
+func (t timeLimitTermination) done(o iterationOutcome) bool {
+	return o.elapsed >= t.limit
+}
+
+// compositeTermination is done when all or any of its policies are, every policy sees every iteration
+type compositeTermination struct {
+	all      bool
+	policies []TerminationPolicy
+}
+
+func (c compositeTermination) done(o iterationOutcome) bool {
+	result := c.all
+	for _, p := range c.policies {
+		if c.all {
+			result = p.done(o) && result
+		} else {
+			result = p.done(o) || result
+		}
+	}
+	return result
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTerminationPolicies(t *testing.T) {
+	c := TerminationConfig{Criterion: criterionAny, Policies: []TerminationConfig{
+		{Criterion: criterionAll, Policies: []TerminationConfig{{Criterion: criterionRelative, Tolerance: 0.01}, {Criterion: criterionWindow, Window: 2}}},
+		{Criterion: criterionTimeLimit, TimeLimit: 60},
+	}}
+	if err := c.validate(); err != nil {
+		t.Fatal(err)
+	}
+	policy := newTerminationPolicy(c)
+	// within 1% of the power and the price, but the window of 2 iterations isn't full
+	o := iterationOutcome{lambda: 20, mismatch: 0.05, P: 10, change: 0.1, epsilon: 1}
+	if policy.done(o) {
+		t.Errorf("done with a window of a single iteration")
+	}
+	if !policy.done(o) {
+		t.Errorf("not done with a full window within the tolerances")
+	}
+	if !newTerminationPolicy(c).done(iterationOutcome{mismatch: 5, change: 5, elapsed: time.Minute}) {
+		t.Errorf("not done at the time limit")
+	}
+	if err := (TerminationConfig{Criterion: criterionAll}).validate(); err == nil {
+		t.Errorf("a composite without policies was accepted")
+	}
+}
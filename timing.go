@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// the phases of an iteration: waiting for the neighbors' events, computing the update, endorsing and ordering its
+// transaction, and waiting for the transaction's commit
+const (
+	phaseWait    = "wait"
+	phaseCompute = "compute"
+	phaseSubmit  = "submit"
+	phaseCommit  = "commit"
+)
+
+var timingPhases = []string{phaseWait, phaseCompute, phaseSubmit, phaseCommit}
+
+// PhaseTiming are the statistics of the durations of a phase over a run
+type PhaseTiming struct {
+	Count int           `json:"count"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// iterationTimings collects the durations of the phases of the iterations, to tell whether the network or the algorithm
+// holds the run up. They are measured with the monotonic clock of this host only, so neither a skew between the hosts
+// nor a step of the wall clock during a run distorts them
+type iterationTimings struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration
+}
+
+func newIterationTimings() *iterationTimings {
+	return &iterationTimings{samples: map[string][]time.Duration{}}
+}
+
+// observe records a duration of a phase, negative durations can only come from a clock that isn't monotonic and are dropped
+func (t *iterationTimings) observe(phase string, d time.Duration) {
+	if d < 0 {
+		return
+	}
+	iterationPhase.WithLabelValues(phase).Observe(d.Seconds())
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples[phase] = append(t.samples[phase], d)
+}
+
+// summary returns the statistics of the phases that were observed
+func (t *iterationTimings) summary() map[string]PhaseTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	summary := map[string]PhaseTiming{}
+	for phase, samples := range t.samples {
+		sorted := append([]time.Duration(nil), samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		var total time.Duration
+		for _, d := range sorted {
+			total += d
+		}
+		summary[phase] = PhaseTiming{
+			Count: len(sorted),
+			Mean:  total / time.Duration(len(sorted)),
+			P50:   percentile(sorted, 0.5),
+			P90:   percentile(sorted, 0.9),
+			P99:   percentile(sorted, 0.99),
+			Max:   sorted[len(sorted)-1],
+		}
+	}
+	return summary
+}
+
+// percentile returns the nearest-rank percentile q of sorted durations
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func (t *iterationTimings) String() string {
+	summary := t.summary()
+	s := ""
+	for _, phase := range timingPhases {
+		p, ok := summary[phase]
+		if !ok {
+			continue
+		}
+		s += fmt.Sprintf("%-8s %5v samples, mean %s, p50 %s, p90 %s, p99 %s, max %s\n", phase, p.Count,
+			p.Mean.Round(time.Microsecond), p.P50.Round(time.Microsecond), p.P90.Round(time.Microsecond), p.P99.Round(time.Microsecond), p.Max.Round(time.Microsecond))
+	}
+	return s
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"testEvent/fabricagent"
+)
+
+// TLSConfig adjusts the TLS connection to the gateway peer, for peers on other machines than the test network's
+// the peer reaches the orderers itself, so they need no settings here
+type TLSConfig struct {
+	// CACerts are further CA certificates, or PEM bundles of them, the peer's TLS certificate may be issued by besides
+	// tlsCert, e.g. the root and intermediate certificates of a TLS CA; relative paths are taken relative to CryptoPath
+	CACerts []string `json:"caCerts" yaml:"caCerts"`
+	// ClientCert and ClientKey are the certificate and the key the agent authenticates with to a peer that requires
+	// mutual TLS, relative paths are taken relative to CryptoPath
+	ClientCert string `json:"clientCert" yaml:"clientCert"`
+	ClientKey  string `json:"clientKey" yaml:"clientKey"`
+	// ServerName is the name the peer's TLS certificate is checked against instead of gatewayPeer, e.g. when the peer is
+	// reached by its IP address or through a load balancer
+	ServerName string `json:"serverName" yaml:"serverName"`
+}
+
+func (t TLSConfig) validate() error {
+	if (t.ClientCert == "") != (t.ClientKey == "") {
+		return fmt.Errorf("mutual TLS needs both clientCert and clientKey")
+	}
+	return nil
+}
+
+// dialOptions are the settings of the connection to the gateway peer
+func (c Config) dialOptions() fabricagent.Options {
+	o := fabricagent.Options{PeerEndpoint: c.PeerEndpoint, TLSCACerts: []string{c.tlsCertPath()}, ServerName: c.GatewayPeer}
+	for _, path := range c.TLS.CACerts {
+		o.TLSCACerts = append(o.TLSCACerts, c.cryptoFile(path, ""))
+	}
+	if c.TLS.ServerName != "" {
+		o.ServerName = c.TLS.ServerName
+	}
+	if c.TLS.ClientCert != "" {
+		o.ClientCert, o.ClientKey = c.cryptoFile(c.TLS.ClientCert, ""), c.cryptoFile(c.TLS.ClientKey, "")
+	}
+	return o
+}
+
+// tlsConfig returns the TLS settings of the connection to the gateway peer
+func (c Config) tlsConfig() (*tls.Config, error) {
+	o := c.dialOptions()
+	return fabricagent.TLSConfig(o.TLSCACerts, o.ServerName, o.ClientCert, o.ClientKey)
+}
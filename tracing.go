@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	otlpEndpoint = flag.String("otlp-endpoint", "", "address (e.g. localhost:4317) of an OpenTelemetry collector, Jaeger or Tempo the traces of the updates are exported to over OTLP/gRPC, empty disables them")
+	otlpInsecure = flag.Bool("otlp-insecure", false, "export the traces without TLS")
+	traceSample  = flag.Float64("trace-sample", 1, "share of the received events that are traced, between 0 and 1")
+)
+
+// tracerName is the instrumentation name of the spans
+const tracerName = "testEvent"
+
+// spans starts the spans of the pipeline of an update, a no-op until startTracing sets up the exporter
+var spans = otel.Tracer(tracerName)
+
+// stopTracing sends the spans still buffered, it has to be called before the process ends
+var stopTracing = func() {}
+
+// startTracing exports the traces to -otlp-endpoint
+func startTracing() {
+	if *otlpEndpoint == "" {
+		return
+	}
+	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(*otlpEndpoint)}
+	if *otlpInsecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	// the exporter connects in the background, an unreachable collector only loses the spans
+	exporter, err := otlptracegrpc.New(context.Background(), options...)
+	if err != nil {
+		logger.Warnf("Failed to export the traces to %s: %v", *otlpEndpoint, err)
+		return
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(*traceSample))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String("agent"),
+			semconv.ServiceVersionKey.String(version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	spans = provider.Tracer(tracerName)
+	logger.Infof("Exporting traces to %s", *otlpEndpoint)
+	stopTracing = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			logger.Warnf("Failed to export the last traces: %v", err)
+		}
+	}
+}
+
+// organizationAttribute tags a span with the MSP ID of the agent it belongs to, the agents of the multi-agent mode
+// share the exporter of the process
+func organizationAttribute(organization string) attribute.KeyValue {
+	return attribute.String("fabric.msp_id", organization)
+}
+
+// eventAttributes identify a chaincode event received by the organization, its transaction ID links it to the commit
+// span of the neighbor that sent it
+func eventAttributes(event *client.ChaincodeEvent, organization string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		organizationAttribute(organization),
+		attribute.String("fabric.event", event.EventName),
+		attribute.Int64("fabric.block", int64(event.BlockNumber)),
+		attribute.String("fabric.tx_id", event.TransactionID),
+	}
+}
+
+// traceReceipt starts the trace of an event the organization received at the time, the event span ends once its
+// payload is decoded
+func traceReceipt(event *client.ChaincodeEvent, organization string, received time.Time) (context.Context, trace.Span) {
+	return spans.Start(context.Background(), "event", trace.WithTimestamp(received), trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(eventAttributes(event, organization)...))
+}
+
+// context returns the trace of the event, without one the spans of its update start a trace of their own
+func (e *decodedEvent) context() context.Context {
+	if e == nil || e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
+// traceOptimization records the iteration the organization computed since the start, within the trace of the event
+// that led to it
+func traceOptimization(ctx context.Context, organization string, start time.Time, iter int, lambda, mismatch, P float64) context.Context {
+	ctx, span := spans.Start(ctx, "optimize", trace.WithTimestamp(start), trace.WithAttributes(
+		organizationAttribute(organization),
+		attribute.Int("iteration", iter),
+		attribute.Float64("lambda", lambda),
+		attribute.Float64("mismatch", mismatch),
+		attribute.Float64("p", P),
+	))
+	span.End()
+	return ctx
+}
+
+// traceSubmission records the submission of a transaction of the organization until the orderer accepted it and its
+// commit, or its failure
+func traceSubmission(r *submitResult, organization string) {
+	if r.trace == nil || !trace.SpanContextFromContext(r.trace).IsValid() {
+		return
+	}
+	attributes := []attribute.KeyValue{organizationAttribute(organization), attribute.String("fabric.function", r.name), attribute.Int("iteration", r.iteration), attribute.String("fabric.tx_id", r.txID)}
+	ordered := r.ordered
+	if ordered.IsZero() {
+		ordered = r.finished
+	}
+	_, submit := spans.Start(r.trace, "submit", trace.WithTimestamp(r.started), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+	if r.ordered.IsZero() && r.err != nil {
+		submit.RecordError(r.err)
+		submit.SetStatus(codes.Error, failureCode(r.err))
+	}
+	submit.End(trace.WithTimestamp(ordered))
+	if r.ordered.IsZero() {
+		return
+	}
+	_, commit := spans.Start(r.trace, "commit", trace.WithTimestamp(r.ordered), trace.WithAttributes(attributes...))
+	if r.err != nil {
+		commit.RecordError(r.err)
+		commit.SetStatus(codes.Error, failureCode(r.err))
+	}
+	commit.End(trace.WithTimestamp(r.finished))
+}
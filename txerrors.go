@@ -0,0 +1,36 @@
+package main
+
+import "testEvent/fabricagent"
+
+// explainedError is a transaction error whose message says what went wrong and what to do about it, it unwraps to the
+// error of the transaction
+type explainedError struct {
+	err         error
+	explanation string
+}
+
+func (e *explainedError) Error() string {
+	return e.explanation
+}
+
+func (e *explainedError) Unwrap() error {
+	return e.err
+}
+
+// explainError turns a transaction error into one saying what went wrong and what to do about it, followed by the raw error
+// an endorsement failure also tells the policy it failed and the organizations that were asked
+func explainError(err error) error {
+	if err == nil {
+		return nil
+	}
+	d := fabricagent.Diagnose(err)
+	if d.Code() == "ENDORSEMENT_POLICY_FAILURE" {
+		return &explainedError{err: err, explanation: d.Explain(endorsementHint(err))}
+	}
+	return &explainedError{err: err, explanation: d.Explain()}
+}
+
+// failureCode returns the code of the known failure the error is, or an empty string
+func failureCode(err error) string {
+	return fabricagent.FailureCode(err)
+}
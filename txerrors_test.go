@@ -0,0 +1,22 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExplainedErrorUnwraps(t *testing.T) {
+	if err := explainError(nil); err != nil {
+		t.Errorf("got %v for no error", err)
+	}
+	cause := errors.New("rpc error: code = Unavailable desc = connection refused")
+	err := fmt.Errorf("failed to submit transaction: %w", explainError(cause))
+	if !errors.Is(err, cause) {
+		t.Errorf("%v doesn't wrap the error of the transaction", err)
+	}
+	if !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("%v lost the raw error", err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sync"
+)
+
+var (
+	lambdaMin      = flag.Float64("lambda-min", -1000, "smallest plausible price received from a neighbor")
+	lambdaMax      = flag.Float64("lambda-max", 1000, "largest plausible price received from a neighbor")
+	mismatchMax    = flag.Float64("mismatch-max", 100, "largest plausible absolute power mismatch in MW received from a neighbor")
+	impliedMax     = flag.Float64("implied-power-max", 100, "largest plausible absolute power in MW the local generator would dispatch at a received price")
+	lambdaRateMax  = flag.Float64("lambda-rate-max", 0, "largest plausible change of a neighbor's price from its previous update, 0 for no bound")
+	invalidUpdates = flag.String("invalid-updates", "reject", "what happens to a neighbor value beyond the bounds: reject discards the update, clamp moves the value into them; NaN and infinite values are always rejected")
+	reportFaults   = flag.Bool("report-faults", false, "submit ReportFault once per run for each neighbor whose updates are rejected or clamped, so the other organizations learn of the suspected faulty agent")
+)
+
+// faultFunction reports a neighbor suspected of sending implausible updates, with the neighbor, the run, the iteration and the reason
+const faultFunction = "ReportFault"
+
+// validateUpdate checks that a neighbor's update is physically plausible before it enters update()
+func validateUpdate(l2 float64, m2 float64, cost costFunction) error {
+	if math.IsNaN(l2) || math.IsInf(l2, 0) || l2 < *lambdaMin || l2 > *lambdaMax {
+		return fmt.Errorf("lambda %v outside [%v, %v]", l2, *lambdaMin, *lambdaMax)
+	}
+	if math.IsNaN(m2) || math.IsInf(m2, 0) || math.Abs(m2) > *mismatchMax {
+		return fmt.Errorf("mismatch %v outside [-%v, %v]", m2, *mismatchMax, *mismatchMax)
+	}
+	if P := cost.dispatch(l2); math.Abs(P) > *impliedMax {
+		return fmt.Errorf("lambda %v implies a local power of %v MW, outside [-%v, %v]", l2, P, *impliedMax, *impliedMax)
+	}
+	return nil
+}
+
+// updateValidator checks the updates of the neighbors against the bounds of validateUpdate and the change of the price
+// from the neighbor's previous update, with -invalid-updates clamp it moves a value beyond them into them instead
+type updateValidator struct {
+	clamp bool
+	// last is the price of the neighbor's last update that was let through
+	last map[string]float64
+	// reported are the neighbors that were reported in this run
+	reported map[string]bool
+	mu       sync.Mutex
+}
+
+func newUpdateValidator() *updateValidator {
+	return &updateValidator{clamp: *invalidUpdates == "clamp", last: map[string]float64{}, reported: map[string]bool{}}
+}
+
+// check returns the values of the neighbor's update that may enter the iteration and what was clamped, or why the update is rejected
+func (v *updateValidator) check(name string, l2 float64, m2 float64, cost costFunction) (float64, float64, []string, error) {
+	if math.IsNaN(l2) || math.IsInf(l2, 0) || math.IsNaN(m2) || math.IsInf(m2, 0) {
+		return l2, m2, nil, fmt.Errorf("lambda %v or mismatch %v is not a number", l2, m2)
+	}
+	if !v.clamp {
+		if err := validateUpdate(l2, m2, cost); err != nil {
+			return l2, m2, nil, err
+		}
+		if last, ok := v.last[name]; ok && *lambdaRateMax > 0 && math.Abs(l2-last) > *lambdaRateMax {
+			return l2, m2, nil, fmt.Errorf("lambda jumped from %v to %v, more than -lambda-rate-max %v", last, l2, *lambdaRateMax)
+		}
+		v.last[name] = l2
+		return l2, m2, nil, nil
+	}
+
+	var clamped []string
+	bound := func(what string, x, min, max float64) float64 {
+		if x < min || x > max {
+			y := math.Max(min, math.Min(max, x))
+			clamped = append(clamped, fmt.Sprintf("%s %v to %v", what, x, y))
+			return y
+		}
+		return x
+	}
+	l2 = bound("lambda", l2, *lambdaMin, *lambdaMax)
+	if last, ok := v.last[name]; ok && *lambdaRateMax > 0 {
+		l2 = bound("lambda", l2, last-*lambdaRateMax, last+*lambdaRateMax)
+	}
+	m2 = bound("mismatch", m2, -*mismatchMax, *mismatchMax)
+	// a price that implies an implausible local power has no bound to clamp to in general, it is rejected
+	if P := cost.dispatch(l2); math.Abs(P) > *impliedMax {
+		return l2, m2, clamped, fmt.Errorf("lambda %v implies a local power of %v MW, outside [-%v, %v]", l2, P, *impliedMax, *impliedMax)
+	}
+	v.last[name] = l2
+	return l2, m2, clamped, nil
+}
+
+// suspect logs a neighbor whose update was rejected or clamped and, with -report-faults, reports it once per run
+func (v *updateValidator) suspect(contract contractAPI, name string, run string, iteration int, reason string) {
+	progress("suspect", map[string]interface{}{"iteration": iteration, "neighbor": name, "reason": reason})
+	if !*reportFaults {
+		return
+	}
+	v.mu.Lock()
+	reported := v.reported[run+"/"+name]
+	v.reported[run+"/"+name] = true
+	v.mu.Unlock()
+	if reported {
+		return
+	}
+	// the report is not part of the optimization, it mustn't hold up the iteration
+	go func() {
+		if _, err := submitTransaction(contract, faultFunction, name, run, fmt.Sprint(iteration), reason); err != nil {
+			logger.Warnf("Failed to report the suspected faulty neighbor %s: %s", name, explainError(err))
+			return
+		}
+		logger.Infof("Reported the suspected faulty neighbor %s", name)
+	}()
+}
+
+// validateInvalidUpdates checks the -invalid-updates flag
+func validateInvalidUpdates() error {
+	if *invalidUpdates != "reject" && *invalidUpdates != "clamp" {
+		return fmt.Errorf("unknown -invalid-updates %q, use reject or clamp", *invalidUpdates)
+	}
+	if *lambdaRateMax < 0 {
+		return fmt.Errorf("-lambda-rate-max must not be negative, got %v", *lambdaRateMax)
+	}
+	return nil
+}
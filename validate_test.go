@@ -0,0 +1,33 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUpdateValidator(t *testing.T) {
+	defer func(rate float64, mode string) { *lambdaRateMax, *invalidUpdates = rate, mode }(*lambdaRateMax, *invalidUpdates)
+	*lambdaRateMax = 2
+	cost := costCurve{A: 1, B: 2}
+	v := newUpdateValidator()
+	if _, _, _, err := v.check("Org2", 6, 0.5, cost); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := v.check("Org2", 9, 0.5, cost); err == nil {
+		t.Errorf("a jump of the price beyond -lambda-rate-max was accepted")
+	}
+	if _, _, _, err := v.check("Org3", 9, 0.5, cost); err != nil {
+		t.Errorf("the first update of another neighbor was rejected: %v", err)
+	}
+
+	*invalidUpdates = "clamp"
+	v = newUpdateValidator()
+	v.check("Org2", 6, 0.5, cost)
+	l2, m2, clamped, err := v.check("Org2", 9, 1000, cost)
+	if err != nil || l2 != 8 || m2 != *mismatchMax || len(clamped) != 2 {
+		t.Errorf("clamped to %v, %v (%q), %v", l2, m2, clamped, err)
+	}
+	if _, _, _, err := v.check("Org2", math.NaN(), 0, cost); err == nil {
+		t.Errorf("NaN was clamped")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer/lifecycle"
+	"google.golang.org/protobuf/proto"
+)
+
+// version, commit and buildDate describe the build, they are set with
+// go build -ldflags "-X main.version=$(git describe --tags --always) -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+var (
+	chaincodeVersions = flag.String("chaincode-versions", "", "comma-separated chaincode versions the agent works with, a version ending in .x matches all versions it starts, e.g. 1.x; another committed version is warned about on connect (default: any)")
+	peerOperations    = flag.String("peer-operations", "", "URL of the operations service of the gateway peer, e.g. http://localhost:9444, whose Fabric version is checked on connect")
+)
+
+// minFabricVersion is the first Fabric release with the gateway service the agent connects to
+const minFabricVersion = "2.4"
+
+// versionString describes the build in a line
+func versionString() string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s)", version, commit, buildDate, runtime.Version())
+}
+
+// versionCommand prints the version of the build, with --check also those of the chaincode and the peer
+func versionCommand(args []string) error {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+	check := flags.Bool("check", false, "connect and check the versions of the chaincode and the peer")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	fmt.Println("agent " + versionString())
+	if !*check {
+		return nil
+	}
+	wallet, err := cfg.openWallet()
+	if err != nil {
+		return err
+	}
+	gw, _, err := cfg.connect(wallet)
+	if err != nil {
+		return err
+	}
+	defer gw.Close()
+	if !printChecks(compatibilityChecks(gw)) {
+		return fmt.Errorf("the network has versions this agent may not work with")
+	}
+	return nil
+}
+
+// warnIncompatible logs the failed compatibility checks, a run goes on regardless
+func warnIncompatible(gw *gatewayConnection) {
+	for _, r := range compatibilityChecks(gw) {
+		if !r.Passed {
+			logger.Warnf("Incompatible %s: %s", r.Name, r.Detail)
+		}
+	}
+}
+
+// compatibilityChecks compares the committed version of the chaincode with -chaincode-versions and the version of the
+// peer with minFabricVersion, a version that can't be queried is left unchecked
+func compatibilityChecks(gw *gatewayConnection) []conformanceResult {
+	var results []conformanceResult
+	if v, err := chaincodeVersion(gw); err != nil {
+		logger.Infof("The chaincode version is not checked: %s", explainError(err))
+	} else {
+		results = append(results, conformanceResult{"chaincode version", chaincodeVersionMatches(v, *chaincodeVersions), fmt.Sprintf("%s %s, supported %s", gw.chaincode, v, orAny(*chaincodeVersions))})
+	}
+	if *peerOperations != "" {
+		if v, err := peerVersion(*peerOperations); err != nil {
+			logger.Infof("The peer version is not checked: %v", err)
+		} else {
+			results = append(results, conformanceResult{"peer version", versionAtLeast(v, minFabricVersion), fmt.Sprintf("Fabric %s, at least %s needed", v, minFabricVersion)})
+		}
+	}
+	return results
+}
+
+func orAny(versions string) string {
+	if versions == "" {
+		return "any"
+	}
+	return versions
+}
+
+// chaincodeVersion queries the version of the chaincode definition committed on the channel
+func chaincodeVersion(gw *gatewayConnection) (string, error) {
+	definition, err := chaincodeDefinition(gw)
+	if err != nil {
+		return "", err
+	}
+	return definition.Version, nil
+}
+
+// chaincodeDefinition queries the definition of the chaincode committed on the channel
+func chaincodeDefinition(gw *gatewayConnection) (*lifecycle.QueryChaincodeDefinitionResult, error) {
+	args, err := proto.Marshal(&lifecycle.QueryChaincodeDefinitionArgs{Name: gw.chaincode})
+	if err != nil {
+		return nil, err
+	}
+	data, err := gw.GetNetwork(gw.channel).GetContract("_lifecycle").EvaluateTransaction("QueryChaincodeDefinition", string(args))
+	if err != nil {
+		return nil, err
+	}
+	result := &lifecycle.QueryChaincodeDefinitionResult{}
+	if err := proto.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// peerVersion reads the Fabric version from the /version endpoint of a peer's operations service
+func peerVersion(operations string) (string, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(strings.TrimSuffix(operations, "/") + "/version")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s/version answered %s", operations, resp.Status)
+	}
+	var info struct {
+		Version string `json:"Version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", err
+	}
+	return info.Version, nil
+}
+
+// chaincodeVersionMatches tells whether the version is one of the comma-separated supported versions, any if there are none
+func chaincodeVersionMatches(v string, supported string) bool {
+	if supported == "" {
+		return true
+	}
+	for _, s := range strings.Split(supported, ",") {
+		s = strings.TrimSpace(s)
+		if s == v || strings.HasSuffix(s, ".x") && strings.HasPrefix(v, strings.TrimSuffix(s, "x")) {
+			return true
+		}
+	}
+	return false
+}
+
+// versionAtLeast compares the numeric parts of two versions like 2.5.4 and 2.4, a part that isn't a number ends the comparison
+func versionAtLeast(v string, min string) bool {
+	have, want := strings.Split(strings.TrimPrefix(v, "v"), "."), strings.Split(min, ".")
+	for i, w := range want {
+		wanted, err := strconv.Atoi(w)
+		if err != nil {
+			return true
+		}
+		if i >= len(have) {
+			return wanted == 0
+		}
+		got, err := strconv.Atoi(strings.SplitN(have[i], "-", 2)[0])
+		if err != nil {
+			return true
+		}
+		if got != wanted {
+			return got > wanted
+		}
+	}
+	return true
+}
@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestVersionChecks(t *testing.T) {
+	for _, c := range []struct {
+		v, min string
+		want   bool
+	}{{"2.5.4", "2.4", true}, {"2.4.0", "2.4", true}, {"v2.4.9", "2.4", true}, {"2.2.10", "2.4", false}, {"1.4.12", "2.4", false}, {"3.0.0-beta", "2.4", true}} {
+		if got := versionAtLeast(c.v, c.min); got != c.want {
+			t.Errorf("versionAtLeast(%q, %q) = %v", c.v, c.min, got)
+		}
+	}
+	if !chaincodeVersionMatches("1.3", "1.x, 2.0") || !chaincodeVersionMatches("2.0", "1.x, 2.0") || chaincodeVersionMatches("2.1", "1.x, 2.0") {
+		t.Errorf("the supported chaincode versions were matched wrongly")
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+
+	"testEvent/fabricagent"
+)
+
+// walletIdentity is an X.509 identity as it is stored in the wallet
+type walletIdentity = fabricagent.Identity
+
+func newX509Identity(mspID string, cert string, key string) *walletIdentity {
+	return fabricagent.NewX509Identity(mspID, cert, key)
+}
+
+// newHSMIdentity returns an identity whose private key is kept in the configured HSM, the wallet only holds the certificate
+func newHSMIdentity(mspID string, cert string) *walletIdentity {
+	id := &walletIdentity{Version: 1, MspID: mspID, Type: hsmIdentityType}
+	id.Credentials.Certificate = cert
+	return id
+}
+
+// fileWallet is the wallet of fabricagent, in the format of the wallets of the Fabric SDKs, which also encrypts the
+// identities and checks their type against the identity providers
+type fileWallet struct {
+	store *fabricagent.Wallet
+	// passphrase encrypts the identities that are put into the wallet, nil stores them in plaintext
+	passphrase []byte
+}
+
+func newFileSystemWallet(path string) (*fileWallet, error) {
+	store, err := fabricagent.OpenWallet(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileWallet{store: store}, nil
+}
+
+// wallet opens the configured wallet, with the passphrase if it is encrypted
+func (c Config) wallet() (*fileWallet, error) {
+	passphrase, err := c.WalletEncryption.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	wallet, err := newFileSystemWallet(c.WalletPath)
+	if err != nil {
+		return nil, err
+	}
+	wallet.passphrase = passphrase
+	return wallet, nil
+}
+
+func (w *fileWallet) exists(label string) bool {
+	return w.store.Exists(label)
+}
+
+func (w *fileWallet) put(label string, id *walletIdentity) error {
+	data, err := json.Marshal(id)
+	if err != nil {
+		return err
+	}
+	if w.passphrase != nil {
+		if data, err = sealIdentity(w.passphrase, data); err != nil {
+			return fmt.Errorf("failed to encrypt identity %s: %w", label, err)
+		}
+	}
+	return w.store.Write(label, data)
+}
+
+func (w *fileWallet) get(label string) (*walletIdentity, error) {
+	data, err := w.store.Read(label)
+	if err != nil {
+		return nil, err
+	}
+	data, encrypted, err := openIdentity(w.passphrase, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt identity %s: %w", label, err)
+	}
+	if w.passphrase != nil && !encrypted {
+		logger.Warnf("Identity %s is stored in plaintext, encrypt it with wallet encrypt", label)
+	}
+	id := &walletIdentity{}
+	if err := json.Unmarshal(data, id); err != nil {
+		return nil, fmt.Errorf("invalid identity %s in the wallet: %w", label, err)
+	}
+	if _, ok := identityProviders[id.Type]; !ok {
+		return nil, fmt.Errorf("identity %s in the wallet has the unsupported type %q", label, id.Type)
+	}
+	return id, nil
+}
+
+// list returns the labels of the identities in the wallet
+func (w *fileWallet) list() ([]string, error) {
+	return w.store.List()
+}
+
+func (w *fileWallet) remove(label string) error {
+	return w.store.Remove(label)
+}
+
+// walletUsage lists the wallet operations, the label defaults to the configured user
+const walletUsage = `usage:
+  wallet populate                    import the configured user's credentials unless they are in the wallet
+  wallet list                        list the identities with their type, MSP ID, subject and expiry
+  wallet add [--label <label>] [--msp <id>] [--cert <file>] [--key <file or folder>] [--hsm]
+                                     import credentials, replacing the identity of the label, e.g. after a renewal
+                                     with --hsm only the certificate is stored, the key stays in the configured token
+  wallet remove <label>              remove an identity
+  wallet export [--plaintext] <label> [file]
+                                     write an identity to a file or the standard output, it contains the private key;
+                                     an encrypted wallet encrypts it with its passphrase unless --plaintext is given
+  wallet import [--label <label>] <file>
+                                     add an identity exported on another device, an encrypted one with the passphrase
+                                     of the wallet
+  wallet enroll [--label <label>] [--id <enrollment id>] [--secret <secret>]
+                                     enroll with the CA of the ca section and store the new identity
+  wallet register [--registrar <label>] [--secret <secret>] [--type <type>] [--affiliation <affiliation>] <id>
+                                     register a new identity with the CA and print its enrollment secret
+  wallet encrypt                     encrypt the identities stored in plaintext, after walletEncryption was enabled`
+
+// walletCommand manages the identities of the wallet
+func walletCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(walletUsage)
+	}
+	if args[0] == "populate" {
+		_, err := cfg.openWallet()
+		return err
+	}
+	wallet, err := cfg.wallet()
+	if err != nil {
+		return fmt.Errorf("failed to open the wallet: %w", err)
+	}
+	switch args[0] {
+	case "list":
+		return walletList(wallet)
+	case "add":
+		return walletAdd(wallet, args[1:])
+	case "remove":
+		if len(args) != 2 {
+			return errors.New(walletUsage)
+		}
+		if !wallet.exists(args[1]) {
+			return fmt.Errorf("no identity %s in the wallet", args[1])
+		}
+		return wallet.remove(args[1])
+	case "export":
+		return walletExport(wallet, args[1:])
+	case "import":
+		return walletImport(wallet, args[1:])
+	case "enroll":
+		return walletEnroll(wallet, args[1:])
+	case "register":
+		return walletRegister(wallet, args[1:])
+	case "encrypt":
+		return walletEncrypt(wallet)
+	}
+	return errors.New(walletUsage)
+}
+
+func walletList(wallet *fileWallet) error {
+	labels, err := wallet.list()
+	if err != nil {
+		return err
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		id, err := wallet.get(label)
+		if err != nil {
+			fmt.Printf("%s\t%v\n", label, err)
+			continue
+		}
+		cert, err := identity.CertificateFromPEM([]byte(id.Credentials.Certificate))
+		if err != nil {
+			fmt.Printf("%s\t%s\t%s\tinvalid certificate: %v\n", label, id.Type, id.MspID, err)
+			continue
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\texpires %s\n", label, id.Type, id.MspID, cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func walletAdd(wallet *fileWallet, args []string) error {
+	flags := flag.NewFlagSet("wallet add", flag.ContinueOnError)
+	label := flags.String("label", cfg.UserName, "label of the identity in the wallet")
+	mspID := flags.String("msp", cfg.MSPID, "MSP ID of the identity")
+	certPath := flags.String("cert", cfg.certPath(), "certificate, or a PEM bundle starting with it")
+	keyPath := flags.String("key", cfg.keyPath(), "private key file or keystore folder")
+	hsm := flags.Bool("hsm", cfg.HSM.Library != "", "the private key is kept in the token configured under hsm")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	id, err := loadIdentity(*mspID, *certPath, *keyPath, *hsm)
+	if err != nil {
+		return err
+	}
+	if err := wallet.put(*label, id); err != nil {
+		return err
+	}
+	logger.Info(tr("Successfully added user %s to wallet!", *label))
+	return nil
+}
+
+// walletExport writes an identity in the form of the wallet: an encrypted wallet exports it encrypted with its
+// passphrase, unless --plaintext asks for the private key in the clear
+func walletExport(wallet *fileWallet, args []string) error {
+	flags := flag.NewFlagSet("wallet export", flag.ContinueOnError)
+	plaintext := flags.Bool("plaintext", false, "write the identity of an encrypted wallet unencrypted, with the private key in the clear")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		return errors.New(walletUsage)
+	}
+	label := flags.Arg(0)
+	id, err := wallet.get(label)
+	if err != nil {
+		return fmt.Errorf("failed to get identity %s from the wallet: %w", label, err)
+	}
+	data, err := json.MarshalIndent(id, "", "  ")
+	if err != nil {
+		return err
+	}
+	if wallet.passphrase != nil && !*plaintext {
+		if data, err = sealIdentity(wallet.passphrase, data); err != nil {
+			return fmt.Errorf("failed to encrypt identity %s: %w", label, err)
+		}
+	}
+	if flags.NArg() == 1 {
+		fmt.Println(string(data))
+		return nil
+	}
+	return os.WriteFile(flags.Arg(1), data, 0600)
+}
+
+func walletImport(wallet *fileWallet, args []string) error {
+	flags := flag.NewFlagSet("wallet import", flag.ContinueOnError)
+	label := flags.String("label", "", "label of the identity in the wallet (default: the file name without extension)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New(walletUsage)
+	}
+	path := flags.Arg(0)
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	// the export of an encrypted wallet opens with the passphrase of this one
+	if data, _, err = openIdentity(wallet.passphrase, data); err != nil {
+		return fmt.Errorf("failed to decrypt the identity in %s: %w", path, err)
+	}
+	id := &walletIdentity{}
+	if err := json.Unmarshal(data, id); err != nil {
+		return fmt.Errorf("invalid identity in %s: %w", path, err)
+	}
+	// an identity that can't sign is of no use, better to find out before it replaces a working one
+	_, _, release, err := signingIdentity(id)
+	if err != nil {
+		return fmt.Errorf("invalid identity in %s: %w", path, err)
+	}
+	release()
+	if *label == "" {
+		*label = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := wallet.put(*label, id); err != nil {
+		return err
+	}
+	logger.Info(tr("Successfully added user %s to wallet!", *label))
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// WalletEncryptionConfig encrypts the identities of the wallet with a passphrase, so the private keys on a device can't
+// be read from its disk
+type WalletEncryptionConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Passphrase is the passphrase of the wallet, the WALLET_PASSPHRASE environment variable overrides it so that it
+	// needn't be kept in the file
+	Passphrase string `json:"passphrase" yaml:"passphrase"`
+	// PassphraseFile is a file holding the passphrase, e.g. a Docker secret or a systemd credential
+	PassphraseFile string `json:"passphraseFile" yaml:"passphraseFile"`
+}
+
+// passphrase returns the passphrase of the wallet, preferring the WALLET_PASSPHRASE environment variable over the file
+// and the file over the config; nil if the wallet isn't encrypted
+func (w WalletEncryptionConfig) passphrase() ([]byte, error) {
+	if !w.Enabled {
+		return nil, nil
+	}
+	passphrase := os.Getenv("WALLET_PASSPHRASE")
+	if passphrase == "" && w.PassphraseFile != "" {
+		data, err := os.ReadFile(filepath.Clean(w.PassphraseFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the wallet passphrase: %w", err)
+		}
+		passphrase = strings.TrimRight(string(data), "\r\n")
+	}
+	if passphrase == "" {
+		passphrase = w.Passphrase
+	}
+	if passphrase == "" {
+		return nil, errors.New("the wallet is encrypted but no passphrase is set, set WALLET_PASSPHRASE or walletEncryption.passphraseFile")
+	}
+	return []byte(passphrase), nil
+}
+
+// the encryption of the identity files, the key is derived from the passphrase with scrypt and a salt of each file
+const walletCipher = "scrypt-aes-256-gcm"
+
+// scrypt costs as recommended for interactive logins, about 100 ms on a small device per identity that is read
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// sealedIdentity is the file of an identity in an encrypted wallet
+type sealedIdentity struct {
+	Version    int    `json:"version"`
+	Encryption string `json:"encryption"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+func walletAEAD(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealIdentity encrypts the file of an identity
+func sealIdentity(passphrase, plain []byte) ([]byte, error) {
+	sealed := sealedIdentity{Version: 1, Encryption: walletCipher, Salt: make([]byte, 16)}
+	if _, err := rand.Read(sealed.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := walletAEAD(passphrase, sealed.Salt)
+	if err != nil {
+		return nil, err
+	}
+	sealed.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(sealed.Nonce); err != nil {
+		return nil, err
+	}
+	// the header is authenticated along with the identity, so the cipher of a file can't be swapped
+	sealed.Data = aead.Seal(nil, sealed.Nonce, plain, []byte(walletCipher))
+	return json.Marshal(sealed)
+}
+
+// openIdentity returns the identity file as it is stored in a plain wallet, decrypting it if it is sealed
+// encrypted tells whether it was, a plain file is returned as it is
+func openIdentity(passphrase, data []byte) (plain []byte, encrypted bool, err error) {
+	var sealed sealedIdentity
+	if err := json.Unmarshal(data, &sealed); err != nil || sealed.Encryption == "" {
+		return data, false, nil
+	}
+	if sealed.Encryption != walletCipher {
+		return nil, true, fmt.Errorf("unsupported encryption %q", sealed.Encryption)
+	}
+	if passphrase == nil {
+		return nil, true, errors.New("the identity is encrypted, enable walletEncryption and set its passphrase")
+	}
+	aead, err := walletAEAD(passphrase, sealed.Salt)
+	if err != nil {
+		return nil, true, err
+	}
+	if len(sealed.Nonce) != aead.NonceSize() {
+		return nil, true, errors.New("invalid nonce")
+	}
+	plain, err = aead.Open(nil, sealed.Nonce, sealed.Data, []byte(walletCipher))
+	if err != nil {
+		return nil, true, errors.New("wrong passphrase or damaged file")
+	}
+	return plain, true, nil
+}
+
+// walletEncrypt encrypts the identities of the wallet that are still stored in plaintext, after encryption was enabled
+func walletEncrypt(wallet *fileWallet) error {
+	if wallet.passphrase == nil {
+		return errors.New("enable walletEncryption in the config and set its passphrase first")
+	}
+	labels, err := wallet.list()
+	if err != nil {
+		return err
+	}
+	for _, label := range labels {
+		data, err := wallet.store.Read(label)
+		if err != nil {
+			return err
+		}
+		if _, encrypted, _ := openIdentity(nil, data); encrypted {
+			continue
+		}
+		id, err := wallet.get(label)
+		if err != nil {
+			return err
+		}
+		if err := wallet.put(label, id); err != nil {
+			return err
+		}
+		logger.Infof("Encrypted identity %s", label)
+	}
+	return nil
+}
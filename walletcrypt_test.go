@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWalletEncryption(t *testing.T) {
+	plain := []byte(`{"version":1,"mspId":"Org1MSP","type":"X.509"}`)
+	data, err := sealIdentity([]byte("correct horse"), plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, encrypted, err := openIdentity([]byte("correct horse"), data)
+	if err != nil || !encrypted || string(opened) != string(plain) {
+		t.Fatalf("got %s, %v: %v", opened, encrypted, err)
+	}
+	if _, _, err := openIdentity([]byte("wrong horse"), data); err == nil {
+		t.Error("a wrong passphrase opened the identity")
+	}
+	if _, _, err := openIdentity(nil, data); err == nil {
+		t.Error("an encrypted identity opened without a passphrase")
+	}
+	var sealed sealedIdentity
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		t.Fatal(err)
+	}
+	swapped := sealed
+	swapped.Encryption = "aes-128-gcm"
+	header, _ := json.Marshal(swapped)
+	if _, _, err := openIdentity([]byte("correct horse"), header); err == nil {
+		t.Error("an identity with a swapped cipher header was opened")
+	}
+	damaged := sealed
+	damaged.Data = append([]byte(nil), sealed.Data...)
+	damaged.Data[0] ^= 1
+	file, _ := json.Marshal(damaged)
+	if _, _, err := openIdentity([]byte("correct horse"), file); err == nil {
+		t.Error("a damaged identity was opened")
+	}
+}
+
+func TestPlaintextInEncryptedWallet(t *testing.T) {
+	w, err := newFileSystemWallet(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.put("appUser", newX509Identity("Org1MSP", "cert", "key")); err != nil {
+		t.Fatal(err)
+	}
+	// encryption enabled after the identity was stored, it is read with a warning until wallet encrypt
+	w.passphrase = []byte("correct horse")
+	id, err := w.get("appUser")
+	if err != nil || id.Credentials.PrivateKey != "key" {
+		t.Fatalf("got %+v: %v", id, err)
+	}
+	data, err := w.store.Read("appUser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, encrypted, _ := openIdentity(nil, data); encrypted {
+		t.Error("the plaintext identity was taken for an encrypted one")
+	}
+	if err := walletEncrypt(w); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = w.store.Read("appUser")
+	if _, encrypted, _ := openIdentity(nil, data); !encrypted {
+		t.Error("wallet encrypt left the identity in plaintext")
+	}
+	if id, err = w.get("appUser"); err != nil || id.Credentials.PrivateKey != "key" {
+		t.Errorf("got %+v after wallet encrypt: %v", id, err)
+	}
+}
+
+// testIdentity returns an identity with a self-signed certificate that can sign
+func testIdentity(t *testing.T) *walletIdentity {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "appUser"}, NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return newX509Identity("Org1MSP", string(cert), string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})))
+}
+
+func TestExportFromEncryptedWallet(t *testing.T) {
+	w, err := newFileSystemWallet(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.passphrase = []byte("correct horse")
+	if err := w.put("appUser", testIdentity(t)); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	sealed, plain := filepath.Join(dir, "appUser.id"), filepath.Join(dir, "plain.id")
+	if err := walletExport(w, []string{"appUser", sealed}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, encrypted, _ := openIdentity(nil, data); !encrypted || strings.Contains(string(data), "PRIVATE KEY") {
+		t.Errorf("the export of an encrypted wallet is in plaintext: %s", data)
+	}
+	if err := walletExport(w, []string{"--plaintext", "appUser", plain}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(plain); !strings.Contains(string(data), "PRIVATE KEY") {
+		t.Errorf("--plaintext exported %s", data)
+	}
+
+	// a wallet with the same passphrase imports the encrypted export, one with another passphrase can't
+	other, err := newFileSystemWallet(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.passphrase = []byte("wrong horse")
+	if err := walletImport(other, []string{sealed}); err == nil {
+		t.Error("the export was imported with another passphrase")
+	}
+	other.passphrase = w.passphrase
+	if err := walletImport(other, []string{"--label", "copy", sealed}); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := other.get("copy"); err != nil || !strings.Contains(id.Credentials.PrivateKey, "PRIVATE KEY") {
+		t.Errorf("imported %+v: %v", id, err)
+	}
+}
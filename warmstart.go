@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the converged price of the last run is kept here so that the next period can start from it, and the results of
+// all converged runs are appended to the history, one JSON object per line
+const (
+	lastPriceFile    = "last_price.json"
+	priceHistoryFile = "price_history.jsonl"
+)
+
+var (
+	initLambda      = flag.String("init-lambda", "", "initial price guess: a number, \"previous\" for the last converged price, \"average\" for the moving average of the converged prices of the last -warm-start-window runs, or \"forecast\" for the price forecast of the current hour (default: the marginal cost at P)")
+	initPower       = flag.String("init-power", "", "initial power: \"previous\" for the last converged power or \"average\" for the moving average of the last -warm-start-window runs, within the power limits (default: the initial state of the role)")
+	warmStartWindow = flag.Int("warm-start-window", 5, "number of the latest converged runs -init-lambda=average and -init-power=average average over")
+	priceForecast   = flag.String("price-forecast", "price_forecast.csv", "CSV file with one \"hour,price\" row per hour, used by -init-lambda=forecast")
+)
+
+// lastPrice is the converged result written at the end of a run
+type lastPrice struct {
+	Lambda     float64   `json:"lambda"`
+	Power      float64   `json:"power"`
+	Iterations int       `json:"iterations"`
+	Time       time.Time `json:"time"`
+}
+
+// initialLambda returns the starting price of the optimization and a short description of where it came from
+func initialLambda(source string, defaultLambda float64) (float64, string, error) {
+	switch strings.ToLower(source) {
+	case "":
+		return defaultLambda, "default", nil
+	case "previous":
+		last, err := loadLastPrice(lastPriceFile)
+		if err != nil {
+			return 0, "", err
+		}
+		return last.Lambda, fmt.Sprintf("previous run at %s", last.Time.Format(time.RFC3339)), nil
+	case "average":
+		lambda, _, runs, err := historyAverage(priceHistoryFile, *warmStartWindow)
+		if err != nil {
+			return 0, "", err
+		}
+		return lambda, fmt.Sprintf("average of the last %v runs", runs), nil
+	case "forecast":
+		lambda, err := forecastPrice(*priceForecast, time.Now().Hour())
+		if err != nil {
+			return 0, "", err
+		}
+		return lambda, fmt.Sprintf("forecast for hour %v", time.Now().Hour()), nil
+	default:
+		lambda, err := strconv.ParseFloat(source, 64)
+		if err != nil {
+			return 0, "", fmt.Errorf("invalid initial price %q: %w", source, err)
+		}
+		return lambda, "command line", nil
+	}
+}
+
+// initialPower returns the power the optimization starts from and where it came from, the power of an earlier run is
+// moved into the limits
+func initialPower(source string, P float64, limits powerLimits) (float64, string, error) {
+	switch strings.ToLower(source) {
+	case "":
+		return P, "initial state", nil
+	case "previous":
+		last, err := loadLastPrice(lastPriceFile)
+		if err != nil {
+			return P, "", err
+		}
+		return limits.clamp(last.Power), fmt.Sprintf("previous run at %s", last.Time.Format(time.RFC3339)), nil
+	case "average":
+		_, power, runs, err := historyAverage(priceHistoryFile, *warmStartWindow)
+		if err != nil {
+			return P, "", err
+		}
+		return limits.clamp(power), fmt.Sprintf("average of the last %v runs", runs), nil
+	}
+	return P, "", fmt.Errorf("invalid initial power %q, use previous or average", source)
+}
+
+// historyAverage returns the moving average of the price and the power of the last window runs of the history, and
+// the number of runs it averaged
+func historyAverage(path string, window int) (float64, float64, int, error) {
+	history, err := loadPriceHistory(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if len(history) == 0 {
+		return 0, 0, 0, fmt.Errorf("%s has no runs", path)
+	}
+	if window > 0 && len(history) > window {
+		history = history[len(history)-window:]
+	}
+	var lambda, power float64
+	for _, h := range history {
+		lambda += h.Lambda
+		power += h.Power
+	}
+	n := float64(len(history))
+	return lambda / n, power / n, len(history), nil
+}
+
+// loadPriceHistory reads the converged runs of the history, oldest first, lines that can't be read are skipped
+func loadPriceHistory(path string) ([]lastPrice, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var history []lastPrice
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var h lastPrice
+		if err := json.Unmarshal(scanner.Bytes(), &h); err != nil {
+			continue
+		}
+		history = append(history, h)
+	}
+	return history, scanner.Err()
+}
+
+// forecastPrice looks up the forecast price for the given hour
+func forecastPrice(path string, hour int) (float64, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read price forecast: %w", err)
+	}
+	for _, record := range records {
+		if len(record) < 2 {
+			continue
+		}
+		h, err := strconv.Atoi(strings.TrimSpace(record[0]))
+		if err != nil || h != hour {
+			// the header row and other hours are skipped
+			continue
+		}
+		return strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+	}
+	return 0, fmt.Errorf("no forecast price for hour %v in %s", hour, path)
+}
+
+func loadLastPrice(path string) (lastPrice, error) {
+	var last lastPrice
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return last, err
+	}
+	err = json.Unmarshal(data, &last)
+	return last, err
+}
+
+// saveLastPrice writes the converged price and power of a run and appends them to the history
+func saveLastPrice(path string, lambda float64, P float64, iter int) error {
+	last := lastPrice{Lambda: lambda, Power: P, Iterations: iter, Time: time.Now()}
+	data, err := json.MarshalIndent(last, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Clean(path), data, 0600); err != nil {
+		return err
+	}
+	return appendPriceHistory(priceHistoryFile, last)
+}
+
+func appendPriceHistory(path string, last lastPrice) error {
+	data, err := json.Marshal(last)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Clean(path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
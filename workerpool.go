@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+var (
+	eventWorkers = flag.Int("event-workers", 4, "number of workers running the event handlers besides the consensus loop")
+	handlerQueue = flag.Int("handler-queue", 100, "events buffered per handler, further events are dropped for that handler only")
+	webhookURL   = flag.String("webhook", "", "URL every received chaincode event is POSTed to as JSON")
+)
+
+// eventHandler receives the events of one consumer, in the order they were dispatched
+type eventHandler struct {
+	name   string
+	handle func(*client.ChaincodeEvent)
+
+	mu        sync.Mutex
+	pending   []*client.ChaincodeEvent
+	scheduled bool
+	dropped   int
+}
+
+// eventPool runs the event handlers on a bounded number of workers, each handler sees its events in order and
+// runs on at most one worker at a time, so a slow handler only delays itself
+type eventPool struct {
+	handlers []*eventHandler
+	ready    chan *eventHandler
+	wg       sync.WaitGroup
+}
+
+// newEventPool starts the workers for the given handlers, it returns nil if there is no handler
+func newEventPool(workers int, handlers ...*eventHandler) *eventPool {
+	if len(handlers) == 0 {
+		return nil
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	// every handler is in the ready queue at most once, so sending to it never blocks
+	p := &eventPool{handlers: handlers, ready: make(chan *eventHandler, len(handlers))}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// dispatch hands an event from any registration to every handler without waiting for them
+func (p *eventPool) dispatch(event *client.ChaincodeEvent) {
+	if p == nil {
+		return
+	}
+	for _, h := range p.handlers {
+		h.mu.Lock()
+		if len(h.pending) >= *handlerQueue {
+			h.dropped++
+			if h.dropped == 1 || h.dropped%100 == 0 {
+				logger.Warnf("Handler %s is falling behind, %v events dropped", h.name, h.dropped)
+			}
+		} else {
+			h.pending = append(h.pending, event)
+			if !h.scheduled {
+				h.scheduled = true
+				p.ready <- h
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+func (p *eventPool) work() {
+	defer p.wg.Done()
+	for h := range p.ready {
+		h.mu.Lock()
+		event := h.pending[0]
+		h.pending = h.pending[1:]
+		h.mu.Unlock()
+
+		h.handle(event)
+
+		// the handler goes back to the end of the queue so that the other handlers get their turn
+		h.mu.Lock()
+		if len(h.pending) > 0 {
+			p.ready <- h
+		} else {
+			h.scheduled = false
+		}
+		h.mu.Unlock()
+	}
+}
+
+// close waits for the handlers to finish the events dispatched so far and stops the workers
+// no event may be dispatched after close
+func (p *eventPool) close(timeout time.Duration) {
+	if p == nil {
+		return
+	}
+	deadline := time.Now().Add(timeout)
+	for _, h := range p.handlers {
+		for {
+			h.mu.Lock()
+			idle := !h.scheduled
+			h.mu.Unlock()
+			if idle {
+				break
+			}
+			if time.Now().After(deadline) {
+				// a busy handler may still requeue itself, so the workers are left running
+				logger.Warnf("Handler %s did not finish within %s", h.name, timeout)
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	close(p.ready)
+	p.wg.Wait()
+}
+
+// eventHandlers returns the handlers enabled on the command line
+func eventHandlers() []*eventHandler {
+	var handlers []*eventHandler
+	if *webhookURL != "" {
+		handlers = append(handlers, webhookHandler(*webhookURL))
+	}
+	return handlers
+}
+
+// webhookHandler forwards every event to an HTTP endpoint
+func webhookHandler(url string) *eventHandler {
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	return &eventHandler{
+		name: "webhook",
+		handle: func(event *client.ChaincodeEvent) {
+			body, err := json.Marshal(map[string]interface{}{
+				"eventName":   event.EventName,
+				"txId":        event.TransactionID,
+				"blockNumber": event.BlockNumber,
+				"payload":     string(event.Payload),
+			})
+			if err != nil {
+				return
+			}
+			resp, err := httpClient.Post(url, "application/json", bytes.NewReader(body))
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode >= 300 {
+					err = fmt.Errorf("status %s", resp.Status)
+				}
+			}
+			if err != nil {
+				logger.Warnf("Failed to forward event %s to the webhook: %v", event.EventName, err)
+			}
+		},
+	}
+}